@@ -12,7 +12,10 @@ import { MatDialog, MatDialogModule } from '@angular/material/dialog';
 import { Subject, take, takeUntil } from 'rxjs';
 
 import { ApiService } from '../shared/services/api.service';
-import { DeploymentApiResponse } from '../shared/model/deployment-response';
+import {
+  DeploymentAction,
+  DeploymentApiResponse,
+} from '../shared/model/deployment-response';
 import { EC2Status } from '../shared/enum/ec2-status.enum';
 import { DeploymentsService } from '../shared/services/deployments.service';
 import { convertDateTime } from '../shared/util/time.util';
@@ -127,6 +130,12 @@ export class DeploymentDashboardComponent {
       });
   }
 
+  // Servers without authorization do not send allowedActions, everything is
+  // allowed then.
+  can(element: DeploymentApiResponse, action: DeploymentAction): boolean {
+    return element.allowedActions?.includes(action) ?? true;
+  }
+
   editInstance(instanceID: string) {
     this.deploymentService.setCurrentEditingDeployment(instanceID);
     this.router.navigate(['/edit']);
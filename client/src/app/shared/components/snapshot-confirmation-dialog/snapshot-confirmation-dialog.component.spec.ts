@@ -10,6 +10,7 @@ import { ApiService } from '../../services/api.service';
 describe('SnapshotConfirmationDialogComponent', () => {
   let component: SnapshotConfirmationDialogComponent;
   let fixture: ComponentFixture<SnapshotConfirmationDialogComponent>;
+  let mockApiService: jasmine.SpyObj<ApiService>;
 
   beforeEach(async () => {
     const mockInstanceElement = {
@@ -38,7 +39,9 @@ describe('SnapshotConfirmationDialogComponent', () => {
         {
           provide: ApiService,
           useValue: jasmine.createSpyObj('ApiService', [
-            'captureInstanceSnapshopt',
+            'checkAmiLimit',
+            'deleteInstanceAmi',
+            'captureInstanceAmi',
           ]),
         },
         {
@@ -50,6 +53,7 @@ describe('SnapshotConfirmationDialogComponent', () => {
 
     fixture = TestBed.createComponent(SnapshotConfirmationDialogComponent);
     component = fixture.componentInstance;
+    mockApiService = TestBed.inject(ApiService) as jasmine.SpyObj<ApiService>;
     fixture.detectChanges();
   });
 
@@ -61,4 +65,24 @@ describe('SnapshotConfirmationDialogComponent', () => {
     expect(component.data.instanceElement).toBeDefined();
     expect(component.data.instanceElement.hostname).toBe('test-server');
   });
+
+  it('should delete the oldest snapshot by instance ID', () => {
+    mockApiService.checkAmiLimit.and.returnValue(
+      of({ ami_limit_hit: true, oldest_image_id: 'ami-old' }),
+    );
+    mockApiService.deleteInstanceAmi.and.returnValue(of(null));
+    mockApiService.captureInstanceAmi.and.returnValue(of(null));
+    spyOn((component as any).dialog, 'open').and.returnValue({
+      afterClosed: () => of(true),
+    });
+
+    component.onConfirm();
+
+    expect(mockApiService.checkAmiLimit).toHaveBeenCalledWith('i-123456789');
+    expect(mockApiService.deleteInstanceAmi).toHaveBeenCalledWith({
+      instance_id: 'i-123456789',
+      image_id: 'ami-old',
+    });
+    expect(mockApiService.captureInstanceAmi).toHaveBeenCalled();
+  });
 });
@@ -59,7 +59,7 @@ export class SnapshotConfirmationDialogComponent {
                   return EMPTY;
                 }
                 const deletePayload = {
-                  instance_id: this.data.instanceElement.deploymentId,
+                  instance_id: this.data.instanceElement.ec2InstanceId,
                   image_id: response.oldest_image_id,
                 };
                 return this.apiService
@@ -0,0 +1,77 @@
+import { TestBed } from '@angular/core/testing';
+import {
+  HttpClient,
+  provideHttpClient,
+  withInterceptors,
+} from '@angular/common/http';
+import {
+  HttpTestingController,
+  provideHttpClientTesting,
+} from '@angular/common/http/testing';
+import { authInterceptor } from './auth.interceptor';
+import { AuthService } from '../services/auth.service';
+
+describe('authInterceptor', () => {
+  let http: HttpClient;
+  let httpMock: HttpTestingController;
+  let mockAuthService: jasmine.SpyObj<AuthService>;
+
+  beforeEach(() => {
+    const authServiceSpy = jasmine.createSpyObj('AuthService', [
+      'token',
+      'signIn',
+    ]);
+
+    TestBed.configureTestingModule({
+      providers: [
+        provideHttpClient(withInterceptors([authInterceptor])),
+        provideHttpClientTesting(),
+        { provide: AuthService, useValue: authServiceSpy },
+      ],
+    });
+
+    http = TestBed.inject(HttpClient);
+    httpMock = TestBed.inject(HttpTestingController);
+    mockAuthService = TestBed.inject(
+      AuthService,
+    ) as jasmine.SpyObj<AuthService>;
+  });
+
+  afterEach(() => {
+    httpMock.verify();
+  });
+
+  it('should send the token as a bearer token', () => {
+    mockAuthService.token.and.returnValue('abc');
+
+    http.get('/dev/deployments').subscribe();
+
+    const req = httpMock.expectOne('/dev/deployments');
+    expect(req.request.headers.get('Authorization')).toBe('Bearer abc');
+    req.flush([]);
+  });
+
+  it('should not send a header without a token', () => {
+    mockAuthService.token.and.returnValue(null);
+
+    http.get('/dev/deployments').subscribe();
+
+    const req = httpMock.expectOne('/dev/deployments');
+    expect(req.request.headers.has('Authorization')).toBeFalse();
+    req.flush([]);
+  });
+
+  it('should ask the user to sign in when the API answers 401', () => {
+    mockAuthService.token.and.returnValue('expired');
+
+    http.get('/dev/deployments').subscribe({ error: () => {} });
+
+    httpMock
+      .expectOne('/dev/deployments')
+      .flush(
+        { code: 'unauthorized' },
+        { status: 401, statusText: 'Unauthorized' },
+      );
+    expect(mockAuthService.signIn).toHaveBeenCalled();
+  });
+});
@@ -0,0 +1,26 @@
+import { HttpErrorResponse, HttpInterceptorFn } from '@angular/common/http';
+import { inject } from '@angular/core';
+import { catchError, throwError } from 'rxjs';
+import { environment } from 'src/environments/environment';
+import { AuthService } from '../services/auth.service';
+
+/**
+ * Attaches the bearer token to requests to the API and sends the user to sign in
+ * when the API answers 401.
+ */
+export const authInterceptor: HttpInterceptorFn = (req, next) => {
+  const auth = inject(AuthService);
+  const token = auth.token();
+  if (token && req.url.startsWith(environment.apiBaseUrl)) {
+    req = req.clone({ setHeaders: { Authorization: `Bearer ${token}` } });
+  }
+
+  return next(req).pipe(
+    catchError((error) => {
+      if (error instanceof HttpErrorResponse && error.status === 401) {
+        auth.signIn();
+      }
+      return throwError(() => error);
+    }),
+  );
+};
@@ -1,9 +1,10 @@
 import { Lifecycle, TimeUnit } from '../enum/dropdown.enum';
 
+// Mirrors the Payload schema in api/openapi.json.
 export class DeploymentApiRequest {
   id?: string;
   instanceId?: string;
-  ami!: number;
+  ami!: string;
   serverSize!: string;
   hostname!: string;
   region!: string;
@@ -12,4 +13,5 @@ export class DeploymentApiRequest {
   ttlUnit?: string;
   timeToExpire?: number;
   userData?: string[];
+  collaborators?: string[];
 }
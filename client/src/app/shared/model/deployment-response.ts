@@ -1,6 +1,24 @@
+// Mirrors the Action schema in api/openapi.json.
+export type DeploymentAction =
+  | 'edit'
+  | 'delete'
+  | 'start'
+  | 'stop'
+  | 'snapshot';
+
+// Mirrors the deploymentStatus enum in api/openapi.json.
+export type DeploymentStatus =
+  | 'requested'
+  | 'provisioning'
+  | 'running'
+  | 'failed'
+  | 'deleting'
+  | 'deleted';
+
+// Mirrors the DeploymentResponse schema in api/openapi.json.
 export class DeploymentApiResponse {
   deploymentId!: string;
-  instanceId!: string;
+  ec2InstanceId!: string;
   hostname!: string;
   snapshotId!: string;
   ami!: string;
@@ -8,7 +26,11 @@ export class DeploymentApiResponse {
   availabilityZone!: string;
   lifecycle!: string;
   status!: string;
+  stopReason?: string;
+  deploymentStatus?: DeploymentStatus;
+  lastError?: string;
   timeToExpire!: string;
   userData!: string[];
+  allowedActions?: DeploymentAction[];
   loading?: boolean;
 }
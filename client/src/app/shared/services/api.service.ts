@@ -23,7 +23,16 @@ export class ApiService {
   ) {}
 
   private handleError(error: any): Observable<never> {
-    const errorMessage = error.error.error || 'An unknown error occurred';
+    const details: { field: string; message: string }[] =
+      error.error?.details ?? [];
+    let errorMessage = error.error?.message || 'An unknown error occurred';
+    if (details.length > 0) {
+      errorMessage +=
+        ': ' + details.map((d) => `${d.field}: ${d.message}`).join('; ');
+    }
+    if (error.error?.requestId) {
+      errorMessage += ` (request ID ${error.error.requestId})`;
+    }
     const errorStatus = error.status || 'Unknown status';
 
     this.dialog.open(ErrorDialogComponent, {
@@ -0,0 +1,59 @@
+import { Injectable } from '@angular/core';
+import { environment } from 'src/environments/environment';
+
+const tokenStorageKey = 'turbo-deploy.token';
+
+/**
+ * Holds the bearer token sent to the API when it runs with auth.mode jwt.
+ * The token is taken from the URL fragment an OpenID Connect provider
+ * redirects back with (#id_token=... or #access_token=...) and kept for the
+ * browser session.
+ */
+@Injectable({
+  providedIn: 'root',
+})
+export class AuthService {
+  constructor() {
+    this.captureRedirectToken();
+  }
+
+  token(): string | null {
+    return sessionStorage.getItem(tokenStorageKey);
+  }
+
+  setToken(token: string): void {
+    sessionStorage.setItem(tokenStorageKey, token);
+  }
+
+  clearToken(): void {
+    sessionStorage.removeItem(tokenStorageKey);
+  }
+
+  /**
+   * Sends the browser to the sign-in page, if one is configured, after the
+   * API refused the token. Returns whether it did.
+   */
+  signIn(): boolean {
+    this.clearToken();
+    if (!environment.loginUrl) {
+      return false;
+    }
+    window.location.assign(environment.loginUrl);
+    return true;
+  }
+
+  private captureRedirectToken(): void {
+    const fragment = new URLSearchParams(window.location.hash.slice(1));
+    const token = fragment.get('id_token') ?? fragment.get('access_token');
+    if (!token) {
+      return;
+    }
+    this.setToken(token);
+    // keep the token out of the address bar and the history
+    history.replaceState(
+      null,
+      '',
+      window.location.pathname + window.location.search,
+    );
+  }
+}
@@ -1,4 +1,6 @@
 export const environment = {
   production: true,
   apiBaseUrl: '', //replace with actual url
+  // sign-in page of the identity provider, used when the API answers 401
+  loginUrl: '',
 };
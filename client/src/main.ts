@@ -1,3 +1,4 @@
+import { inject, provideAppInitializer } from '@angular/core';
 import { bootstrapApplication } from '@angular/platform-browser';
 import { AppComponent } from './app/app.component';
 import { provideRouter } from '@angular/router';
@@ -5,14 +6,25 @@ import { provideAnimations } from '@angular/platform-browser/animations';
 import {
   provideHttpClient,
   withFetch,
+  withInterceptors,
   withInterceptorsFromDi,
 } from '@angular/common/http';
 import { routes } from './app/app.routes';
+import { authInterceptor } from './app/shared/interceptors/auth.interceptor';
+import { AuthService } from './app/shared/services/auth.service';
 
 bootstrapApplication(AppComponent, {
   providers: [
     provideRouter(routes),
     provideAnimations(),
-    provideHttpClient(withInterceptorsFromDi(), withFetch()),
+    // take the token from the sign-in redirect before the router runs
+    provideAppInitializer(() => {
+      inject(AuthService);
+    }),
+    provideHttpClient(
+      withInterceptors([authInterceptor]),
+      withInterceptorsFromDi(),
+      withFetch(),
+    ),
   ],
 }).catch((err) => console.error(err));
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/spf13/cobra"
+)
+
+// apikeyCmd represents the apikey command
+var apikeyCmd = &cobra.Command{
+	Use:     "apikey",
+	Aliases: []string{"apikeys"},
+	Short:   "Manage API keys for CI and automation clients",
+	Long: `Manage the API keys that let CI pipelines and other automation call the API
+without an interactive login.
+
+A key acts as its user, limited to the permissions it was created with. Send it
+like a bearer token, e.g. with --token or TURBO_DEPLOY_API_TOKEN. Keys can only
+be managed with a token from the identity provider, not with another key.
+
+The API is located and authenticated against the same way as for the
+deployments command.`,
+}
+
+var apikeyListCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "List your API keys, admins see every key",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		c, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+
+		user, _ := cmd.Flags().GetString("user")
+		keys, err := c.ListAPIKeys(cmd.Context(), user)
+		if err != nil {
+			return err
+		}
+
+		return printOutput(cmd.OutOrStdout(), outputFormat, keys, func() table {
+			return apiKeyTable(keys...)
+		})
+	},
+}
+
+var apikeyCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create an API key, it is only shown once",
+	Example: `  turbo-deploy apikey create --name github-actions --permissions create,delete \
+    --expires-in 2160h`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		c, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+
+		name, _ := cmd.Flags().GetString("name")
+		user, _ := cmd.Flags().GetString("user")
+		permissions, _ := cmd.Flags().GetStringSlice("permissions")
+		expiresIn, _ := cmd.Flags().GetDuration("expires-in")
+
+		req := models.APIKeyRequest{Name: name, User: user}
+		for _, permission := range permissions {
+			req.Permissions = append(req.Permissions, models.Permission(permission))
+		}
+		if expiresIn > 0 {
+			req.ExpiresAt = time.Now().Add(expiresIn).Unix()
+		}
+
+		key, err := c.CreateAPIKey(cmd.Context(), req)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(cmd.ErrOrStderr(), "Store the key now, it cannot be shown again.")
+		return printOutput(cmd.OutOrStdout(), outputFormat, key, func() table {
+			t := apiKeyTable(key.APIKey)
+			t.header = append(t.header, "KEY")
+			t.rows[0] = append(t.rows[0], key.Key)
+			return t
+		})
+	},
+}
+
+var apikeyRevokeCmd = &cobra.Command{
+	Use:          "revoke <id>...",
+	Short:        "Revoke API keys",
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+
+		for _, id := range args {
+			if err := c.RevokeAPIKey(cmd.Context(), id); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "revoked %s\n", id)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(apikeyCmd)
+	apikeyCmd.AddCommand(apikeyListCmd, apikeyCreateCmd, apikeyRevokeCmd)
+	addAPIFlags(apikeyCmd)
+
+	apikeyListCmd.Flags().String("user", "", "only list the keys of this user, admins only")
+
+	permissions := make([]string, 0, len(models.Permissions))
+	for _, permission := range models.Permissions {
+		permissions = append(permissions, string(permission))
+	}
+	apikeyCreateCmd.Flags().String("name", "", "what the key is used for, e.g. the CI pipeline")
+	apikeyCreateCmd.Flags().String("user", "", "user the key acts as, admins only (default the caller)")
+	apikeyCreateCmd.Flags().StringSlice("permissions", nil, "what the key may do: "+strings.Join(permissions, ", "))
+	apikeyCreateCmd.Flags().Duration("expires-in", 0, "how long the key is valid, it never expires if 0")
+	cobra.CheckErr(apikeyCreateCmd.MarkFlagRequired("name"))
+	cobra.CheckErr(apikeyCreateCmd.MarkFlagRequired("permissions"))
+}
+
+func apiKeyTable(keys ...models.APIKey) table {
+	t := table{header: []string{"ID", "NAME", "USER", "PERMISSIONS", "CREATED", "EXPIRES", "STATUS"}}
+	now := time.Now().Unix()
+	for _, k := range keys {
+		permissions := make([]string, 0, len(k.Permissions))
+		for _, permission := range k.Permissions {
+			permissions = append(permissions, string(permission))
+		}
+
+		expires := "never"
+		if k.ExpiresAt > 0 {
+			expires = time.Unix(k.ExpiresAt, 0).Local().Format(time.DateTime)
+		}
+
+		status := "active"
+		switch {
+		case k.RevokedAt > 0:
+			status = "revoked"
+		case k.ExpiresAt > 0 && k.ExpiresAt <= now:
+			status = "expired"
+		}
+
+		t.rows = append(t.rows, []string{
+			k.ID,
+			k.Name,
+			k.User,
+			strings.Join(permissions, ","),
+			time.Unix(k.CreatedAt, 0).Local().Format(time.DateTime),
+			expires,
+			status,
+		})
+	}
+	return t
+}
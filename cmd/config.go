@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/frgrisk/turbo-deploy/server/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
+)
+
+var configOutput string
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the server configuration",
+	Long: `Inspect the configuration the server would start with.
+
+Configuration is read from the config file, TURBO_DEPLOY_* environment
+variables (e.g. TURBO_DEPLOY_CATALOG_SERVER_SIZES) and the environment
+variables set by the Terraform module, such as MY_REGION and MY_AMI_ATTR.`,
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:          "validate",
+	Short:        "Check that the configuration is complete and valid",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		if _, err := config.Load(viper.GetViper()); err != nil {
+			return fmt.Errorf("configuration is invalid:\n%w", err)
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), "configuration is valid")
+		return nil
+	},
+}
+
+var configPrintCmd = &cobra.Command{
+	Use:          "print",
+	Short:        "Print the effective configuration",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		cfg, err := config.Load(viper.GetViper())
+		if err != nil {
+			return fmt.Errorf("configuration is invalid:\n%w", err)
+		}
+
+		var out []byte
+		switch configOutput {
+		case "yaml":
+			out, err = yaml.Marshal(cfg)
+		case "json":
+			out, err = json.MarshalIndent(cfg, "", "  ")
+			out = append(out, '\n')
+		default:
+			return fmt.Errorf("unknown output format %q, expected yaml or json", configOutput)
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = cmd.OutOrStdout().Write(out)
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configPrintCmd)
+
+	configPrintCmd.Flags().StringVarP(&configOutput, "output", "o", "yaml", "output format (yaml or json)")
+}
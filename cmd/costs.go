@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"strconv"
+
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/spf13/cobra"
+)
+
+// costsCmd represents the costs command
+var costsCmd = &cobra.Command{
+	Use:   "costs",
+	Short: "Show the estimated cost of all deployments by user",
+	Long: `Show the estimated cost of all deployments, summed up by the user who created
+them. Costs are estimated by the server from its price table, they are only
+available if one is configured.
+
+The API is located and authenticated against the same way as for the
+deployments command.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		c, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+
+		summary, err := c.CostSummary(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		return printOutput(cmd.OutOrStdout(), outputFormat, summary, func() table {
+			t := table{header: []string{"USER", "DEPLOYMENTS", "UNPRICED", "HOURLY", "ACCRUED"}}
+			for _, u := range summary.Users {
+				t.rows = append(t.rows, []string{
+					orDash(u.User),
+					strconv.Itoa(u.Deployments),
+					strconv.Itoa(u.Unpriced),
+					formatMoney(u.HourlyCost, summary.Currency),
+					formatMoney(u.AccruedCost, summary.Currency),
+				})
+			}
+			t.rows = append(t.rows, []string{"total", "", "", formatMoney(summary.HourlyCost, summary.Currency), formatMoney(summary.AccruedCost, summary.Currency)})
+			return t
+		})
+	},
+}
+
+var costsEstimateCmd = &cobra.Command{
+	Use:          "estimate",
+	Short:        "Estimate what a deployment would cost before creating it",
+	Example:      `  turbo-deploy costs estimate --ami ami-0123456789abcdef0 --server-size t3.large --ttl-value 8`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		c, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+
+		req := deploymentRequestFromFlags(cmd.Flags(), models.DeploymentRequest{Lifecycle: "on-demand"})
+		estimate, err := c.EstimateCost(cmd.Context(), req)
+		if err != nil {
+			return err
+		}
+
+		return printOutput(cmd.OutOrStdout(), outputFormat, estimate, func() table {
+			lifetime := "-"
+			if estimate.LifetimeHours > 0 {
+				lifetime = formatMoney(estimate.LifetimeCost, estimate.Currency) + " for " + strconv.FormatFloat(estimate.LifetimeHours, 'f', -1, 64) + "h"
+			}
+			return table{
+				header: []string{"REGION", "SIZE", "LIFECYCLE", "STORAGE", "HOURLY", "MONTHLY", "LIFETIME"},
+				rows: [][]string{{
+					estimate.Region,
+					estimate.ServerSize,
+					estimate.Lifecycle,
+					strconv.Itoa(estimate.StorageGB) + " GB",
+					formatMoney(estimate.HourlyCost, estimate.Currency),
+					formatMoney(estimate.MonthlyCost, estimate.Currency),
+					lifetime,
+				}},
+			}
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(costsCmd)
+	costsCmd.AddCommand(costsEstimateCmd)
+	addAPIFlags(costsCmd)
+
+	costsEstimateCmd.Flags().String("ami", "", "AMI to launch, its volumes are priced as storage")
+	costsEstimateCmd.Flags().String("server-size", "", "EC2 instance type")
+	costsEstimateCmd.Flags().String("lifecycle", "on-demand", "on-demand or spot")
+	costsEstimateCmd.Flags().Int64("ttl-value", 0, "time to live, the cost over it is estimated if set")
+	costsEstimateCmd.Flags().String("ttl-unit", "h", "unit of --ttl-value, h or m")
+	cobra.CheckErr(costsEstimateCmd.MarkFlagRequired("server-size"))
+}
+
+// formatCost formats the hourly cost of a deployment, or "-" if it has no
+// price.
+func formatCost(cost *models.Cost) string {
+	if cost == nil {
+		return "-"
+	}
+	return formatMoney(cost.HourlyCost, cost.Currency)
+}
+
+func formatMoney(amount float64, currency string) string {
+	return strconv.FormatFloat(amount, 'f', 4, 64) + " " + currency
+}
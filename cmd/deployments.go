@@ -0,0 +1,519 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/pkg/client"
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	apiURLKey     = "api_url"
+	apiTokenKey   = "api_token"
+	defaultAPIURL = "http://localhost:8080"
+)
+
+var (
+	outputFormat string
+	waitFlag     bool
+	waitTimeout  time.Duration
+	pollInterval time.Duration
+)
+
+// deploymentsCmd represents the deployments command
+var deploymentsCmd = &cobra.Command{
+	Use:     "deployments",
+	Aliases: []string{"deployment", "deploy"},
+	Short:   "Manage deployments through the turbo-deploy API",
+	Long: `Manage deployments without the web application.
+
+The API is reached at --api-url, which can also be set as api_url in the config
+file or with TURBO_DEPLOY_API_URL. Include the API Gateway stage in the URL,
+e.g. https://abc123.execute-api.us-east-2.amazonaws.com/dev.
+
+When the server requires authentication, pass a bearer token issued by its
+identity provider or an API key with --token, api_token or
+TURBO_DEPLOY_API_TOKEN.`,
+}
+
+var deploymentsListCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "List deployments",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		c, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+
+		deployments, err := c.ListDeployments(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		return printOutput(cmd.OutOrStdout(), outputFormat, deployments, func() table {
+			return deploymentTable(deployments...)
+		})
+	},
+}
+
+var deploymentsGetCmd = &cobra.Command{
+	Use:          "get <id>",
+	Short:        "Show a deployment",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+
+		deployment, err := c.GetDeployment(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+
+		return printDeployment(cmd, deployment)
+	},
+}
+
+var deploymentsCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Request a new deployment",
+	Example: `  turbo-deploy deployments create --hostname web1 --ami ami-0123456789abcdef0 \
+    --server-size t3.medium --user-data docker --ttl-value 8 --ttl-unit h --wait`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		c, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+
+		req := deploymentRequestFromFlags(cmd.Flags(), models.DeploymentRequest{Lifecycle: "on-demand"})
+		deployment, err := c.CreateDeployment(cmd.Context(), req)
+		if err != nil {
+			return err
+		}
+
+		if waitFlag {
+			deployment, err = waitForStatus(cmd, c, deployment.ID, "running")
+			if err != nil {
+				return err
+			}
+		}
+
+		return printDeployment(cmd, deployment)
+	},
+}
+
+var deploymentsEditCmd = &cobra.Command{
+	Use:          "edit <id>",
+	Short:        "Change a deployment, flags that are not given keep their current value",
+	Example:      `  turbo-deploy deployments edit 1a2b3c4d --server-size t3.large`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+
+		current, err := c.GetDeployment(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+
+		req := deploymentRequestFromFlags(cmd.Flags(), models.DeploymentRequest{
+			Hostname:      current.Hostname,
+			Ami:           current.Ami,
+			ServerSize:    current.ServerSize,
+			Lifecycle:     current.Lifecycle,
+			CreationUser:  current.CreationUser,
+			UserData:      current.UserData,
+			Collaborators: current.Collaborators,
+		})
+		// the expiry is absolute, keep it unless a new time to live is given
+		if !cmd.Flags().Changed("ttl-value") && current.TimeToExpire > 0 {
+			if remaining := time.Until(time.Unix(current.TimeToExpire, 0)); remaining > 0 {
+				req.TTLValue = int64(remaining.Round(time.Minute) / time.Minute)
+				req.TTLUnit = "m"
+			}
+		}
+
+		deployment, err := c.UpdateDeployment(cmd.Context(), args[0], req)
+		if err != nil {
+			return err
+		}
+
+		return printDeployment(cmd, deployment)
+	},
+}
+
+var deploymentsDeleteCmd = &cobra.Command{
+	Use:          "delete <id>...",
+	Short:        "Delete deployments, terminating their instances",
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+
+		for _, id := range args {
+			if err := c.DeleteDeployment(cmd.Context(), id); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "deleting %s\n", id)
+		}
+		return nil
+	},
+}
+
+var deploymentsStartCmd = &cobra.Command{
+	Use:          "start <id>",
+	Short:        "Start the instance of a deployment",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runInstanceAction(cmd, args[0], (*client.Client).StartDeployment, "running")
+	},
+}
+
+var deploymentsStopCmd = &cobra.Command{
+	Use:          "stop <id>",
+	Short:        "Stop the instance of a deployment",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runInstanceAction(cmd, args[0], (*client.Client).StopDeployment, "stopped")
+	},
+}
+
+var deploymentsSnapshotCmd = &cobra.Command{
+	Use:          "snapshot <id>",
+	Short:        "Capture a snapshot of the instance of a deployment",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+
+		snapshot, err := c.CreateSnapshot(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+
+		if waitFlag {
+			snapshot, err = waitForSnapshot(cmd, c, args[0], snapshot.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return printOutput(cmd.OutOrStdout(), outputFormat, snapshot, func() table {
+			return table{
+				header: []string{"ID", "NAME", "STATE", "CREATED"},
+				rows:   [][]string{{snapshot.ID, orDash(snapshot.Name), snapshot.State, orDash(snapshot.CreatedAt)}},
+			}
+		})
+	},
+}
+
+var deploymentsExtendCmd = &cobra.Command{
+	Use:   "extend <id>",
+	Short: "Extend or shorten the time to live of a deployment",
+	Example: `  turbo-deploy deployments extend 1a2b3c4d --by 4h
+  turbo-deploy deployments extend 1a2b3c4d --by -30m
+  turbo-deploy deployments extend 1a2b3c4d --until 2026-10-20T18:00:00Z`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+
+		var req models.ExtendRequest
+		req.Duration, _ = cmd.Flags().GetString("by")
+		if until, _ := cmd.Flags().GetString("until"); until != "" {
+			expiresAt, err := time.Parse(time.RFC3339, until)
+			if err != nil {
+				return fmt.Errorf("--until: %q is not an RFC 3339 time", until)
+			}
+			req.ExpiresAt = &expiresAt
+		}
+
+		expiry, err := c.ExtendDeployment(cmd.Context(), args[0], req)
+		if err != nil {
+			return err
+		}
+
+		return printOutput(cmd.OutOrStdout(), outputFormat, expiry, func() table {
+			return table{
+				header: []string{"ID", "EXPIRES", "EXTENDED BY"},
+				rows:   [][]string{{expiry.DeploymentID, expiry.ExpiresAt.Local().Format(time.DateTime), orDash(expiry.ExtendedBy)}},
+			}
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(deploymentsCmd)
+	deploymentsCmd.AddCommand(
+		deploymentsListCmd,
+		deploymentsGetCmd,
+		deploymentsCreateCmd,
+		deploymentsEditCmd,
+		deploymentsDeleteCmd,
+		deploymentsStartCmd,
+		deploymentsStopCmd,
+		deploymentsSnapshotCmd,
+		deploymentsExtendCmd,
+	)
+
+	addAPIFlags(deploymentsCmd)
+	cobra.CheckErr(viper.BindEnv(apiURLKey, "TURBO_DEPLOY_API_URL"))
+	cobra.CheckErr(viper.BindEnv(apiTokenKey, "TURBO_DEPLOY_API_TOKEN"))
+	viper.SetDefault(apiURLKey, defaultAPIURL)
+
+	for _, cmd := range []*cobra.Command{deploymentsCreateCmd, deploymentsEditCmd} {
+		cmd.Flags().String("hostname", "", "hostname, without the domain")
+		cmd.Flags().String("ami", "", "AMI to launch")
+		cmd.Flags().String("server-size", "", "EC2 instance type")
+		cmd.Flags().String("lifecycle", "on-demand", "on-demand or spot")
+		cmd.Flags().StringSlice("user-data", nil, "user-data scripts to run on boot")
+		cmd.Flags().String("creation-user", "", "user the deployment is created for, ignored when the server authenticates callers")
+		cmd.Flags().StringSlice("collaborators", nil, "users who may start and stop the deployment")
+		cmd.Flags().Int64("ttl-value", 0, "time to live, the deployment never expires if 0")
+		cmd.Flags().String("ttl-unit", "h", "unit of --ttl-value, h or m")
+	}
+	cobra.CheckErr(deploymentsCreateCmd.MarkFlagRequired("hostname"))
+	cobra.CheckErr(deploymentsCreateCmd.MarkFlagRequired("ami"))
+	cobra.CheckErr(deploymentsCreateCmd.MarkFlagRequired("server-size"))
+
+	deploymentsExtendCmd.Flags().String("by", "", "move the expiry by this duration, e.g. 4h or -30m")
+	deploymentsExtendCmd.Flags().String("until", "", "move the expiry to this RFC 3339 time")
+	deploymentsExtendCmd.MarkFlagsOneRequired("by", "until")
+	deploymentsExtendCmd.MarkFlagsMutuallyExclusive("by", "until")
+
+	for _, cmd := range []*cobra.Command{deploymentsCreateCmd, deploymentsStartCmd, deploymentsStopCmd, deploymentsSnapshotCmd} {
+		cmd.Flags().BoolVar(&waitFlag, "wait", false, "wait until the instance or snapshot reaches its target state")
+		cmd.Flags().DurationVar(&waitTimeout, "timeout", 15*time.Minute, "how long --wait waits")
+		cmd.Flags().DurationVar(&pollInterval, "poll-interval", 5*time.Second, "how often --wait checks the state")
+	}
+}
+
+// addAPIFlags adds the flags locating the API and formatting its responses
+// to cmd and its subcommands.
+func addAPIFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("api-url", "", "base URL of the turbo-deploy API (default "+defaultAPIURL+")")
+	cmd.PersistentFlags().String("token", "", "bearer token or API key to authenticate with")
+	cmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "table", "output format (table, json or yaml)")
+	cmd.PersistentPreRunE = bindAPIFlags
+}
+
+// bindAPIFlags binds the flags added by addAPIFlags when a command runs, as
+// several commands define them and viper keeps one flag per key.
+func bindAPIFlags(cmd *cobra.Command, _ []string) error {
+	if err := viper.BindPFlag(apiURLKey, cmd.Flags().Lookup("api-url")); err != nil {
+		return err
+	}
+	return viper.BindPFlag(apiTokenKey, cmd.Flags().Lookup("token"))
+}
+
+func newAPIClient() (*client.Client, error) {
+	var opts []client.Option
+	if token := viper.GetString(apiTokenKey); token != "" {
+		opts = append(opts, client.WithBearerToken(token))
+	}
+	return client.New(viper.GetString(apiURLKey), opts...)
+}
+
+// deploymentRequestFromFlags overrides the fields of base with the flags
+// given on the command line.
+func deploymentRequestFromFlags(flags *pflag.FlagSet, base models.DeploymentRequest) models.DeploymentRequest {
+	req := base
+	if flags.Changed("hostname") {
+		req.Hostname, _ = flags.GetString("hostname")
+	}
+	if flags.Changed("ami") {
+		req.Ami, _ = flags.GetString("ami")
+	}
+	if flags.Changed("server-size") {
+		req.ServerSize, _ = flags.GetString("server-size")
+	}
+	if flags.Changed("lifecycle") {
+		req.Lifecycle, _ = flags.GetString("lifecycle")
+	}
+	if flags.Changed("user-data") {
+		req.UserData, _ = flags.GetStringSlice("user-data")
+	}
+	if flags.Changed("creation-user") {
+		req.CreationUser, _ = flags.GetString("creation-user")
+	}
+	if flags.Changed("collaborators") {
+		req.Collaborators, _ = flags.GetStringSlice("collaborators")
+	}
+	if flags.Changed("ttl-value") {
+		req.TTLValue, _ = flags.GetInt64("ttl-value")
+		req.TTLUnit, _ = flags.GetString("ttl-unit")
+	}
+	return req
+}
+
+type instanceAction func(c *client.Client, ctx context.Context, id string) error
+
+func runInstanceAction(cmd *cobra.Command, id string, action instanceAction, target string) error {
+	c, err := newAPIClient()
+	if err != nil {
+		return err
+	}
+
+	if err := action(c, cmd.Context(), id); err != nil {
+		return err
+	}
+
+	if !waitFlag {
+		fmt.Fprintf(cmd.OutOrStdout(), "instance of %s is changing to %s\n", id, target)
+		return nil
+	}
+
+	deployment, err := waitForStatus(cmd, c, id, target)
+	if err != nil {
+		return err
+	}
+	return printDeployment(cmd, deployment)
+}
+
+// waitForStatus polls a deployment until its instance has the status target.
+// It gives up once the deployment failed to provision.
+func waitForStatus(cmd *cobra.Command, c *client.Client, id, target string) (*models.Deployment, error) {
+	var deployment *models.Deployment
+	err := poll(cmd, func(ctx context.Context) (bool, error) {
+		var err error
+		deployment, err = c.GetDeployment(ctx, id)
+		if err != nil {
+			return false, err
+		}
+		if deployment.Status == models.StatusFailed {
+			return false, fmt.Errorf("deployment %s failed to provision: %s", id, deployment.LastError)
+		}
+
+		status := string(deployment.Status)
+		if deployment.Instance != nil {
+			status = deployment.Instance.Status
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "%s: %s\n", id, status)
+		return status == target, nil
+	})
+	return deployment, err
+}
+
+// waitForSnapshot polls the snapshots of a deployment until snapshotID is
+// available.
+func waitForSnapshot(cmd *cobra.Command, c *client.Client, id, snapshotID string) (*models.Snapshot, error) {
+	var snapshot *models.Snapshot
+	err := poll(cmd, func(ctx context.Context) (bool, error) {
+		list, err := c.ListSnapshots(ctx, id)
+		if err != nil {
+			return false, err
+		}
+
+		i := slices.IndexFunc(list.Snapshots, func(s models.Snapshot) bool { return s.ID == snapshotID })
+		if i < 0 {
+			return false, fmt.Errorf("snapshot %s of %s disappeared", snapshotID, id)
+		}
+		snapshot = &list.Snapshots[i]
+
+		fmt.Fprintf(cmd.ErrOrStderr(), "%s: %s\n", snapshotID, snapshot.State)
+		if snapshot.State == "failed" {
+			return false, fmt.Errorf("snapshot %s failed", snapshotID)
+		}
+		return snapshot.State == "available", nil
+	})
+	return snapshot, err
+}
+
+// poll calls check every --poll-interval until it reports done, fails or
+// --timeout passes.
+func poll(cmd *cobra.Command, check func(ctx context.Context) (bool, error)) error {
+	ctx, cancel := context.WithTimeout(cmd.Context(), waitTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		done, err := check(ctx)
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return fmt.Errorf("gave up waiting after %s", waitTimeout)
+			}
+			return err
+		}
+		if done {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up waiting after %s", waitTimeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+func printDeployment(cmd *cobra.Command, deployment *models.Deployment) error {
+	return printOutput(cmd.OutOrStdout(), outputFormat, deployment, func() table {
+		return deploymentTable(*deployment)
+	})
+}
+
+func deploymentTable(deployments ...models.Deployment) table {
+	t := table{header: []string{"ID", "HOSTNAME", "AMI", "SIZE", "LIFECYCLE", "INSTANCE", "STATUS", "EXPIRES", "COST/H", "USER DATA"}}
+	for _, d := range deployments {
+		instanceID, status := "-", string(d.Status)
+		if d.Instance != nil {
+			instanceID, status = d.Instance.ID, d.Instance.Status
+			// an edit the provisioner has yet to apply, or a deletion
+			if d.Status != models.StatusRunning {
+				status = string(d.Status) + "/" + status
+			}
+		}
+		if d.StopReason != "" {
+			status += " (" + d.StopReason + ")"
+		}
+
+		expires := "never"
+		if d.TimeToExpire > 0 {
+			expires = time.Unix(d.TimeToExpire, 0).Local().Format(time.DateTime)
+		}
+
+		t.rows = append(t.rows, []string{
+			d.ID,
+			d.Hostname,
+			d.Ami,
+			d.ServerSize,
+			d.Lifecycle,
+			instanceID,
+			status,
+			expires,
+			formatCost(d.Cost),
+			orDash(strings.Join(d.UserData, ",")),
+		})
+	}
+	return t
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// driftCmd represents the drift command
+var driftCmd = &cobra.Command{
+	Use:   "drift",
+	Short: "Show where the deployment records and the EC2 instances disagree",
+	Long: `Compare every deployment record with the instances tagged
+DeployedBy=turbo-deploy and list the deployments without an instance, the
+instances without a deployment, duplicate instances and instances whose server
+size, AMI or lifecycle differs from their deployment. Deployments the
+provisioner has yet to apply are left out. Only admins may run it.
+
+Use -o json to feed the report to alerting, and --exit-code to fail when
+anything drifted. The API is located and authenticated against the same way as
+for the deployments command.`,
+	Example:      `  turbo-deploy drift -o json --exit-code`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		c, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+
+		report, err := c.DriftReport(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		err = printOutput(cmd.OutOrStdout(), outputFormat, report, func() table {
+			t := table{header: []string{"DEPLOYMENT", "INSTANCE", "HOSTNAME", "STATUS", "DRIFT", "EXPECTED", "ACTUAL"}}
+			for _, d := range report.Drifts {
+				t.rows = append(t.rows, []string{
+					orDash(d.DeploymentID),
+					orDash(d.InstanceID),
+					orDash(d.Hostname),
+					orDash(string(d.Status)),
+					string(d.Kind),
+					orDash(d.Expected),
+					orDash(d.Actual),
+				})
+			}
+			return t
+		})
+		if err != nil {
+			return err
+		}
+
+		if exitCode, _ := cmd.Flags().GetBool("exit-code"); exitCode && len(report.Drifts) > 0 {
+			return fmt.Errorf("found %d discrepancies between %d deployments and %d instances",
+				len(report.Drifts), report.Deployments, report.Instances)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(driftCmd)
+	addAPIFlags(driftCmd)
+
+	driftCmd.Flags().Bool("exit-code", false, "exit with status 1 if anything drifted")
+}
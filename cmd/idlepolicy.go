@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/frgrisk/turbo-deploy/server/timeutil"
+	"github.com/spf13/cobra"
+)
+
+var deploymentsIdlePolicyCmd = &cobra.Command{
+	Use:   "idle-policy",
+	Short: "Stop deployments automatically when they are idle",
+	Long: `Attach idle policies to deployments. The stop-idle job stops the instance of a
+deployment once its CPU utilization and network traffic stayed below the
+thresholds of its policy for the lookback, see turbo-deploy stop-idle.`,
+}
+
+var deploymentsIdlePolicySetCmd = &cobra.Command{
+	Use:          "set <id>",
+	Short:        "Give a deployment an idle policy, replacing the one it has",
+	Example:      `  turbo-deploy deployments idle-policy set 1a2b3c4d --cpu 5 --network 10000 --lookback 2h`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+
+		var policy models.IdlePolicy
+		policy.CPUPercent, _ = cmd.Flags().GetFloat64("cpu")
+		policy.NetworkBytesPerSecond, _ = cmd.Flags().GetFloat64("network")
+		lookback, _ := cmd.Flags().GetDuration("lookback")
+		policy.Lookback = timeutil.FormatDuration(lookback)
+
+		deployment, err := c.SetIdlePolicy(cmd.Context(), args[0], policy)
+		if err != nil {
+			return err
+		}
+
+		return printOutput(cmd.OutOrStdout(), outputFormat, deployment, func() table {
+			t := table{header: []string{"ID", "CPU BELOW", "NETWORK BELOW", "LOOKBACK"}}
+			if p := deployment.IdlePolicy; p != nil {
+				cpu, network := "-", "-"
+				if p.CPUPercent > 0 {
+					cpu = fmt.Sprintf("%g%%", p.CPUPercent)
+				}
+				if p.NetworkBytesPerSecond > 0 {
+					network = fmt.Sprintf("%g B/s", p.NetworkBytesPerSecond)
+				}
+				t.rows = append(t.rows, []string{deployment.ID, cpu, network, p.Lookback})
+			}
+			return t
+		})
+	},
+}
+
+var deploymentsIdlePolicyClearCmd = &cobra.Command{
+	Use:          "clear <id>",
+	Short:        "Remove the idle policy of a deployment",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+
+		if err := c.DeleteIdlePolicy(cmd.Context(), args[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "removed the idle policy of %s\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	deploymentsCmd.AddCommand(deploymentsIdlePolicyCmd)
+	deploymentsIdlePolicyCmd.AddCommand(deploymentsIdlePolicySetCmd, deploymentsIdlePolicyClearCmd)
+
+	deploymentsIdlePolicySetCmd.Flags().Float64("cpu", 0, "idle while CPU utilization stays below this percentage")
+	deploymentsIdlePolicySetCmd.Flags().Float64("network", 0, "idle while network traffic stays below this many bytes per second")
+	deploymentsIdlePolicySetCmd.Flags().Duration("lookback", 2*time.Hour, "how long the instance must be idle before it is stopped")
+	deploymentsIdlePolicySetCmd.MarkFlagsOneRequired("cpu", "network")
+}
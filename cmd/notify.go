@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// notifyCmd represents the notify command
+var notifyCmd = &cobra.Command{
+	Use:   "notify",
+	Short: "Warn users whose deployments are about to expire",
+	Long: `Warn the users who created deployments that expire within one of the lead
+times in notify.lead_times, through the webhook, Slack and SMTP channels
+configured in the notify section. Each lead time is warned about once per
+expiry, so notify can run as often as needed.
+
+Like reap, notify talks to DynamoDB directly with the AWS credentials in the
+environment. The Lambda function runs it when invoked with the event
+{"job": "notify"}.`,
+	Example:      `  turbo-deploy notify --dry-run`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		srv, err := newJobServer(cmd)
+		if err != nil {
+			return err
+		}
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		report, notifyErr := srv.Notify(cmd.Context(), dryRun)
+
+		err = printOutput(cmd.OutOrStdout(), outputFormat, report, func() table {
+			t := table{header: []string{"DEPLOYMENT", "HOSTNAME", "USER", "EXPIRES", "LEAD TIME", "RESULT"}}
+			for _, w := range report.Sent {
+				result := "sent via " + strings.Join(w.Channels, ",")
+				switch {
+				case w.Error != "":
+					result = w.Error
+				case report.DryRun:
+					result = "would be sent via " + strings.Join(report.Channels, ",")
+				}
+				t.rows = append(t.rows, []string{
+					w.DeploymentID,
+					w.Hostname,
+					orDash(w.User),
+					w.ExpiresAt.Local().Format(time.DateTime),
+					w.LeadTime,
+					result,
+				})
+			}
+			return t
+		})
+		if notifyErr != nil {
+			return notifyErr
+		}
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(notifyCmd)
+
+	notifyCmd.Flags().Bool("dry-run", false, "list the warnings that are due without sending them")
+	notifyCmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "output format (table, json or yaml)")
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/frgrisk/turbo-deploy/server"
+	"github.com/spf13/cobra"
+)
+
+const defaultSpecFile = "api/openapi.json"
+
+var specFile string
+
+// openapiCmd represents the openapi command
+var openapiCmd = &cobra.Command{
+	Use:   "openapi",
+	Short: "Generate or check the OpenAPI specification",
+	Long: `The OpenAPI specification is generated from the routes and models of the
+server. A running server also serves it at /openapi.json, with a rendered
+version at /docs.`,
+}
+
+var openapiGenerateCmd = &cobra.Command{
+	Use:          "generate",
+	Short:        "Write the OpenAPI specification",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		spec, err := server.OpenAPISpec()
+		if err != nil {
+			return err
+		}
+
+		if specFile == "-" {
+			_, err = cmd.OutOrStdout().Write(spec)
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(specFile), 0o750); err != nil {
+			return err
+		}
+		if err := os.WriteFile(specFile, spec, 0o600); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "wrote %s\n", specFile)
+		return nil
+	},
+}
+
+var openapiCheckCmd = &cobra.Command{
+	Use:          "check",
+	Short:        "Fail if the committed OpenAPI specification is out of date",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		spec, err := server.OpenAPISpec()
+		if err != nil {
+			return err
+		}
+
+		committed, err := os.ReadFile(specFile)
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%s does not exist, run `turbo-deploy openapi generate`", specFile)
+		}
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(committed, spec) {
+			return fmt.Errorf("%s is out of date, run `turbo-deploy openapi generate` and commit the result", specFile)
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "%s is up to date\n", specFile)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(openapiCmd)
+	openapiCmd.AddCommand(openapiGenerateCmd)
+	openapiCmd.AddCommand(openapiCheckCmd)
+
+	openapiCmd.PersistentFlags().StringVarP(&specFile, "file", "f", defaultSpecFile, "specification file (- writes to stdout when generating)")
+}
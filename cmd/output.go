@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// table is output rendered as aligned columns.
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+// printOutput writes value as JSON or YAML, or as the table built by toTable.
+func printOutput(w io.Writer, format string, value any, toTable func() table) error {
+	switch format {
+	case "table":
+		return printTable(w, toTable())
+	case "json":
+		out, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(out))
+		return err
+	case "yaml":
+		return printYAML(w, value)
+	default:
+		return fmt.Errorf("unknown output format %q, expected table, json or yaml", format)
+	}
+}
+
+func printTable(w io.Writer, t table) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(t.header, "\t"))
+	for _, row := range t.rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// printYAML writes value as YAML using its JSON field names, which are the
+// names used by the API.
+func printYAML(w io.Writer, value any) error {
+	out, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	// JSON is YAML, decoding it into a node keeps the field order
+	var node yaml.Node
+	if err := yaml.Unmarshal(out, &node); err != nil {
+		return err
+	}
+	blockStyle(&node)
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// blockStyle resets the flow and quoting styles nodes decoded from JSON have,
+// the encoder quotes scalars where YAML needs it.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// orDash returns value, or "-" for an empty table cell.
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
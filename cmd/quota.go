@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/spf13/cobra"
+)
+
+// quotaCmd represents the quota command
+var quotaCmd = &cobra.Command{
+	Use:   "quota",
+	Short: "Show your deployment quotas and how much of them is used",
+	Long: `Show the deployment quotas of your user and of every team you are a member
+of, and how much of each is in use. Creating or editing a deployment that
+would go over a limit is refused.
+
+The API is located and authenticated against the same way as for the
+deployments command.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		c, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+
+		user, _ := cmd.Flags().GetString("user")
+		quota, err := c.GetQuota(cmd.Context(), user)
+		if err != nil {
+			return err
+		}
+
+		return printOutput(cmd.OutOrStdout(), outputFormat, quota, func() table {
+			return quotaTable(quota)
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(quotaCmd)
+	addAPIFlags(quotaCmd)
+
+	quotaCmd.Flags().String("user", "", "show the quota of this user, admins only")
+}
+
+func quotaTable(quota *models.Quota) table {
+	t := table{header: []string{"QUOTA", "DEPLOYMENTS", "VCPUS", "ON-DEMAND", "SERVER SIZES"}}
+	row := func(name string, limits models.QuotaLimits, usage models.QuotaUsage) []string {
+		sizes := "any"
+		if len(limits.ServerSizes) > 0 {
+			sizes = strings.Join(limits.ServerSizes, ",")
+		}
+		return []string{
+			name,
+			usageOf(usage.Deployments, limits.MaxDeployments),
+			usageOf(usage.VCPUs, limits.MaxVCPUs),
+			usageOf(usage.OnDemand, limits.MaxOnDemand),
+			sizes,
+		}
+	}
+
+	t.rows = append(t.rows, row("user "+orDash(quota.User), quota.Limits, quota.Usage))
+	for _, team := range quota.Teams {
+		t.rows = append(t.rows, row("team "+team.Name, team.Limits, team.Usage))
+	}
+	return t
+}
+
+// usageOf formats usage against a limit, where 0 is unlimited.
+func usageOf(used, limit int) string {
+	if limit == 0 {
+		return strconv.Itoa(used)
+	}
+	return strconv.Itoa(used) + "/" + strconv.Itoa(limit)
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server"
+	"github.com/frgrisk/turbo-deploy/server/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// reapCmd represents the reap command
+var reapCmd = &cobra.Command{
+	Use:   "reap",
+	Short: "Remove deployments whose time to expire has passed",
+	Long: `Remove every deployment whose TimeToExpire has passed: it is marked deleting,
+and the provisioner terminates its instance, unregisters its hostname and
+removes the record after the deleted retention. Instances whose record is
+already gone are found by their TimeToExpire tag and terminated. With
+--final-snapshot every instance is captured in an image first, and waited for
+until the image is available.
+
+The reaper talks to DynamoDB and EC2 directly with the AWS credentials in the
+environment, like serve does. The Lambda function runs it when invoked with
+the event {"job": "reap"}, e.g. by a scheduled EventBridge rule.`,
+	Example: `  turbo-deploy reap --dry-run
+  turbo-deploy reap --grace-period 1h --final-snapshot`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		srv, err := newJobServer(cmd)
+		if err != nil {
+			return err
+		}
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		report, reapErr := srv.Reap(cmd.Context(), dryRun)
+
+		err = printOutput(cmd.OutOrStdout(), outputFormat, report, func() table {
+			t := table{header: []string{"DEPLOYMENT", "INSTANCE", "HOSTNAME", "EXPIRED", "SNAPSHOT", "RESULT"}}
+			for _, r := range report.Reaped {
+				result := "reaped"
+				switch {
+				case r.Error != "":
+					result = r.Error
+				case report.DryRun:
+					result = "would be reaped"
+				}
+				t.rows = append(t.rows, []string{
+					r.DeploymentID,
+					orDash(r.InstanceID),
+					orDash(r.Hostname),
+					r.ExpiredAt.Local().Format(time.DateTime),
+					orDash(r.SnapshotID),
+					result,
+				})
+			}
+			return t
+		})
+		if reapErr != nil {
+			return reapErr
+		}
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reapCmd)
+
+	reapCmd.Flags().Bool("dry-run", false, "list the expired deployments without removing them")
+	reapCmd.Flags().Duration("grace-period", 0, "keep deployments for this long past their expiry")
+	reapCmd.Flags().Bool("final-snapshot", false, "capture an image of every instance before terminating it")
+	reapCmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "output format (table, json or yaml)")
+
+	bindFlags(reapCmd, map[string]string{
+		"grace-period":   "reaper.grace_period",
+		"final-snapshot": "reaper.final_snapshot",
+	})
+}
+
+// newJobServer builds the server a scheduled job runs on from the
+// configuration, talking to AWS directly.
+func newJobServer(cmd *cobra.Command) (*server.Server, error) {
+	cfg, err := config.Load(viper.GetViper())
+	if err != nil {
+		return nil, err
+	}
+	return server.NewFromConfig(cmd.Context(), cfg)
+}
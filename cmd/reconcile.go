@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// reconcileCmd represents the reconcile command
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Launch, update and terminate instances to match the deployments",
+	Long: `Compare the deployment records with the instances tagged with their
+DeploymentID and act on the deployments that differ: launch the missing
+instances, replace those whose image, lifecycle or hostname changed, resize and
+retag the others in place, and terminate the instances of deleted deployments.
+The hostnames are registered in the Route53 hosted zone of the provisioner
+configuration.
+
+Like reap, reconcile talks to DynamoDB, EC2, Route53 and S3 directly with the
+AWS credentials in the environment. The Lambda function runs it when invoked
+with the event {"job": "reconcile"}, and for the deployments changed in a
+DynamoDB stream event.`,
+	Example: `  turbo-deploy reconcile --dry-run
+  turbo-deploy reconcile --deployment 1a2b3c4d`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		srv, err := newJobServer(cmd)
+		if err != nil {
+			return err
+		}
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		deploymentIDs, _ := cmd.Flags().GetStringSlice("deployment")
+		report, reconcileErr := srv.Reconcile(cmd.Context(), dryRun, deploymentIDs...)
+
+		err = printOutput(cmd.OutOrStdout(), outputFormat, report, func() table {
+			t := table{header: []string{"DEPLOYMENT", "INSTANCE", "HOSTNAME", "ACTIONS", "STATUS", "RESULT"}}
+			for _, c := range report.Changes {
+				actions := make([]string, 0, len(c.Actions))
+				for _, action := range c.Actions {
+					actions = append(actions, string(action))
+				}
+				result := "done"
+				switch {
+				case c.Error != "":
+					result = c.Error
+				case report.DryRun:
+					result = "would be done"
+				}
+				t.rows = append(t.rows, []string{
+					c.DeploymentID,
+					orDash(c.InstanceID),
+					orDash(c.Hostname),
+					orDash(strings.Join(actions, ",")),
+					orDash(string(c.Status)),
+					result,
+				})
+			}
+			return t
+		})
+		if reconcileErr != nil {
+			return reconcileErr
+		}
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reconcileCmd)
+
+	reconcileCmd.Flags().Bool("dry-run", false, "list the changes without making them")
+	reconcileCmd.Flags().StringSlice("deployment", nil, "only reconcile these deployments")
+	reconcileCmd.Flags().Duration("deleted-retention", 0, "keep deleted deployments for this long before removing their records")
+	reconcileCmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "output format (table, json or yaml)")
+
+	bindFlags(reconcileCmd, map[string]string{
+		"deleted-retention": "provisioner.deleted_retention",
+	})
+}
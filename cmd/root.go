@@ -51,7 +51,7 @@ func Execute() {
 }
 
 func init() {
-	cobra.OnInitialize(initConfig)
+	cobra.OnInitialize(InitConfig)
 
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
@@ -64,17 +64,24 @@ func init() {
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
 
-// initConfig reads in config file and ENV variables if set.
-func initConfig() {
+// bindFlags binds the flags of cmd to configuration keys, flags are given
+// precedence over the config file and environment.
+func bindFlags(cmd *cobra.Command, keys map[string]string) {
+	for flag, key := range keys {
+		cobra.CheckErr(viper.BindPFlag(key, cmd.Flags().Lookup(flag)))
+	}
+}
+
+// InitConfig reads in config file and ENV variables if set. Commands run it
+// before they start, the Lambda runtime calls it before loading the server
+// configuration since it does not go through the commands.
+func InitConfig() {
 	if cfgFile != "" {
 		// Use config file from the flag.
 		viper.SetConfigFile(cfgFile)
-	} else {
-		// Find home directory.
-		home, err := os.UserHomeDir()
-		cobra.CheckErr(err)
-
+	} else if home, err := os.UserHomeDir(); err == nil {
 		// Search config in home directory with name ".turbo-deploy" (without extension).
+		// Lambda runtimes have no home directory and are configured by the environment.
 		viper.AddConfigPath(home)
 		viper.SetConfigType("yaml")
 		viper.SetConfigName(".turbo-deploy")
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/frgrisk/turbo-deploy/server/validate"
+	"github.com/spf13/cobra"
+)
+
+var deploymentsScheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Run deployments on office-hours schedules",
+	Long: `Attach office-hours schedules to deployments. The scheduler job starts the
+instance of a deployment within the windows of its schedule and stops it
+outside them, see turbo-deploy scheduler run.`,
+}
+
+var deploymentsScheduleSetCmd = &cobra.Command{
+	Use:   "set <id>",
+	Short: "Put a deployment on a schedule, replacing the one it has",
+	Long: `Put a deployment on a schedule, replacing the one it has.
+
+A window is given as days and times, e.g. "mon-fri 08:00-18:00" or
+"mon,wed 22:00-02:00". Days are mon, tue, wed, thu, fri, sat and sun, a range
+such as mon-fri includes both ends. A window whose stop is not after its start
+runs past midnight. No window starts on a holiday.`,
+	Example: `  turbo-deploy deployments schedule set 1a2b3c4d --timezone Europe/London \
+    --window "mon-fri 08:00-18:00" --holiday 2026-12-25,2026-12-28`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+
+		var schedule models.Schedule
+		schedule.Timezone, _ = cmd.Flags().GetString("timezone")
+		schedule.Holidays, _ = cmd.Flags().GetStringSlice("holiday")
+		windows, _ := cmd.Flags().GetStringArray("window")
+		for _, value := range windows {
+			window, err := parseWindow(value)
+			if err != nil {
+				return fmt.Errorf("--window: %w", err)
+			}
+			schedule.Windows = append(schedule.Windows, window)
+		}
+
+		deployment, err := c.SetSchedule(cmd.Context(), args[0], schedule)
+		if err != nil {
+			return err
+		}
+
+		return printSchedule(cmd, deployment)
+	},
+}
+
+var deploymentsScheduleClearCmd = &cobra.Command{
+	Use:          "clear <id>",
+	Short:        "Remove the schedule of a deployment",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+
+		if err := c.DeleteSchedule(cmd.Context(), args[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "removed the schedule of %s\n", args[0])
+		return nil
+	},
+}
+
+var deploymentsScheduleSuspendCmd = &cobra.Command{
+	Use:   "suspend <id>",
+	Short: "Leave the instance of a deployment alone until a given time",
+	Example: `  turbo-deploy deployments schedule suspend 1a2b3c4d --for 3h
+  turbo-deploy deployments schedule suspend 1a2b3c4d --until 2026-10-20T09:00:00+01:00`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+
+		until := time.Now()
+		if d, _ := cmd.Flags().GetDuration("for"); d != 0 {
+			until = until.Add(d)
+		}
+		if value, _ := cmd.Flags().GetString("until"); value != "" {
+			until, err = time.Parse(time.RFC3339, value)
+			if err != nil {
+				return fmt.Errorf("--until: %q is not an RFC 3339 time", value)
+			}
+		}
+
+		deployment, err := c.SuspendSchedule(cmd.Context(), args[0], until)
+		if err != nil {
+			return err
+		}
+
+		return printSchedule(cmd, deployment)
+	},
+}
+
+var deploymentsScheduleResumeCmd = &cobra.Command{
+	Use:          "resume <id>",
+	Short:        "End the suspension of a deployment's schedule",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+
+		if err := c.ResumeSchedule(cmd.Context(), args[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "resumed the schedule of %s\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	deploymentsCmd.AddCommand(deploymentsScheduleCmd)
+	deploymentsScheduleCmd.AddCommand(
+		deploymentsScheduleSetCmd,
+		deploymentsScheduleClearCmd,
+		deploymentsScheduleSuspendCmd,
+		deploymentsScheduleResumeCmd,
+	)
+
+	deploymentsScheduleSetCmd.Flags().String("timezone", "UTC", "IANA time zone of the windows and holidays, e.g. Europe/London")
+	deploymentsScheduleSetCmd.Flags().StringArray("window", nil, `days and times the instance runs, e.g. "mon-fri 08:00-18:00", repeatable`)
+	deploymentsScheduleSetCmd.Flags().StringSlice("holiday", nil, "dates on which no window starts, e.g. 2026-12-25")
+	cobra.CheckErr(deploymentsScheduleSetCmd.MarkFlagRequired("window"))
+
+	deploymentsScheduleSuspendCmd.Flags().Duration("for", 0, "suspend the schedule for this long, e.g. 3h")
+	deploymentsScheduleSuspendCmd.Flags().String("until", "", "suspend the schedule until this RFC 3339 time")
+	deploymentsScheduleSuspendCmd.MarkFlagsOneRequired("for", "until")
+	deploymentsScheduleSuspendCmd.MarkFlagsMutuallyExclusive("for", "until")
+}
+
+// parseWindow parses a window such as "mon-fri 08:00-18:00".
+func parseWindow(value string) (models.ScheduleWindow, error) {
+	days, times, ok := strings.Cut(strings.TrimSpace(value), " ")
+	start, stop, ok2 := strings.Cut(strings.TrimSpace(times), "-")
+	if !ok || !ok2 {
+		return models.ScheduleWindow{}, fmt.Errorf("%q is not a window such as \"mon-fri 08:00-18:00\"", value)
+	}
+
+	window := models.ScheduleWindow{Start: start, Stop: stop}
+	for _, item := range strings.Split(days, ",") {
+		first, last, isRange := strings.Cut(item, "-")
+		from := slices.Index(validate.Weekdays, first)
+		to := slices.Index(validate.Weekdays, last)
+		if from < 0 || (isRange && to < 0) {
+			return models.ScheduleWindow{}, fmt.Errorf("%q is not a day or range of days such as mon-fri", item)
+		}
+		if !isRange {
+			to = from
+		}
+		// ranges may wrap around the week, e.g. fri-mon
+		for i := from; ; i = (i + 1) % len(validate.Weekdays) {
+			if day := validate.Weekdays[i]; !slices.Contains(window.Days, day) {
+				window.Days = append(window.Days, day)
+			}
+			if i == to {
+				break
+			}
+		}
+	}
+	return window, nil
+}
+
+func printSchedule(cmd *cobra.Command, deployment *models.Deployment) error {
+	return printOutput(cmd.OutOrStdout(), outputFormat, deployment, func() table {
+		t := table{header: []string{"ID", "TIMEZONE", "WINDOWS", "HOLIDAYS", "SUSPENDED UNTIL"}}
+		if deployment.Schedule == nil {
+			t.rows = append(t.rows, []string{deployment.ID, "-", "-", "-", "-"})
+			return t
+		}
+
+		var windows []string
+		for _, w := range deployment.Schedule.Windows {
+			windows = append(windows, fmt.Sprintf("%s %s-%s", strings.Join(w.Days, ","), w.Start, w.Stop))
+		}
+		suspended := "-"
+		if deployment.ScheduleSuspendedUntil > 0 {
+			suspended = time.Unix(deployment.ScheduleSuspendedUntil, 0).Local().Format(time.DateTime)
+		}
+		t.rows = append(t.rows, []string{
+			deployment.ID,
+			deployment.Schedule.Timezone,
+			strings.Join(windows, "; "),
+			orDash(strings.Join(deployment.Schedule.Holidays, ",")),
+			suspended,
+		})
+		return t
+	})
+}
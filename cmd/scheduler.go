@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// schedulerCmd represents the scheduler command
+var schedulerCmd = &cobra.Command{
+	Use:   "scheduler",
+	Short: "Power deployments on and off on their office-hours schedules",
+}
+
+var schedulerRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Start and stop the instances that do not match their schedule",
+	Long: `Start the stopped instances of scheduled deployments within a window of their
+schedule, and stop the running ones outside. Deployments whose schedule is
+suspended are left alone. Run it every few minutes, a window starts or stops
+the instance at the first run after it opens or closes.
+
+Like reap, the scheduler talks to DynamoDB and EC2 directly with the AWS
+credentials in the environment. The Lambda function runs it when invoked with
+the event {"job": "scheduler"}.`,
+	Example:      `  turbo-deploy scheduler run --dry-run`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		srv, err := newJobServer(cmd)
+		if err != nil {
+			return err
+		}
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		report, runErr := srv.Schedule(cmd.Context(), dryRun)
+
+		err = printOutput(cmd.OutOrStdout(), outputFormat, report, func() table {
+			t := table{header: []string{"DEPLOYMENT", "INSTANCE", "HOSTNAME", "ACTION", "REASON", "RESULT"}}
+			for _, a := range report.Actions {
+				result := "done"
+				switch {
+				case a.Error != "":
+					result = a.Error
+				case report.DryRun:
+					result = "dry run"
+				}
+				t.rows = append(t.rows, []string{a.DeploymentID, a.InstanceID, orDash(a.Hostname), a.Action, a.Reason, result})
+			}
+			return t
+		})
+		if runErr != nil {
+			return runErr
+		}
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(schedulerCmd)
+	schedulerCmd.AddCommand(schedulerRunCmd)
+
+	schedulerRunCmd.Flags().Bool("dry-run", false, "list the instances that would be started or stopped without changing them")
+	schedulerRunCmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "output format (table, json or yaml)")
+}
@@ -4,31 +4,78 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"log"
+
 	"github.com/frgrisk/turbo-deploy/server"
+	"github.com/frgrisk/turbo-deploy/server/config"
+	"github.com/frgrisk/turbo-deploy/server/local"
+	"github.com/frgrisk/turbo-deploy/server/pricing"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // serveCmd represents the serve command
 var serveCmd = &cobra.Command{
 	Use:   "serve",
 	Short: "Start the HTTP server",
-	Long:  `Starts the HTTP server to handle requests. This server will run locally and can be used for development and testing.`,
-	// parameters were cmd and args
-	Run: func(_ *cobra.Command, _ []string) {
-		server.Start()
+	Long: `Starts the HTTP server to handle requests. This server will run locally and can be used for development and testing.
+
+With --local the server does not talk to AWS at all. Deployment requests are
+kept in memory and turned into simulated EC2 instances, so the whole REST API
+and the Angular client can be used without credentials or network access.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		cfg, err := config.Load(viper.GetViper())
+		if err != nil {
+			return err
+		}
+
+		if cfg.Local.Enabled {
+			return serveLocally(cmd, cfg)
+		}
+
+		srv, err := server.NewFromConfig(cmd.Context(), cfg)
+		if err != nil {
+			return err
+		}
+		srv.Start()
+		return nil
 	},
 }
 
+func serveLocally(cmd *cobra.Command, cfg *config.Config) error {
+	opts, err := local.OptionsFromConfig(cfg.Local)
+	if err != nil {
+		return err
+	}
+	if cfg.Pricing.TableFile != "" {
+		if opts.Prices, err = pricing.LoadTable(cfg.Pricing.TableFile); err != nil {
+			return err
+		}
+	}
+
+	env := local.New(cfg, opts)
+	go env.Run(cmd.Context())
+
+	log.Printf("Running in local mode with %d AMIs, %d server sizes and %d user-data scripts", len(opts.Amis), len(opts.ServerSizes), len(opts.UserScripts))
+	env.Server.Start()
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(serveCmd)
 
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// serveCmd.PersistentFlags().String("foo", "", "A help for foo")
+	serveCmd.Flags().Int("port", 0, "port to listen on (default 8080)")
+	serveCmd.Flags().Bool("local", false, "serve with in-memory stand-ins for DynamoDB and EC2 instead of AWS")
+	serveCmd.Flags().StringArray("local-ami", nil, "AMI offered in local mode as ami-<id>[=name], can be repeated")
+	serveCmd.Flags().StringSlice("local-server-size", nil, "server sizes offered in local mode")
+	serveCmd.Flags().StringSlice("local-user-script", nil, "user-data script names offered in local mode")
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// serveCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	bindFlags(serveCmd, map[string]string{
+		"port":              "port",
+		"local":             "local.enabled",
+		"local-ami":         "local.amis",
+		"local-server-size": "local.server_sizes",
+		"local-user-script": "local.user_scripts",
+	})
 }
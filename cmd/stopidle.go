@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// stopIdleCmd represents the stop-idle command
+var stopIdleCmd = &cobra.Command{
+	Use:   "stop-idle",
+	Short: "Stop the instances of deployments that have been idle",
+	Long: `Stop the running instance of every deployment with an idle policy whose CPU
+utilization and network traffic stayed below the thresholds of the policy for
+its lookback, according to CloudWatch. The reason, e.g. "idle 2h", is shown on
+the deployment until it is started again.
+
+Like reap, stop-idle talks to DynamoDB, EC2 and CloudWatch directly with the
+AWS credentials in the environment. The Lambda function runs it when invoked
+with the event {"job": "stop-idle"}.`,
+	Example:      `  turbo-deploy stop-idle --dry-run`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		srv, err := newJobServer(cmd)
+		if err != nil {
+			return err
+		}
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		report, runErr := srv.StopIdle(cmd.Context(), dryRun)
+
+		err = printOutput(cmd.OutOrStdout(), outputFormat, report, func() table {
+			t := table{header: []string{"DEPLOYMENT", "INSTANCE", "HOSTNAME", "PEAK CPU", "PEAK NETWORK", "REASON", "RESULT"}}
+			for _, s := range report.Stopped {
+				result := "stopped"
+				switch {
+				case s.Error != "":
+					result = s.Error
+				case report.DryRun:
+					result = "would be stopped"
+				}
+				t.rows = append(t.rows, []string{
+					s.DeploymentID,
+					s.InstanceID,
+					orDash(s.Hostname),
+					fmt.Sprintf("%.1f%%", s.Utilization.CPUPercent),
+					fmt.Sprintf("%.0f B/s", s.Utilization.NetworkBytesPerSecond),
+					s.Reason,
+					result,
+				})
+			}
+			return t
+		})
+		if runErr != nil {
+			return runErr
+		}
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(stopIdleCmd)
+
+	stopIdleCmd.Flags().Bool("dry-run", false, "list the idle instances without stopping them")
+	stopIdleCmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "output format (table, json or yaml)")
+}
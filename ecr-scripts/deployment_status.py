@@ -0,0 +1,206 @@
+"""Moves deployment records through their lifecycle status around a
+Terraform apply, see DeploymentStatus in server/models/models.go.
+
+    deployment_status.py changed EVENTFILE
+        exits with status 1 if the DynamoDB stream event in EVENTFILE holds
+        nothing to apply, only writes of this script
+    deployment_status.py start [--retry-failed]
+        requested deployments are provisioning, failed ones too with
+        --retry-failed
+    deployment_status.py success
+        provisioning deployments are running, deleting ones deleted, and
+        deleted ones are removed a day later
+    deployment_status.py failure LOGFILE
+        provisioning deployments failed, deleting ones stay deleting to be
+        retried, both with the errors in LOGFILE as their lastError
+
+Failed deployments are only retried when they are edited, which makes them
+requested again, or by a scheduled run with --retry-failed. Retrying them on
+every stream event would apply them again and again, as recording the failure
+is itself a change to the table.
+
+start saves the statuses it leaves behind to SNAPSHOT, and success and
+failure only move deployments whose status is unchanged since, so one edited
+or deleted through the API during the apply is left for the next one.
+"""
+import json
+import os
+import re
+import sys
+import time
+
+import boto3
+from botocore.exceptions import ClientError
+
+table_name = "http_crud_backend"
+
+# deleted records are kept this long so users can see what became of them
+deleted_retention = 24 * 60 * 60
+
+# lastError is cut to this many characters
+max_error_length = 2000
+
+# statuses of the deployments when the apply started
+snapshot_file = "/tmp/deployment_status.json"
+
+# attributes written by this script, changes to them alone need no apply
+status_attributes = ("status", "statusChangedAt", "lastError", "lastErrorAt")
+
+
+def scan(table):
+    kwargs = {}
+    while True:
+        response = table.scan(**kwargs)
+        yield from response["Items"]
+        if "LastEvaluatedKey" not in response:
+            return
+        kwargs["ExclusiveStartKey"] = response["LastEvaluatedKey"]
+
+
+def set_status(table, item, status, now, error=""):
+    update = "SET #status = :status, statusChangedAt = :now"
+    values = {":status": status, ":now": now, ":previous": item["status"]}
+    if error:
+        update += ", lastError = :error, lastErrorAt = :now"
+        values[":error"] = error
+    try:
+        table.update_item(
+            Key={"id": item["id"]},
+            UpdateExpression=update,
+            ConditionExpression="#status = :previous",
+            ExpressionAttributeNames={"#status": "status"},
+            ExpressionAttributeValues=values,
+        )
+    except ClientError as e:
+        if e.response["Error"]["Code"] != "ConditionalCheckFailedException":
+            raise
+        print(f"deployment {item['id']} changed during the apply, left as is")
+        return
+    print(f"deployment {item['id']}: {item['status']} -> {status}")
+
+
+def remove(table, item):
+    try:
+        table.delete_item(
+            Key={"id": item["id"]},
+            ConditionExpression="#status = :deleted",
+            ExpressionAttributeNames={"#status": "status"},
+            ExpressionAttributeValues={":deleted": "deleted"},
+        )
+    except ClientError as e:
+        if e.response["Error"]["Code"] != "ConditionalCheckFailedException":
+            raise
+        return
+    print(f"deployment {item['id']}: removed")
+
+
+def errors_by_deployment(log):
+    """Returns the Terraform errors in log by the deployment ID of the
+    resource they are reported for, errors of no deployment under None."""
+    errors = {}
+    for block in re.split(r"\n(?=Error: )", log):
+        if not block.startswith("Error: "):
+            continue
+        message = block.splitlines()[0].removeprefix("Error: ").strip()
+        resource = re.search(r'with [\w.]+\["([^"]+)"\]', block)
+        errors.setdefault(resource.group(1) if resource else None, []).append(message)
+    return errors
+
+
+def needs_apply(record):
+    """Reports whether a DynamoDB stream record changed anything but the
+    attributes written by this script. Without the old image, as with the
+    NEW_IMAGE stream view type, only changes to requested and deleting are
+    told apart."""
+    if record.get("eventName") != "MODIFY":
+        return True
+    change = record.get("dynamodb", {})
+    old, new = change.get("OldImage"), change.get("NewImage", {})
+    if old is None:
+        return new.get("status", {}).get("S") in ("requested", "deleting")
+
+    def strip(image):
+        return {k: v for k, v in image.items() if k not in status_attributes}
+
+    return strip(old) != strip(new) or (
+        old.get("status") != new.get("status")
+        and new.get("status", {}).get("S") in ("requested", "deleting")
+    )
+
+
+def changed(event_file):
+    with open(event_file) as f:
+        event = json.load(f)
+    records = event.get("Records")
+    # scheduled and manual invocations always apply
+    if not records or records[0].get("eventSource") != "aws:dynamodb":
+        return True
+    return any(needs_apply(record) for record in records)
+
+
+def main():
+    usage = "usage: deployment_status.py changed EVENTFILE | start [--retry-failed] | success | failure LOGFILE"
+    if len(sys.argv) < 2 or sys.argv[1] not in ("changed", "start", "success", "failure"):
+        sys.exit(usage)
+    step = sys.argv[1]
+
+    if step == "changed":
+        if len(sys.argv) < 3:
+            sys.exit(usage)
+        sys.exit(0 if changed(sys.argv[2]) else 1)
+    retry_failed = "--retry-failed" in sys.argv[2:]
+
+    region = os.environ.get("AWS_REGION_CUSTOM", "us-east-1")
+    table = boto3.resource("dynamodb", region_name=region).Table(table_name)
+    now = int(time.time())
+
+    snapshot = {}
+    if step != "start":
+        with open(snapshot_file) as f:
+            snapshot = json.load(f)
+
+    errors = {}
+    if step == "failure":
+        with open(sys.argv[2]) as f:
+            log = f.read()
+        errors = errors_by_deployment(log)
+        if not errors:
+            errors[None] = ["\n".join(log.strip().splitlines()[-5:])]
+
+    seen = {}
+    for item in scan(table):
+        # records created before statuses were kept have none
+        if "status" not in item:
+            continue
+        status = item["status"]
+        if step != "start" and status != "deleted" and snapshot.get(item["id"]) != status:
+            continue
+
+        if step == "start":
+            seen[item["id"]] = status
+            if status == "requested" or (retry_failed and status == "failed"):
+                set_status(table, item, "provisioning", now)
+                seen[item["id"]] = "provisioning"
+        elif step == "success" and status == "provisioning":
+            set_status(table, item, "running", now)
+        elif step == "success" and status == "deleting":
+            set_status(table, item, "deleted", now)
+        elif step == "success" and status == "deleted":
+            if now - int(item.get("statusChangedAt", 0)) >= deleted_retention:
+                remove(table, item)
+        elif step == "failure" and status in ("provisioning", "deleting"):
+            messages = errors.get(item["id"]) or errors.get(None) or ["Terraform apply failed, see the provisioner logs"]
+            error = "\n".join(messages)[:max_error_length]
+            if status == "provisioning":
+                set_status(table, item, "failed", now, error)
+            elif item.get("lastError") != error:
+                # deleting ones keep their status, only a new error is written
+                set_status(table, item, "deleting", now, error)
+
+    if step == "start":
+        with open(snapshot_file, "w") as f:
+            json.dump(seen, f)
+
+
+if __name__ == "__main__":
+    main()
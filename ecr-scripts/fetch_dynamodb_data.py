@@ -23,8 +23,13 @@ table = dynamodb.Table(table_name)
 
 response = table.scan()
 
-# Convert items to a map with string keys and string values
-items_map = {item["id"]: json.dumps(item, default=default) for item in response['Items']}
+# Convert items to a map with string keys and string values, leaving out
+# deleted deployments so that their resources are destroyed
+items_map = {
+    item["id"]: json.dumps(item, default=default)
+    for item in response['Items']
+    if item.get("status") not in ("deleting", "deleted")
+}
 
 # Output the JSON encoded map
 print(json.dumps(items_map))
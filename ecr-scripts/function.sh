@@ -1,6 +1,7 @@
 #!/bin/bash
 
 function handler() {
+    local event="${1:-}"
     echo "Starting script execution."
 
     VENV_PATH="/tmp/venv"
@@ -27,6 +28,23 @@ function handler() {
     # Use envsubst to replace variables in the template and save it as main.tf
     envsubst < "$TEMPLATES_DIR/main.tf.tpl" > main.tf
 
+    # stream events of status changes alone come from the previous run
+    echo "$event" > /tmp/event.json
+    if ! python "$TF_WORKING_DIR/deployment_status.py" changed /tmp/event.json; then
+        echo "Only deployment statuses changed, nothing to apply."
+        echo '{"statusCode":200,"body":"Nothing to apply"}'
+        return 0
+    fi
+
+    # failed deployments are retried by scheduled runs, not by stream events
+    local retry_failed=""
+    if ! grep -q '"aws:dynamodb"' /tmp/event.json; then
+        retry_failed="--retry-failed"
+    fi
+
+    echo "Marking requested deployments as provisioning."
+    python "$TF_WORKING_DIR/deployment_status.py" start $retry_failed
+
     echo "Initializing Terraform."
     terraform init -input=false -no-color
 
@@ -34,6 +52,14 @@ function handler() {
     terraform apply -input=false -auto-approve -no-color 2>&1 | tee /tmp/tf_output.log
     tf_exit_code=${PIPESTATUS[0]}
 
+    if [ $tf_exit_code -eq 0 ]; then
+        echo "Recording the provisioned and deleted deployments."
+        python "$TF_WORKING_DIR/deployment_status.py" success
+    else
+        echo "Recording the failure on the deployments."
+        python "$TF_WORKING_DIR/deployment_status.py" failure /tmp/tf_output.log
+    fi
+
     local sns_topic_arn="${SNS_TOPIC_ARN:-}"
     if [ -n "$sns_topic_arn" ] && [ $tf_exit_code -ne 0 ]; then
         echo "Terraform apply failed. Sending notification to SNS."
@@ -22,17 +22,30 @@ THE SOFTWARE.
 package main
 
 import (
+	"context"
+	"log"
 	"os"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/frgrisk/turbo-deploy/cmd"
 	"github.com/frgrisk/turbo-deploy/server"
+	"github.com/frgrisk/turbo-deploy/server/config"
+	"github.com/spf13/viper"
 )
 
 func main() {
 	lambdaRuntime := os.Getenv("MY_CUSTOM_ENV")
 	if lambdaRuntime != "" {
-		lambda.Start(server.Handler)
+		cmd.InitConfig()
+		cfg, err := config.Load(viper.GetViper())
+		if err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+		srv, err := server.NewFromConfig(context.Background(), cfg)
+		if err != nil {
+			log.Fatalf("Failed to initialize server: %v", err)
+		}
+		lambda.Start(srv.Handler)
 	}
 	cmd.Execute()
 }
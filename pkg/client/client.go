@@ -0,0 +1,465 @@
+// Package client is a Go client for the turbo-deploy REST API.
+//
+//	c, err := client.New("https://api.turbo.example.com/dev")
+//	if err != nil {
+//		return err
+//	}
+//	deployment, err := c.CreateDeployment(ctx, models.DeploymentRequest{...})
+//	if errors.Is(err, client.ErrHostnameExists) {
+//		...
+//	}
+//
+// The client talks to the versioned /v1 routes. Failed requests return an
+// *APIError carrying the error code, message and request ID reported by the
+// server.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+const (
+	defaultMaxRetries = 3
+	defaultBackoff    = 500 * time.Millisecond
+	maxBackoff        = 10 * time.Second
+	defaultUserAgent  = "turbo-deploy-go-client"
+)
+
+// Client calls the turbo-deploy API. It is safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	maxRetries int
+	backoff    time.Duration
+	header     http.Header
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used to send requests.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetries sets how many times a failed request is retried. Zero disables
+// retries.
+func WithRetries(maxRetries int) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+	}
+}
+
+// WithBackoff sets the delay before the first retry. It doubles on every
+// further retry.
+func WithBackoff(backoff time.Duration) Option {
+	return func(c *Client) {
+		c.backoff = backoff
+	}
+}
+
+// WithHeader adds a header to every request, e.g. for authentication.
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		c.header.Add(key, value)
+	}
+}
+
+// WithBearerToken authenticates every request with token, a JWT issued by the
+// identity provider the server is configured with or an API key.
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// New returns a Client for the API served at baseURL, including the API
+// Gateway stage if there is one.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL %q: %w", baseURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL %q: scheme must be http or https", baseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	c := &Client{
+		baseURL:    u,
+		httpClient: http.DefaultClient,
+		maxRetries: defaultMaxRetries,
+		backoff:    defaultBackoff,
+		header:     make(http.Header),
+	}
+	c.header.Set("User-Agent", defaultUserAgent)
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
+}
+
+// ListDeployments returns every deployment with its instance.
+func (c *Client) ListDeployments(ctx context.Context) ([]models.Deployment, error) {
+	var list models.DeploymentList
+	if err := c.do(ctx, http.MethodGet, "/v1/deployments", nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Deployments, nil
+}
+
+// GetDeployment returns a deployment.
+func (c *Client) GetDeployment(ctx context.Context, id string) (*models.Deployment, error) {
+	var deployment models.Deployment
+	if err := c.do(ctx, http.MethodGet, "/v1/deployments/"+url.PathEscape(id), nil, &deployment); err != nil {
+		return nil, err
+	}
+	return &deployment, nil
+}
+
+// CreateDeployment requests a new deployment. The instance is launched
+// asynchronously, so the returned deployment has no instance yet.
+func (c *Client) CreateDeployment(ctx context.Context, req models.DeploymentRequest) (*models.Deployment, error) {
+	var deployment models.Deployment
+	if err := c.do(ctx, http.MethodPost, "/v1/deployments", req, &deployment); err != nil {
+		return nil, err
+	}
+	return &deployment, nil
+}
+
+// UpdateDeployment replaces the settings of a deployment.
+func (c *Client) UpdateDeployment(ctx context.Context, id string, req models.DeploymentRequest) (*models.Deployment, error) {
+	var deployment models.Deployment
+	if err := c.do(ctx, http.MethodPut, "/v1/deployments/"+url.PathEscape(id), req, &deployment); err != nil {
+		return nil, err
+	}
+	return &deployment, nil
+}
+
+// DeleteDeployment deletes a deployment, which terminates its instance.
+func (c *Client) DeleteDeployment(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/deployments/"+url.PathEscape(id), nil, nil)
+}
+
+// StartDeployment starts the instance of a deployment. It returns before the
+// instance is running.
+func (c *Client) StartDeployment(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/v1/deployments/"+url.PathEscape(id)+"/actions/start", nil, nil)
+}
+
+// StopDeployment stops the instance of a deployment. It returns before the
+// instance is stopped.
+func (c *Client) StopDeployment(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/v1/deployments/"+url.PathEscape(id)+"/actions/stop", nil, nil)
+}
+
+// ExtendDeployment moves the expiry of a deployment by a duration or to a
+// time, see models.ExtendRequest.
+func (c *Client) ExtendDeployment(ctx context.Context, id string, req models.ExtendRequest) (*models.Expiry, error) {
+	var expiry models.Expiry
+	if err := c.do(ctx, http.MethodPost, "/v1/deployments/"+url.PathEscape(id)+"/actions/extend", req, &expiry); err != nil {
+		return nil, err
+	}
+	return &expiry, nil
+}
+
+// SetSchedule puts a deployment on an office-hours schedule, replacing the
+// one it has.
+func (c *Client) SetSchedule(ctx context.Context, id string, schedule models.Schedule) (*models.Deployment, error) {
+	var deployment models.Deployment
+	if err := c.do(ctx, http.MethodPut, "/v1/deployments/"+url.PathEscape(id)+"/schedule", schedule, &deployment); err != nil {
+		return nil, err
+	}
+	return &deployment, nil
+}
+
+// DeleteSchedule removes the schedule of a deployment.
+func (c *Client) DeleteSchedule(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/deployments/"+url.PathEscape(id)+"/schedule", nil, nil)
+}
+
+// SuspendSchedule keeps the scheduler away from a deployment until until.
+func (c *Client) SuspendSchedule(ctx context.Context, id string, until time.Time) (*models.Deployment, error) {
+	var deployment models.Deployment
+	req := models.ScheduleOverride{Until: until}
+	if err := c.do(ctx, http.MethodPut, "/v1/deployments/"+url.PathEscape(id)+"/schedule/override", req, &deployment); err != nil {
+		return nil, err
+	}
+	return &deployment, nil
+}
+
+// ResumeSchedule ends the override of a deployment's schedule.
+func (c *Client) ResumeSchedule(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/deployments/"+url.PathEscape(id)+"/schedule/override", nil, nil)
+}
+
+// SetIdlePolicy gives a deployment an idle policy, replacing the one it has.
+func (c *Client) SetIdlePolicy(ctx context.Context, id string, policy models.IdlePolicy) (*models.Deployment, error) {
+	var deployment models.Deployment
+	if err := c.do(ctx, http.MethodPut, "/v1/deployments/"+url.PathEscape(id)+"/idle-policy", policy, &deployment); err != nil {
+		return nil, err
+	}
+	return &deployment, nil
+}
+
+// DeleteIdlePolicy removes the idle policy of a deployment.
+func (c *Client) DeleteIdlePolicy(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/deployments/"+url.PathEscape(id)+"/idle-policy", nil, nil)
+}
+
+// ListSnapshots returns the snapshots of a deployment, newest first.
+func (c *Client) ListSnapshots(ctx context.Context, id string) (*models.SnapshotList, error) {
+	var list models.SnapshotList
+	if err := c.do(ctx, http.MethodGet, "/v1/deployments/"+url.PathEscape(id)+"/snapshots", nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// CreateSnapshot captures a snapshot of a deployment's instance. The snapshot
+// is pending until AWS has finished creating the image.
+func (c *Client) CreateSnapshot(ctx context.Context, id string) (*models.Snapshot, error) {
+	var snapshot models.Snapshot
+	if err := c.do(ctx, http.MethodPost, "/v1/deployments/"+url.PathEscape(id)+"/snapshots", nil, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// GetSnapshot returns a snapshot of a deployment.
+func (c *Client) GetSnapshot(ctx context.Context, id, snapshotID string) (*models.Snapshot, error) {
+	var snapshot models.Snapshot
+	path := "/v1/deployments/" + url.PathEscape(id) + "/snapshots/" + url.PathEscape(snapshotID)
+	if err := c.do(ctx, http.MethodGet, path, nil, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// DeleteSnapshot deletes a snapshot of a deployment.
+func (c *Client) DeleteSnapshot(ctx context.Context, id, snapshotID string) error {
+	path := "/v1/deployments/" + url.PathEscape(id) + "/snapshots/" + url.PathEscape(snapshotID)
+	return c.do(ctx, http.MethodDelete, path, nil, nil)
+}
+
+// Catalog returns the AMIs, server sizes and user-data scripts deployments can
+// use, the same data the legacy /awsdata route serves.
+func (c *Client) Catalog(ctx context.Context) (*models.Config, error) {
+	var catalog models.Config
+	if err := c.do(ctx, http.MethodGet, "/v1/catalog", nil, &catalog); err != nil {
+		return nil, err
+	}
+	return &catalog, nil
+}
+
+// ListAPIKeys returns the API keys of the caller. Admins get every key, or
+// those of user if it is not empty.
+func (c *Client) ListAPIKeys(ctx context.Context, user string) ([]models.APIKey, error) {
+	path := "/v1/apikeys"
+	if user != "" {
+		path += "?user=" + url.QueryEscape(user)
+	}
+
+	var list models.APIKeyList
+	if err := c.do(ctx, http.MethodGet, path, nil, &list); err != nil {
+		return nil, err
+	}
+	return list.APIKeys, nil
+}
+
+// CreateAPIKey creates an API key. The returned Key is the only copy of the
+// secret, the server only keeps its hash.
+func (c *Client) CreateAPIKey(ctx context.Context, req models.APIKeyRequest) (*models.CreatedAPIKey, error) {
+	var key models.CreatedAPIKey
+	if err := c.do(ctx, http.MethodPost, "/v1/apikeys", req, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// RevokeAPIKey revokes an API key, it can no longer be used to authenticate.
+func (c *Client) RevokeAPIKey(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/apikeys/"+url.PathEscape(id), nil, nil)
+}
+
+// GetQuota returns the quota limits and usage of the caller, or of user if it
+// is not empty, which requires an admin.
+func (c *Client) GetQuota(ctx context.Context, user string) (*models.Quota, error) {
+	path := "/v1/quota"
+	if user != "" {
+		path += "?user=" + url.QueryEscape(user)
+	}
+
+	var quota models.Quota
+	if err := c.do(ctx, http.MethodGet, path, nil, &quota); err != nil {
+		return nil, err
+	}
+	return &quota, nil
+}
+
+// CostSummary returns the estimated cost of all deployments by user.
+func (c *Client) CostSummary(ctx context.Context) (*models.CostSummary, error) {
+	var summary models.CostSummary
+	if err := c.do(ctx, http.MethodGet, "/v1/costs", nil, &summary); err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+// EstimateCost estimates what a deployment request would cost, without
+// creating it.
+func (c *Client) EstimateCost(ctx context.Context, req models.DeploymentRequest) (*models.CostEstimate, error) {
+	var estimate models.CostEstimate
+	if err := c.do(ctx, http.MethodPost, "/v1/costs/estimate", req, &estimate); err != nil {
+		return nil, err
+	}
+	return &estimate, nil
+}
+
+// DriftReport lists where the deployment records and the EC2 instances
+// disagree. Only admins may call it.
+func (c *Client) DriftReport(ctx context.Context) (*models.DriftReport, error) {
+	var report models.DriftReport
+	if err := c.do(ctx, http.MethodGet, "/v1/admin/drift", nil, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// do sends a request with body encoded as JSON and decodes the response into
+// out. Failed attempts are retried with exponential backoff when it is safe
+// to do so.
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("encoding request: %w", err)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, path, payload)
+
+		var retryAfter time.Duration
+		switch {
+		case err != nil:
+			// the request may have reached the server, only idempotent
+			// requests are sent again
+			if ctx.Err() != nil || !idempotent(method) || attempt >= c.maxRetries {
+				return err
+			}
+		case resp.StatusCode < http.StatusBadRequest:
+			return decodeResponse(resp, out)
+		default:
+			apiErr := readAPIError(resp)
+			if !c.retryable(method, resp.StatusCode) || attempt >= c.maxRetries {
+				return apiErr
+			}
+			retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		}
+
+		if err := c.wait(ctx, attempt, retryAfter); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, path string, payload []byte) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL.String()+path, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range c.header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return c.httpClient.Do(req)
+}
+
+// retryable reports whether a request that failed with status may be sent
+// again. Throttled requests were rejected before doing anything, so they are
+// retried whatever the method.
+func (c *Client) retryable(method string, status int) bool {
+	switch status {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent(method)
+	default:
+		return false
+	}
+}
+
+// wait sleeps before retry number attempt+1, for at least retryAfter.
+func (c *Client) wait(ctx context.Context, attempt int, retryAfter time.Duration) error {
+	delay := c.backoff << attempt
+	if delay <= 0 || delay > maxBackoff {
+		delay = maxBackoff
+	}
+	// add up to 50% jitter so concurrent clients spread out
+	delay += time.Duration(rand.Int64N(int64(delay)/2 + 1)) //nolint:gosec // jitter needs no secure randomness
+	delay = max(delay, retryAfter)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func idempotent(method string) bool {
+	return method != http.MethodPost && method != http.MethodPatch
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+func decodeResponse(resp *http.Response, out any) error {
+	defer resp.Body.Close()
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		_, err := io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
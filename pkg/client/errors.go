@@ -0,0 +1,96 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+// APIError is returned when the server responds with an error.
+type APIError struct {
+	StatusCode int
+	Code       models.ErrorCode
+	Message    string
+	RequestID  string
+	Details    []models.FieldError
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "turbo-deploy: %s (%d", e.Message, e.StatusCode)
+	if e.Code != "" {
+		fmt.Fprintf(&b, " %s", e.Code)
+	}
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, ", request %s", e.RequestID)
+	}
+	b.WriteString(")")
+	for _, detail := range e.Details {
+		fmt.Fprintf(&b, "\n  %s: %s", detail.Field, detail.Message)
+	}
+	return b.String()
+}
+
+// Is makes errors.Is match an APIError against the sentinel errors below by
+// error code.
+func (e *APIError) Is(target error) bool {
+	var sentinel *APIError
+	if !errors.As(target, &sentinel) {
+		return false
+	}
+	return sentinel.StatusCode == 0 && sentinel.Code != "" && sentinel.Code == e.Code
+}
+
+// Sentinel errors for use with errors.Is, one per error code of the API.
+var (
+	ErrInvalidRequest   = &APIError{Code: models.ErrCodeInvalidRequest, Message: "invalid request"}
+	ErrValidationFailed = &APIError{Code: models.ErrCodeValidationFailed, Message: "validation failed"}
+	ErrUnauthorized     = &APIError{Code: models.ErrCodeUnauthorized, Message: "unauthorized"}
+	ErrForbidden        = &APIError{Code: models.ErrCodeForbidden, Message: "forbidden"}
+	ErrNotFound         = &APIError{Code: models.ErrCodeNotFound, Message: "not found"}
+	ErrHostnameExists   = &APIError{Code: models.ErrCodeHostnameExists, Message: "hostname exists"}
+	ErrConflict         = &APIError{Code: models.ErrCodeConflict, Message: "conflict"}
+	ErrQuotaExceeded    = &APIError{Code: models.ErrCodeQuotaExceeded, Message: "quota exceeded"}
+	ErrThrottled        = &APIError{Code: models.ErrCodeThrottled, Message: "throttled"}
+	ErrAWSUnauthorized  = &APIError{Code: models.ErrCodeAWSUnauthorized, Message: "AWS operation not permitted"}
+	ErrAWSError         = &APIError{Code: models.ErrCodeAWSError, Message: "AWS error"}
+	ErrInternal         = &APIError{Code: models.ErrCodeInternal, Message: "internal error"}
+)
+
+// maxErrorBody bounds how much of an error response is read.
+const maxErrorBody = 64 << 10
+
+// readAPIError builds an APIError from an error response. Responses that are
+// not an error envelope, e.g. from a proxy in front of the API, keep the
+// status and use the body as message.
+func readAPIError(resp *http.Response) *APIError {
+	defer resp.Body.Close()
+
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get("X-Request-ID"),
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	var envelope models.ErrorResponse
+	if err := json.Unmarshal(body, &envelope); err == nil && envelope.Code != "" {
+		apiErr.Code = envelope.Code
+		apiErr.Message = envelope.Message
+		apiErr.Details = envelope.Details
+		if envelope.RequestID != "" {
+			apiErr.RequestID = envelope.RequestID
+		}
+		return apiErr
+	}
+
+	apiErr.Message = strings.TrimSpace(string(body))
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	return apiErr
+}
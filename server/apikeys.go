@@ -0,0 +1,134 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/auth"
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/frgrisk/turbo-deploy/server/validate"
+	"github.com/gin-gonic/gin"
+)
+
+const apiKeyParameterName = "key_id"
+
+// ListAPIKeys lists the API keys of the caller. Admins see every key, or
+// those of the user in the user query parameter.
+func (s *Server) ListAPIKeys(c *gin.Context) {
+	identity, _ := auth.FromContext(c.Request.Context())
+
+	user := identity.User
+	if s.policy.IsAdmin(identity) {
+		user = c.Query("user")
+	}
+
+	records, err := s.apiKeys.ListAPIKeys(c.Request.Context(), user)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	keys := make([]models.APIKey, 0, len(records))
+	for _, record := range records {
+		keys = append(keys, apiKeyFromRecord(record))
+	}
+	c.JSON(http.StatusOK, models.APIKeyList{APIKeys: keys})
+}
+
+// CreateAPIKey issues an API key. The key itself is only part of this
+// response, the store keeps the hash of its secret.
+func (s *Server) CreateAPIKey(c *gin.Context) {
+	var req models.APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, badRequest(err))
+		return
+	}
+
+	now := time.Now()
+	if details := validate.APIKeyRequest(req, now); len(details) > 0 {
+		respondWithError(c, &apiError{
+			status:  http.StatusBadRequest,
+			code:    models.ErrCodeValidationFailed,
+			message: "Invalid API key request",
+			details: details,
+		})
+		return
+	}
+
+	identity, _ := auth.FromContext(c.Request.Context())
+	user := strings.TrimSpace(req.User)
+	switch {
+	case user == "":
+		user = identity.User
+	case !strings.EqualFold(user, identity.User) && !s.policy.IsAdmin(identity):
+		respondWithError(c, newAPIError(http.StatusForbidden, models.ErrCodeForbidden, "Only admins may create API keys for other users"))
+		return
+	}
+
+	id, key, secretHash, err := auth.NewAPIKey()
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	record := models.APIKeyRecord{
+		ID:          id,
+		Name:        strings.TrimSpace(req.Name),
+		User:        user,
+		Permissions: req.Permissions,
+		SecretHash:  secretHash,
+		CreatedBy:   identity.User,
+		CreatedAt:   now.Unix(),
+		ExpiresAt:   req.ExpiresAt,
+	}
+	if err := s.apiKeys.SaveAPIKey(c.Request.Context(), record); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.CreatedAPIKey{APIKey: apiKeyFromRecord(record), Key: key})
+}
+
+// RevokeAPIKey revokes an API key of the caller, admins may revoke any key.
+// Revoked keys are kept so they still show up in the list.
+func (s *Server) RevokeAPIKey(c *gin.Context) {
+	ctx := c.Request.Context()
+	identity, _ := auth.FromContext(ctx)
+
+	record, err := s.apiKeys.GetAPIKey(ctx, c.Param(apiKeyParameterName))
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	if !strings.EqualFold(record.User, identity.User) && !s.policy.IsAdmin(identity) {
+		respondWithError(c, newAPIError(http.StatusForbidden, models.ErrCodeForbidden, "You may not revoke API key %s", record.ID))
+		return
+	}
+
+	if record.RevokedAt == 0 {
+		if err := s.apiKeys.RevokeAPIKey(ctx, record.ID, time.Now().Unix()); err != nil {
+			respondWithError(c, err)
+			return
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func apiKeyFromRecord(record models.APIKeyRecord) models.APIKey {
+	permissions := record.Permissions
+	if permissions == nil {
+		permissions = []models.Permission{}
+	}
+	return models.APIKey{
+		ID:          record.ID,
+		Name:        record.Name,
+		User:        record.User,
+		Permissions: permissions,
+		CreatedBy:   record.CreatedBy,
+		CreatedAt:   record.CreatedAt,
+		ExpiresAt:   record.ExpiresAt,
+		RevokedAt:   record.RevokedAt,
+	}
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/auth"
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	auditContextKey     = "audit"
+	errorCodeContextKey = "errorCode"
+
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// auditEntry collects what the handler of a mutating route learns about the
+// resources it touches.
+type auditEntry struct {
+	deploymentID string
+	instanceID   string
+	imageID      string
+	// actor is recorded for calls that are not authenticated, e.g. the
+	// user an extend link was sent to.
+	actor string
+	// compare is set when the deployment request is compared before and
+	// after the call. before is nil for deployments that did not exist.
+	compare bool
+	before  *models.DynamoDBData
+}
+
+// noteAudit returns the audit entry of the request, handlers fill in the
+// resources they resolve. Requests that are not audited get a throwaway
+// entry.
+func noteAudit(c *gin.Context) *auditEntry {
+	if entry, ok := c.Get(auditContextKey); ok {
+		return entry.(*auditEntry)
+	}
+	return &auditEntry{}
+}
+
+// noteCreated records that the request created deployment id, so all of its
+// fields are audited as changed.
+func noteCreated(c *gin.Context, id string) {
+	entry := noteAudit(c)
+	entry.deploymentID = id
+	entry.compare = true
+	entry.before = nil
+}
+
+// auditRoute writes an audit event for every call of route, whether it
+// succeeds or not. It runs before authorization so refused calls are
+// recorded too.
+func (s *Server) auditRoute(route route) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		started := time.Now().UTC()
+
+		entry := &auditEntry{}
+		if route.instanceParam != "" {
+			entry.instanceID = c.Param(route.instanceParam)
+		} else if id := c.Param(pathParameterName); id != "" {
+			entry.deploymentID = id
+			entry.compare = true
+			entry.before, _ = s.store.GetRecord(ctx, id)
+		}
+		c.Set(auditContextKey, entry)
+
+		c.Next()
+
+		event := models.AuditEvent{
+			ID:            uuid.New().String(),
+			Time:          started,
+			RequestID:     c.GetString(requestIDContextKey),
+			CorrelationID: c.GetString(correlationIDContextKey),
+			SourceIP:      c.ClientIP(),
+			Action:        route.OperationID,
+			Method:        c.Request.Method,
+			Path:          c.Request.URL.Path,
+			DeploymentID:  entry.deploymentID,
+			InstanceID:    entry.instanceID,
+			ImageID:       entry.imageID,
+			Status:        c.Writer.Status(),
+			Result:        auditResult(c.Writer.Status()),
+		}
+		if identity, ok := auth.FromContext(ctx); ok {
+			event.Actor = identity.User
+			event.APIKeyID = identity.APIKeyID
+		} else {
+			event.Actor = entry.actor
+		}
+		if code, ok := c.Get(errorCodeContextKey); ok {
+			event.ErrorCode = code.(models.ErrorCode)
+		}
+		if entry.compare && event.Result == models.AuditSuccess {
+			after, _ := s.store.GetRecord(ctx, entry.deploymentID)
+			event.Changes = recordChanges(entry.before, after)
+		}
+
+		// the response is already written, a lost event can only be logged
+		if err := s.audit.RecordEvent(context.WithoutCancel(ctx), event); err != nil {
+			log.Printf("request %s: failed to record audit event %+v: %v", event.RequestID, event, err)
+		}
+	}
+}
+
+func auditResult(status int) models.AuditResult {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return models.AuditDenied
+	case status >= http.StatusBadRequest:
+		return models.AuditFailure
+	default:
+		return models.AuditSuccess
+	}
+}
+
+// recordChanges lists the fields that differ between two versions of a
+// deployment request, either of which may be nil.
+func recordChanges(before, after *models.DynamoDBData) []models.AuditChange {
+	var beforeValue, afterValue reflect.Value
+	if before != nil {
+		beforeValue = reflect.ValueOf(*before)
+	}
+	if after != nil {
+		afterValue = reflect.ValueOf(*after)
+	}
+
+	var changes []models.AuditChange
+	t := reflect.TypeFor[models.DynamoDBData]()
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("dynamodbav"), ",")
+		if name == db.IDDynamoDBAttributename {
+			continue
+		}
+
+		oldValue, newValue := auditValue(beforeValue, i), auditValue(afterValue, i)
+		if oldValue != newValue {
+			changes = append(changes, models.AuditChange{Field: name, Before: oldValue, After: newValue})
+		}
+	}
+	return changes
+}
+
+// auditValue formats field i of the struct v, or returns "" if v is not
+// valid.
+func auditValue(v reflect.Value, i int) string {
+	if !v.IsValid() {
+		return ""
+	}
+
+	field := v.Field(i)
+	switch field.Kind() {
+	case reflect.String:
+		return field.String()
+	case reflect.Int64:
+		if field.Int() == 0 {
+			return ""
+		}
+		return strconv.FormatInt(field.Int(), 10)
+	case reflect.Slice:
+		values := make([]string, 0, field.Len())
+		for j := range field.Len() {
+			values = append(values, fmt.Sprint(field.Index(j).Interface()))
+		}
+		return strings.Join(values, ",")
+	default:
+		return fmt.Sprint(field.Interface())
+	}
+}
+
+// ListAuditEvents returns the audit log, newest first, filtered by the user,
+// deployment, from and to query parameters.
+func (s *Server) ListAuditEvents(c *gin.Context) {
+	filter := db.AuditFilter{
+		Actor:        c.Query("user"),
+		DeploymentID: c.Query("deployment"),
+		Limit:        defaultAuditLimit,
+	}
+
+	var details []models.FieldError
+	for _, param := range []struct {
+		name string
+		dest *time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			details = append(details, models.FieldError{Field: param.name, Message: param.name + " must be an RFC 3339 time, e.g. 2026-10-18T09:00:00Z"})
+			continue
+		}
+		*param.dest = parsed
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxAuditLimit {
+			details = append(details, models.FieldError{Field: "limit", Message: fmt.Sprintf("limit must be between 1 and %d", maxAuditLimit)})
+		}
+		filter.Limit = limit
+	}
+	if len(details) > 0 {
+		respondWithError(c, &apiError{
+			status:  http.StatusBadRequest,
+			code:    models.ErrCodeInvalidRequest,
+			message: "Invalid audit query",
+			details: details,
+		})
+		return
+	}
+
+	events, err := s.audit.ListEvents(c.Request.Context(), filter)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.AuditEventList{Events: events})
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+// APIKeyPrefix starts every API key, it tells keys apart from JWTs.
+const APIKeyPrefix = "td_"
+
+const (
+	apiKeyIDBytes     = 8
+	apiKeySecretBytes = 32
+)
+
+// NewAPIKey generates an API key. It returns the ID of the key, the key to
+// hand to the client and the hash of its secret to store.
+func NewAPIKey() (id, key, secretHash string, err error) {
+	idBytes := make([]byte, apiKeyIDBytes)
+	secret := make([]byte, apiKeySecretBytes)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	id = hex.EncodeToString(idBytes)
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+	return id, APIKeyPrefix + id + "_" + encoded, hashSecret(encoded), nil
+}
+
+// IsAPIKey reports whether token looks like an API key rather than a JWT.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// parseAPIKey splits key into the ID of its record and its secret.
+func parseAPIKey(key string) (id, secret string, ok bool) {
+	id, secret, ok = strings.Cut(strings.TrimPrefix(key, APIKeyPrefix), "_")
+	return id, secret, ok && id != "" && secret != ""
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeys authenticates callers by the API keys in store.
+type APIKeys struct {
+	store db.APIKeyStore
+	now   func() time.Time
+}
+
+// NewAPIKeys returns an Authenticator for the API keys in store.
+func NewAPIKeys(store db.APIKeyStore) *APIKeys {
+	return &APIKeys{store: store, now: time.Now}
+}
+
+func (k *APIKeys) Authenticate(r *http.Request) (*Identity, error) {
+	token, err := BearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+	return k.Verify(r.Context(), token)
+}
+
+// Verify checks key and returns the identity of its user, restricted to the
+// permissions of the key.
+func (k *APIKeys) Verify(ctx context.Context, key string) (*Identity, error) {
+	id, secret, ok := parseAPIKey(key)
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed API key", ErrUnauthenticated)
+	}
+
+	record, err := k.store.GetAPIKey(ctx, id)
+	switch {
+	case errors.Is(err, db.ErrAPIKeyNotFound):
+		return nil, fmt.Errorf("%w: unknown API key %s", ErrUnauthenticated, id)
+	case err != nil:
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(record.SecretHash)) != 1 {
+		return nil, fmt.Errorf("%w: wrong secret for API key %s", ErrUnauthenticated, id)
+	}
+	if record.RevokedAt > 0 {
+		return nil, fmt.Errorf("%w: API key %s was revoked", ErrUnauthenticated, id)
+	}
+	if record.ExpiresAt > 0 && k.now().Unix() >= record.ExpiresAt {
+		return nil, fmt.Errorf("%w: API key %s expired", ErrUnauthenticated, id)
+	}
+
+	permissions := record.Permissions
+	if permissions == nil {
+		permissions = []models.Permission{}
+	}
+	return &Identity{
+		Subject:     "apikey:" + id,
+		User:        record.User,
+		APIKeyID:    id,
+		Permissions: permissions,
+	}, nil
+}
+
+// withAPIKeys accepts API keys in addition to the bearer tokens accepted by
+// next.
+type withAPIKeys struct {
+	next    Authenticator
+	apiKeys *APIKeys
+}
+
+func (a *withAPIKeys) Authenticate(r *http.Request) (*Identity, error) {
+	token, err := BearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+	if IsAPIKey(token) {
+		return a.apiKeys.Verify(r.Context(), token)
+	}
+	return a.next.Authenticate(r)
+}
@@ -0,0 +1,114 @@
+// Package auth authenticates API callers from the bearer token they send.
+//
+// Tokens are JWTs, either issued by an OIDC provider and verified against its
+// JWKS, or signed with a static HMAC key for local testing. CI and automation
+// clients may send an API key instead. The identity of the caller is stored
+// in the request context, where handlers find it with FromContext.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/frgrisk/turbo-deploy/server/config"
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+const (
+	// ModeNone disables authentication, every caller is anonymous.
+	ModeNone = "none"
+	// ModeJWT requires a JWT bearer token on every API request.
+	ModeJWT = "jwt"
+)
+
+// ErrUnauthenticated is wrapped by every error returned for a request whose
+// caller could not be authenticated.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Identity is an authenticated caller.
+type Identity struct {
+	// Subject is the sub claim of the token, the caller's stable ID.
+	Subject string
+	// User is the name deployments are recorded under, taken from the
+	// configured user claim and falling back to Subject.
+	User string
+	// Groups are the groups the caller belongs to according to the
+	// configured groups claim.
+	Groups []string
+	// APIKeyID is the ID of the API key the caller authenticated with, it is
+	// empty for interactive callers.
+	APIKeyID string
+	// Permissions restrict what callers authenticated with an API key may
+	// do. Nil means unrestricted.
+	Permissions []models.Permission
+}
+
+// Allows reports whether the identity was granted permission.
+func (i *Identity) Allows(permission models.Permission) bool {
+	return i.Permissions == nil || slices.Contains(i.Permissions, permission)
+}
+
+// Authenticator establishes the identity of the caller of a request.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// FromConfig returns the Authenticator configured by cfg, or nil when
+// authentication is disabled. The API keys in apiKeys are accepted alongside
+// JWTs unless it is nil.
+func FromConfig(cfg config.AuthConfig, apiKeys db.APIKeyStore) Authenticator {
+	if cfg.Mode != ModeJWT {
+		return nil
+	}
+
+	var keys KeySource
+	if cfg.HMACKey != "" {
+		keys = StaticKey([]byte(cfg.HMACKey))
+	} else {
+		keys = NewJWKS(cfg.JWKSURL, nil)
+	}
+
+	var authenticator Authenticator = NewVerifier(keys, VerifierOptions{
+		Issuer:      cfg.Issuer,
+		Audience:    cfg.Audience,
+		UserClaim:   cfg.UserClaim,
+		GroupsClaim: cfg.GroupsClaim,
+	})
+	if apiKeys != nil {
+		authenticator = &withAPIKeys{next: authenticator, apiKeys: NewAPIKeys(apiKeys)}
+	}
+	return authenticator
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying identity.
+func NewContext(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, identity)
+}
+
+// FromContext returns the identity stored in ctx, if any.
+func FromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(contextKey{}).(*Identity)
+	return identity, ok && identity != nil
+}
+
+// BearerToken returns the token of the Authorization header of r.
+func BearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", fmt.Errorf("%w: missing Authorization header", ErrUnauthenticated)
+	}
+
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", fmt.Errorf("%w: Authorization header is not a bearer token", ErrUnauthenticated)
+	}
+
+	return strings.TrimSpace(token), nil
+}
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// jwksTTL is how long fetched keys are used before being fetched again.
+	jwksTTL = time.Hour
+	// jwksMinRefresh bounds how often an unknown key ID triggers a fetch, so
+	// tokens with made up key IDs cannot hammer the identity provider.
+	jwksMinRefresh = time.Minute
+	maxJWKSBody    = 1 << 20
+)
+
+// JWKS is the JSON Web Key Set of an identity provider, fetched from its
+// jwks_uri. Keys are cached and fetched again when a token names a key ID
+// that is not known yet, which happens after the provider rotates its keys.
+// Concurrent lookups share a single fetch.
+type JWKS struct {
+	url        string
+	httpClient *http.Client
+	refreshes  singleflight.Group
+
+	mu          sync.Mutex
+	keys        map[string]*rsa.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+// NewJWKS returns the key set served at url. A nil httpClient uses a client
+// with a 10 second timeout.
+func NewJWKS(url string, httpClient *http.Client) *JWKS {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &JWKS{url: url, httpClient: httpClient}
+}
+
+// Key returns the RSA public key kid.
+func (j *JWKS) Key(ctx context.Context, alg, kid string) (any, error) {
+	if alg != algRS256 {
+		return nil, fmt.Errorf("%w: algorithm %s not accepted, expected %s", ErrUnauthenticated, alg, algRS256)
+	}
+
+	j.mu.Lock()
+	key, ok := j.keys[kid]
+	stale := time.Since(j.fetchedAt) > jwksTTL
+	j.mu.Unlock()
+	if ok && !stale {
+		return key, nil
+	}
+
+	// the fetch is shared, so it outlives the lookup that started it
+	refreshed := j.refreshes.DoChan("", func() (any, error) {
+		return nil, j.refresh(context.WithoutCancel(ctx))
+	})
+	var err error
+	select {
+	case result := <-refreshed:
+		err = result.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	j.mu.Lock()
+	key, ok = j.keys[kid]
+	j.mu.Unlock()
+	// a stale key is kept if the provider is unavailable
+	switch {
+	case ok:
+		return key, nil
+	case err != nil:
+		return nil, fmt.Errorf("fetching signing keys: %w", err)
+	default:
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrUnauthenticated, kid)
+	}
+}
+
+// refresh fetches the key set and swaps it in, unless it was fetched less
+// than jwksMinRefresh ago. The lock is only held to read and swap the keys.
+func (j *JWKS) refresh(ctx context.Context) error {
+	j.mu.Lock()
+	if time.Since(j.attemptedAt) <= jwksMinRefresh {
+		j.mu.Unlock()
+		return nil
+	}
+	j.attemptedAt = time.Now()
+	j.mu.Unlock()
+
+	keys, err := j.fetch(ctx)
+	if err != nil {
+		log.Printf("failed to fetch JWKS from %s: %v", j.url, err)
+		return err
+	}
+
+	j.mu.Lock()
+	j.keys = keys
+	j.fetchedAt = time.Now()
+	j.mu.Unlock()
+	return nil
+}
+
+// jwk is a JSON Web Key, only the members of RSA keys are decoded.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// fetch returns the RSA signing keys served at the URL of the key set.
+func (j *JWKS) fetch(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSBody)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decoding key set: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") || (k.Alg != "" && k.Alg != algRS256) {
+			continue
+		}
+		key, err := k.rsaPublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func (k jwk) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("unsupported exponent")
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	algRS256 = "RS256"
+	algHS256 = "HS256"
+
+	defaultUserClaim   = "email"
+	defaultGroupsClaim = "groups"
+	// leeway is the clock skew tolerated between the issuer and the server.
+	leeway = time.Minute
+)
+
+// KeySource supplies the keys that token signatures are verified with.
+type KeySource interface {
+	// Key returns the key for a token signed with alg by key kid: an
+	// *rsa.PublicKey for RS256 or a []byte secret for HS256.
+	Key(ctx context.Context, alg, kid string) (any, error)
+}
+
+// StaticKey is an HMAC secret that signs HS256 tokens. It stands in for an
+// identity provider when testing locally.
+type StaticKey []byte
+
+// Key returns the secret for HS256 tokens.
+func (k StaticKey) Key(_ context.Context, alg, _ string) (any, error) {
+	if alg != algHS256 {
+		return nil, fmt.Errorf("%w: algorithm %s not accepted, expected %s", ErrUnauthenticated, alg, algHS256)
+	}
+	return []byte(k), nil
+}
+
+// VerifierOptions are the claims a Verifier checks besides the signature and
+// validity period.
+type VerifierOptions struct {
+	// Issuer is the expected iss claim, not checked if empty.
+	Issuer string
+	// Audience must be one of the aud claim values, not checked if empty.
+	Audience string
+	// UserClaim names the claim used as Identity.User, email by default.
+	UserClaim string
+	// GroupsClaim names the claim used as Identity.Groups, groups by
+	// default. Cognito lists groups in cognito:groups.
+	GroupsClaim string
+}
+
+// Verifier authenticates requests by their JWT bearer token.
+type Verifier struct {
+	keys KeySource
+	opts VerifierOptions
+	now  func() time.Time
+}
+
+// NewVerifier returns a Verifier checking tokens against keys.
+func NewVerifier(keys KeySource, opts VerifierOptions) *Verifier {
+	if opts.UserClaim == "" {
+		opts.UserClaim = defaultUserClaim
+	}
+	if opts.GroupsClaim == "" {
+		opts.GroupsClaim = defaultGroupsClaim
+	}
+	return &Verifier{keys: keys, opts: opts, now: time.Now}
+}
+
+// Authenticate verifies the bearer token of r.
+func (v *Verifier) Authenticate(r *http.Request) (*Identity, error) {
+	token, err := BearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+	return v.Verify(r.Context(), token)
+}
+
+// header is the JOSE header of a token.
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// claims are the registered claims checked by Verify.
+type claims struct {
+	Issuer    string      `json:"iss"`
+	Subject   string      `json:"sub"`
+	Audience  audience    `json:"aud"`
+	ExpiresAt numericDate `json:"exp"`
+	NotBefore numericDate `json:"nbf"`
+}
+
+// Verify checks the signature and claims of token and returns the identity
+// it asserts.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrUnauthenticated)
+	}
+
+	var hdr header
+	if err := decodeSegment(parts[0], &hdr); err != nil {
+		return nil, fmt.Errorf("%w: malformed token header: %w", ErrUnauthenticated, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed token signature: %w", ErrUnauthenticated, err)
+	}
+
+	key, err := v.keys.Key(ctx, hdr.Alg, hdr.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(hdr.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var registered claims
+	if err := decodeSegment(parts[1], &registered); err != nil {
+		return nil, fmt.Errorf("%w: malformed token claims: %w", ErrUnauthenticated, err)
+	}
+	if err := v.checkClaims(registered); err != nil {
+		return nil, err
+	}
+
+	var all map[string]any
+	if err := decodeSegment(parts[1], &all); err != nil {
+		return nil, fmt.Errorf("%w: malformed token claims: %w", ErrUnauthenticated, err)
+	}
+
+	identity := &Identity{Subject: registered.Subject, User: registered.Subject}
+	if user, ok := all[v.opts.UserClaim].(string); ok && user != "" {
+		identity.User = user
+	}
+	if identity.User == "" {
+		return nil, fmt.Errorf("%w: token has neither a sub nor a %s claim", ErrUnauthenticated, v.opts.UserClaim)
+	}
+	identity.Groups = stringList(all[v.opts.GroupsClaim])
+
+	return identity, nil
+}
+
+func (v *Verifier) checkClaims(c claims) error {
+	now := v.now()
+
+	if c.ExpiresAt == 0 {
+		return fmt.Errorf("%w: token has no expiry", ErrUnauthenticated)
+	}
+	if now.After(c.ExpiresAt.Time().Add(leeway)) {
+		return fmt.Errorf("%w: token expired", ErrUnauthenticated)
+	}
+	if c.NotBefore != 0 && now.Add(leeway).Before(c.NotBefore.Time()) {
+		return fmt.Errorf("%w: token not valid yet", ErrUnauthenticated)
+	}
+	if v.opts.Issuer != "" && c.Issuer != v.opts.Issuer {
+		return fmt.Errorf("%w: token issued by %q", ErrUnauthenticated, c.Issuer)
+	}
+	if v.opts.Audience != "" && !slices.Contains(c.Audience, v.opts.Audience) {
+		return fmt.Errorf("%w: token not issued for this API", ErrUnauthenticated)
+	}
+
+	return nil
+}
+
+func verifySignature(alg string, key any, signed string, signature []byte) error {
+	switch alg {
+	case algRS256:
+		publicKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: key is not an RSA public key", ErrUnauthenticated)
+		}
+		digest := sha256.Sum256([]byte(signed))
+		if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature); err != nil {
+			return fmt.Errorf("%w: invalid token signature", ErrUnauthenticated)
+		}
+	case algHS256:
+		secret, ok := key.([]byte)
+		if !ok {
+			return fmt.Errorf("%w: key is not an HMAC secret", ErrUnauthenticated)
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return fmt.Errorf("%w: invalid token signature", ErrUnauthenticated)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrUnauthenticated, alg)
+	}
+	return nil
+}
+
+// stringList converts a claim holding a list of strings, or a single space
+// separated string as some providers send, into a slice.
+func stringList(claim any) []string {
+	switch value := claim.(type) {
+	case string:
+		return strings.Fields(value)
+	case []any:
+		list := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	default:
+		return nil
+	}
+}
+
+func decodeSegment(segment string, v any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// audience is the aud claim, which is either a string or a list of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("aud must be a string or a list of strings: %w", err)
+	}
+	*a = list
+	return nil
+}
+
+// numericDate is a JWT timestamp in seconds since the epoch. Some issuers
+// include fractional seconds.
+type numericDate int64
+
+func (d *numericDate) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err != nil {
+		return fmt.Errorf("timestamps must be numbers: %w", err)
+	}
+	*d = numericDate(seconds)
+	return nil
+}
+
+func (d numericDate) Time() time.Time {
+	return time.Unix(int64(d), 0)
+}
@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testSecret = StaticKey("secret")
+
+// serveJWKS serves key as the signing key k1 of a key set.
+func serveJWKS(t *testing.T, key *rsa.PublicKey) *JWKS {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []jwk{{
+			Kty: "RSA",
+			Kid: "k1",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	t.Cleanup(srv.Close)
+	return NewJWKS(srv.URL, srv.Client())
+}
+
+func encodeSegment(t *testing.T, v any) string {
+	t.Helper()
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func signHS256(t *testing.T, secret []byte, claims map[string]any) string {
+	t.Helper()
+	signed := encodeSegment(t, header{Alg: algHS256}) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, claims map[string]any) string {
+	t.Helper()
+	signed := encodeSegment(t, header{Alg: algRS256, Kid: "k1"}) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func newTestVerifier(keys KeySource, opts VerifierOptions, now time.Time) *Verifier {
+	v := NewVerifier(keys, opts)
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+	opts := VerifierOptions{Issuer: "https://idp", Audience: "turbo-deploy"}
+	validClaims := func() map[string]any {
+		return map[string]any{
+			"iss":    "https://idp",
+			"sub":    "u-1",
+			"aud":    "turbo-deploy",
+			"exp":    now.Add(time.Hour).Unix(),
+			"email":  "alice@example.com",
+			"groups": []string{"admins"},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(map[string]any)
+		ok     bool
+	}{
+		{"valid", func(map[string]any) {}, true},
+		{"audience in a list", func(c map[string]any) { c["aud"] = []string{"other", "turbo-deploy"} }, true},
+		{"expired within leeway", func(c map[string]any) { c["exp"] = now.Add(-leeway / 2).Unix() }, true},
+		{"expired", func(c map[string]any) { c["exp"] = now.Add(-2 * leeway).Unix() }, false},
+		{"no expiry", func(c map[string]any) { delete(c, "exp") }, false},
+		{"not valid yet", func(c map[string]any) { c["nbf"] = now.Add(2 * leeway).Unix() }, false},
+		{"other audience", func(c map[string]any) { c["aud"] = "another-api" }, false},
+		{"no audience", func(c map[string]any) { delete(c, "aud") }, false},
+		{"other issuer", func(c map[string]any) { c["iss"] = "https://evil" }, false},
+		{"no user", func(c map[string]any) { delete(c, "sub"); delete(c, "email") }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			tt.modify(claims)
+			token := signHS256(t, testSecret, claims)
+
+			identity, err := newTestVerifier(testSecret, opts, now).Verify(context.Background(), token)
+			if !tt.ok {
+				if !errors.Is(err, ErrUnauthenticated) {
+					t.Fatalf("Verify() = %v, want ErrUnauthenticated", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify(): %v", err)
+			}
+			if identity.Subject != "u-1" || identity.User != "alice@example.com" || !slices.Equal(identity.Groups, []string{"admins"}) {
+				t.Errorf("Verify() = %+v", identity)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsAlgorithmMismatch(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+	claims := map[string]any{"sub": "u-1", "exp": now.Add(time.Hour).Unix()}
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := serveJWKS(t, &rsaPrivate.PublicKey)
+
+	unsigned := encodeSegment(t, header{Alg: "none"}) + "." + encodeSegment(t, claims) + "."
+	tests := []struct {
+		name  string
+		keys  KeySource
+		token string
+	}{
+		{"RS256 token for an HMAC secret", testSecret, signRS256(t, rsaPrivate, claims)},
+		{"HS256 token for an RSA key", jwks, signHS256(t, testSecret, claims)},
+		{"unsigned token", testSecret, unsigned},
+		{"wrong secret", testSecret, signHS256(t, []byte("guess"), claims)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTestVerifier(tt.keys, VerifierOptions{}, now).Verify(context.Background(), tt.token)
+			if !errors.Is(err, ErrUnauthenticated) {
+				t.Fatalf("Verify() = %v, want ErrUnauthenticated", err)
+			}
+		})
+	}
+
+	// the same claims pass when signed with the expected algorithm
+	if _, err := newTestVerifier(jwks, VerifierOptions{}, now).Verify(context.Background(), signRS256(t, rsaPrivate, claims)); err != nil {
+		t.Fatalf("Verify() of an RS256 token: %v", err)
+	}
+}
+
+func TestJWKSSharesFetches(t *testing.T) {
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &rsaPrivate.PublicKey
+
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fetches.Add(1)
+		// slow enough for the lookups to overlap
+		time.Sleep(50 * time.Millisecond)
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []jwk{{
+			Kty: "RSA",
+			Kid: "k1",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	t.Cleanup(srv.Close)
+	jwks := NewJWKS(srv.URL, srv.Client())
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := jwks.Key(context.Background(), algRS256, "k1")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Key(k1): %v", err)
+		}
+	}
+
+	// unknown key IDs do not fetch again within jwksMinRefresh
+	if _, err := jwks.Key(context.Background(), algRS256, "k2"); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("Key(k2) = %v, want ErrUnauthenticated", err)
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetched the key set %d times, want once", n)
+	}
+}
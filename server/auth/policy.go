@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/frgrisk/turbo-deploy/server/config"
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+// Role is the relationship of a caller to a deployment.
+type Role string
+
+const (
+	// RoleAdmin may do anything to every deployment.
+	RoleAdmin Role = "admin"
+	// RoleOwner created the deployment and may do anything to it.
+	RoleOwner Role = "owner"
+	// RoleCollaborator was named by the owner and may start and stop the
+	// deployment's instance.
+	RoleCollaborator Role = "collaborator"
+)
+
+var roleActions = map[Role][]models.Action{
+	RoleAdmin:        models.Actions,
+	RoleOwner:        models.Actions,
+	RoleCollaborator: {models.ActionStart, models.ActionStop},
+}
+
+// Policy decides what callers may do to deployments.
+type Policy struct {
+	admins      []string
+	adminGroups []string
+}
+
+// NewPolicy returns the policy configured by cfg.
+func NewPolicy(cfg config.AuthConfig) *Policy {
+	return &Policy{admins: cfg.Admins, adminGroups: cfg.AdminGroups}
+}
+
+// IsAdmin reports whether identity may manage every deployment.
+func (p *Policy) IsAdmin(identity *Identity) bool {
+	if slices.ContainsFunc(p.admins, func(admin string) bool { return sameUser(admin, identity.User) }) {
+		return true
+	}
+	return slices.ContainsFunc(identity.Groups, func(group string) bool { return slices.Contains(p.adminGroups, group) })
+}
+
+// Role returns the role of identity for the deployment described by record,
+// or false if it has none.
+func (p *Policy) Role(identity *Identity, record *models.DynamoDBData) (Role, bool) {
+	switch {
+	case p.IsAdmin(identity):
+		return RoleAdmin, true
+	case record.CreationUser != "" && sameUser(record.CreationUser, identity.User):
+		return RoleOwner, true
+	case slices.ContainsFunc(record.Collaborators, func(user string) bool { return sameUser(user, identity.User) }):
+		return RoleCollaborator, true
+	default:
+		return "", false
+	}
+}
+
+// AllowedActions returns the actions identity may take on the deployment
+// described by record, limited to the permissions of its API key.
+func (p *Policy) AllowedActions(identity *Identity, record *models.DynamoDBData) []models.Action {
+	allowed := []models.Action{}
+	role, ok := p.Role(identity, record)
+	if !ok {
+		return allowed
+	}
+	for _, action := range roleActions[role] {
+		if identity.Allows(models.Permission(action)) {
+			allowed = append(allowed, action)
+		}
+	}
+	return allowed
+}
+
+// Can reports whether identity may take action on the deployment described by
+// record.
+func (p *Policy) Can(identity *Identity, record *models.DynamoDBData, action models.Action) bool {
+	return slices.Contains(p.AllowedActions(identity, record), action)
+}
+
+// sameUser compares user names ignoring case, as e-mail addresses are.
+func sameUser(a, b string) bool {
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/frgrisk/turbo-deploy/server/auth"
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/gin-gonic/gin"
+)
+
+// authenticate establishes the caller of an API request and stores their
+// identity in the request context. It lets every request through when
+// authentication is disabled.
+func (s *Server) authenticate(c *gin.Context) {
+	if s.authenticator == nil {
+		c.Next()
+		return
+	}
+
+	identity, err := s.authenticator.Authenticate(c.Request)
+	if err != nil {
+		if !errors.Is(err, auth.ErrUnauthenticated) {
+			respondWithError(c, err)
+			return
+		}
+
+		log.Printf("request %s: authentication failed: %v", c.GetString(requestIDContextKey), err)
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		respondWithError(c, newAPIError(http.StatusUnauthorized, models.ErrCodeUnauthorized, "A valid bearer token is required"))
+		return
+	}
+
+	c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), identity))
+	c.Next()
+}
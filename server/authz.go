@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/frgrisk/turbo-deploy/server/auth"
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/gin-gonic/gin"
+)
+
+// deploymentIDContextKey holds the deployment of the instance a legacy route
+// addresses, once requireInstanceAction has looked it up.
+const deploymentIDContextKey = "deploymentID"
+
+// allowedActions returns the actions the caller of ctx may take on the
+// deployment described by record. Without authentication anyone may do
+// anything, but nobody can do anything to a deleted deployment.
+func (s *Server) allowedActions(ctx context.Context, record *models.DynamoDBData) []models.Action {
+	if record.Removed() {
+		return []models.Action{}
+	}
+	if s.authenticator == nil {
+		return models.Actions
+	}
+	identity, ok := auth.FromContext(ctx)
+	if !ok {
+		return []models.Action{}
+	}
+	return s.policy.AllowedActions(identity, record)
+}
+
+// requireAction only lets callers through that may take action on the
+// deployment in the id path parameter.
+func (s *Server) requireAction(action models.Action) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.authenticator == nil {
+			c.Next()
+			return
+		}
+
+		record, err := s.store.GetRecord(c.Request.Context(), c.Param(pathParameterName))
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+		s.authorize(c, record, action)
+	}
+}
+
+// requireInstanceAction only lets callers through that may take action on the
+// deployment of the instance in path parameter param, as the legacy routes
+// address instances rather than deployments.
+func (s *Server) requireInstanceAction(action models.Action, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.authenticator == nil {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+
+		deploymentID, err := s.instanceDeploymentID(ctx, c.Param(param))
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+		c.Set(deploymentIDContextKey, deploymentID)
+
+		record, err := s.store.GetRecord(ctx, deploymentID)
+		switch {
+		case errors.Is(err, db.ErrURLNotFound):
+			// the request was deleted but the instance is still around,
+			// only admins may touch it
+			record = &models.DynamoDBData{ID: deploymentID}
+		case err != nil:
+			respondWithError(c, err)
+			return
+		}
+		s.authorize(c, record, action)
+	}
+}
+
+// requirePermission only lets callers through whose API key grants
+// permission. Interactive callers have every permission.
+func (s *Server) requirePermission(permission models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.authenticator == nil {
+			c.Next()
+			return
+		}
+
+		identity, ok := auth.FromContext(c.Request.Context())
+		if !ok || !identity.Allows(permission) {
+			respondWithError(c, newAPIError(http.StatusForbidden, models.ErrCodeForbidden,
+				"The API key does not have the %s permission", permission))
+			return
+		}
+		c.Next()
+	}
+}
+
+// requireInteractive only lets callers through that did not authenticate
+// with an API key, so keys cannot be used to issue more keys. API keys need
+// authentication to be enabled.
+func (s *Server) requireInteractive(c *gin.Context) {
+	if s.authenticator == nil {
+		respondWithError(c, newAPIError(http.StatusConflict, models.ErrCodeConflict,
+			"API keys are only available when the server authenticates callers"))
+		return
+	}
+
+	identity, ok := auth.FromContext(c.Request.Context())
+	if !ok || identity.APIKeyID != "" {
+		respondWithError(c, newAPIError(http.StatusForbidden, models.ErrCodeForbidden, "API keys cannot be used to manage API keys"))
+		return
+	}
+	c.Next()
+}
+
+// requireAdmin only lets admins through. API keys of admins also need
+// permissions.
+func (s *Server) requireAdmin(permissions ...models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.authenticator == nil {
+			c.Next()
+			return
+		}
+
+		identity, ok := auth.FromContext(c.Request.Context())
+		if !ok || !s.policy.IsAdmin(identity) {
+			respondWithError(c, newAPIError(http.StatusForbidden, models.ErrCodeForbidden, "Only admins may do this"))
+			return
+		}
+		for _, permission := range permissions {
+			if !identity.Allows(permission) {
+				respondWithError(c, newAPIError(http.StatusForbidden, models.ErrCodeForbidden,
+					"The API key does not have the %s permission", permission))
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+func (s *Server) authorize(c *gin.Context, record *models.DynamoDBData, action models.Action) {
+	identity, ok := auth.FromContext(c.Request.Context())
+	if !ok || !s.policy.Can(identity, record, action) {
+		respondWithError(c, newAPIError(http.StatusForbidden, models.ErrCodeForbidden,
+			"You may not %s deployment %s", action, record.ID))
+		return
+	}
+	c.Next()
+}
@@ -0,0 +1,694 @@
+// Package config holds the typed configuration of the turbo-deploy server.
+//
+// Settings are loaded through viper from a config file, TURBO_DEPLOY_*
+// environment variables and command line flags. The environment variables set
+// by the terraform-aws-turbo-deploy module (ROUTE53_DOMAIN_NAME, MY_REGION,
+// MY_AMI_ATTR, AMI_FILTERS, USER_SCRIPTS, ...) are still honoured so existing
+// deployments keep working unchanged.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/decode"
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/spf13/viper"
+)
+
+const (
+	envPrefix         = "TURBO_DEPLOY"
+	defaultPort       = 8080
+	defaultTableName  = "http_crud_backend"
+	defaultKeysTable  = "turbo_deploy_api_keys"
+	defaultAuditTable = "turbo_deploy_audit"
+	localDomain       = "turbo.local"
+	localCORSOrigin   = "http://localhost:4200"
+)
+
+// Config is the complete server configuration.
+type Config struct {
+	Port      int             `mapstructure:"port" yaml:"port" json:"port"`
+	Region    string          `mapstructure:"region" yaml:"region" json:"region"`
+	Domain    string          `mapstructure:"domain" yaml:"domain" json:"domain"`
+	Webserver WebserverConfig `mapstructure:"webserver" yaml:"webserver" json:"webserver"`
+	CORS      CORSConfig      `mapstructure:"cors" yaml:"cors" json:"cors"`
+	Database  DatabaseConfig  `mapstructure:"database" yaml:"database" json:"database"`
+	Catalog   CatalogConfig   `mapstructure:"catalog" yaml:"catalog" json:"catalog"`
+	Local     LocalConfig     `mapstructure:"local" yaml:"local" json:"local"`
+	API       APIConfig       `mapstructure:"api" yaml:"api" json:"api"`
+	Auth      AuthConfig      `mapstructure:"auth" yaml:"auth" json:"auth"`
+	Quota     QuotaConfig     `mapstructure:"quota" yaml:"quota" json:"quota"`
+	Pricing   PricingConfig   `mapstructure:"pricing" yaml:"pricing" json:"pricing"`
+	Reaper    ReaperConfig    `mapstructure:"reaper" yaml:"reaper" json:"reaper"`
+	Expiry    ExpiryConfig    `mapstructure:"expiry" yaml:"expiry" json:"expiry"`
+	Notify    NotifyConfig    `mapstructure:"notify" yaml:"notify" json:"notify"`
+	// Provisioner configures the instances launched by the reconcile job.
+	Provisioner ProvisionerConfig `mapstructure:"provisioner" yaml:"provisioner" json:"provisioner"`
+}
+
+// WebserverConfig describes where the web application is hosted, it is used
+// to derive the allowed CORS origins.
+type WebserverConfig struct {
+	Hostname  string `mapstructure:"hostname" yaml:"hostname" json:"hostname"`
+	HTTPPort  string `mapstructure:"http_port" yaml:"http_port" json:"http_port"`
+	HTTPSPort string `mapstructure:"https_port" yaml:"https_port" json:"https_port"`
+}
+
+// CORSConfig overrides the origins derived from WebserverConfig.
+type CORSConfig struct {
+	AllowOrigins []string `mapstructure:"allow_origins" yaml:"allow_origins" json:"allow_origins"`
+}
+
+// DatabaseConfig configures the DynamoDB tables.
+type DatabaseConfig struct {
+	TableName string `mapstructure:"table_name" yaml:"table_name" json:"table_name"`
+	// APIKeysTable holds the API keys, it needs the string hash key id.
+	APIKeysTable string `mapstructure:"api_keys_table" yaml:"api_keys_table" json:"api_keys_table"`
+	// AuditTable receives the audit log, it needs the string hash key id.
+	AuditTable string `mapstructure:"audit_table" yaml:"audit_table" json:"audit_table"`
+}
+
+// CatalogConfig lists what users can choose from when creating a deployment.
+type CatalogConfig struct {
+	Amis        []string `mapstructure:"amis" yaml:"amis" json:"amis"`
+	ServerSizes []string `mapstructure:"server_sizes" yaml:"server_sizes" json:"server_sizes"`
+	UserScripts []string `mapstructure:"user_scripts" yaml:"user_scripts" json:"user_scripts"`
+	// AmiFilters are named DescribeImages filters whose results are offered
+	// in addition to Amis.
+	AmiFilters map[string][]Filter `mapstructure:"ami_filters" yaml:"ami_filters" json:"ami_filters"`
+	// AmiAttributes is the JSON document passed in MY_AMI_ATTR, it supplies
+	// Amis and ServerSizes when those are not set directly.
+	AmiAttributes string `mapstructure:"ami_attributes" yaml:"-" json:"-"`
+}
+
+// Filter is an EC2 DescribeImages filter.
+type Filter struct {
+	Name   string   `mapstructure:"name" yaml:"name" json:"name"`
+	Values []string `mapstructure:"values" yaml:"values" json:"values"`
+}
+
+// LocalConfig configures serve --local. Empty seed lists fall back to the
+// built-in local catalog.
+type LocalConfig struct {
+	Enabled     bool     `mapstructure:"enabled" yaml:"enabled" json:"enabled"`
+	Amis        []string `mapstructure:"amis" yaml:"amis" json:"amis"`
+	ServerSizes []string `mapstructure:"server_sizes" yaml:"server_sizes" json:"server_sizes"`
+	UserScripts []string `mapstructure:"user_scripts" yaml:"user_scripts" json:"user_scripts"`
+}
+
+// APIConfig controls the lifecycle of API versions.
+type APIConfig struct {
+	// LegacySunset is the date (YYYY-MM-DD) after which the unversioned
+	// routes may be removed. It is announced in the Sunset header.
+	LegacySunset string `mapstructure:"legacy_sunset" yaml:"legacy_sunset" json:"legacy_sunset"`
+}
+
+// Sunset returns the parsed LegacySunset and whether one is configured.
+func (a APIConfig) Sunset() (time.Time, bool) {
+	sunset, err := time.Parse(time.DateOnly, a.LegacySunset)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return sunset, true
+}
+
+// AuthConfig configures how API callers are authenticated.
+type AuthConfig struct {
+	// Mode is none, which lets anyone call the API, or jwt, which requires
+	// a bearer token.
+	Mode string `mapstructure:"mode" yaml:"mode" json:"mode"`
+	// JWKSURL is the jwks_uri of the OIDC provider issuing tokens.
+	JWKSURL string `mapstructure:"jwks_url" yaml:"jwks_url" json:"jwks_url"`
+	// HMACKey is a shared secret for HS256 tokens, used instead of JWKSURL
+	// when testing without an identity provider.
+	HMACKey   string `mapstructure:"hmac_key" yaml:"-" json:"-"`
+	Issuer    string `mapstructure:"issuer" yaml:"issuer" json:"issuer"`
+	Audience  string `mapstructure:"audience" yaml:"audience" json:"audience"`
+	UserClaim string `mapstructure:"user_claim" yaml:"user_claim" json:"user_claim"`
+	// GroupsClaim names the claim listing the caller's groups.
+	GroupsClaim string `mapstructure:"groups_claim" yaml:"groups_claim" json:"groups_claim"`
+	// Admins and members of AdminGroups may manage every deployment.
+	Admins      []string `mapstructure:"admins" yaml:"admins" json:"admins"`
+	AdminGroups []string `mapstructure:"admin_groups" yaml:"admin_groups" json:"admin_groups"`
+}
+
+// QuotaConfig limits what users and teams may deploy. A user is held to
+// their entry in Users, or to Default if they have none, and to the limits
+// of every team they are a member of.
+type QuotaConfig struct {
+	Default QuotaLimits `mapstructure:"default" yaml:"default" json:"default"`
+	Users   []UserQuota `mapstructure:"users" yaml:"users" json:"users"`
+	Teams   []TeamQuota `mapstructure:"teams" yaml:"teams" json:"teams"`
+}
+
+// QuotaLimits are the limits of a quota. Zero limits and an empty
+// ServerSizes are unlimited.
+type QuotaLimits struct {
+	MaxDeployments int `mapstructure:"max_deployments" yaml:"max_deployments,omitempty" json:"max_deployments,omitempty"`
+	MaxVCPUs       int `mapstructure:"max_vcpus" yaml:"max_vcpus,omitempty" json:"max_vcpus,omitempty"`
+	// MaxOnDemand limits the deployments that are not spot instances.
+	MaxOnDemand int      `mapstructure:"max_on_demand" yaml:"max_on_demand,omitempty" json:"max_on_demand,omitempty"`
+	ServerSizes []string `mapstructure:"server_sizes" yaml:"server_sizes,omitempty" json:"server_sizes,omitempty"`
+}
+
+// Unlimited reports whether no limit is set.
+func (l QuotaLimits) Unlimited() bool {
+	return l.MaxDeployments == 0 && l.MaxVCPUs == 0 && l.MaxOnDemand == 0 && len(l.ServerSizes) == 0
+}
+
+// UserQuota replaces the default limits for a single user.
+type UserQuota struct {
+	User        string `mapstructure:"user" yaml:"user" json:"user"`
+	QuotaLimits `mapstructure:",squash" yaml:",inline"`
+}
+
+// TeamQuota limits what the members of a team deploy together.
+type TeamQuota struct {
+	Name        string   `mapstructure:"name" yaml:"name" json:"name"`
+	Members     []string `mapstructure:"members" yaml:"members" json:"members"`
+	QuotaLimits `mapstructure:",squash" yaml:",inline"`
+}
+
+// PricingConfig locates the price table costs are estimated from. Costs are
+// not reported without one.
+type PricingConfig struct {
+	// TableFile is a YAML or JSON price table, see the pricing package.
+	TableFile string `mapstructure:"table_file" yaml:"table_file" json:"table_file"`
+}
+
+// ReaperConfig controls how expired deployments are reaped.
+type ReaperConfig struct {
+	// GracePeriod is how long past its expiry a deployment is kept.
+	GracePeriod time.Duration `mapstructure:"grace_period" yaml:"grace_period" json:"grace_period"`
+	// FinalSnapshot captures an image of every instance before it is
+	// terminated.
+	FinalSnapshot bool `mapstructure:"final_snapshot" yaml:"final_snapshot" json:"final_snapshot"`
+}
+
+// ExpiryConfig limits how long deployments may live.
+type ExpiryConfig struct {
+	// MaxLifetime is the longest a deployment may live from its creation,
+	// zero for no limit. While it is set, every deployment needs a TTL.
+	MaxLifetime time.Duration `mapstructure:"max_lifetime" yaml:"max_lifetime" json:"max_lifetime"`
+}
+
+// NotifyConfig configures the warnings sent to users before their
+// deployments expire. Warnings are only sent through the channels that are
+// configured.
+type NotifyConfig struct {
+	// LeadTimes are how long before its expiry a deployment is warned about.
+	LeadTimes []time.Duration `mapstructure:"lead_times" yaml:"lead_times" json:"lead_times"`
+	// LinkSecret signs the one-click extend links in warnings, there are no
+	// links without it.
+	LinkSecret string `mapstructure:"link_secret" yaml:"-" json:"-"`
+	// LinkBaseURL is the URL of the API the links point at, including the
+	// API Gateway stage.
+	LinkBaseURL string `mapstructure:"link_base_url" yaml:"link_base_url" json:"link_base_url"`
+	// ExtendBy is how much a link extends a deployment by.
+	ExtendBy time.Duration `mapstructure:"extend_by" yaml:"extend_by" json:"extend_by"`
+	Webhook  WebhookConfig `mapstructure:"webhook" yaml:"webhook" json:"webhook"`
+	Slack    SlackConfig   `mapstructure:"slack" yaml:"slack" json:"slack"`
+	SMTP     SMTPConfig    `mapstructure:"smtp" yaml:"smtp" json:"smtp"`
+}
+
+// WebhookConfig posts warnings as JSON to URL.
+type WebhookConfig struct {
+	URL string `mapstructure:"url" yaml:"url" json:"url"`
+}
+
+// SlackConfig posts warnings as messages to a Slack compatible incoming
+// webhook.
+type SlackConfig struct {
+	WebhookURL string `mapstructure:"webhook_url" yaml:"-" json:"-"`
+}
+
+// SMTPConfig mails warnings to the users that created the deployments, who
+// must be e-mail addresses.
+type SMTPConfig struct {
+	Host     string `mapstructure:"host" yaml:"host" json:"host"`
+	Port     int    `mapstructure:"port" yaml:"port" json:"port"`
+	Username string `mapstructure:"username" yaml:"username" json:"username"`
+	Password string `mapstructure:"password" yaml:"-" json:"-"`
+	From     string `mapstructure:"from" yaml:"from" json:"from"`
+}
+
+// ProvisionerConfig describes how the instances of deployments are launched,
+// as the Terraform module did for the Terraform Lambda.
+type ProvisionerConfig struct {
+	// SubnetID and SecurityGroupID default to those of the default VPC.
+	SubnetID        string `mapstructure:"subnet_id" yaml:"subnet_id" json:"subnet_id"`
+	SecurityGroupID string `mapstructure:"security_group_id" yaml:"security_group_id" json:"security_group_id"`
+	// KeyName is the EC2 key pair instances are launched with.
+	KeyName string `mapstructure:"key_name" yaml:"key_name" json:"key_name"`
+	// InstanceProfile is the name of the IAM instance profile of instances.
+	InstanceProfile string `mapstructure:"instance_profile" yaml:"instance_profile" json:"instance_profile"`
+	// HostedZoneID is the Route53 zone the hostnames of deployments are
+	// registered in, they are not registered without one.
+	HostedZoneID string `mapstructure:"hosted_zone_id" yaml:"hosted_zone_id" json:"hosted_zone_id"`
+	// ScriptsBucket holds user-data-base/base.sh and the user scripts in
+	// user-data-scripts/NAME.sh. Instances get no user data without it.
+	ScriptsBucket string `mapstructure:"scripts_bucket" yaml:"scripts_bucket" json:"scripts_bucket"`
+	// DeletedRetention is how long deleted deployments are kept before their
+	// records are removed.
+	DeletedRetention time.Duration `mapstructure:"deleted_retention" yaml:"deleted_retention" json:"deleted_retention"`
+}
+
+// legacyEnv maps config keys to the environment variables set by the
+// Terraform module. TURBO_DEPLOY_* variables take precedence over them.
+var legacyEnv = map[string]string{
+	"port":                   "PORT",
+	"region":                 "MY_REGION",
+	"domain":                 "ROUTE53_DOMAIN_NAME",
+	"webserver.hostname":     "WEBSERVER_HOSTNAME",
+	"webserver.http_port":    "WEBSERVER_HTTP_PORT",
+	"webserver.https_port":   "WEBSERVER_HTTPS_PORT",
+	"catalog.ami_attributes": "MY_AMI_ATTR",
+	"catalog.ami_filters":    "AMI_FILTERS",
+	"catalog.user_scripts":   "USER_SCRIPTS",
+
+	"provisioner.subnet_id":         "PUBLIC_SUBNET_ID",
+	"provisioner.security_group_id": "SECURITY_GROUP_ID",
+	"provisioner.key_name":          "PUBLIC_KEY",
+	"provisioner.instance_profile":  "PROFILE_NAME",
+	"provisioner.hosted_zone_id":    "HOSTED_ZONE_ID",
+	"provisioner.scripts_bucket":    "S3_BUCKET_NAME",
+}
+
+// setDefaults registers the default value and environment variables of every
+// key on v.
+func setDefaults(v *viper.Viper) {
+	defaults := map[string]any{
+		"port":                          defaultPort,
+		"region":                        "",
+		"domain":                        "",
+		"webserver.hostname":            "",
+		"webserver.http_port":           "",
+		"webserver.https_port":          "",
+		"cors.allow_origins":            []string{},
+		"database.table_name":           defaultTableName,
+		"database.api_keys_table":       defaultKeysTable,
+		"database.audit_table":          defaultAuditTable,
+		"catalog.amis":                  []string{},
+		"catalog.server_sizes":          []string{},
+		"catalog.user_scripts":          []string{},
+		"catalog.ami_filters":           map[string]any{},
+		"catalog.ami_attributes":        "",
+		"local.enabled":                 false,
+		"local.amis":                    []string{},
+		"local.server_sizes":            []string{},
+		"local.user_scripts":            []string{},
+		"api.legacy_sunset":             "",
+		"auth.mode":                     "none",
+		"auth.jwks_url":                 "",
+		"auth.hmac_key":                 "",
+		"auth.issuer":                   "",
+		"auth.audience":                 "",
+		"auth.user_claim":               "email",
+		"auth.groups_claim":             "groups",
+		"auth.admins":                   []string{},
+		"auth.admin_groups":             []string{},
+		"quota.default.max_deployments": 0,
+		"quota.default.max_vcpus":       0,
+		"quota.default.max_on_demand":   0,
+		"quota.default.server_sizes":    []string{},
+		"quota.users":                   []UserQuota{},
+		"quota.teams":                   []TeamQuota{},
+		"pricing.table_file":            "",
+		"reaper.grace_period":           "0s",
+		"reaper.final_snapshot":         false,
+		"expiry.max_lifetime":           "0s",
+		"notify.lead_times":             []string{"24h", "1h"},
+		"notify.link_secret":            "",
+		"notify.link_base_url":          "",
+		"notify.extend_by":              "4h",
+		"notify.webhook.url":            "",
+		"notify.slack.webhook_url":      "",
+		"notify.smtp.host":              "",
+		"notify.smtp.port":              587,
+		"notify.smtp.username":          "",
+		"notify.smtp.password":          "",
+		"notify.smtp.from":              "",
+		"provisioner.subnet_id":         "",
+		"provisioner.security_group_id": "",
+		"provisioner.key_name":          "",
+		"provisioner.instance_profile":  "",
+		"provisioner.hosted_zone_id":    "",
+		"provisioner.scripts_bucket":    "",
+		"provisioner.deleted_retention": "24h",
+	}
+
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+
+		envNames := []string{envPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))}
+		if legacy, ok := legacyEnv[key]; ok {
+			envNames = append(envNames, legacy)
+		}
+		if err := v.BindEnv(append([]string{key}, envNames...)...); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Load reads the configuration from v and validates it.
+func Load(v *viper.Viper) (*Config, error) {
+	setDefaults(v)
+
+	var cfg Config
+	err := v.Unmarshal(&cfg, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		encodedStringHook,
+		mapstructure.StringToSliceHookFunc(","),
+		mapstructure.StringToTimeDurationHookFunc(),
+	)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode configuration: %w", err)
+	}
+
+	if err := cfg.applyAmiAttributes(); err != nil {
+		return nil, err
+	}
+	cfg.applyLocalDefaults()
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// applyAmiAttributes fills Amis and ServerSizes from MY_AMI_ATTR.
+func (c *Config) applyAmiAttributes() error {
+	if c.Catalog.AmiAttributes == "" {
+		return nil
+	}
+
+	var attributes struct {
+		Amis        []string `json:"amis"`
+		ServerSizes []string `json:"serverSizes"`
+	}
+	if err := json.Unmarshal([]byte(c.Catalog.AmiAttributes), &attributes); err != nil {
+		return fmt.Errorf("catalog.ami_attributes (MY_AMI_ATTR): %w", err)
+	}
+
+	if len(c.Catalog.Amis) == 0 {
+		c.Catalog.Amis = attributes.Amis
+	}
+	if len(c.Catalog.ServerSizes) == 0 {
+		c.Catalog.ServerSizes = attributes.ServerSizes
+	}
+
+	return nil
+}
+
+// applyLocalDefaults fills in the settings that serve --local does not need
+// to be told about.
+func (c *Config) applyLocalDefaults() {
+	if !c.Local.Enabled {
+		return
+	}
+
+	if c.Domain == "" {
+		c.Domain = localDomain
+	}
+	if len(c.AllowedOrigins()) == 0 {
+		c.CORS.AllowOrigins = []string{localCORSOrigin}
+	}
+}
+
+// Validate checks the configuration and reports every problem found.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port: %d is not a valid TCP port", c.Port))
+	}
+
+	for _, origin := range c.AllowedOrigins() {
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("cors.allow_origins: %q is not a valid origin", origin))
+		}
+	}
+	if len(c.AllowedOrigins()) == 0 {
+		errs = append(errs, errors.New("cors.allow_origins: no origins configured, set webserver.hostname (WEBSERVER_HOSTNAME) or cors.allow_origins"))
+	}
+
+	if c.Database.TableName == "" {
+		errs = append(errs, errors.New("database.table_name: must not be empty"))
+	}
+	if c.Database.APIKeysTable == "" {
+		errs = append(errs, errors.New("database.api_keys_table: must not be empty"))
+	}
+	if c.Database.AuditTable == "" {
+		errs = append(errs, errors.New("database.audit_table: must not be empty"))
+	}
+
+	if c.API.LegacySunset != "" {
+		if _, err := time.Parse(time.DateOnly, c.API.LegacySunset); err != nil {
+			errs = append(errs, fmt.Errorf("api.legacy_sunset: %q is not a date in YYYY-MM-DD format", c.API.LegacySunset))
+		}
+	}
+
+	errs = append(errs, c.Auth.validate()...)
+	errs = append(errs, c.Quota.validate()...)
+	errs = append(errs, c.Notify.validate()...)
+	if c.Reaper.GracePeriod < 0 {
+		errs = append(errs, fmt.Errorf("reaper.grace_period: %s must not be negative", c.Reaper.GracePeriod))
+	}
+	if c.Expiry.MaxLifetime < 0 {
+		errs = append(errs, fmt.Errorf("expiry.max_lifetime: %s must not be negative", c.Expiry.MaxLifetime))
+	}
+	if c.Provisioner.DeletedRetention < 0 {
+		errs = append(errs, fmt.Errorf("provisioner.deleted_retention: %s must not be negative", c.Provisioner.DeletedRetention))
+	}
+
+	// the catalog and AWS settings are replaced by seeds in local mode
+	if !c.Local.Enabled {
+		if c.Region == "" {
+			errs = append(errs, errors.New("region: must be set (MY_REGION)"))
+		}
+		if c.Domain == "" {
+			errs = append(errs, errors.New("domain: must be set (ROUTE53_DOMAIN_NAME)"))
+		}
+		errs = append(errs, c.Catalog.validate()...)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *CatalogConfig) validate() []error {
+	var errs []error
+
+	if len(c.Amis) == 0 && len(c.AmiFilters) == 0 {
+		errs = append(errs, errors.New("catalog: at least one of catalog.amis or catalog.ami_filters must be set (MY_AMI_ATTR, AMI_FILTERS)"))
+	}
+	for _, ami := range c.Amis {
+		if ami != "" && !strings.HasPrefix(ami, "ami-") {
+			errs = append(errs, fmt.Errorf("catalog.amis: %q is not an AMI ID", ami))
+		}
+	}
+	if len(c.ServerSizes) == 0 {
+		errs = append(errs, errors.New("catalog.server_sizes: at least one server size must be set (MY_AMI_ATTR)"))
+	}
+	for _, script := range c.UserScripts {
+		if strings.TrimSpace(script) == "" {
+			errs = append(errs, errors.New("catalog.user_scripts: script names must not be empty"))
+		}
+	}
+	for name, filters := range c.AmiFilters {
+		for _, filter := range filters {
+			if filter.Name == "" || len(filter.Values) == 0 {
+				errs = append(errs, fmt.Errorf("catalog.ami_filters.%s: every filter needs a name and at least one value", name))
+			}
+		}
+	}
+
+	return errs
+}
+
+func (q *QuotaConfig) validate() []error {
+	errs := q.Default.validate("quota.default")
+
+	users := make(map[string]bool, len(q.Users))
+	for i, user := range q.Users {
+		key := strings.ToLower(strings.TrimSpace(user.User))
+		switch {
+		case key == "":
+			errs = append(errs, fmt.Errorf("quota.users[%d]: user must be set", i))
+		case users[key]:
+			errs = append(errs, fmt.Errorf("quota.users[%d]: %s has more than one quota", i, user.User))
+		}
+		users[key] = true
+		errs = append(errs, user.validate(fmt.Sprintf("quota.users[%d]", i))...)
+	}
+
+	teams := make(map[string]bool, len(q.Teams))
+	for i, team := range q.Teams {
+		switch {
+		case strings.TrimSpace(team.Name) == "":
+			errs = append(errs, fmt.Errorf("quota.teams[%d]: name must be set", i))
+		case teams[team.Name]:
+			errs = append(errs, fmt.Errorf("quota.teams[%d]: team %s is defined more than once", i, team.Name))
+		}
+		teams[team.Name] = true
+		if len(team.Members) == 0 {
+			errs = append(errs, fmt.Errorf("quota.teams[%d]: team %s has no members", i, team.Name))
+		}
+		errs = append(errs, team.validate(fmt.Sprintf("quota.teams[%d]", i))...)
+	}
+
+	return errs
+}
+
+func (l *QuotaLimits) validate(key string) []error {
+	var errs []error
+	if l.MaxDeployments < 0 || l.MaxVCPUs < 0 || l.MaxOnDemand < 0 {
+		errs = append(errs, fmt.Errorf("%s: limits must not be negative", key))
+	}
+	for _, size := range l.ServerSizes {
+		if strings.TrimSpace(size) == "" {
+			errs = append(errs, fmt.Errorf("%s.server_sizes: server sizes must not be empty", key))
+		}
+	}
+	return errs
+}
+
+// minHMACKeyLength is the shortest accepted auth.hmac_key, the size of the
+// HS256 hash.
+const minHMACKeyLength = 32
+
+func (n *NotifyConfig) validate() []error {
+	var errs []error
+
+	for _, lead := range n.LeadTimes {
+		if lead <= 0 {
+			errs = append(errs, fmt.Errorf("notify.lead_times: %s is not a positive duration", lead))
+		}
+	}
+
+	if n.LinkSecret != "" {
+		if len(n.LinkSecret) < minHMACKeyLength {
+			errs = append(errs, fmt.Errorf("notify.link_secret: must be at least %d characters long", minHMACKeyLength))
+		}
+		if !isHTTPURL(n.LinkBaseURL) {
+			errs = append(errs, fmt.Errorf("notify.link_base_url: %q is not a valid URL, it is needed for extend links", n.LinkBaseURL))
+		}
+		if n.ExtendBy <= 0 {
+			errs = append(errs, fmt.Errorf("notify.extend_by: %s is not a positive duration", n.ExtendBy))
+		}
+	}
+
+	if n.Webhook.URL != "" && !isHTTPURL(n.Webhook.URL) {
+		errs = append(errs, fmt.Errorf("notify.webhook.url: %q is not a valid URL", n.Webhook.URL))
+	}
+	if n.Slack.WebhookURL != "" && !isHTTPURL(n.Slack.WebhookURL) {
+		errs = append(errs, errors.New("notify.slack.webhook_url: not a valid URL"))
+	}
+	if n.SMTP.Host != "" {
+		if n.SMTP.Port < 1 || n.SMTP.Port > 65535 {
+			errs = append(errs, fmt.Errorf("notify.smtp.port: %d is not a valid TCP port", n.SMTP.Port))
+		}
+		if !strings.Contains(n.SMTP.From, "@") {
+			errs = append(errs, fmt.Errorf("notify.smtp.from: %q is not an e-mail address", n.SMTP.From))
+		}
+	}
+
+	return errs
+}
+
+func isHTTPURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
+}
+
+func (a *AuthConfig) validate() []error {
+	var errs []error
+
+	switch a.Mode {
+	case "none":
+		return nil
+	case "jwt":
+	default:
+		return []error{fmt.Errorf("auth.mode: %q is not one of none or jwt", a.Mode)}
+	}
+
+	switch {
+	case a.JWKSURL == "" && a.HMACKey == "":
+		errs = append(errs, errors.New("auth: auth.jwks_url or auth.hmac_key must be set when auth.mode is jwt"))
+	case a.JWKSURL != "" && a.HMACKey != "":
+		errs = append(errs, errors.New("auth: set only one of auth.jwks_url and auth.hmac_key"))
+	case a.JWKSURL != "":
+		if u, err := url.Parse(a.JWKSURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("auth.jwks_url: %q is not a valid URL", a.JWKSURL))
+		}
+	case len(a.HMACKey) < minHMACKeyLength:
+		errs = append(errs, fmt.Errorf("auth.hmac_key: must be at least %d characters long", minHMACKeyLength))
+	}
+
+	return errs
+}
+
+// AllowedOrigins returns the CORS origins, derived from the webserver
+// settings unless cors.allow_origins is set.
+func (c *Config) AllowedOrigins() []string {
+	if len(c.CORS.AllowOrigins) > 0 {
+		return c.CORS.AllowOrigins
+	}
+	if c.Webserver.Hostname == "" {
+		return nil
+	}
+
+	fullName := c.Webserver.Hostname
+	if c.Domain != "" {
+		fullName += "." + c.Domain
+	}
+
+	origins := []string{"https://" + fullName}
+	if c.Webserver.HTTPPort != "" {
+		origins = append(origins, fmt.Sprintf("http://%s:%s", fullName, c.Webserver.HTTPPort))
+	}
+	if c.Webserver.HTTPSPort != "" {
+		origins = append(origins, fmt.Sprintf("https://%s:%s", fullName, c.Webserver.HTTPSPort))
+	}
+
+	return origins
+}
+
+// encodedStringHook decodes lists and maps given as strings, which is how they
+// arrive from environment variables. JSON is accepted for both, maps may also
+// be base64 encoded gzipped JSON as produced for AMI_FILTERS.
+func encodedStringHook(from, to reflect.Type, data any) (any, error) {
+	raw, ok := data.(string)
+	if !ok || from.Kind() != reflect.String {
+		return data, nil
+	}
+	if to.Kind() != reflect.Slice && to.Kind() != reflect.Map {
+		return data, nil
+	}
+
+	raw = strings.TrimSpace(raw)
+	switch {
+	case raw == "":
+		return reflect.Zero(to).Interface(), nil
+	case to.Kind() == reflect.Map && !strings.HasPrefix(raw, "{"):
+		decoded, err := decode.Base64Gzip(raw)
+		if err != nil {
+			return nil, fmt.Errorf("expected JSON or base64 encoded gzipped JSON: %w", err)
+		}
+		raw = decoded
+	case to.Kind() == reflect.Slice && !strings.HasPrefix(raw, "["):
+		// plain comma separated lists are handled by the next hook
+		return data, nil
+	}
+
+	value := reflect.New(to)
+	if err := json.Unmarshal([]byte(raw), value.Interface()); err != nil {
+		return nil, err
+	}
+	return value.Elem().Interface(), nil
+}
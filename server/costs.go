@@ -0,0 +1,256 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/frgrisk/turbo-deploy/server/pricing"
+	"github.com/frgrisk/turbo-deploy/server/timeutil"
+	"github.com/frgrisk/turbo-deploy/server/validate"
+	"github.com/gin-gonic/gin"
+)
+
+// errNoPriceTable is returned by the cost routes when no price table is
+// configured.
+var errNoPriceTable = newAPIError(http.StatusConflict, models.ErrCodeConflict, "Costs are not available, no price table is configured (pricing.table_file)")
+
+// pricedDeployment is what a deployment is priced by: its instance if it has
+// one, its request otherwise.
+type pricedDeployment struct {
+	usage      pricing.Usage
+	ami        string
+	launchTime *time.Time
+}
+
+// deploymentCosts estimates the cost of every deployment in records and
+// instances, by deployment ID. Deployments without a price are left out, and
+// nil is returned if there is no price table.
+func (s *Server) deploymentCosts(ctx context.Context, records []models.DynamoDBData, instances map[string]*models.DeploymentResponse) (map[string]*models.Cost, error) {
+	if s.prices == nil {
+		return nil, nil
+	}
+
+	priced := make(map[string]pricedDeployment, len(records)+len(instances))
+	for _, record := range records {
+		// deleted deployments only cost what is left of their instance
+		if record.Removed() {
+			continue
+		}
+		priced[record.ID] = pricedDeployment{
+			usage: pricing.Usage{
+				Region:       cmp.Or(record.Region, s.cfg.Region),
+				InstanceType: record.ServerSize,
+				Lifecycle:    record.Lifecycle,
+				Running:      true,
+			},
+			ami: record.Ami,
+		}
+	}
+	for id, inst := range instances {
+		p := priced[id]
+		p.usage.Region = cmp.Or(p.usage.Region, s.cfg.Region)
+		p.usage.InstanceType = inst.ServerSize
+		p.usage.Lifecycle = inst.Lifecycle
+		p.usage.Running = inst.Status == "pending" || inst.Status == "running"
+		p.ami = inst.Ami
+		p.launchTime = inst.LaunchTime
+		priced[id] = p
+	}
+
+	amis := make([]string, 0, len(priced))
+	for _, p := range priced {
+		if p.ami != "" && !slices.Contains(amis, p.ami) {
+			amis = append(amis, p.ami)
+		}
+	}
+	storage, err := s.compute.ImageStorageGB(ctx, amis)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up image storage: %w", err)
+	}
+
+	now := time.Now()
+	costs := make(map[string]*models.Cost, len(priced))
+	for id, p := range priced {
+		p.usage.StorageGB = storage[p.ami]
+		hourly, ok := s.prices.Hourly(p.usage)
+		if !ok {
+			continue
+		}
+
+		cost := &models.Cost{Currency: s.prices.Currency, HourlyCost: hourly}
+		if p.usage.Running && p.launchTime != nil {
+			cost.AccruedCost = pricing.Round(hourly * now.Sub(*p.launchTime).Hours())
+		}
+		costs[id] = cost
+	}
+
+	return costs, nil
+}
+
+// EstimateDeploymentCost prices a deployment request before it is created.
+func (s *Server) EstimateDeploymentCost(c *gin.Context) {
+	if s.prices == nil {
+		respondWithError(c, errNoPriceTable)
+		return
+	}
+
+	var req models.DeploymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, badRequest(err))
+		return
+	}
+
+	var details []models.FieldError
+	if req.ServerSize == "" {
+		details = append(details, models.FieldError{Field: "serverSize", Message: "serverSize is required"})
+	}
+	lifecycle := cmp.Or(req.Lifecycle, "on-demand")
+	if !slices.Contains(validate.Lifecycles, lifecycle) {
+		details = append(details, models.FieldError{Field: "lifecycle", Message: "lifecycle must be one of " + strings.Join(validate.Lifecycles, ", ")})
+	}
+
+	var lifetime time.Duration
+	if req.TTLValue > 0 && req.TTLUnit != "" {
+		ttl, err := timeutil.CalculateTTL(req.TTLValue, req.TTLUnit)
+		if err != nil {
+			details = append(details, models.FieldError{Field: "ttlValue", Message: err.Error()})
+		}
+		lifetime = time.Until(time.Unix(ttl, 0))
+	}
+	if len(details) > 0 {
+		respondWithError(c, validationFailed(details))
+		return
+	}
+
+	var storage map[string]int
+	if req.Ami != "" {
+		var err error
+		if storage, err = s.compute.ImageStorageGB(c.Request.Context(), []string{req.Ami}); err != nil {
+			respondWithError(c, fmt.Errorf("failed to look up image storage: %w", err))
+			return
+		}
+	}
+
+	usage := pricing.Usage{
+		Region:       s.cfg.Region,
+		InstanceType: req.ServerSize,
+		Lifecycle:    lifecycle,
+		StorageGB:    storage[req.Ami],
+		Running:      true,
+	}
+	hourly, ok := s.prices.Hourly(usage)
+	if !ok {
+		respondWithError(c, validationFailed([]models.FieldError{{
+			Field:   "serverSize",
+			Message: fmt.Sprintf("no price is configured for %s in %s", req.ServerSize, usage.Region),
+		}}))
+		return
+	}
+
+	estimate := models.CostEstimate{
+		Currency:    s.prices.Currency,
+		Region:      usage.Region,
+		ServerSize:  usage.InstanceType,
+		Lifecycle:   usage.Lifecycle,
+		StorageGB:   usage.StorageGB,
+		HourlyCost:  hourly,
+		MonthlyCost: pricing.Round(hourly * pricing.HoursPerMonth),
+	}
+	if lifetime > 0 {
+		// the TTL is cut to whole seconds, which would show as 7.9999 hours
+		hours := lifetime.Round(time.Minute).Hours()
+		estimate.LifetimeHours = pricing.Round(hours)
+		estimate.LifetimeCost = pricing.Round(hourly * hours)
+	}
+
+	c.JSON(http.StatusOK, estimate)
+}
+
+// GetCostSummary sums the costs of all deployments by creation user.
+// Instances whose request is gone are counted under an empty user.
+func (s *Server) GetCostSummary(c *gin.Context) {
+	if s.prices == nil {
+		respondWithError(c, errNoPriceTable)
+		return
+	}
+
+	ctx := c.Request.Context()
+	records, err := s.store.ListRecords(ctx)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	if err := s.compute.PopulateSpotTagResponse(ctx); err != nil {
+		respondWithError(c, fmt.Errorf("failed to populate tags for deployed instances: %w", err))
+		return
+	}
+	instances, err := s.compute.GetDeployedInstances(ctx)
+	if err != nil {
+		respondWithError(c, fmt.Errorf("failed to get deployed instances: %w", err))
+		return
+	}
+
+	byDeployment := make(map[string]*models.DeploymentResponse, len(instances))
+	for i := range instances {
+		byDeployment[instances[i].DeploymentID] = &instances[i]
+	}
+	costs, err := s.deploymentCosts(ctx, records, byDeployment)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	owners := make(map[string]string, len(records))
+	for _, record := range records {
+		// deleted deployments only count while their instance is left
+		if record.Removed() && byDeployment[record.ID] == nil {
+			continue
+		}
+		owners[record.ID] = record.CreationUser
+	}
+	for id := range byDeployment {
+		if _, ok := owners[id]; !ok {
+			owners[id] = ""
+		}
+	}
+
+	byUser := make(map[string]*models.UserCost)
+	for id, user := range owners {
+		userCost, ok := byUser[user]
+		if !ok {
+			userCost = &models.UserCost{User: user}
+			byUser[user] = userCost
+		}
+
+		userCost.Deployments++
+		cost, ok := costs[id]
+		if !ok {
+			userCost.Unpriced++
+			continue
+		}
+		userCost.HourlyCost += cost.HourlyCost
+		userCost.AccruedCost += cost.AccruedCost
+	}
+
+	summary := models.CostSummary{Currency: s.prices.Currency, Users: make([]models.UserCost, 0, len(byUser))}
+	for _, userCost := range byUser {
+		userCost.HourlyCost = pricing.Round(userCost.HourlyCost)
+		userCost.AccruedCost = pricing.Round(userCost.AccruedCost)
+		summary.HourlyCost += userCost.HourlyCost
+		summary.AccruedCost += userCost.AccruedCost
+		summary.Users = append(summary.Users, *userCost)
+	}
+	summary.HourlyCost = pricing.Round(summary.HourlyCost)
+	summary.AccruedCost = pricing.Round(summary.AccruedCost)
+	slices.SortFunc(summary.Users, func(a, b models.UserCost) int {
+		return cmp.Or(cmp.Compare(b.AccruedCost, a.AccruedCost), cmp.Compare(a.User, b.User))
+	})
+
+	c.JSON(http.StatusOK, summary)
+}
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"cmp"
+	"context"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+// DynamoDBAPIKeyStore is the APIKeyStore backed by a DynamoDB table with the
+// string hash key id.
+type DynamoDBAPIKeyStore struct {
+	client    *dynamodb.Client
+	tableName string
+}
+
+// NewDynamoDBAPIKeyStore returns an APIKeyStore that persists keys in the
+// given table.
+func NewDynamoDBAPIKeyStore(client *dynamodb.Client, tableName string) *DynamoDBAPIKeyStore {
+	return &DynamoDBAPIKeyStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+func (s *DynamoDBAPIKeyStore) SaveAPIKey(ctx context.Context, key models.APIKeyRecord) error {
+	item, err := attributevalue.MarshalMap(key)
+	if err != nil {
+		log.Printf("failed to marshal api key: %v", err)
+		return err
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item:      item,
+	})
+	return err
+}
+
+func (s *DynamoDBAPIKeyStore) GetAPIKey(ctx context.Context, id string) (*models.APIKeyRecord, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			IDDynamoDBAttributename: &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		log.Printf("failed to get api key %v", err)
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	var key models.APIKeyRecord
+	if err := attributevalue.UnmarshalMap(result.Item, &key); err != nil {
+		log.Printf("failed to unmarshal api key: %v", err)
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+func (s *DynamoDBAPIKeyStore) ListAPIKeys(ctx context.Context, user string) ([]models.APIKeyRecord, error) {
+	var keys []models.APIKeyRecord
+
+	// there are few keys, scanning is cheaper than maintaining an index
+	paginator := dynamodb.NewScanPaginator(s.client, &dynamodb.ScanInput{
+		TableName: aws.String(s.tableName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			log.Printf("Failed to scan DynamoDB table: %v", err)
+			return nil, err
+		}
+
+		var items []models.APIKeyRecord
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			log.Printf("failed to unmarshal api keys: %v", err)
+			return nil, err
+		}
+		keys = append(keys, items...)
+	}
+
+	return filterAPIKeys(keys, user), nil
+}
+
+func (s *DynamoDBAPIKeyStore) RevokeAPIKey(ctx context.Context, id string, revokedAt int64) error {
+	update := expression.Set(expression.Name("revokedAt"), expression.Value(revokedAt))
+	// only revoke keys that exist, UpdateItem would otherwise create one
+	condition := expression.AttributeExists(expression.Name(IDDynamoDBAttributename))
+
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		log.Printf("error building update expression: %v", err)
+		return err
+	}
+
+	_, err = s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			IDDynamoDBAttributename: &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	if isConditionalCheckFailed(err) {
+		return ErrAPIKeyNotFound
+	}
+
+	return err
+}
+
+// filterAPIKeys returns the keys of user, or all keys if user is empty,
+// sorted by creation time. User names are compared ignoring case, as e-mail
+// addresses are.
+func filterAPIKeys(keys []models.APIKeyRecord, user string) []models.APIKeyRecord {
+	filtered := make([]models.APIKeyRecord, 0, len(keys))
+	for _, key := range keys {
+		if user == "" || strings.EqualFold(key.User, user) {
+			filtered = append(filtered, key)
+		}
+	}
+
+	slices.SortStableFunc(filtered, func(a, b models.APIKeyRecord) int {
+		return cmp.Or(cmp.Compare(a.CreatedAt, b.CreatedAt), strings.Compare(a.ID, b.ID))
+	})
+	return filtered
+}
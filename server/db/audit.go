@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+// DynamoDBAuditStore is the AuditStore backed by a DynamoDB table with the
+// string hash key id.
+type DynamoDBAuditStore struct {
+	client    *dynamodb.Client
+	tableName string
+}
+
+// NewDynamoDBAuditStore returns an AuditStore that appends events to the
+// given table.
+func NewDynamoDBAuditStore(client *dynamodb.Client, tableName string) *DynamoDBAuditStore {
+	return &DynamoDBAuditStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+func (s *DynamoDBAuditStore) RecordEvent(ctx context.Context, event models.AuditEvent) error {
+	item, err := attributevalue.MarshalMap(event)
+	if err != nil {
+		log.Printf("failed to marshal audit event: %v", err)
+		return err
+	}
+
+	// never overwrite an event, even if an ID were reused
+	condition := expression.AttributeNotExists(expression.Name(IDDynamoDBAttributename))
+	expr, err := expression.NewBuilder().WithCondition(condition).Build()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                aws.String(s.tableName),
+		Item:                     item,
+		ConditionExpression:      expr.Condition(),
+		ExpressionAttributeNames: expr.Names(),
+	})
+	return err
+}
+
+func (s *DynamoDBAuditStore) ListEvents(ctx context.Context, filter AuditFilter) ([]models.AuditEvent, error) {
+	var events []models.AuditEvent
+
+	// a scan reads the whole table whether it filters or not, so the filter
+	// is applied here where it can be shared with MemoryAuditStore
+	paginator := dynamodb.NewScanPaginator(s.client, &dynamodb.ScanInput{
+		TableName: aws.String(s.tableName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			log.Printf("Failed to scan DynamoDB table: %v", err)
+			return nil, err
+		}
+
+		var items []models.AuditEvent
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			log.Printf("failed to unmarshal audit events: %v", err)
+			return nil, err
+		}
+		events = append(events, filterAuditEvents(items, filter)...)
+	}
+
+	return newestEvents(events, filter.Limit), nil
+}
+
+// filterAuditEvents returns the events matching filter.
+func filterAuditEvents(events []models.AuditEvent, filter AuditFilter) []models.AuditEvent {
+	var matching []models.AuditEvent
+	for _, event := range events {
+		switch {
+		case filter.Actor != "" && !strings.EqualFold(event.Actor, filter.Actor):
+		case filter.DeploymentID != "" && event.DeploymentID != filter.DeploymentID:
+		case !filter.From.IsZero() && event.Time.Before(filter.From):
+		case !filter.To.IsZero() && !event.Time.Before(filter.To):
+		default:
+			matching = append(matching, event)
+		}
+	}
+	return matching
+}
+
+// newestEvents sorts events newest first and keeps at most limit of them, or
+// all of them if limit is not positive.
+func newestEvents(events []models.AuditEvent, limit int) []models.AuditEvent {
+	slices.SortStableFunc(events, func(a, b models.AuditEvent) int {
+		if c := b.Time.Compare(a.Time); c != 0 {
+			return c
+		}
+		return strings.Compare(b.ID, a.ID)
+	})
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+	if events == nil {
+		events = []models.AuditEvent{}
+	}
+	return events
+}
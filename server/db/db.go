@@ -4,10 +4,8 @@ import (
 	"context"
 	"errors"
 	"log"
-	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
@@ -15,28 +13,29 @@ import (
 	"github.com/frgrisk/turbo-deploy/server/models"
 )
 
-var client *dynamodb.Client
-
 const (
 	TableName               = "http_crud_backend"
 	IDDynamoDBAttributename = "id"
 )
 
-var ErrURLNotFound = errors.New("url not found")
+// DynamoDBStore is the DeploymentStore backed by the DynamoDB table that the
+// Terraform provisioner reads from.
+type DynamoDBStore struct {
+	client    *dynamodb.Client
+	tableName string
+}
 
-func init() {
-	cfg, err := config.LoadDefaultConfig(context.Background())
-	if err != nil {
-		log.Printf("unable to load SDK config %v", err)
+// NewDynamoDBStore returns a DeploymentStore that persists records in the
+// given table, which is normally TableName.
+func NewDynamoDBStore(client *dynamodb.Client, tableName string) *DynamoDBStore {
+	return &DynamoDBStore{
+		client:    client,
+		tableName: tableName,
 	}
-
-	client = dynamodb.NewFromConfig(cfg)
 }
 
-var ErrHostnameExists = errors.New("hostname already exists")
-
-func SaveRecord(inputStruc models.DynamoDBData) (string, error) {
-	exists, err := hostnameExists(inputStruc.Hostname)
+func (s *DynamoDBStore) SaveRecord(ctx context.Context, inputStruc models.DynamoDBData) (string, error) {
+	exists, err := s.hostnameExists(ctx, inputStruc.Hostname)
 	if err != nil {
 		log.Printf("Error checking hostname existence: %s", err)
 		return "", err
@@ -51,8 +50,8 @@ func SaveRecord(inputStruc models.DynamoDBData) (string, error) {
 		return "", err
 	}
 
-	_, err = client.PutItem(context.Background(), &dynamodb.PutItemInput{
-		TableName: aws.String(TableName),
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
 		Item:      attributeValue,
 	})
 	if err != nil {
@@ -62,9 +61,9 @@ func SaveRecord(inputStruc models.DynamoDBData) (string, error) {
 	return inputStruc.ID, nil
 }
 
-func hostnameExists(hostname string, excludingID ...string) (bool, error) {
+func (s *DynamoDBStore) hostnameExists(ctx context.Context, hostname string, excludingID ...string) (bool, error) {
 	queryInput := &dynamodb.QueryInput{
-		TableName:              aws.String(TableName),
+		TableName:              aws.String(s.tableName),
 		IndexName:              aws.String("HostnameIndex"),
 		KeyConditionExpression: aws.String("hostname = :hostname"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
@@ -72,12 +71,17 @@ func hostnameExists(hostname string, excludingID ...string) (bool, error) {
 		},
 	}
 
+	// deleted deployments give their hostname up, status is a reserved word
+	filter := "(attribute_not_exists(#status) OR #status <> :deleted)"
+	queryInput.ExpressionAttributeNames = map[string]string{"#status": "status"}
+	queryInput.ExpressionAttributeValues[":deleted"] = &types.AttributeValueMemberS{Value: string(models.StatusDeleted)}
 	if len(excludingID) > 0 && excludingID[0] != "" {
-		queryInput.FilterExpression = aws.String("id <> :excludingID")
+		filter += " AND id <> :excludingID"
 		queryInput.ExpressionAttributeValues[":excludingID"] = &types.AttributeValueMemberS{Value: excludingID[0]}
 	}
+	queryInput.FilterExpression = aws.String(filter)
 
-	result, err := client.Query(context.Background(), queryInput)
+	result, err := s.client.Query(ctx, queryInput)
 	if err != nil {
 		return false, err
 	}
@@ -85,9 +89,9 @@ func hostnameExists(hostname string, excludingID ...string) (bool, error) {
 	return len(result.Items) > 0, nil
 }
 
-func GetRecord(id string) (*models.DynamoDBData, error) {
-	result, err := client.GetItem(context.Background(), &dynamodb.GetItemInput{
-		TableName: aws.String(TableName),
+func (s *DynamoDBStore) GetRecord(ctx context.Context, id string) (*models.DynamoDBData, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.tableName),
 		Key: map[string]types.AttributeValue{
 			IDDynamoDBAttributename: &types.AttributeValueMemberS{Value: id},
 		},
@@ -98,7 +102,7 @@ func GetRecord(id string) (*models.DynamoDBData, error) {
 	}
 
 	if result.Item == nil {
-		return nil, errors.New("record not found")
+		return nil, ErrURLNotFound
 	}
 
 	var dataToReturn models.DynamoDBData
@@ -111,9 +115,33 @@ func GetRecord(id string) (*models.DynamoDBData, error) {
 	return &dataToReturn, nil
 }
 
+func (s *DynamoDBStore) ListRecords(ctx context.Context) ([]models.DynamoDBData, error) {
+	var records []models.DynamoDBData
+
+	paginator := dynamodb.NewScanPaginator(s.client, &dynamodb.ScanInput{
+		TableName: aws.String(s.tableName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			log.Printf("Failed to scan DynamoDB table: %v", err)
+			return nil, err
+		}
+
+		var items []models.DynamoDBData
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			log.Printf("failed to unmarshal records: %v", err)
+			return nil, err
+		}
+		records = append(records, items...)
+	}
+
+	return records, nil
+}
+
 // updates an existing record in dynamodb
-func UpdateRecord(id string, updateData models.DynamoDBData) error {
-	exists, err := hostnameExists(updateData.Hostname, id)
+func (s *DynamoDBStore) UpdateRecord(ctx context.Context, id string, updateData models.DynamoDBData) error {
+	exists, err := s.hostnameExists(ctx, updateData.Hostname, id)
 	if err != nil {
 		log.Printf("Error checking hostname existence: %s", err)
 		return err
@@ -139,40 +167,218 @@ func UpdateRecord(id string, updateData models.DynamoDBData) error {
 		expression.Name("snapShot"), expression.Value(updateData.SnapShot),
 	).Set(
 		expression.Name("userData"), expression.Value(updateData.UserData),
+	).Set(
+		expression.Name("collaborators"), expression.Value(updateData.Collaborators),
+	).Set(
+		expression.Name("status"), expression.Value(updateData.Status),
+	).Set(
+		expression.Name("statusChangedAt"), expression.Value(updateData.StatusChangedAt),
 	)
 
+	// only update records that exist, UpdateItem would otherwise create one,
+	// and never bring a deleting or deleted one back to requested
+	condition := expression.AttributeExists(expression.Name(IDDynamoDBAttributename)).And(expression.Or(
+		expression.AttributeNotExists(expression.Name("status")),
+		expression.Name("status").In(expression.Value(models.StatusDeleting), expression.Value(models.StatusDeleted)).Not(),
+	))
+
 	// Build the update expression.
-	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
 	if err != nil {
 		log.Printf("error building update expression: %v", err)
 		return err
 	}
 
 	input := &dynamodb.UpdateItemInput{
-		TableName: aws.String(TableName),
+		TableName: aws.String(s.tableName),
 		Key: map[string]types.AttributeValue{
 			IDDynamoDBAttributename: &types.AttributeValueMemberS{Value: id},
 		},
 		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
 		ReturnValues:              types.ReturnValueUpdatedNew,
+		// tells a missing record from a removed one
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+
+	_, err = s.client.UpdateItem(ctx, input)
+	var conditionalErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionalErr) {
+		if len(conditionalErr.Item) == 0 {
+			return ErrURLNotFound
+		}
+		return ErrDeploymentRemoved
+	}
+
+	return err
+}
+
+func (s *DynamoDBStore) SetExpiry(ctx context.Context, id string, previous, timeToExpire int64, extendedBy string, extendedAt int64) error {
+	update := expression.Set(
+		expression.Name("timeToExpire"), expression.Value(timeToExpire),
+	).Set(
+		expression.Name("extendedBy"), expression.Value(extendedBy),
+	).Set(
+		expression.Name("extendedAt"), expression.Value(extendedAt),
+	)
+	unchanged := expression.Name("timeToExpire").Equal(expression.Value(previous))
+	if previous == 0 {
+		unchanged = unchanged.Or(expression.AttributeNotExists(expression.Name("timeToExpire")))
 	}
+	condition := expression.AttributeExists(expression.Name(IDDynamoDBAttributename)).And(unchanged)
 
-	_, err = client.UpdateItem(context.Background(), input)
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
 	if err != nil {
+		log.Printf("error building update expression: %v", err)
 		return err
 	}
 
-	return nil
+	_, err = s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			IDDynamoDBAttributename: &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		// tells a missing record from a changed expiry
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	var conditionalErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionalErr) {
+		if len(conditionalErr.Item) == 0 {
+			return ErrURLNotFound
+		}
+		return ErrExpiryChanged
+	}
+
+	return err
+}
+
+func (s *DynamoDBStore) MarkWarningSent(ctx context.Context, id, warning string) error {
+	update := expression.Add(
+		expression.Name("warningsSent"), expression.Value(types.AttributeValueMemberSS{Value: []string{warning}}),
+	)
+	condition := expression.AttributeExists(expression.Name(IDDynamoDBAttributename))
+
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		log.Printf("error building update expression: %v", err)
+		return err
+	}
+
+	_, err = s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			IDDynamoDBAttributename: &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	if isConditionalCheckFailed(err) {
+		return ErrURLNotFound
+	}
+
+	return err
+}
+
+func (s *DynamoDBStore) SetSchedule(ctx context.Context, id string, schedule *models.Schedule) error {
+	var update expression.UpdateBuilder
+	if schedule == nil {
+		update = expression.Remove(expression.Name("schedule")).Remove(expression.Name("scheduleSuspendedUntil"))
+	} else {
+		update = expression.Set(expression.Name("schedule"), expression.Value(schedule))
+	}
+	return s.updateExisting(ctx, id, update)
+}
+
+func (s *DynamoDBStore) SuspendSchedule(ctx context.Context, id string, until int64) error {
+	update := expression.Set(expression.Name("scheduleSuspendedUntil"), expression.Value(until))
+	if until == 0 {
+		update = expression.Remove(expression.Name("scheduleSuspendedUntil"))
+	}
+	return s.updateExisting(ctx, id, update)
+}
+
+func (s *DynamoDBStore) SetIdlePolicy(ctx context.Context, id string, policy *models.IdlePolicy) error {
+	update := expression.Remove(expression.Name("idlePolicy"))
+	if policy != nil {
+		update = expression.Set(expression.Name("idlePolicy"), expression.Value(policy))
+	}
+	return s.updateExisting(ctx, id, update)
+}
+
+func (s *DynamoDBStore) SetStopReason(ctx context.Context, id, reason string, stoppedAt int64) error {
+	update := expression.Remove(expression.Name("stopReason")).Remove(expression.Name("stoppedAt"))
+	if reason != "" {
+		update = expression.Set(
+			expression.Name("stopReason"), expression.Value(reason),
+		).Set(
+			expression.Name("stoppedAt"), expression.Value(stoppedAt),
+		)
+	}
+	return s.updateExisting(ctx, id, update)
+}
+
+func (s *DynamoDBStore) SetSnapshot(ctx context.Context, id, imageID string) error {
+	return s.updateExisting(ctx, id, expression.Set(expression.Name("snapShot"), expression.Value(imageID)))
+}
+
+func (s *DynamoDBStore) SetStatus(ctx context.Context, id string, status models.DeploymentStatus, lastError string, at int64) error {
+	update := expression.Set(
+		expression.Name("status"), expression.Value(status),
+	).Set(
+		expression.Name("statusChangedAt"), expression.Value(at),
+	)
+	if lastError != "" {
+		update = update.Set(
+			expression.Name("lastError"), expression.Value(lastError),
+		).Set(
+			expression.Name("lastErrorAt"), expression.Value(at),
+		)
+	}
+	return s.updateExisting(ctx, id, update)
 }
 
-func DeleteRecord(id string) error {
+// updateExisting applies update to the record with the given ID, or returns
+// ErrURLNotFound rather than creating it.
+func (s *DynamoDBStore) updateExisting(ctx context.Context, id string, update expression.UpdateBuilder) error {
+	condition := expression.AttributeExists(expression.Name(IDDynamoDBAttributename))
+
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		log.Printf("error building update expression: %v", err)
+		return err
+	}
+
+	_, err = s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			IDDynamoDBAttributename: &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	if isConditionalCheckFailed(err) {
+		return ErrURLNotFound
+	}
+
+	return err
+}
+
+func (s *DynamoDBStore) DeleteRecord(ctx context.Context, id string) error {
 	condition := expression.AttributeExists(expression.Name(IDDynamoDBAttributename))
 	conditionExpression, _ := expression.NewBuilder().WithCondition(condition).Build()
 
 	itemToDelete := &dynamodb.DeleteItemInput{
-		TableName: aws.String(TableName),
+		TableName: aws.String(s.tableName),
 		Key: map[string]types.AttributeValue{
 			IDDynamoDBAttributename: &types.AttributeValueMemberS{Value: id},
 		},
@@ -181,29 +387,28 @@ func DeleteRecord(id string) error {
 		ExpressionAttributeValues: conditionExpression.Values(),
 	}
 
-	_, err := client.DeleteItem(context.Background(), itemToDelete)
-
-	if err != nil && strings.Contains(err.Error(), "ConditionalCheckFailedException") {
+	_, err := s.client.DeleteItem(ctx, itemToDelete)
+	if isConditionalCheckFailed(err) {
 		log.Printf("Item not found %v, ", err)
-		return err
+		return ErrURLNotFound
 	}
 
 	return err
 }
 
-func ClearAllRecords() error {
+func (s *DynamoDBStore) ClearAllRecords(ctx context.Context) error {
 	var lastEvaluatedKey map[string]types.AttributeValue
 
 	// added an outer for loop and lastEvaluatedKey for dynamoDB pagination
 	// data scan if data exceeds a certain number of records
 	for {
 		scanInput := &dynamodb.ScanInput{
-			TableName:            aws.String(TableName),
+			TableName:            aws.String(s.tableName),
 			ProjectionExpression: aws.String(IDDynamoDBAttributename),
 			ExclusiveStartKey:    lastEvaluatedKey,
 		}
 
-		scanOutput, err := client.Scan(context.Background(), scanInput)
+		scanOutput, err := s.client.Scan(ctx, scanInput)
 		if err != nil {
 			log.Printf("Failed to scan DynamoDB table: %v", err)
 			return err
@@ -221,7 +426,7 @@ func ClearAllRecords() error {
 			})
 
 			if len(writeRequests) == 25 {
-				if err := executeBatchWrite(TableName, writeRequests); err != nil {
+				if err := s.executeBatchWrite(ctx, writeRequests); err != nil {
 					return err
 				}
 				writeRequests = nil
@@ -230,7 +435,7 @@ func ClearAllRecords() error {
 
 		// process any write request after loop if number of items are < 25
 		if len(writeRequests) > 0 {
-			if err := executeBatchWrite(TableName, writeRequests); err != nil {
+			if err := s.executeBatchWrite(ctx, writeRequests); err != nil {
 				return err
 			}
 		}
@@ -244,17 +449,22 @@ func ClearAllRecords() error {
 	return nil
 }
 
-func executeBatchWrite(tableName string, writeRequest []types.WriteRequest) error {
+func (s *DynamoDBStore) executeBatchWrite(ctx context.Context, writeRequest []types.WriteRequest) error {
 	batchInput := &dynamodb.BatchWriteItemInput{
 		RequestItems: map[string][]types.WriteRequest{
-			tableName: writeRequest,
+			s.tableName: writeRequest,
 		},
 	}
 
-	_, err := client.BatchWriteItem(context.Background(), batchInput)
+	_, err := s.client.BatchWriteItem(ctx, batchInput)
 	if err != nil {
 		log.Printf("Failed to batch Delete items: %v", err)
 		return err
 	}
 	return nil
 }
+
+func isConditionalCheckFailed(err error) bool {
+	var conditionalErr *types.ConditionalCheckFailedException
+	return errors.As(err, &conditionalErr)
+}
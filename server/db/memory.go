@@ -0,0 +1,417 @@
+package db
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+// MemoryStore is a DeploymentStore that keeps records in process memory. It
+// mirrors the behaviour of the DynamoDB table: hostnames are unique across
+// records and records whose TimeToExpire has passed are treated as deleted,
+// the same way DynamoDB TTL would eventually remove them.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]models.DynamoDBData
+	now     func() time.Time
+}
+
+// NewMemoryStore returns an empty in-memory DeploymentStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: make(map[string]models.DynamoDBData),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) SaveRecord(_ context.Context, data models.DynamoDBData) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired()
+	if s.hostnameExists(data.Hostname, "") {
+		return "", ErrHostnameExists
+	}
+
+	s.records[data.ID] = cloneRecord(data)
+	return data.ID, nil
+}
+
+func (s *MemoryStore) GetRecord(_ context.Context, id string) (*models.DynamoDBData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired()
+	record, ok := s.records[id]
+	if !ok {
+		return nil, ErrURLNotFound
+	}
+
+	record = cloneRecord(record)
+	return &record, nil
+}
+
+func (s *MemoryStore) ListRecords(_ context.Context) ([]models.DynamoDBData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired()
+	records := make([]models.DynamoDBData, 0, len(s.records))
+	for _, id := range slices.Sorted(maps.Keys(s.records)) {
+		records = append(records, cloneRecord(s.records[id]))
+	}
+
+	return records, nil
+}
+
+func (s *MemoryStore) UpdateRecord(_ context.Context, id string, data models.DynamoDBData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired()
+	if s.hostnameExists(data.Hostname, id) {
+		return ErrHostnameExists
+	}
+
+	record, ok := s.records[id]
+	if !ok {
+		return ErrURLNotFound
+	}
+	if record.Removed() {
+		return ErrDeploymentRemoved
+	}
+
+	// only the attributes written by DynamoDBStore.UpdateRecord are changed
+	record.Ami = data.Ami
+	record.ServerSize = data.ServerSize
+	record.Hostname = data.Hostname
+	record.CreationUser = data.CreationUser
+	record.Lifecycle = data.Lifecycle
+	record.TimeToExpire = data.TimeToExpire
+	record.SnapShot = data.SnapShot
+	record.UserData = append([]string(nil), data.UserData...)
+	record.Collaborators = append([]string(nil), data.Collaborators...)
+	record.Status = data.Status
+	record.StatusChangedAt = data.StatusChangedAt
+	s.records[id] = record
+
+	return nil
+}
+
+func (s *MemoryStore) SetExpiry(_ context.Context, id string, previous, timeToExpire int64, extendedBy string, extendedAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired()
+	record, ok := s.records[id]
+	if !ok {
+		return ErrURLNotFound
+	}
+	if record.TimeToExpire != previous {
+		return ErrExpiryChanged
+	}
+
+	record.TimeToExpire = timeToExpire
+	record.ExtendedBy = extendedBy
+	record.ExtendedAt = extendedAt
+	s.records[id] = record
+
+	return nil
+}
+
+func (s *MemoryStore) MarkWarningSent(_ context.Context, id, warning string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired()
+	record, ok := s.records[id]
+	if !ok {
+		return ErrURLNotFound
+	}
+
+	if !slices.Contains(record.WarningsSent, warning) {
+		record.WarningsSent = append(slices.Clone(record.WarningsSent), warning)
+		s.records[id] = record
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) SetSchedule(_ context.Context, id string, schedule *models.Schedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired()
+	record, ok := s.records[id]
+	if !ok {
+		return ErrURLNotFound
+	}
+
+	record.Schedule = cloneSchedule(schedule)
+	if schedule == nil {
+		record.ScheduleSuspendedUntil = 0
+	}
+	s.records[id] = record
+
+	return nil
+}
+
+func (s *MemoryStore) SuspendSchedule(_ context.Context, id string, until int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired()
+	record, ok := s.records[id]
+	if !ok {
+		return ErrURLNotFound
+	}
+
+	record.ScheduleSuspendedUntil = until
+	s.records[id] = record
+
+	return nil
+}
+
+func (s *MemoryStore) SetIdlePolicy(_ context.Context, id string, policy *models.IdlePolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired()
+	record, ok := s.records[id]
+	if !ok {
+		return ErrURLNotFound
+	}
+
+	record.IdlePolicy = nil
+	if policy != nil {
+		clone := *policy
+		record.IdlePolicy = &clone
+	}
+	s.records[id] = record
+
+	return nil
+}
+
+func (s *MemoryStore) SetStopReason(_ context.Context, id, reason string, stoppedAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired()
+	record, ok := s.records[id]
+	if !ok {
+		return ErrURLNotFound
+	}
+
+	record.StopReason = reason
+	record.StoppedAt = stoppedAt
+	if reason == "" {
+		record.StoppedAt = 0
+	}
+	s.records[id] = record
+
+	return nil
+}
+
+func (s *MemoryStore) SetSnapshot(_ context.Context, id, imageID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired()
+	record, ok := s.records[id]
+	if !ok {
+		return ErrURLNotFound
+	}
+
+	record.SnapShot = imageID
+	s.records[id] = record
+
+	return nil
+}
+
+func (s *MemoryStore) SetStatus(_ context.Context, id string, status models.DeploymentStatus, lastError string, at int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired()
+	record, ok := s.records[id]
+	if !ok {
+		return ErrURLNotFound
+	}
+
+	record.Status = status
+	record.StatusChangedAt = at
+	if lastError != "" {
+		record.LastError = lastError
+		record.LastErrorAt = at
+	}
+	s.records[id] = record
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteRecord(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired()
+	if _, ok := s.records[id]; !ok {
+		return ErrURLNotFound
+	}
+
+	delete(s.records, id)
+	return nil
+}
+
+func (s *MemoryStore) ClearAllRecords(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records = make(map[string]models.DynamoDBData)
+	return nil
+}
+
+// hostnameExists reports whether a record other than excludingID uses the
+// hostname, deleted deployments give theirs up. The caller must hold s.mu.
+func (s *MemoryStore) hostnameExists(hostname, excludingID string) bool {
+	for id, record := range s.records {
+		if id != excludingID && record.Hostname == hostname && record.Status != models.StatusDeleted {
+			return true
+		}
+	}
+	return false
+}
+
+// purgeExpired drops records whose TTL has passed. A TimeToExpire of zero
+// means the record never expires. The caller must hold s.mu.
+func (s *MemoryStore) purgeExpired() {
+	now := s.now().Unix()
+	for id, record := range s.records {
+		if record.TimeToExpire > 0 && record.TimeToExpire <= now {
+			delete(s.records, id)
+		}
+	}
+}
+
+func cloneRecord(record models.DynamoDBData) models.DynamoDBData {
+	record.UserData = append([]string(nil), record.UserData...)
+	record.Collaborators = append([]string(nil), record.Collaborators...)
+	record.WarningsSent = append([]string(nil), record.WarningsSent...)
+	record.Schedule = cloneSchedule(record.Schedule)
+	if record.IdlePolicy != nil {
+		policy := *record.IdlePolicy
+		record.IdlePolicy = &policy
+	}
+	return record
+}
+
+func cloneSchedule(schedule *models.Schedule) *models.Schedule {
+	if schedule == nil {
+		return nil
+	}
+	clone := *schedule
+	clone.Windows = make([]models.ScheduleWindow, len(schedule.Windows))
+	for i, window := range schedule.Windows {
+		window.Days = append([]string(nil), window.Days...)
+		clone.Windows[i] = window
+	}
+	clone.Holidays = append([]string(nil), schedule.Holidays...)
+	return &clone
+}
+
+// MemoryAPIKeyStore is an APIKeyStore that keeps keys in process memory.
+type MemoryAPIKeyStore struct {
+	mu   sync.Mutex
+	keys map[string]models.APIKeyRecord
+}
+
+// NewMemoryAPIKeyStore returns an empty in-memory APIKeyStore.
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{keys: make(map[string]models.APIKeyRecord)}
+}
+
+func (s *MemoryAPIKeyStore) SaveAPIKey(_ context.Context, key models.APIKeyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[key.ID] = cloneAPIKey(key)
+	return nil
+}
+
+func (s *MemoryAPIKeyStore) GetAPIKey(_ context.Context, id string) (*models.APIKeyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	key = cloneAPIKey(key)
+	return &key, nil
+}
+
+func (s *MemoryAPIKeyStore) ListAPIKeys(_ context.Context, user string) ([]models.APIKeyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]models.APIKeyRecord, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, cloneAPIKey(key))
+	}
+
+	return filterAPIKeys(keys, user), nil
+}
+
+func (s *MemoryAPIKeyStore) RevokeAPIKey(_ context.Context, id string, revokedAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+
+	key.RevokedAt = revokedAt
+	s.keys[id] = key
+	return nil
+}
+
+func cloneAPIKey(key models.APIKeyRecord) models.APIKeyRecord {
+	key.Permissions = append([]models.Permission(nil), key.Permissions...)
+	return key
+}
+
+// MemoryAuditStore is an AuditStore that keeps events in process memory.
+type MemoryAuditStore struct {
+	mu     sync.Mutex
+	events []models.AuditEvent
+}
+
+// NewMemoryAuditStore returns an empty in-memory AuditStore.
+func NewMemoryAuditStore() *MemoryAuditStore {
+	return &MemoryAuditStore{}
+}
+
+func (s *MemoryAuditStore) RecordEvent(_ context.Context, event models.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event.Changes = slices.Clone(event.Changes)
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *MemoryAuditStore) ListEvents(_ context.Context, filter AuditFilter) ([]models.AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := filterAuditEvents(s.events, filter)
+	for i := range events {
+		events[i].Changes = slices.Clone(events[i].Changes)
+	}
+	return newestEvents(events, filter.Limit), nil
+}
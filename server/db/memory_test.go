@@ -0,0 +1,190 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+func TestMemoryStoreHostnameUnique(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	if _, err := s.SaveRecord(ctx, models.DynamoDBData{ID: "a", Hostname: "web"}); err != nil {
+		t.Fatalf("SaveRecord: %v", err)
+	}
+	if _, err := s.SaveRecord(ctx, models.DynamoDBData{ID: "b", Hostname: "web"}); !errors.Is(err, ErrHostnameExists) {
+		t.Fatalf("SaveRecord of a taken hostname = %v, want ErrHostnameExists", err)
+	}
+	if _, err := s.SaveRecord(ctx, models.DynamoDBData{ID: "b", Hostname: "api"}); err != nil {
+		t.Fatalf("SaveRecord: %v", err)
+	}
+	if err := s.UpdateRecord(ctx, "b", models.DynamoDBData{Hostname: "web"}); !errors.Is(err, ErrHostnameExists) {
+		t.Fatalf("UpdateRecord to a taken hostname = %v, want ErrHostnameExists", err)
+	}
+	// a record keeps its own hostname
+	if err := s.UpdateRecord(ctx, "a", models.DynamoDBData{Hostname: "web", ServerSize: "t3.large"}); err != nil {
+		t.Fatalf("UpdateRecord keeping the hostname: %v", err)
+	}
+}
+
+func TestMemoryStoreDeletedReleasesHostname(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	if _, err := s.SaveRecord(ctx, models.DynamoDBData{ID: "a", Hostname: "web", Status: models.StatusRunning}); err != nil {
+		t.Fatalf("SaveRecord: %v", err)
+	}
+
+	for _, status := range []models.DeploymentStatus{models.StatusDeleting, models.StatusDeleted} {
+		if err := s.SetStatus(ctx, "a", status, "", 1); err != nil {
+			t.Fatalf("SetStatus(%s): %v", status, err)
+		}
+		_, err := s.SaveRecord(ctx, models.DynamoDBData{ID: "b", Hostname: "web"})
+		if status == models.StatusDeleting && !errors.Is(err, ErrHostnameExists) {
+			t.Fatalf("SaveRecord while %s = %v, want ErrHostnameExists", status, err)
+		}
+		if status == models.StatusDeleted && err != nil {
+			t.Fatalf("SaveRecord once deleted: %v", err)
+		}
+	}
+}
+
+func TestMemoryStorePurgesExpired(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1_000_000, 0)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+
+	records := []models.DynamoDBData{
+		{ID: "expired", Hostname: "old", TimeToExpire: now.Unix()},
+		{ID: "live", Hostname: "new", TimeToExpire: now.Unix() + 60},
+		{ID: "forever", Hostname: "any"},
+	}
+	for _, record := range records {
+		if _, err := s.SaveRecord(ctx, record); err != nil {
+			t.Fatalf("SaveRecord(%s): %v", record.ID, err)
+		}
+	}
+
+	list, err := s.ListRecords(ctx)
+	if err != nil {
+		t.Fatalf("ListRecords: %v", err)
+	}
+	var ids []string
+	for _, record := range list {
+		ids = append(ids, record.ID)
+	}
+	if len(ids) != 2 || ids[0] != "forever" || ids[1] != "live" {
+		t.Fatalf("ListRecords = %v, want [forever live]", ids)
+	}
+	if _, err := s.GetRecord(ctx, "expired"); !errors.Is(err, ErrURLNotFound) {
+		t.Fatalf("GetRecord of an expired record = %v, want ErrURLNotFound", err)
+	}
+	// the expired record's hostname is free again
+	if _, err := s.SaveRecord(ctx, models.DynamoDBData{ID: "again", Hostname: "old"}); err != nil {
+		t.Fatalf("SaveRecord of an expired hostname: %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := s.GetRecord(ctx, "live"); !errors.Is(err, ErrURLNotFound) {
+		t.Fatalf("GetRecord after its TTL = %v, want ErrURLNotFound", err)
+	}
+}
+
+func TestMemoryStoreSetExpiryOnlyFromThePreviousExpiry(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	expiry := time.Now().Add(time.Hour).Unix()
+	if _, err := s.SaveRecord(ctx, models.DynamoDBData{ID: "a", Hostname: "web", TimeToExpire: expiry}); err != nil {
+		t.Fatalf("SaveRecord: %v", err)
+	}
+
+	if err := s.SetExpiry(ctx, "a", expiry, expiry+60, "alice", 1); err != nil {
+		t.Fatalf("SetExpiry: %v", err)
+	}
+	// a second extension from the same expiry lost the race
+	if err := s.SetExpiry(ctx, "a", expiry, expiry+120, "bob", 2); !errors.Is(err, ErrExpiryChanged) {
+		t.Fatalf("SetExpiry from a stale expiry = %v, want ErrExpiryChanged", err)
+	}
+	if err := s.SetExpiry(ctx, "missing", 0, expiry, "bob", 2); !errors.Is(err, ErrURLNotFound) {
+		t.Fatalf("SetExpiry of a missing record = %v, want ErrURLNotFound", err)
+	}
+
+	record, err := s.GetRecord(ctx, "a")
+	if err != nil {
+		t.Fatalf("GetRecord: %v", err)
+	}
+	if record.TimeToExpire != expiry+60 || record.ExtendedBy != "alice" {
+		t.Errorf("record expires at %d extended by %q, want %d by alice", record.TimeToExpire, record.ExtendedBy, expiry+60)
+	}
+}
+
+func TestMemoryStoreSetSnapshotKeepsTheStatus(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	if _, err := s.SaveRecord(ctx, models.DynamoDBData{ID: "a", Hostname: "web", Status: models.StatusRunning}); err != nil {
+		t.Fatalf("SaveRecord: %v", err)
+	}
+
+	// the deployment is deleted while its image is captured
+	if err := s.SetStatus(ctx, "a", models.StatusDeleting, "", 1); err != nil {
+		t.Fatalf("SetStatus: %v", err)
+	}
+	if err := s.SetSnapshot(ctx, "a", "ami-1"); err != nil {
+		t.Fatalf("SetSnapshot: %v", err)
+	}
+	if err := s.SetSnapshot(ctx, "missing", "ami-1"); !errors.Is(err, ErrURLNotFound) {
+		t.Fatalf("SetSnapshot of a missing record = %v, want ErrURLNotFound", err)
+	}
+
+	record, err := s.GetRecord(ctx, "a")
+	if err != nil {
+		t.Fatalf("GetRecord: %v", err)
+	}
+	if record.SnapShot != "ami-1" || record.Status != models.StatusDeleting {
+		t.Errorf("record has snapshot %q and status %s, want ami-1 and deleting", record.SnapShot, record.Status)
+	}
+}
+
+func TestMemoryStoreUpdateRecordRefusesRemoved(t *testing.T) {
+	tests := []struct {
+		status models.DeploymentStatus
+		err    error
+	}{
+		{"", nil},
+		{models.StatusRunning, nil},
+		{models.StatusFailed, nil},
+		{models.StatusDeleting, ErrDeploymentRemoved},
+		{models.StatusDeleted, ErrDeploymentRemoved},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			ctx := context.Background()
+			s := NewMemoryStore()
+			if _, err := s.SaveRecord(ctx, models.DynamoDBData{ID: "a", Hostname: "web", ServerSize: "t3.small", Status: tt.status}); err != nil {
+				t.Fatalf("SaveRecord: %v", err)
+			}
+
+			err := s.UpdateRecord(ctx, "a", models.DynamoDBData{Hostname: "web", ServerSize: "t3.large", Status: models.StatusRequested})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("UpdateRecord() = %v, want %v", err, tt.err)
+			}
+
+			record, err := s.GetRecord(ctx, "a")
+			if err != nil {
+				t.Fatalf("GetRecord: %v", err)
+			}
+			want := models.DynamoDBData{ServerSize: "t3.large", Status: models.StatusRequested}
+			if tt.err != nil {
+				want = models.DynamoDBData{ServerSize: "t3.small", Status: tt.status}
+			}
+			if record.ServerSize != want.ServerSize || record.Status != want.Status {
+				t.Errorf("record is %s %s, want %s %s", record.ServerSize, record.Status, want.ServerSize, want.Status)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+var (
+	ErrURLNotFound       = errors.New("url not found")
+	ErrHostnameExists    = errors.New("hostname already exists")
+	ErrAPIKeyNotFound    = errors.New("api key not found")
+	ErrExpiryChanged     = errors.New("expiry changed")
+	ErrDeploymentRemoved = errors.New("deployment is deleting or deleted")
+)
+
+// Stores bundles the stores the server keeps its state in.
+type Stores struct {
+	Deployments DeploymentStore
+	APIKeys     APIKeyStore
+	Audit       AuditStore
+}
+
+// DeploymentStore persists the deployment requests submitted through the API.
+// The gin handlers only talk to this interface so the DynamoDB table can be
+// swapped for an in-memory store when running without AWS.
+type DeploymentStore interface {
+	// SaveRecord stores a new deployment request and returns its ID. It fails
+	// with ErrHostnameExists if another record already uses the hostname,
+	// unless that deployment is StatusDeleted.
+	SaveRecord(ctx context.Context, data models.DynamoDBData) (string, error)
+	// GetRecord returns the record with the given ID or ErrURLNotFound.
+	GetRecord(ctx context.Context, id string) (*models.DynamoDBData, error)
+	// ListRecords returns every record in the store.
+	ListRecords(ctx context.Context) ([]models.DynamoDBData, error)
+	// UpdateRecord overwrites the mutable fields of an existing record,
+	// including its Status and StatusChangedAt. It returns ErrURLNotFound,
+	// or ErrDeploymentRemoved if the record is deleting or deleted.
+	UpdateRecord(ctx context.Context, id string, data models.DynamoDBData) error
+	// SetExpiry changes the TimeToExpire of an existing record from previous
+	// and records who changed it when (Unix time in seconds). It returns
+	// ErrURLNotFound, or ErrExpiryChanged if the record no longer expires at
+	// previous.
+	SetExpiry(ctx context.Context, id string, previous, timeToExpire int64, extendedBy string, extendedAt int64) error
+	// MarkWarningSent adds warning to the WarningsSent of an existing record
+	// or returns ErrURLNotFound.
+	MarkWarningSent(ctx context.Context, id, warning string) error
+	// SetSchedule replaces the Schedule of an existing record, or returns
+	// ErrURLNotFound. A nil schedule removes it together with any override.
+	SetSchedule(ctx context.Context, id string, schedule *models.Schedule) error
+	// SuspendSchedule sets the ScheduleSuspendedUntil of an existing record
+	// (Unix time in seconds) or returns ErrURLNotFound. Zero resumes the
+	// schedule.
+	SuspendSchedule(ctx context.Context, id string, until int64) error
+	// SetIdlePolicy replaces the IdlePolicy of an existing record, or returns
+	// ErrURLNotFound. A nil policy removes it.
+	SetIdlePolicy(ctx context.Context, id string, policy *models.IdlePolicy) error
+	// SetStopReason records why the instance of an existing record was
+	// stopped automatically at stoppedAt (Unix time in seconds), or returns
+	// ErrURLNotFound. An empty reason clears both.
+	SetStopReason(ctx context.Context, id, reason string, stoppedAt int64) error
+	// SetSnapshot records imageID as the snapshot of an existing record, or
+	// returns ErrURLNotFound. Nothing else of the record is changed.
+	SetSnapshot(ctx context.Context, id, imageID string) error
+	// SetStatus moves an existing record to status at (Unix time in seconds),
+	// or returns ErrURLNotFound. A non-empty lastError is recorded as its
+	// LastError at the same time, an empty one keeps the previous.
+	SetStatus(ctx context.Context, id string, status models.DeploymentStatus, lastError string, at int64) error
+	// DeleteRecord removes the record with the given ID or returns ErrURLNotFound.
+	DeleteRecord(ctx context.Context, id string) error
+	// ClearAllRecords removes every record in the store.
+	ClearAllRecords(ctx context.Context) error
+}
+
+// APIKeyStore persists the API keys issued to CI and automation clients.
+type APIKeyStore interface {
+	// SaveAPIKey stores a new API key.
+	SaveAPIKey(ctx context.Context, key models.APIKeyRecord) error
+	// GetAPIKey returns the key with the given ID or ErrAPIKeyNotFound.
+	GetAPIKey(ctx context.Context, id string) (*models.APIKeyRecord, error)
+	// ListAPIKeys returns the keys of user, or every key if user is empty,
+	// oldest first.
+	ListAPIKeys(ctx context.Context, user string) ([]models.APIKeyRecord, error)
+	// RevokeAPIKey marks the key with the given ID as revoked at revokedAt
+	// (Unix time in seconds) or returns ErrAPIKeyNotFound.
+	RevokeAPIKey(ctx context.Context, id string, revokedAt int64) error
+}
+
+// AuditStore keeps the audit log. It only appends, events are never changed
+// or removed through it.
+type AuditStore interface {
+	// RecordEvent appends event to the log.
+	RecordEvent(ctx context.Context, event models.AuditEvent) error
+	// ListEvents returns the events matching filter, newest first.
+	ListEvents(ctx context.Context, filter AuditFilter) ([]models.AuditEvent, error)
+}
+
+// AuditFilter selects audit events, zero fields match every event.
+type AuditFilter struct {
+	Actor        string
+	DeploymentID string
+	// From is inclusive and To exclusive.
+	From time.Time
+	To   time.Time
+	// Limit caps the number of events returned.
+	Limit int
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/gin-gonic/gin"
+)
+
+// GetDriftReport compares the deployment records with the turbo-deploy
+// instances and lists where they disagree.
+func (s *Server) GetDriftReport(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	records, err := s.store.ListRecords(ctx)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	if err := s.compute.PopulateSpotTagResponse(ctx); err != nil {
+		respondWithError(c, fmt.Errorf("failed to populate tags for deployed instances: %w", err))
+		return
+	}
+	instances, err := s.compute.GetDeployedInstances(ctx)
+	if err != nil {
+		respondWithError(c, fmt.Errorf("failed to get deployed instances: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, driftReport(records, instances, time.Now()))
+}
+
+// driftReport classifies every disagreement between records and instances.
+// Deployments waiting for or being applied by the provisioner are not
+// compared, their instance has yet to catch up, and neither are deleting
+// deployments that still have their instance.
+func driftReport(records []models.DynamoDBData, instances []models.DeploymentResponse, now time.Time) models.DriftReport {
+	report := models.DriftReport{
+		CheckedAt:   now.UTC(),
+		Deployments: len(records),
+		Instances:   len(instances),
+		Drifts:      []models.Drift{},
+	}
+
+	byDeployment := make(map[string][]models.DeploymentResponse, len(instances))
+	for _, inst := range instances {
+		byDeployment[inst.DeploymentID] = append(byDeployment[inst.DeploymentID], inst)
+	}
+	// the provisioner keeps the oldest instance of a deployment
+	for _, insts := range byDeployment {
+		slices.SortFunc(insts, func(a, b models.DeploymentResponse) int {
+			return cmp.Or(compareLaunchTimes(a.LaunchTime, b.LaunchTime), cmp.Compare(a.InstanceID, b.InstanceID))
+		})
+	}
+
+	recorded := make(map[string]bool, len(records))
+	for _, record := range records {
+		recorded[record.ID] = true
+		insts := byDeployment[record.ID]
+
+		switch record.Status {
+		case models.StatusRequested, models.StatusProvisioning, models.StatusDeleting:
+			continue
+		case models.StatusDeleted:
+			for _, inst := range insts {
+				report.Drifts = append(report.Drifts, instanceDrift(models.DriftOrphanedInstance, record, inst))
+			}
+			continue
+		}
+
+		if len(insts) == 0 {
+			report.Drifts = append(report.Drifts, models.Drift{
+				Kind:         models.DriftMissingInstance,
+				DeploymentID: record.ID,
+				Hostname:     record.Hostname,
+				Status:       record.Status,
+			})
+			continue
+		}
+
+		current := insts[0]
+		for _, mismatch := range []struct {
+			kind             models.DriftKind
+			expected, actual string
+		}{
+			{models.DriftServerSize, record.ServerSize, current.ServerSize},
+			{models.DriftAmi, record.Ami, current.Ami},
+			{models.DriftLifecycle, cmp.Or(record.Lifecycle, "on-demand"), current.Lifecycle},
+		} {
+			if mismatch.expected != mismatch.actual {
+				drift := instanceDrift(mismatch.kind, record, current)
+				drift.Expected, drift.Actual = mismatch.expected, mismatch.actual
+				report.Drifts = append(report.Drifts, drift)
+			}
+		}
+		for _, inst := range insts[1:] {
+			report.Drifts = append(report.Drifts, instanceDrift(models.DriftDuplicateInstance, record, inst))
+		}
+	}
+
+	for id, insts := range byDeployment {
+		if recorded[id] {
+			continue
+		}
+		for _, inst := range insts {
+			report.Drifts = append(report.Drifts, models.Drift{
+				Kind:         models.DriftOrphanedInstance,
+				DeploymentID: id,
+				InstanceID:   inst.InstanceID,
+				Hostname:     inst.Hostname,
+			})
+		}
+	}
+
+	slices.SortFunc(report.Drifts, func(a, b models.Drift) int {
+		return cmp.Or(
+			cmp.Compare(a.DeploymentID, b.DeploymentID),
+			cmp.Compare(a.InstanceID, b.InstanceID),
+			cmp.Compare(slices.Index(models.DriftKinds, a.Kind), slices.Index(models.DriftKinds, b.Kind)),
+		)
+	})
+	return report
+}
+
+func instanceDrift(kind models.DriftKind, record models.DynamoDBData, inst models.DeploymentResponse) models.Drift {
+	return models.Drift{
+		Kind:         kind,
+		DeploymentID: record.ID,
+		InstanceID:   inst.InstanceID,
+		Hostname:     record.Hostname,
+		Status:       record.Status,
+	}
+}
+
+// compareLaunchTimes orders instances without a launch time last.
+func compareLaunchTimes(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	return a.Compare(*b)
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+func TestDriftReport(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-time.Hour)
+	record := func(id string, status models.DeploymentStatus) models.DynamoDBData {
+		return models.DynamoDBData{ID: id, Hostname: id, ServerSize: "t3.small", Ami: "ami-1", Status: status}
+	}
+	inst := func(deploymentID, instanceID string, launched time.Time) models.DeploymentResponse {
+		return models.DeploymentResponse{
+			DeploymentID: deploymentID,
+			InstanceID:   instanceID,
+			Hostname:     deploymentID,
+			ServerSize:   "t3.small",
+			Ami:          "ami-1",
+			Lifecycle:    "on-demand",
+			LaunchTime:   &launched,
+		}
+	}
+	resized := inst("a", "i-1", now)
+	resized.ServerSize = "t3.large"
+	spot := inst("a", "i-1", now)
+	spot.Lifecycle = "spot"
+	rebuilt := inst("a", "i-1", now)
+	rebuilt.Ami = "ami-2"
+
+	tests := []struct {
+		name      string
+		records   []models.DynamoDBData
+		instances []models.DeploymentResponse
+		// want lists the drifts as kind, deployment and instance
+		want [][3]string
+	}{
+		{"in sync", []models.DynamoDBData{record("a", models.StatusRunning)}, []models.DeploymentResponse{inst("a", "i-1", now)}, nil},
+		{"legacy record", []models.DynamoDBData{record("a", "")}, []models.DeploymentResponse{inst("a", "i-1", now)}, nil},
+		{"missing instance", []models.DynamoDBData{record("a", models.StatusRunning)}, nil, [][3]string{{"missing_instance", "a", ""}}},
+		{"failed without an instance", []models.DynamoDBData{record("a", models.StatusFailed)}, nil, [][3]string{{"missing_instance", "a", ""}}},
+		{"requested", []models.DynamoDBData{record("a", models.StatusRequested)}, nil, nil},
+		{"provisioning", []models.DynamoDBData{record("a", models.StatusProvisioning)}, []models.DeploymentResponse{resized}, nil},
+		{"deleting", []models.DynamoDBData{record("a", models.StatusDeleting)}, []models.DeploymentResponse{inst("a", "i-1", now)}, nil},
+		{"deleted with an instance", []models.DynamoDBData{record("a", models.StatusDeleted)}, []models.DeploymentResponse{inst("a", "i-1", now)}, [][3]string{{"orphaned_instance", "a", "i-1"}}},
+		{"no record", nil, []models.DeploymentResponse{inst("a", "i-1", now)}, [][3]string{{"orphaned_instance", "a", "i-1"}}},
+		{"duplicate instance", []models.DynamoDBData{record("a", models.StatusRunning)}, []models.DeploymentResponse{inst("a", "i-2", now), inst("a", "i-1", earlier)}, [][3]string{{"duplicate_instance", "a", "i-2"}}},
+		{"server size", []models.DynamoDBData{record("a", models.StatusRunning)}, []models.DeploymentResponse{resized}, [][3]string{{"server_size_mismatch", "a", "i-1"}}},
+		{"AMI", []models.DynamoDBData{record("a", models.StatusRunning)}, []models.DeploymentResponse{rebuilt}, [][3]string{{"ami_mismatch", "a", "i-1"}}},
+		{"lifecycle", []models.DynamoDBData{record("a", models.StatusRunning)}, []models.DeploymentResponse{spot}, [][3]string{{"lifecycle_mismatch", "a", "i-1"}}},
+		{"sorted by deployment", []models.DynamoDBData{record("b", models.StatusRunning), record("a", models.StatusRunning)}, []models.DeploymentResponse{inst("c", "i-3", now)}, [][3]string{
+			{"missing_instance", "a", ""},
+			{"missing_instance", "b", ""},
+			{"orphaned_instance", "c", "i-3"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := driftReport(tt.records, tt.instances, now)
+			if report.Deployments != len(tt.records) || report.Instances != len(tt.instances) {
+				t.Errorf("report counts %d deployments and %d instances, want %d and %d", report.Deployments, report.Instances, len(tt.records), len(tt.instances))
+			}
+			var got [][3]string
+			for _, d := range report.Drifts {
+				got = append(got, [3]string{string(d.Kind), d.DeploymentID, d.InstanceID})
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("drifts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
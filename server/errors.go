@@ -0,0 +1,184 @@
+package server
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/aws/smithy-go"
+	"github.com/awslabs/aws-lambda-go-api-proxy/core"
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/instance"
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	requestIDHeader     = "X-Request-ID"
+	requestIDContextKey = "requestID"
+	// the X-Request-ID or X-Correlation-ID a caller sent is kept as its
+	// correlation ID and echoed in X-Correlation-ID
+	correlationIDHeader     = "X-Correlation-ID"
+	correlationIDContextKey = "correlationID"
+	maxCorrelationIDLength  = 128
+)
+
+// apiError is an error that knows how it should be reported to the client.
+type apiError struct {
+	status  int
+	code    models.ErrorCode
+	message string
+	details []models.FieldError
+	err     error
+}
+
+func (e *apiError) Error() string {
+	if e.err != nil {
+		return fmt.Sprintf("%s: %v", e.message, e.err)
+	}
+	return e.message
+}
+
+func (e *apiError) Unwrap() error {
+	return e.err
+}
+
+func newAPIError(status int, code models.ErrorCode, format string, args ...any) *apiError {
+	return &apiError{status: status, code: code, message: fmt.Sprintf(format, args...)}
+}
+
+func badRequest(err error) *apiError {
+	return &apiError{
+		status:  http.StatusBadRequest,
+		code:    models.ErrCodeInvalidRequest,
+		message: "Invalid request body",
+		details: []models.FieldError{{Field: "body", Message: err.Error()}},
+		err:     err,
+	}
+}
+
+func validationFailed(details []models.FieldError) *apiError {
+	return &apiError{
+		status:  http.StatusBadRequest,
+		code:    models.ErrCodeValidationFailed,
+		message: "Invalid deployment request",
+		details: details,
+	}
+}
+
+// classifyAWSError maps the AWS error codes callers can act on to a status
+// and error code. Anything else is reported as a generic AWS failure.
+func classifyAWSError(code string) (int, models.ErrorCode, string) {
+	switch {
+	case code == "Throttling" || code == "ThrottlingException" || code == "RequestLimitExceeded" ||
+		code == "TooManyRequestsException" || code == "ProvisionedThroughputExceededException":
+		return http.StatusTooManyRequests, models.ErrCodeThrottled, "AWS is throttling requests, try again shortly"
+	case code == "UnauthorizedOperation" || code == "AccessDenied" || code == "AccessDeniedException" ||
+		code == "AuthFailure" || code == "UnrecognizedClientException" || code == "ExpiredToken":
+		return http.StatusForbidden, models.ErrCodeAWSUnauthorized, "turbo-deploy is not permitted to perform this AWS operation"
+	case strings.HasSuffix(code, ".NotFound") || strings.HasSuffix(code, ".Malformed") ||
+		code == "InvalidAMIID.Unavailable" || code == "ResourceNotFoundException":
+		return http.StatusNotFound, models.ErrCodeNotFound, "The requested AWS resource does not exist"
+	case code == "IncorrectInstanceState" || strings.HasSuffix(code, ".Duplicate"):
+		return http.StatusConflict, models.ErrCodeConflict, "The AWS resource is not in a state that allows this action"
+	default:
+		return http.StatusBadGateway, models.ErrCodeAWSError, fmt.Sprintf("AWS request failed (%s)", code)
+	}
+}
+
+// toAPIError classifies err into the status and code returned to the client.
+func toAPIError(err error) *apiError {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	switch {
+	case errors.Is(err, db.ErrURLNotFound):
+		return &apiError{status: http.StatusNotFound, code: models.ErrCodeNotFound, message: "Record not found", err: err}
+	case errors.Is(err, db.ErrAPIKeyNotFound):
+		return &apiError{status: http.StatusNotFound, code: models.ErrCodeNotFound, message: "API key not found", err: err}
+	case errors.Is(err, db.ErrHostnameExists):
+		return &apiError{status: http.StatusConflict, code: models.ErrCodeHostnameExists, message: "Hostname already exists", err: err}
+	case errors.Is(err, db.ErrDeploymentRemoved):
+		return errDeploymentRemoved
+	case errors.Is(err, db.ErrExpiryChanged):
+		return &apiError{status: http.StatusConflict, code: models.ErrCodeConflict, message: "The expiry of the deployment changed meanwhile, try again", err: err}
+	case errors.Is(err, instance.ErrNotManaged):
+		return &apiError{status: http.StatusForbidden, code: models.ErrCodeForbidden, message: "The instance or image does not belong to this turbo-deploy deployment", err: err}
+	case errors.Is(err, instance.ErrNoInstance):
+		return &apiError{status: http.StatusConflict, code: models.ErrCodeConflict, message: "The deployment has no instance yet", err: err}
+	}
+
+	var awsErr smithy.APIError
+	if errors.As(err, &awsErr) {
+		status, code, message := classifyAWSError(awsErr.ErrorCode())
+		return &apiError{status: status, code: code, message: message, err: err}
+	}
+
+	return &apiError{status: http.StatusInternalServerError, code: models.ErrCodeInternal, message: "Internal server error", err: err}
+}
+
+// respondWithError aborts the request with the error envelope for err.
+func respondWithError(c *gin.Context, err error) {
+	apiErr := toAPIError(err)
+	requestID := c.GetString(requestIDContextKey)
+	c.Set(errorCodeContextKey, apiErr.code)
+
+	if apiErr.status >= http.StatusInternalServerError || apiErr.err != nil {
+		log.Printf("request %s: %s %s failed: %v", requestID, c.Request.Method, c.Request.URL.Path, err)
+	}
+
+	c.AbortWithStatusJSON(apiErr.status, models.ErrorResponse{
+		Code:          apiErr.code,
+		Message:       apiErr.message,
+		RequestID:     requestID,
+		CorrelationID: c.GetString(correlationIDContextKey),
+		Details:       apiErr.details,
+	})
+}
+
+// requestIDMiddleware tags every request with an ID that is echoed in the
+// X-Request-ID header and in error responses, the API Gateway request ID when
+// running in Lambda. An ID sent by the caller is never used as the request ID,
+// it is kept as the correlation ID if it passes validCorrelationID.
+func requestIDMiddleware(c *gin.Context) {
+	var requestID string
+	if gatewayCtx, ok := core.GetAPIGatewayContextFromContext(c.Request.Context()); ok {
+		requestID = gatewayCtx.RequestID
+	}
+	if requestID == "" {
+		requestID = uuid.New().String()
+	}
+	c.Set(requestIDContextKey, requestID)
+	c.Header(requestIDHeader, requestID)
+
+	correlationID := cmp.Or(c.GetHeader(correlationIDHeader), c.GetHeader(requestIDHeader))
+	if validCorrelationID(correlationID) {
+		c.Set(correlationIDContextKey, correlationID)
+		c.Header(correlationIDHeader, correlationID)
+	}
+	c.Next()
+}
+
+// validCorrelationID reports whether id is short enough and only made of
+// letters, digits and "-_.:", so it is safe to echo and to log.
+func validCorrelationID(id string) bool {
+	if id == "" || len(id) > maxCorrelationIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || strings.ContainsRune("-_.:", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func notFoundHandler(c *gin.Context) {
+	respondWithError(c, newAPIError(http.StatusNotFound, models.ErrCodeNotFound, "No route for %s %s", c.Request.Method, c.Request.URL.Path))
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/awslabs/aws-lambda-go-api-proxy/core"
+	"github.com/gin-gonic/gin"
+
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(requestIDMiddleware)
+	r.NoRoute(notFoundHandler)
+
+	tests := []struct {
+		name          string
+		gatewayID     string
+		headers       map[string]string
+		correlationID string
+	}{
+		{"no IDs", "", nil, ""},
+		{"API Gateway", "gw-1", map[string]string{"X-Request-ID": "caller-1"}, "caller-1"},
+		{"caller ID", "", map[string]string{"X-Request-ID": "caller-1"}, "caller-1"},
+		{"correlation ID first", "", map[string]string{"X-Request-ID": "caller-1", "X-Correlation-ID": "caller-2"}, "caller-2"},
+		{"too long", "", map[string]string{"X-Request-ID": strings.Repeat("a", maxCorrelationIDLength+1)}, ""},
+		{"longest", "", map[string]string{"X-Request-ID": strings.Repeat("a", maxCorrelationIDLength)}, strings.Repeat("a", maxCorrelationIDLength)},
+		{"invalid characters", "", map[string]string{"X-Request-ID": "caller 1\r\nforged: yes"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+			if tt.gatewayID != "" {
+				var err error
+				req, err = new(core.RequestAccessor).EventToRequestWithContext(context.Background(), events.APIGatewayProxyRequest{
+					HTTPMethod:     http.MethodGet,
+					Path:           "/missing",
+					RequestContext: events.APIGatewayProxyRequestContext{RequestID: tt.gatewayID},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			requestID := w.Header().Get(requestIDHeader)
+			switch {
+			case tt.gatewayID != "" && requestID != tt.gatewayID:
+				t.Errorf("request ID is %q, want the API Gateway's %q", requestID, tt.gatewayID)
+			case requestID == "" || requestID == tt.headers["X-Request-ID"]:
+				t.Errorf("request ID is %q, want one assigned by the server", requestID)
+			}
+			if got := w.Header().Get(correlationIDHeader); got != tt.correlationID {
+				t.Errorf("correlation ID header is %q, want %q", got, tt.correlationID)
+			}
+
+			var body models.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.RequestID != requestID || body.CorrelationID != tt.correlationID {
+				t.Errorf("error response has request %q and correlation %q, want %q and %q", body.RequestID, body.CorrelationID, requestID, tt.correlationID)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/auth"
+	"github.com/frgrisk/turbo-deploy/server/config"
+	"github.com/frgrisk/turbo-deploy/server/instance"
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/frgrisk/turbo-deploy/server/notify"
+	"github.com/frgrisk/turbo-deploy/server/timeutil"
+	"github.com/gin-gonic/gin"
+)
+
+// ExtendDeployment moves the expiry of a deployment without editing the rest
+// of it.
+func (s *Server) ExtendDeployment(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param(pathParameterName)
+
+	var req models.ExtendRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, badRequest(err))
+		return
+	}
+
+	record, err := s.store.GetRecord(ctx, id)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	if record.Removed() {
+		respondWithError(c, errDeploymentRemoved)
+		return
+	}
+
+	now := time.Now()
+	expiry, field, err := newExpiry(record.TimeToExpire, req, now)
+	if err == nil {
+		err = s.checkLifetime(field, record.CreatedAt, record.TimeToExpire, expiry.Unix())
+	} else {
+		err = validationFailed([]models.FieldError{{Field: field, Message: err.Error()}})
+	}
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	var user string
+	if identity, ok := auth.FromContext(ctx); ok {
+		user = identity.User
+	}
+	s.applyExpiry(c, id, record.TimeToExpire, expiry, user, now)
+}
+
+// extendLinkPage asks to confirm the extension of a deployment through the
+// link of an expiry warning. Following the link only shows the page, so link
+// previews and mail scanners do not extend anything.
+var extendLinkPage = template.Must(template.New("extend-link").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Extend {{.Hostname}}</title>
+</head>
+<body>
+<h1>Extend {{.Hostname}}</h1>
+<p>The deployment expires at {{.ExpiresAt}}. Extend it by {{.By}}?</p>
+<form method="post" action="{{.Action}}">
+<button type="submit">Extend by {{.By}}</button>
+</form>
+</body>
+</html>
+`))
+
+// ConfirmExtendDeploymentByLink shows the page that confirms an extension
+// through the signed link of an expiry warning, without changing anything.
+func (s *Server) ConfirmExtendDeploymentByLink(c *gin.Context) {
+	record, link, ok := s.extendLink(c)
+	if !ok {
+		return
+	}
+
+	// the query holds the signature, keep it out of Referer headers and caches
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	err := extendLinkPage.Execute(c.Writer, map[string]string{
+		"Hostname":  s.shortHostname(record.Hostname),
+		"ExpiresAt": time.Unix(link.expiry, 0).UTC().Format(time.RFC1123),
+		"By":        timeutil.FormatDuration(link.by),
+		"Action":    "extend-link?" + c.Request.URL.RawQuery,
+	})
+	if err != nil {
+		log.Printf("failed to render the extend page of deployment %s: %v", record.ID, err)
+	}
+}
+
+// ExtendDeploymentByLink extends a deployment through the signed link of an
+// expiry warning, once confirmed. The link stands in for authentication, so
+// the extension is recorded for the user the warning was sent to.
+func (s *Server) ExtendDeploymentByLink(c *gin.Context) {
+	record, link, ok := s.extendLink(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	extended := time.Unix(link.expiry, 0).Add(link.by)
+	if !extended.After(now) {
+		extended = now.Add(link.by)
+	}
+	if err := s.checkLifetime("by", record.CreatedAt, record.TimeToExpire, extended.Unix()); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	s.applyExpiry(c, record.ID, link.expiry, extended, record.CreationUser, now)
+}
+
+// signedLink is a verified extend link.
+type signedLink struct {
+	by     time.Duration
+	expiry int64
+}
+
+// extendLink verifies the extend link of the request and returns the record
+// of its deployment, while the link can still be used. It responds with the
+// error and returns false otherwise.
+func (s *Server) extendLink(c *gin.Context) (*models.DynamoDBData, signedLink, bool) {
+	ctx := c.Request.Context()
+	id := c.Param(pathParameterName)
+
+	if s.links == nil {
+		respondWithError(c, newAPIError(http.StatusNotFound, models.ErrCodeNotFound, "Extend links are not enabled"))
+		return nil, signedLink{}, false
+	}
+
+	by := c.Query("by")
+	expiry, err := strconv.ParseInt(c.Query("expiry"), 10, 64)
+	if err != nil || !s.links.Verify(id, by, expiry, c.Query("sig")) {
+		respondWithError(c, newAPIError(http.StatusForbidden, models.ErrCodeForbidden, "The extend link is not valid"))
+		return nil, signedLink{}, false
+	}
+	duration, err := time.ParseDuration(by)
+	if err != nil {
+		respondWithError(c, newAPIError(http.StatusForbidden, models.ErrCodeForbidden, "The extend link is not valid"))
+		return nil, signedLink{}, false
+	}
+
+	record, err := s.store.GetRecord(ctx, id)
+	if err != nil {
+		respondWithError(c, err)
+		return nil, signedLink{}, false
+	}
+	noteAudit(c).actor = record.CreationUser
+	if record.Removed() {
+		respondWithError(c, errDeploymentRemoved)
+		return nil, signedLink{}, false
+	}
+	if record.TimeToExpire != expiry {
+		respondWithError(c, errExtendLinkUsed)
+		return nil, signedLink{}, false
+	}
+
+	return record, signedLink{by: duration, expiry: expiry}, true
+}
+
+// applyExpiry moves deployment id from its previous expiry to expiry and
+// responds with it. The record is updated first, it is what the reaper goes
+// by, then the TimeToExpire tag of the instance if it has one.
+func (s *Server) applyExpiry(c *gin.Context, id string, previous int64, expiry time.Time, user string, now time.Time) {
+	ctx := c.Request.Context()
+
+	if err := s.store.SetExpiry(ctx, id, previous, expiry.Unix(), user, now.Unix()); err != nil {
+		respondWithError(c, err)
+		return
+	}
+	log.Printf("deployment %s now expires at %s", id, expiry.Format(time.RFC3339))
+
+	// the provisioner tags new instances from the record
+	inst, err := s.deploymentInstance(ctx, id)
+	switch {
+	case errors.Is(err, instance.ErrNoInstance):
+	case err != nil:
+		log.Printf("failed to find the instance of deployment %s to tag: %v", id, err)
+	default:
+		noteAudit(c).instanceID = inst.InstanceID
+		if err := s.compute.SetInstanceExpiry(ctx, id, inst.InstanceID, expiry.Unix()); err != nil {
+			log.Printf("failed to update the TimeToExpire tag of instance %s: %v", inst.InstanceID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, models.Expiry{
+		DeploymentID: id,
+		TimeToExpire: expiry.Unix(),
+		ExpiresAt:    expiry.UTC(),
+		ExtendedBy:   user,
+		ExtendedAt:   now.UTC().Truncate(time.Second),
+	})
+}
+
+// errExtendLinkUsed refuses an extend link whose deployment no longer
+// expires at the time the link was signed for.
+var errExtendLinkUsed = newAPIError(http.StatusConflict, models.ErrCodeConflict, "The extend link was used already or the deployment was extended since")
+
+// extendLinks returns the extend links configured by cfg, or nil.
+func extendLinks(cfg config.NotifyConfig) *notify.Links {
+	if cfg.LinkSecret == "" {
+		return nil
+	}
+	return &notify.Links{BaseURL: cfg.LinkBaseURL, Secret: []byte(cfg.LinkSecret), ExtendBy: cfg.ExtendBy}
+}
+
+// newExpiry returns the expiry asked for by req, given the current one, and
+// the request field it was taken from.
+func newExpiry(current int64, req models.ExtendRequest, now time.Time) (time.Time, string, error) {
+	if (req.Duration == "") == (req.ExpiresAt == nil) {
+		return time.Time{}, "duration", errors.New("set either duration or expiresAt")
+	}
+
+	field := "expiresAt"
+	var expiry time.Time
+	if req.ExpiresAt != nil {
+		expiry = *req.ExpiresAt
+	} else {
+		field = "duration"
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			return time.Time{}, field, fmt.Errorf("%q is not a duration such as 4h or 90m", req.Duration)
+		}
+		base := now
+		if current > 0 {
+			base = time.Unix(current, 0)
+		}
+		expiry = base.Add(duration)
+	}
+
+	if !expiry.After(now) {
+		return time.Time{}, field, fmt.Errorf("the new expiry %s is not in the future", expiry.UTC().Format(time.RFC3339))
+	}
+	return expiry.Truncate(time.Second), field, nil
+}
+
+// checkLifetime refuses an expiry past the maximum lifetime of a deployment
+// created at createdAt, reporting it on field, and no expiry at all. Records
+// from before the creation time was kept count from now. An expiry that is
+// not later than the previous one is allowed, so lowering the limit does not
+// lock existing deployments.
+func (s *Server) checkLifetime(field string, createdAt, previous, expiry int64) error {
+	maxLifetime := s.cfg.Expiry.MaxLifetime
+	if maxLifetime <= 0 {
+		return nil
+	}
+	if expiry <= 0 {
+		return validationFailed([]models.FieldError{{
+			Field:   field,
+			Message: fmt.Sprintf("a TTL is required, deployments may live at most %s", maxLifetime),
+		}})
+	}
+
+	start := time.Now()
+	if createdAt > 0 {
+		start = time.Unix(createdAt, 0)
+	}
+	deadline := start.Add(maxLifetime)
+	if expiry <= deadline.Unix() || (previous > 0 && expiry <= previous) {
+		return nil
+	}
+
+	return validationFailed([]models.FieldError{{
+		Field:   field,
+		Message: fmt.Sprintf("deployments may live at most %s, this one until %s", maxLifetime, deadline.UTC().Format(time.RFC3339)),
+	}})
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/frgrisk/turbo-deploy/server/config"
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/instance"
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/frgrisk/turbo-deploy/server/notify"
+)
+
+func TestCheckLifetime(t *testing.T) {
+	s := &Server{cfg: &config.Config{Expiry: config.ExpiryConfig{MaxLifetime: 24 * time.Hour}}}
+	now := time.Now().Unix()
+	created := now - int64(time.Hour/time.Second)
+	deadline := created + int64(24*time.Hour/time.Second)
+
+	tests := []struct {
+		name      string
+		createdAt int64
+		previous  int64
+		expiry    int64
+		ok        bool
+	}{
+		{"within the lifetime", created, 0, deadline, true},
+		{"past the lifetime", created, 0, deadline + 60, false},
+		{"no TTL", created, 0, 0, false},
+		{"no TTL on an edit", created, deadline, 0, false},
+		{"keeping an expiry past a lowered limit", created, deadline + 3600, deadline + 3600, true},
+		{"shortening an expiry past a lowered limit", created, deadline + 3600, deadline + 60, true},
+		{"extending an expiry past a lowered limit", created, deadline + 3600, deadline + 7200, false},
+		{"unknown creation time counts from now", 0, 0, now + int64(23*time.Hour/time.Second), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.checkLifetime("ttlValue", tt.createdAt, tt.previous, tt.expiry)
+			if tt.ok {
+				if err != nil {
+					t.Fatalf("checkLifetime() = %v, want nil", err)
+				}
+				return
+			}
+			var apiErr *apiError
+			if !errors.As(err, &apiErr) || apiErr.code != models.ErrCodeValidationFailed || len(apiErr.details) != 1 || apiErr.details[0].Field != "ttlValue" {
+				t.Fatalf("checkLifetime() = %v, want a validation error on ttlValue", err)
+			}
+		})
+	}
+}
+
+func TestCheckLifetimeUnlimited(t *testing.T) {
+	s := &Server{cfg: &config.Config{}}
+	if err := s.checkLifetime("ttlValue", 1, 0, 0); err != nil {
+		t.Errorf("checkLifetime() without a TTL = %v, want nil", err)
+	}
+	if err := s.checkLifetime("ttlValue", 1, 0, time.Now().Add(24*365*time.Hour).Unix()); err != nil {
+		t.Errorf("checkLifetime() a year out = %v, want nil", err)
+	}
+}
+
+func TestExtendDeploymentByLink(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	links := &notify.Links{BaseURL: "http://api", Secret: []byte("secret"), ExtendBy: 4 * time.Hour}
+	s := &Server{
+		cfg:     &config.Config{Domain: "example.com"},
+		store:   store,
+		compute: instance.NewService(instance.NewFakeProvider()),
+		links:   links,
+	}
+	router := gin.New()
+	router.GET("/v1/deployments/:id/extend-link", s.ConfirmExtendDeploymentByLink)
+	router.POST("/v1/deployments/:id/extend-link", s.ExtendDeploymentByLink)
+
+	expiry := time.Now().Add(time.Hour).Unix()
+	if _, err := store.SaveRecord(ctx, models.DynamoDBData{ID: "a1", Hostname: "web.example.com", TimeToExpire: expiry}); err != nil {
+		t.Fatalf("SaveRecord: %v", err)
+	}
+	link := strings.TrimPrefix(links.URL("a1", expiry), "http://api")
+	expiresAt := func() int64 {
+		record, err := store.GetRecord(ctx, "a1")
+		if err != nil {
+			t.Fatalf("GetRecord: %v", err)
+		}
+		return record.TimeToExpire
+	}
+
+	steps := []struct {
+		name   string
+		method string
+		target string
+		status int
+		expiry int64
+	}{
+		{"opening the link", http.MethodGet, link, http.StatusOK, expiry},
+		{"opening it again", http.MethodGet, link, http.StatusOK, expiry},
+		{"a tampered link", http.MethodPost, strings.Replace(link, "by=4h", "by=400h", 1), http.StatusForbidden, expiry},
+		{"confirming", http.MethodPost, link, http.StatusOK, expiry + 4*3600},
+		{"confirming again", http.MethodPost, link, http.StatusConflict, expiry + 4*3600},
+		{"opening a used link", http.MethodGet, link, http.StatusConflict, expiry + 4*3600},
+	}
+	for _, step := range steps {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(step.method, step.target, nil))
+		if w.Code != step.status {
+			t.Fatalf("%s: status %d, want %d: %s", step.name, w.Code, step.status, w.Body)
+		}
+		if got := expiresAt(); got != step.expiry {
+			t.Fatalf("%s: expiry %d, want %d", step.name, got, step.expiry)
+		}
+		if step.method == http.MethodGet && w.Code == http.StatusOK && !strings.Contains(w.Body.String(), `<form method="post"`) {
+			t.Fatalf("%s: no confirmation form in %s", step.name, w.Body)
+		}
+	}
+}
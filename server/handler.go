@@ -7,137 +7,199 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	ginadapter "github.com/awslabs/aws-lambda-go-api-proxy/gin"
+	"github.com/frgrisk/turbo-deploy/server/auth"
+	"github.com/frgrisk/turbo-deploy/server/config"
 	"github.com/frgrisk/turbo-deploy/server/db"
-	"github.com/frgrisk/turbo-deploy/server/decode"
+	"github.com/frgrisk/turbo-deploy/server/idle"
 	"github.com/frgrisk/turbo-deploy/server/instance"
 	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/frgrisk/turbo-deploy/server/notify"
+	"github.com/frgrisk/turbo-deploy/server/pricing"
+	"github.com/frgrisk/turbo-deploy/server/provisioner"
+	"github.com/frgrisk/turbo-deploy/server/quota"
 	"github.com/frgrisk/turbo-deploy/server/timeutil"
+	"github.com/frgrisk/turbo-deploy/server/validate"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
-var (
-	r         *gin.Engine // Declare r at the package level
+// Server serves the turbo-deploy REST API on top of a DeploymentStore and an
+// instance.Service.
+type Server struct {
+	cfg     *config.Config
+	store   db.DeploymentStore
+	apiKeys db.APIKeyStore
+	audit   db.AuditStore
+	compute *instance.Service
+	// authenticator is nil when authentication is disabled.
+	authenticator auth.Authenticator
+	policy        *auth.Policy
+	quotas        *quota.Quotas
+	// prices is nil when no price table is configured.
+	prices *pricing.Table
+	// links is nil when extend links are not configured.
+	links *notify.Links
+	// metrics reads the utilization of instances for idle policies.
+	metrics idle.Metrics
+	// backends register the hostnames and supply the user data of the
+	// instances launched by the provisioner.
+	backends  provisioner.Backends
+	router    *gin.Engine
 	ginLambda *ginadapter.GinLambda
-)
+}
 
-func init() {
+// New builds a Server that keeps deployment requests, API keys and the audit
+// log in stores, and manages instances and images through compute. Costs are
+// estimated from prices, which may be nil. Idle instances are found from
+// metrics. The provisioner launches instances with backends.
+func New(cfg *config.Config, stores db.Stores, compute *instance.Service, prices *pricing.Table, metrics idle.Metrics, backends provisioner.Backends) *Server {
 	gin.SetMode(gin.ReleaseMode)
-	r = gin.Default()
-
-	// construct hostname for cors
-	domainEnv := os.Getenv("ROUTE53_DOMAIN_NAME")
-	hostEnv := os.Getenv("WEBSERVER_HOSTNAME")
-	httpPortEnv := os.Getenv("WEBSERVER_HTTP_PORT")
-	httpsPortEnv := os.Getenv("WEBSERVER_HTTPS_PORT")
-	fullName := fmt.Sprintf("%s.%s", hostEnv, domainEnv)
+	r := gin.Default()
 
 	// setup allowed origins
-	config := cors.DefaultConfig()
-	config.AllowOrigins = []string{fmt.Sprintf("http://%s:%s", fullName, httpPortEnv), fmt.Sprintf("https://%s:%s", fullName, httpsPortEnv), fmt.Sprintf("https://%s", fullName), fmt.Sprintf("https://%s", fullName)}
-	r.Use(cors.New(config))
-
-	SetupRoutes(r)
-	ginLambda = ginadapter.New(r)
+	corsConfig := cors.DefaultConfig()
+	corsConfig.AllowOrigins = cfg.AllowedOrigins()
+	corsConfig.AddAllowHeaders("Authorization")
+	corsConfig.ExposeHeaders = []string{requestIDHeader, correlationIDHeader}
+	r.Use(cors.New(corsConfig))
+	r.Use(requestIDMiddleware)
+	r.NoRoute(notFoundHandler)
+
+	s := &Server{
+		cfg:           cfg,
+		store:         stores.Deployments,
+		apiKeys:       stores.APIKeys,
+		audit:         stores.Audit,
+		compute:       compute,
+		authenticator: auth.FromConfig(cfg.Auth, stores.APIKeys),
+		policy:        auth.NewPolicy(cfg.Auth),
+		quotas:        quota.New(cfg.Quota),
+		prices:        prices,
+		links:         extendLinks(cfg.Notify),
+		metrics:       metrics,
+		backends:      backends,
+		router:        r,
+	}
+	s.SetupRoutes(r)
+	s.ginLambda = ginadapter.New(r)
+
+	return s
 }
 
-func Start() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+// NewFromConfig builds a Server backed by DynamoDB, EC2, CloudWatch, Route53
+// and S3, using the AWS credentials found in the environment.
+func NewFromConfig(ctx context.Context, cfg *config.Config) (*Server, error) {
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load SDK config: %w", err)
 	}
-	fmt.Printf("Server listening on port %s...\n", port)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatalf("Failed to run server: %v", err)
+
+	dynamoClient := dynamodb.NewFromConfig(awsCfg)
+	stores := db.Stores{
+		Deployments: db.NewDynamoDBStore(dynamoClient, cfg.Database.TableName),
+		APIKeys:     db.NewDynamoDBAPIKeyStore(dynamoClient, cfg.Database.APIKeysTable),
+		Audit:       db.NewDynamoDBAuditStore(dynamoClient, cfg.Database.AuditTable),
 	}
-}
+	compute := instance.NewService(ec2.NewFromConfig(awsCfg))
 
-func Handler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	return ginLambda.ProxyWithContext(ctx, req)
-}
+	var prices *pricing.Table
+	if cfg.Pricing.TableFile != "" {
+		if prices, err = pricing.LoadTable(cfg.Pricing.TableFile); err != nil {
+			return nil, err
+		}
+	}
+
+	var backends provisioner.Backends
+	if cfg.Provisioner.HostedZoneID != "" {
+		backends.DNS = provisioner.NewRoute53(route53.NewFromConfig(awsCfg), cfg.Provisioner.HostedZoneID)
+	}
+	if cfg.Provisioner.ScriptsBucket != "" {
+		backends.Scripts = provisioner.NewS3Scripts(s3.NewFromConfig(awsCfg), cfg.Provisioner.ScriptsBucket)
+	}
 
-func SetupRoutes(r *gin.Engine) {
-	// EC2 Instance Request Management
-	r.POST("/instance-request", CreateInstanceRequest)
-	r.GET("/instance-request/:id", GetInstanceRequest)
-	r.DELETE("/instance-request/:id", DeleteInstanceRequest)
-	r.DELETE("/instance-requests", DeleteAllInstanceRequests)
-	r.PUT("/instance-request/:id", UpdateInstanceRequest)
-
-	// Deployed EC2 Instances
-	r.GET("/deployments", GetDeployedRequest)
-	r.POST("/start-instance/:id", StartInstanceRequest)
-	r.POST("/stop-instance/:id", StopInstanceRequest)
-
-	// AWS Data requests
-	r.GET("/awsdata", GetAWSData)
-
-	// Capture instance Ami
-	r.PUT("/instance-ami/:id/capture", CaptureInstanceAMI)
-	r.GET("/instance-ami/:instance_id/check-limit", CheckAMILimit)
-	r.DELETE("/instance-ami/:instance_id/:image_id", DeleteInstanceAMI)
+	return New(cfg, stores, compute, prices, idle.NewCloudWatch(cloudwatch.NewFromConfig(awsCfg)), backends), nil
 }
 
-func CreateInstanceRequest(c *gin.Context) {
-	var req models.Payload
+func (s *Server) Start() {
+	fmt.Printf("Server listening on port %d...\n", s.cfg.Port)
+	if err := s.router.Run(fmt.Sprintf(":%d", s.cfg.Port)); err != nil {
+		log.Fatalf("Failed to run server: %v", err)
+	}
+}
 
-	err := c.BindJSON(&req)
-	if err != nil {
-		if err := c.AbortWithError(http.StatusInternalServerError, err); err != nil {
-			log.Printf("Failed to abort with error: %v", err)
-		}
-		return
+// Handler is the Lambda entry point. It runs the scheduled job named by a
+// job event, reconciles the deployments changed in a DynamoDB stream event
+// and serves every other event as an API Gateway request.
+func (s *Server) Handler(ctx context.Context, event json.RawMessage) (any, error) {
+	var job JobEvent
+	if err := json.Unmarshal(event, &job); err == nil && job.Job != "" {
+		return s.RunJob(ctx, job)
 	}
 
-	// get hostname and concat with domain
-	domainEnv := os.Getenv("ROUTE53_DOMAIN_NAME")
-	hostname := req.Hostname + "." + domainEnv
+	var stream events.DynamoDBEvent
+	if err := json.Unmarshal(event, &stream); err == nil && len(stream.Records) > 0 && stream.Records[0].EventSource == "aws:dynamodb" {
+		return s.reconcileStream(ctx, stream)
+	}
 
-	// Convert request to DynamoDBData struct
-	data := models.DynamoDBData{
-		ID:                uuid.New().String()[:8],
-		Ami:               req.Ami,
-		ServerSize:        req.ServerSize,
-		Hostname:          hostname,
-		Region:            req.Region,
-		CreationUser:      req.CreationUser,
-		Lifecycle:         req.Lifecycle,
-		SnapShot:          req.SnapShot,
-		ContentDeployment: req.ContentDeployment,
-		UserData:          req.UserData,
+	var req events.APIGatewayProxyRequest
+	if err := json.Unmarshal(event, &req); err != nil {
+		return nil, fmt.Errorf("failed to decode event: %w", err)
 	}
+	return s.ginLambda.ProxyWithContext(ctx, req)
+}
 
-	if req.TTLValue > 0 && req.TTLUnit != "" {
-		ttl, err := timeutil.CalculateTTL(req.TTLValue, req.TTLUnit)
-		if err != nil {
-			log.Printf("Failed to calculate TTL: %v", err)
-			return
+func (s *Server) SetupRoutes(r *gin.Engine) {
+	for _, route := range s.routes() {
+		var handlers []gin.HandlerFunc
+		if !route.Public {
+			handlers = append(handlers, s.authenticate)
 		}
-		data.TimeToExpire = ttl
+		if route.Method != http.MethodGet && !route.readOnly {
+			handlers = append(handlers, s.auditRoute(route))
+		}
+		if route.authorize != nil {
+			handlers = append(handlers, route.authorize)
+		}
+		if route.Deprecated {
+			handlers = append(handlers, s.deprecated(route.successor, route.instanceParam))
+		}
+		r.Handle(route.Method, route.Path, append(handlers, route.handler)...)
 	}
 
-	record, err := db.SaveRecord(data)
+	// API documentation, readable without authentication
+	r.GET("/openapi.json", s.GetOpenAPISpec)
+	r.GET("/docs", s.GetDocs)
+}
+
+func (s *Server) CreateInstanceRequest(c *gin.Context) {
+	var req models.Payload
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, badRequest(err))
+		return
+	}
+
+	record, err := s.createRecord(c.Request.Context(), req)
 	if err != nil {
-		if errors.Is(err, db.ErrHostnameExists) {
-			c.JSON(http.StatusConflict, gin.H{"error": "Hostname already exists"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save record"})
+		respondWithError(c, err)
 		return
 	}
+	noteCreated(c, record)
 
 	response := models.Response{ReturnedResponse: record}
 	c.JSON(http.StatusCreated, response)
@@ -145,48 +207,111 @@ func CreateInstanceRequest(c *gin.Context) {
 
 const pathParameterName = "id"
 
-func GetInstanceRequest(c *gin.Context) {
+func (s *Server) GetInstanceRequest(c *gin.Context) {
 	id := c.Param(pathParameterName)
-	record, err := db.GetRecord(id)
+	record, err := s.store.GetRecord(c.Request.Context(), id)
 	if err != nil {
-		if errors.Is(err, db.ErrURLNotFound) {
-			if err := c.AbortWithError(http.StatusNotFound, err); err != nil {
-				log.Printf("Failed to abort with error: %v", err)
-			}
-
-			return
-		}
-		if err := c.AbortWithError(http.StatusInternalServerError, err); err != nil {
-			log.Printf("Failed to abort with error: %v", err)
-		}
+		respondWithError(c, err)
 		return
 	}
 
 	// remove domain from hostname
-	domainEnv := os.Getenv("ROUTE53_DOMAIN_NAME")
-	record.Hostname = strings.TrimSuffix(record.Hostname, "."+domainEnv)
+	record.Hostname = s.shortHostname(record.Hostname)
 
 	c.JSON(http.StatusOK, record)
 }
 
-func UpdateInstanceRequest(c *gin.Context) {
-	// needs some change and fix here
+func (s *Server) UpdateInstanceRequest(c *gin.Context) {
 	var req models.Payload
 
-	err := c.BindJSON(&req)
-	if err != nil {
-		if err := c.AbortWithError(http.StatusInternalServerError, err); err != nil {
-			log.Printf("Failed to abort with error: %v", err)
-		}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, badRequest(err))
 		return
 	}
 
 	id := c.Param(pathParameterName)
 	log.Println("update request for id:", id)
 
+	if err := s.updateRecord(c.Request.Context(), id, req); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	log.Println("successfully updated record for", id)
+	c.Status(http.StatusNoContent)
+}
+
+// createRecord validates a deployment request, checks it against the quotas
+// and saves it, returning the ID of the new record. The record is created for
+// the authenticated caller, if there is one.
+func (s *Server) createRecord(ctx context.Context, req models.Payload) (string, error) {
+	if identity, ok := auth.FromContext(ctx); ok {
+		req.CreationUser = identity.User
+	}
+
+	if err := s.validatePayload(ctx, req, nil); err != nil {
+		return "", err
+	}
+
+	data, err := s.recordFromPayload(uuid.New().String()[:8], req)
+	if err != nil {
+		return "", err
+	}
+	data.CreatedAt = time.Now().Unix()
+	data.Status, data.StatusChangedAt = models.StatusRequested, data.CreatedAt
+	if err := s.checkLifetime("ttlValue", data.CreatedAt, 0, data.TimeToExpire); err != nil {
+		return "", err
+	}
+	if err := s.checkQuota(ctx, data); err != nil {
+		return "", err
+	}
+
+	return s.store.SaveRecord(ctx, data)
+}
+
+// updateRecord validates an edit of the deployment request id, checks it
+// against the quotas and saves it for the provisioner to apply. Authenticated
+// callers cannot change who the deployment was created for. Collaborators are
+// kept unless the edit lists them. Deleted deployments cannot be edited.
+func (s *Server) updateRecord(ctx context.Context, id string, req models.Payload) error {
+	existing, err := s.store.GetRecord(ctx, id)
+	if err != nil {
+		return err
+	}
+	if existing.Removed() {
+		return errDeploymentRemoved
+	}
+	if _, ok := auth.FromContext(ctx); ok {
+		req.CreationUser = existing.CreationUser
+	}
+	if req.Collaborators == nil {
+		req.Collaborators = existing.Collaborators
+	}
+
+	if err := s.validatePayload(ctx, req, existing); err != nil {
+		return err
+	}
+
+	data, err := s.recordFromPayload(id, req)
+	if err != nil {
+		return err
+	}
+	if err := s.checkLifetime("ttlValue", existing.CreatedAt, existing.TimeToExpire, data.TimeToExpire); err != nil {
+		return err
+	}
+	if err := s.checkQuota(ctx, data); err != nil {
+		return err
+	}
+	data.Status, data.StatusChangedAt = models.StatusRequested, time.Now().Unix()
+
+	return s.store.UpdateRecord(ctx, id, data)
+}
+
+// recordFromPayload converts a validated request into the record stored for
+// deployment id.
+func (s *Server) recordFromPayload(id string, req models.Payload) (models.DynamoDBData, error) {
 	// get hostname and concat with domain
-	domainEnv := os.Getenv("ROUTE53_DOMAIN_NAME")
-	hostname := req.Hostname + "." + domainEnv
+	hostname := req.Hostname + "." + s.cfg.Domain
 
 	// Convert request to DynamoDBData struct
 	data := models.DynamoDBData{
@@ -200,105 +325,104 @@ func UpdateInstanceRequest(c *gin.Context) {
 		SnapShot:          req.SnapShot,
 		ContentDeployment: req.ContentDeployment,
 		UserData:          req.UserData,
+		Collaborators:     req.Collaborators,
 	}
 
 	if req.TTLValue > 0 && req.TTLUnit != "" {
 		ttl, err := timeutil.CalculateTTL(req.TTLValue, req.TTLUnit)
 		if err != nil {
-			log.Printf("Failed to calculate TTL: %v", err)
-			return
+			return models.DynamoDBData{}, validationFailed([]models.FieldError{{Field: "ttlValue", Message: err.Error()}})
 		}
 		data.TimeToExpire = ttl
 	}
 
-	err = db.UpdateRecord(id, data)
+	return data, nil
+}
+
+// shortHostname removes the Route 53 domain from a stored hostname.
+func (s *Server) shortHostname(hostname string) string {
+	return strings.TrimSuffix(hostname, "."+s.cfg.Domain)
+}
+
+// validatePayload checks a create or edit request against the catalog and
+// returns the offending fields as a validation error. When editing, the
+// current AMI, size and scripts of the record stay valid even if they were
+// since removed from the catalog, and a deployment with a schedule or idle
+// policy cannot be moved to spot.
+func (s *Server) validatePayload(ctx context.Context, req models.Payload, existing *models.DynamoDBData) error {
+	available, err := s.loadCatalog(ctx)
 	if err != nil {
-		if errors.Is(err, db.ErrURLNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Record not found."})
-			return
-		}
-		if errors.Is(err, db.ErrHostnameExists) {
-			c.JSON(http.StatusConflict, gin.H{"error": "Hostname already exists"})
-			return
+		return err
+	}
+
+	catalog := validate.CatalogFromConfig(available)
+	if existing != nil {
+		catalog.Amis = append(catalog.Amis, existing.Ami)
+		catalog.ServerSizes = append(catalog.ServerSizes, existing.ServerSize)
+		catalog.UserScripts = append(catalog.UserScripts, existing.UserData...)
+	}
+
+	fieldErrors := validate.Payload(req, catalog)
+	if existing != nil && (existing.Schedule != nil || existing.IdlePolicy != nil) {
+		if err := validate.Stoppable(req.Lifecycle); err != nil {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: "lifecycle", Message: err.Error() + ", remove them first"})
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save record"})
-		return
+	}
+	if len(fieldErrors) > 0 {
+		return validationFailed(fieldErrors)
 	}
 
-	log.Println("successfully updated record for", id)
-	c.Status(http.StatusNoContent)
+	return nil
 }
 
-func DeleteInstanceRequest(c *gin.Context) {
+func (s *Server) DeleteInstanceRequest(c *gin.Context) {
 	id := c.Param(pathParameterName)
 
 	log.Println("delete request for id", id)
 
-	err := db.DeleteRecord(id)
+	err := s.deleteDeployment(c.Request.Context(), id)
 	if err != nil {
-		if errors.Is(err, db.ErrURLNotFound) {
-			if err := c.AbortWithError(http.StatusNotFound, err); err != nil {
-				log.Printf("Failed to abort with error: %v", err)
-			}
-			return
-		}
-		if err := c.AbortWithError(http.StatusInternalServerError, err); err != nil {
-			log.Printf("Failed to abort with error: %v", err)
-		}
+		respondWithError(c, err)
 		return
 	}
 
-	log.Println("successfully deleted", id)
+	log.Println("marked deployment for deletion", id)
 	c.Status(http.StatusNoContent)
 }
 
-func DeleteAllInstanceRequests(c *gin.Context) {
-	err := db.ClearAllRecords()
+func (s *Server) DeleteAllInstanceRequests(c *gin.Context) {
+	err := s.store.ClearAllRecords(c.Request.Context())
 	if err != nil {
-		if errors.Is(err, db.ErrURLNotFound) {
-			if err := c.AbortWithError(http.StatusNotFound, err); err != nil {
-				log.Printf("Failed to abort with error: %v", err)
-			}
-			return
-		}
-		if err := c.AbortWithError(http.StatusInternalServerError, err); err != nil {
-			log.Printf("Failed to abort with error: %v", err)
-		}
+		respondWithError(c, err)
 		return
 	}
 	log.Println("successfully deleted")
 	c.Status(http.StatusNoContent)
 }
 
-func GetAWSData(c *gin.Context) {
-	// read env variable
-	configEnv := os.Getenv("MY_AMI_ATTR")
-	regionEnv := os.Getenv("MY_REGION")
-	filterEnv := os.Getenv("AMI_FILTERS")
-	userdataEnv := os.Getenv("USER_SCRIPTS")
-
-	tempConfig := models.TempConfig{}
-	config := models.Config{}
-
-	// get list of userdata scripts from the env
-	err := json.Unmarshal([]byte(userdataEnv), &config.UserData)
+func (s *Server) GetAWSData(c *gin.Context) {
+	config, err := s.loadCatalog(c.Request.Context())
 	if err != nil {
-		log.Printf("Error parsing environment variable: %v", err)
-		abortWithLog(c, http.StatusInternalServerError, err)
+		respondWithError(c, err)
 		return
 	}
 
-	// get list of AMIs from the env
-	err = json.Unmarshal([]byte(configEnv), &tempConfig)
-	if err != nil {
-		log.Printf("Error parsing environment variable: %v", err)
-		abortWithLog(c, http.StatusInternalServerError, err)
-		return
+	c.JSON(http.StatusOK, config)
+}
+
+// loadCatalog resolves the configured AMIs, AMI filters and snapshots into the
+// choices offered to users.
+func (s *Server) loadCatalog(ctx context.Context) (models.Config, error) {
+	catalog := s.cfg.Catalog
+	config := models.Config{
+		Region:      s.cfg.Region,
+		ServerSizes: catalog.ServerSizes,
+		UserData:    catalog.UserScripts,
 	}
 
 	// Remove empty strings from the Ami config and add any amis to amilist
 	var amilist []models.AmiAttr
-	for _, ami := range tempConfig.Ami {
+	for _, ami := range catalog.Amis {
 		if ami != "" {
 			amiID := models.AmiAttr{
 				AmiID: ami,
@@ -307,23 +431,20 @@ func GetAWSData(c *gin.Context) {
 		}
 	}
 
-	amilist, err = instance.GetAMIName(amilist)
+	amilist, err := s.compute.GetAMIName(ctx, amilist)
 	if err != nil {
 		log.Printf("Failed to get AMI names: %v", err)
-		abortWithLog(c, http.StatusInternalServerError, err)
-		return
+		return models.Config{}, err
 	}
 
-	decodedFilter, _ := decode.Base64Gzip(filterEnv)
-
-	var filterMap map[string][]types.Filter
-
-	// get list of AMIs from the filters provided by user
-	err = json.Unmarshal([]byte(decodedFilter), &filterMap)
-	if err != nil {
-		log.Printf("Error parsing environment variable: %v", err)
-		abortWithLog(c, http.StatusInternalServerError, err)
-		return
+	filterMap := make(map[string][]types.Filter, len(catalog.AmiFilters)+1)
+	for name, filters := range catalog.AmiFilters {
+		for _, filter := range filters {
+			filterMap[name] = append(filterMap[name], types.Filter{
+				Name:   aws.String(filter.Name),
+				Values: filter.Values,
+			})
+		}
 	}
 
 	// manually add mandatory filter to the map
@@ -343,210 +464,174 @@ func GetAWSData(c *gin.Context) {
 	}
 
 	// add the amis retrieved based on filters given
-	amilist, err = instance.GetAvailableAmis(amilist, filterMap)
+	amilist, err = s.compute.GetAvailableAmis(ctx, amilist, filterMap)
 	if err != nil {
 		log.Printf("Error retrieving available AMIs: %v", err)
-		abortWithLog(c, http.StatusInternalServerError, err)
-		return
+		return models.Config{}, err
 	}
 
-	config.Region = regionEnv
-	config.ServerSizes = tempConfig.ServerSizes
 	config.Ami = amilist
 
-	c.JSON(http.StatusOK, config)
+	return config, nil
 }
 
-func abortWithLog(c *gin.Context, statusCode int, err error) {
-	if abortErr := c.AbortWithError(statusCode, err); abortErr != nil {
-		log.Printf("Failed to abort with status %d: %v", statusCode, abortErr)
+func (s *Server) GetDeployedRequest(c *gin.Context) {
+	ctx := c.Request.Context() // Extract the standard context from Gin's context
+	if err := s.compute.PopulateSpotTagResponse(ctx); err != nil {
+		respondWithError(c, fmt.Errorf("failed to populate tags for deployed instances: %w", err))
+		return
 	}
-}
 
-func GetEC2InstanceTypes(ctx context.Context) ([]string, error) {
-	cfg, err := config.LoadDefaultConfig(ctx)
+	instances, err := s.compute.GetDeployedInstances(ctx)
 	if err != nil {
-		log.Printf("Failed to load AWS SDk Config: %v", err)
-		return nil, err
-	}
-
-	ec2Client := ec2.NewFromConfig(cfg)
-
-	input := &ec2.DescribeInstanceTypesInput{
-		Filters: []types.Filter{
-			{
-				Name:   aws.String("processor-info.supported-architecture"),
-				Values: []string{"x86_64"},
-			},
-		},
+		respondWithError(c, fmt.Errorf("failed to get deployed instances: %w", err))
+		return
 	}
 
-	response, err := ec2Client.DescribeInstanceTypes(ctx, input)
+	// the owner and collaborators are kept with the request, not the instance
+	records, err := s.store.ListRecords(ctx)
 	if err != nil {
-		log.Printf("Failed to describe EC2 instance types: %v", err)
-		return nil, err
+		respondWithError(c, err)
+		return
 	}
-
-	instanceTypes := make([]string, 0, len(response.InstanceTypes))
-	for _, it := range response.InstanceTypes {
-		instanceTypes = append(instanceTypes, string(it.InstanceType))
+	byID := make(map[string]*models.DynamoDBData, len(records))
+	for i := range records {
+		byID[records[i].ID] = &records[i]
+	}
+	byDeployment := make(map[string]*models.DeploymentResponse, len(instances))
+	for i := range instances {
+		byDeployment[instances[i].DeploymentID] = &instances[i]
+	}
+	costs, err := s.deploymentCosts(ctx, records, byDeployment)
+	if err != nil {
+		respondWithError(c, err)
+		return
 	}
 
-	return instanceTypes, nil
-}
-
-func GetDeployedRequest(c *gin.Context) {
-	ctx := c.Request.Context() // Extract the standard context from Gin's context
-	if err := PopulateSpotTagResponse(ctx); err != nil {
-		log.Printf("Failed to populate tags for deployed instances: %v", err)
-		if abortErr := c.AbortWithError(http.StatusInternalServerError, err); abortErr != nil {
-			log.Printf("Failed to abort with error: %v", abortErr)
+	for i := range instances {
+		record, ok := byID[instances[i].DeploymentID]
+		if !ok {
+			record = &models.DynamoDBData{ID: instances[i].DeploymentID}
 		}
-		return
+		instances[i].AllowedActions = s.allowedActions(ctx, record)
+		instances[i].Cost = costs[instances[i].DeploymentID]
+		instances[i].StopReason, _ = stopReason(record, &instances[i])
+		instances[i].DeploymentStatus = deploymentStatus(record, &instances[i])
+		instances[i].LastError = record.LastError
 	}
 
-	instances, err := instance.GetDeployedInstances()
-	if err != nil {
-		log.Printf("Failed to get deployed instances: %v", err)
-		if abortErr := c.AbortWithError(http.StatusInternalServerError, err); abortErr != nil {
-			log.Printf("Failed to abort with error: %v", abortErr)
+	// requests the provisioner has not launched an instance for yet
+	for i := range records {
+		if _, ok := byDeployment[records[i].ID]; ok {
+			continue
 		}
-		return
+		pending := s.pendingDeployment(ctx, &records[i])
+		pending.Cost = costs[records[i].ID]
+		instances = append(instances, pending)
 	}
 
 	c.JSON(http.StatusOK, instances)
 }
 
-func StartInstanceRequest(c *gin.Context) {
+func (s *Server) StartInstanceRequest(c *gin.Context) {
+	ctx := c.Request.Context()
 	instanceID := c.Param(pathParameterName)
 
-	if err := instance.StartInstance(instanceID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	deploymentID, err := s.instanceDeploymentID(ctx, instanceID)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	noteAudit(c).deploymentID = deploymentID
+
+	if err := s.startInstance(ctx, deploymentID, instanceID); err != nil {
+		respondWithError(c, err)
 		return
 	}
 
 	c.Status(http.StatusOK)
 }
 
-func StopInstanceRequest(c *gin.Context) {
+func (s *Server) StopInstanceRequest(c *gin.Context) {
+	ctx := c.Request.Context()
 	instanceID := c.Param(pathParameterName)
 
-	if err := instance.StopInstance(instanceID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	deploymentID, err := s.instanceDeploymentID(ctx, instanceID)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	noteAudit(c).deploymentID = deploymentID
+
+	if err := s.compute.StopInstance(ctx, deploymentID, instanceID); err != nil {
+		respondWithError(c, err)
 		return
 	}
 
 	c.Status(http.StatusOK)
 }
 
-func PopulateSpotTagResponse(ctx context.Context) error {
-	cfg, err := config.LoadDefaultConfig(ctx)
-	if err != nil {
-		log.Printf("Failed to load AWS SDk Config: %v", err)
-		return err
-	}
-
-	ec2Client := ec2.NewFromConfig(cfg)
+const instanceParameterName = "instance_id"
 
-	// Get all EC2 instances
-	instancesResp, err := ec2Client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{})
-	if err != nil {
-		log.Printf("error describing EC2 instances: %v", err)
-		return err
+// instanceDeploymentID returns the deployment that instanceID was launched
+// for. The legacy routes address instances directly, anything that is not a
+// turbo-deploy instance is refused.
+func (s *Server) instanceDeploymentID(ctx context.Context, instanceID string) (string, error) {
+	if err := s.compute.PopulateSpotTagResponse(ctx); err != nil {
+		return "", fmt.Errorf("failed to populate tags for deployed instances: %w", err)
 	}
 
-	// Get all Spot instance requests
-	spotResp, err := ec2Client.DescribeSpotInstanceRequests(ctx, &ec2.DescribeSpotInstanceRequestsInput{})
-	if err != nil {
-		log.Printf("error describing EC2 spot instances: %v", err)
-		return err
+	inst, err := s.compute.GetInstanceDeployment(ctx, instanceID)
+	if errors.Is(err, instance.ErrNoInstance) || (err == nil && inst.DeploymentID == "") {
+		return "", fmt.Errorf("%w: instance %s", instance.ErrNotManaged, instanceID)
 	}
-
-	// Create a map to associate spot instance request IDs with their tags
-	requestTags := make(map[string][]types.Tag)
-	for _, request := range spotResp.SpotInstanceRequests {
-		requestTags[*request.SpotInstanceRequestId] = request.Tags
-	}
-
-	for _, reservation := range instancesResp.Reservations {
-		for _, instance := range reservation.Instances {
-			// check if the instance is a spot instance and has a corresponding spot req
-			if instance.InstanceLifecycle == types.InstanceLifecycleTypeSpot && instance.SpotInstanceRequestId != nil {
-				spotRequestID := *instance.SpotInstanceRequestId
-				if tags, ok := requestTags[spotRequestID]; ok {
-					// Check if instance already has tags; if not, apply them
-					if len(instance.Tags) == 0 {
-						_, err := ec2Client.CreateTags(ctx, &ec2.CreateTagsInput{
-							Resources: []string{*instance.InstanceId},
-							Tags:      tags,
-						})
-						if err != nil {
-							log.Printf("Failed to create tags for instance %s: %v", *instance.InstanceId, err)
-							return err
-						}
-						log.Printf("Tags from Spot Request %s have been applied to Instance %s", spotRequestID, *instance.InstanceId)
-					}
-				}
-			}
-		}
+	if err != nil {
+		return "", err
 	}
-	return nil
+	return inst.DeploymentID, nil
 }
 
-const instanceParameterName = "instance_id"
-
-func CheckAMILimit(c *gin.Context) {
-	maxAMIsAllowed := 3
+// maxImagesPerInstance is the number of images that may be captured from an
+// instance before the oldest has to be deleted.
+const maxImagesPerInstance = 3
 
+func (s *Server) CheckAMILimit(c *gin.Context) {
 	id := c.Param(instanceParameterName)
 	log.Println("capture instance image request for instance:", id)
 
 	// check if an image for that instance already exists
-	filter := []types.Filter{
-		{
-			Name:   aws.String("source-instance-id"),
-			Values: []string{id},
-		},
-		{
-			Name:   aws.String("is-public"),
-			Values: []string{"false"},
-		},
-	}
-
-	imageResult, err := instance.GetImage(filter)
+	images, err := s.compute.GetInstanceImages(c.Request.Context(), id)
 	if err != nil {
-		log.Printf("failed to resolve image for instance %s: %v", id, err)
+		respondWithError(c, fmt.Errorf("failed to resolve images of instance %s: %w", id, err))
+		return
 	}
 
-	if len(imageResult.Images) >= maxAMIsAllowed {
-		// Sort images by creation date to find the oldest (ascending order)
-		sort.Slice(imageResult.Images, func(i, j int) bool {
-			timeI, _ := time.Parse(time.RFC3339, *imageResult.Images[i].CreationDate)
-			timeJ, _ := time.Parse(time.RFC3339, *imageResult.Images[j].CreationDate)
-			return timeI.Before(timeJ) // Oldest first
-		})
+	if len(images) >= maxImagesPerInstance {
+		sortImagesOldestFirst(images)
 
-		oldestImage := imageResult.Images[0]
-		oldestImageID := *oldestImage.ImageId
-		oldestImageDate := *oldestImage.CreationDate
-		oldestImageName := aws.ToString(oldestImage.Name)
-		amiLimitHit := true
-
-		c.JSON(http.StatusOK, gin.H{
-			"oldest_image_id":   oldestImageID,
-			"oldest_image_name": oldestImageName,
-			"oldest_image_date": oldestImageDate,
-			"ami_limit_hit":     amiLimitHit,
+		oldestImage := images[0]
+		c.JSON(http.StatusOK, models.AMILimitResponse{
+			OldestImageID:   aws.ToString(oldestImage.ImageId),
+			OldestImageName: aws.ToString(oldestImage.Name),
+			OldestImageDate: aws.ToString(oldestImage.CreationDate),
+			AMILimitHit:     true,
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"ami_limit_hit": false,
+	c.JSON(http.StatusOK, models.AMILimitResponse{AMILimitHit: false})
+}
+
+// sortImagesOldestFirst sorts images by creation date in ascending order.
+func sortImagesOldestFirst(images []types.Image) {
+	sort.Slice(images, func(i, j int) bool {
+		timeI, _ := time.Parse(time.RFC3339, aws.ToString(images[i].CreationDate))
+		timeJ, _ := time.Parse(time.RFC3339, aws.ToString(images[j].CreationDate))
+		return timeI.Before(timeJ)
 	})
 }
 
-func DeleteInstanceAMI(c *gin.Context) {
+func (s *Server) DeleteInstanceAMI(c *gin.Context) {
 	id := c.Param(instanceParameterName)
 	imageID := c.Param("image_id")
 
@@ -554,58 +639,60 @@ func DeleteInstanceAMI(c *gin.Context) {
 
 	log.Printf("Attempting to delete image with ID: %s", imageID)
 
-	if err := instance.DeregisterImage(imageID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	entry := noteAudit(c)
+	entry.imageID = imageID
+
+	deploymentID, err := s.instanceDeploymentID(c.Request.Context(), id)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	entry.deploymentID = deploymentID
+
+	if err := s.compute.DeregisterImage(c.Request.Context(), deploymentID, imageID); err != nil {
+		respondWithError(c, err)
 		return
 	}
 
 	c.Status(http.StatusOK)
 }
 
-func CaptureInstanceAMI(c *gin.Context) {
+func (s *Server) CaptureInstanceAMI(c *gin.Context) {
 	var req models.Payload
 
-	err := c.BindJSON(&req)
-	if err != nil {
-		if err := c.AbortWithError(http.StatusInternalServerError, err); err != nil {
-			log.Printf("Failed to abort with error: %v", err)
-		}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, badRequest(err))
 		return
 	}
 
 	id := c.Param(pathParameterName)
+	ctx := c.Request.Context()
 	log.Println("create ami request for id:", id)
 
-	var amiID string
-	if amiID, err = instance.CaptureInstanceImage(req.InstanceID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if req.InstanceID == "" {
+		respondWithError(c, validationFailed([]models.FieldError{{Field: "instanceId", Message: "instanceId is required"}}))
 		return
 	}
 
-	timeToLive, err := strconv.ParseInt(req.TimeToExpire, 10, 64)
-	if err != nil {
-		log.Printf("Failed to parse ttl with error %v", err)
+	if _, err := s.store.GetRecord(ctx, id); err != nil {
+		respondWithError(c, err)
+		return
 	}
 
-	// Convert request to DynamoDBData struct
-	data := models.DynamoDBData{
-		ID:                id,
-		Ami:               req.Ami,
-		ServerSize:        req.ServerSize,
-		Hostname:          req.Hostname,
-		Region:            req.Region,
-		CreationUser:      req.CreationUser,
-		Lifecycle:         req.Lifecycle,
-		SnapShot:          amiID,
-		ContentDeployment: req.ContentDeployment,
-		TimeToExpire:      timeToLive,
-		UserData:          req.UserData,
+	entry := noteAudit(c)
+	entry.instanceID = req.InstanceID
+
+	amiID, err := s.compute.CaptureInstanceImage(ctx, id, req.InstanceID)
+	if err != nil {
+		respondWithError(c, err)
+		return
 	}
+	entry.imageID = amiID
 
-	// Update the DynamoDB row to include the captured snapshot ID
-	if err := db.UpdateRecord(id, data); err != nil {
-		log.Printf("Failed to update snapshot ID: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update snapshot ID"})
+	// only the snapshot is taken from the capture, the rest of the body is
+	// ignored so it cannot bypass the checks of an edit
+	if err := s.store.SetSnapshot(ctx, id, amiID); err != nil {
+		respondWithError(c, fmt.Errorf("failed to update snapshot ID: %w", err))
 		return
 	}
 	c.Status(http.StatusOK)
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/frgrisk/turbo-deploy/server/config"
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/instance"
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/frgrisk/turbo-deploy/server/quota"
+)
+
+// deletedAfterRead is a store whose records are deleted right after they are
+// read, as if a DELETE landed in between.
+type deletedAfterRead struct {
+	db.DeploymentStore
+}
+
+func (s deletedAfterRead) GetRecord(ctx context.Context, id string) (*models.DynamoDBData, error) {
+	record, err := s.DeploymentStore.GetRecord(ctx, id)
+	if err == nil {
+		err = s.SetStatus(ctx, id, models.StatusDeleting, "", 1)
+	}
+	return record, err
+}
+
+func TestUpdateRecordDeletedMeanwhile(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	s := &Server{
+		cfg:     &config.Config{Domain: "example.com"},
+		store:   deletedAfterRead{store},
+		compute: instance.NewService(instance.NewFakeProvider()),
+		quotas:  quota.New(config.QuotaConfig{}),
+	}
+	_, err := store.SaveRecord(ctx, models.DynamoDBData{
+		ID:         "a",
+		Hostname:   "web.example.com",
+		Ami:        "ami-1",
+		ServerSize: "t3.small",
+		Lifecycle:  "on-demand",
+		Status:     models.StatusRunning,
+	})
+	if err != nil {
+		t.Fatalf("SaveRecord: %v", err)
+	}
+
+	err = s.updateRecord(ctx, "a", models.Payload{Hostname: "web", Ami: "ami-1", ServerSize: "t3.small", Lifecycle: "on-demand"})
+	if toAPIError(err) != errDeploymentRemoved {
+		t.Fatalf("updateRecord() = %v, want errDeploymentRemoved", err)
+	}
+	if !errors.Is(err, db.ErrDeploymentRemoved) {
+		t.Errorf("updateRecord() = %v, want db.ErrDeploymentRemoved", err)
+	}
+
+	record, err := store.GetRecord(ctx, "a")
+	if err != nil {
+		t.Fatalf("GetRecord: %v", err)
+	}
+	if record.Status != models.StatusDeleting {
+		t.Errorf("deployment is %s, want deleting", record.Status)
+	}
+}
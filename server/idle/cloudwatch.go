@@ -0,0 +1,91 @@
+package idle
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// CloudWatchAPI is the subset of the CloudWatch API that CloudWatch depends
+// on.
+type CloudWatchAPI interface {
+	GetMetricStatistics(ctx context.Context, params *cloudwatch.GetMetricStatisticsInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.GetMetricStatisticsOutput, error)
+}
+
+var (
+	_ CloudWatchAPI = (*cloudwatch.Client)(nil)
+	_ Metrics       = (*CloudWatch)(nil)
+)
+
+// CloudWatch reads the AWS/EC2 metrics of instances from Amazon CloudWatch
+// with GetMetricStatistics.
+type CloudWatch struct {
+	client CloudWatchAPI
+}
+
+// NewCloudWatch returns a CloudWatch reading metrics through client.
+func NewCloudWatch(client CloudWatchAPI) *CloudWatch {
+	return &CloudWatch{client: client}
+}
+
+func (c *CloudWatch) Utilization(ctx context.Context, instanceID string, start, end time.Time) (Utilization, error) {
+	cpu, err := c.statistics(ctx, instanceID, "CPUUtilization", types.StatisticAverage, start, end)
+	if err != nil {
+		return Utilization{}, err
+	}
+	received, err := c.statistics(ctx, instanceID, "NetworkIn", types.StatisticSum, start, end)
+	if err != nil {
+		return Utilization{}, err
+	}
+	sent, err := c.statistics(ctx, instanceID, "NetworkOut", types.StatisticSum, start, end)
+	if err != nil {
+		return Utilization{}, err
+	}
+
+	u := Utilization{Datapoints: len(cpu)}
+	for _, value := range cpu {
+		u.CPUPercent = max(u.CPUPercent, value)
+	}
+	traffic := make(map[time.Time]float64, len(received))
+	for timestamp, bytes := range received {
+		traffic[timestamp] += bytes
+	}
+	for timestamp, bytes := range sent {
+		traffic[timestamp] += bytes
+	}
+	for _, bytes := range traffic {
+		u.NetworkBytesPerSecond = max(u.NetworkBytesPerSecond, bytes/Period.Seconds())
+	}
+	return u, nil
+}
+
+// statistics returns statistic of the AWS/EC2 metric of instanceID for every
+// Period between start and end, by the start of the period.
+func (c *CloudWatch) statistics(ctx context.Context, instanceID, metric string, statistic types.Statistic, start, end time.Time) (map[time.Time]float64, error) {
+	out, err := c.client.GetMetricStatistics(ctx, &cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String("AWS/EC2"),
+		MetricName: aws.String(metric),
+		Dimensions: []types.Dimension{{Name: aws.String("InstanceId"), Value: aws.String(instanceID)}},
+		Statistics: []types.Statistic{statistic},
+		Period:     aws.Int32(int32(Period.Seconds())),
+		StartTime:  aws.Time(start),
+		EndTime:    aws.Time(end),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s of instance %s: %w", metric, instanceID, err)
+	}
+
+	values := make(map[time.Time]float64, len(out.Datapoints))
+	for _, datapoint := range out.Datapoints {
+		value := datapoint.Average
+		if statistic == types.StatisticSum {
+			value = datapoint.Sum
+		}
+		values[aws.ToTime(datapoint.Timestamp)] = aws.ToFloat64(value)
+	}
+	return values, nil
+}
@@ -0,0 +1,39 @@
+package idle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// stubCloudWatch answers GetMetricStatistics with the datapoints of each
+// metric.
+type stubCloudWatch map[string][]types.Datapoint
+
+func (s stubCloudWatch) GetMetricStatistics(_ context.Context, params *cloudwatch.GetMetricStatisticsInput, _ ...func(*cloudwatch.Options)) (*cloudwatch.GetMetricStatisticsOutput, error) {
+	return &cloudwatch.GetMetricStatisticsOutput{Datapoints: s[aws.ToString(params.MetricName)]}, nil
+}
+
+func TestCloudWatchUtilization(t *testing.T) {
+	start := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	at := func(periods int) *time.Time { return aws.Time(start.Add(time.Duration(periods) * Period)) }
+	metrics := stubCloudWatch{
+		"CPUUtilization": {{Timestamp: at(0), Average: aws.Float64(2)}, {Timestamp: at(1), Average: aws.Float64(7.5)}},
+		"NetworkIn":      {{Timestamp: at(0), Sum: aws.Float64(30000)}, {Timestamp: at(1), Sum: aws.Float64(600)}},
+		"NetworkOut":     {{Timestamp: at(0), Sum: aws.Float64(60000)}, {Timestamp: at(1), Sum: aws.Float64(300)}},
+	}
+
+	u, err := NewCloudWatch(metrics).Utilization(context.Background(), "i-1", start, start.Add(2*Period))
+	if err != nil {
+		t.Fatalf("Utilization: %v", err)
+	}
+	// the busiest period moved 90000 bytes in 300 seconds
+	want := Utilization{Datapoints: 2, CPUPercent: 7.5, NetworkBytesPerSecond: 300}
+	if u != want {
+		t.Errorf("Utilization() = %+v, want %+v", u, want)
+	}
+}
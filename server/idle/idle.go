@@ -0,0 +1,171 @@
+// Package idle stops instances that have been idle.
+//
+// Every run reads the utilization of the running instance of each deployment
+// with an idle policy over the policy's lookback window. An instance whose
+// CPU utilization and network traffic stayed below the thresholds in every
+// Period of the window is stopped, and the reason is recorded on the
+// deployment. Instances started within the window are not idle yet, nor are
+// instances without metrics. Spot instances cannot be stopped and are never
+// checked.
+package idle
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/instance"
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/frgrisk/turbo-deploy/server/timeutil"
+	"github.com/frgrisk/turbo-deploy/server/validate"
+)
+
+// Options control a run of the idle stopper.
+type Options struct {
+	// DryRun reports what would be stopped without stopping it.
+	DryRun bool
+	// Now returns the current time, time.Now if nil.
+	Now func() time.Time
+}
+
+// Stopper stops idle instances.
+type Stopper struct {
+	store   db.DeploymentStore
+	compute *instance.Service
+	metrics Metrics
+	opts    Options
+}
+
+// New returns a Stopper for the deployments in store, reading the
+// utilization of their instances from metrics and stopping them through
+// compute.
+func New(store db.DeploymentStore, compute *instance.Service, metrics Metrics, opts Options) *Stopper {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Stopper{store: store, compute: compute, metrics: metrics, opts: opts}
+}
+
+// Report lists what a run stopped, or would have stopped in a dry run.
+type Report struct {
+	DryRun  bool      `json:"dryRun"`
+	Stopped []Stopped `json:"stopped"`
+}
+
+// Stopped is an idle instance.
+type Stopped struct {
+	DeploymentID string `json:"deploymentId"`
+	InstanceID   string `json:"instanceId"`
+	Hostname     string `json:"hostname"`
+	// Reason is recorded on the deployment, e.g. idle 2h.
+	Reason      string      `json:"reason"`
+	Utilization Utilization `json:"utilization"`
+	// Error is set if the instance could not be stopped.
+	Error string `json:"error,omitempty"`
+}
+
+// Run stops the idle instances, in deployment ID order. The returned error
+// joins the failures, which are also reported in the Report.
+func (s *Stopper) Run(ctx context.Context) (Report, error) {
+	report := Report{DryRun: s.opts.DryRun, Stopped: []Stopped{}}
+
+	records, err := s.store.ListRecords(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to list deployment records: %w", err)
+	}
+	records = slices.DeleteFunc(records, func(r models.DynamoDBData) bool { return r.IdlePolicy == nil || r.Removed() })
+	if len(records) == 0 {
+		return report, nil
+	}
+	slices.SortFunc(records, func(a, b models.DynamoDBData) int { return cmp.Compare(a.ID, b.ID) })
+
+	// spot instances only carry the tags of their request until populated
+	if err := s.compute.PopulateSpotTagResponse(ctx); err != nil {
+		return report, fmt.Errorf("failed to populate tags for deployed instances: %w", err)
+	}
+	instances, err := s.compute.GetDeployedInstances(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to get deployed instances: %w", err)
+	}
+	byDeployment := make(map[string]*models.DeploymentResponse, len(instances))
+	for i := range instances {
+		byDeployment[instances[i].DeploymentID] = &instances[i]
+	}
+
+	now := s.opts.Now()
+	var errs []error
+	for _, record := range records {
+		inst := byDeployment[record.ID]
+		if inst == nil || inst.Status != "running" || validate.Stoppable(inst.Lifecycle) != nil {
+			continue
+		}
+
+		lookback, err := time.ParseDuration(record.IdlePolicy.Lookback)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("deployment %s: invalid idle lookback %q", record.ID, record.IdlePolicy.Lookback))
+			continue
+		}
+		start := now.Add(-lookback)
+		if inst.LaunchTime != nil && inst.LaunchTime.After(start) {
+			continue
+		}
+
+		u, err := s.metrics.Utilization(ctx, inst.InstanceID, start, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("deployment %s: %w", record.ID, err))
+			continue
+		}
+		if !Idle(*record.IdlePolicy, u) {
+			continue
+		}
+
+		stopped := Stopped{
+			DeploymentID: record.ID,
+			InstanceID:   inst.InstanceID,
+			Hostname:     record.Hostname,
+			Reason:       "idle " + timeutil.FormatDuration(lookback),
+			Utilization:  u,
+		}
+		if !s.opts.DryRun {
+			if err := s.stop(ctx, record.ID, inst.InstanceID, stopped.Reason, now); err != nil {
+				stopped.Error = err.Error()
+				errs = append(errs, fmt.Errorf("deployment %s: %w", record.ID, err))
+			}
+		}
+		report.Stopped = append(report.Stopped, stopped)
+	}
+
+	return report, errors.Join(errs...)
+}
+
+// Idle reports whether utilization u is below the thresholds of policy.
+// Without datapoints nothing is known, so the instance is not idle.
+func Idle(policy models.IdlePolicy, u Utilization) bool {
+	if u.Datapoints == 0 {
+		return false
+	}
+	if policy.CPUPercent > 0 && u.CPUPercent >= policy.CPUPercent {
+		return false
+	}
+	if policy.NetworkBytesPerSecond > 0 && u.NetworkBytesPerSecond >= policy.NetworkBytesPerSecond {
+		return false
+	}
+	return policy.CPUPercent > 0 || policy.NetworkBytesPerSecond > 0
+}
+
+func (s *Stopper) stop(ctx context.Context, deploymentID, instanceID, reason string, now time.Time) error {
+	if err := s.compute.StopInstance(ctx, deploymentID, instanceID); err != nil {
+		return fmt.Errorf("failed to stop instance %s: %w", instanceID, err)
+	}
+	log.Printf("idle: stopped instance %s of deployment %s, %s", instanceID, deploymentID, reason)
+
+	if err := s.store.SetStopReason(ctx, deploymentID, reason, now.Unix()); err != nil && !errors.Is(err, db.ErrURLNotFound) {
+		return fmt.Errorf("failed to record the stop reason: %w", err)
+	}
+	return nil
+}
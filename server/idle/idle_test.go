@@ -0,0 +1,144 @@
+package idle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/instance"
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+func TestIdle(t *testing.T) {
+	both := models.IdlePolicy{CPUPercent: 5, NetworkBytesPerSecond: 1000, Lookback: "2h"}
+
+	tests := []struct {
+		name   string
+		policy models.IdlePolicy
+		u      Utilization
+		idle   bool
+	}{
+		{"below both thresholds", both, Utilization{Datapoints: 24, CPUPercent: 1, NetworkBytesPerSecond: 100}, true},
+		{"busy CPU", both, Utilization{Datapoints: 24, CPUPercent: 5, NetworkBytesPerSecond: 100}, false},
+		{"busy network", both, Utilization{Datapoints: 24, CPUPercent: 1, NetworkBytesPerSecond: 1000}, false},
+		{"no datapoints", both, Utilization{}, false},
+		{"CPU threshold only", models.IdlePolicy{CPUPercent: 5}, Utilization{Datapoints: 24, CPUPercent: 1, NetworkBytesPerSecond: 1e9}, true},
+		{"network threshold only", models.IdlePolicy{NetworkBytesPerSecond: 1000}, Utilization{Datapoints: 24, CPUPercent: 99, NetworkBytesPerSecond: 10}, true},
+		{"no thresholds", models.IdlePolicy{Lookback: "2h"}, Utilization{Datapoints: 24}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Idle(tt.policy, tt.u); got != tt.idle {
+				t.Errorf("Idle() = %v, want %v", got, tt.idle)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	provider := instance.NewFakeProvider()
+	provider.TransitionDelay = 0
+	metrics := NewFakeMetrics()
+	policy := &models.IdlePolicy{CPUPercent: 5, Lookback: "2h"}
+
+	launch := func(id string, u Utilization) string {
+		if _, err := store.SaveRecord(ctx, models.DynamoDBData{ID: id, Hostname: id, IdlePolicy: policy, Status: models.StatusRunning}); err != nil {
+			t.Fatalf("SaveRecord: %v", err)
+		}
+		instanceID := provider.RunInstance(instance.FakeInstanceSpec{
+			ImageID:      "ami-1",
+			InstanceType: "t3.small",
+			Tags:         map[string]string{"DeployedBy": "turbo-deploy", "DeploymentID": id},
+		})
+		metrics.Set(instanceID, u)
+		return instanceID
+	}
+	idleID := launch("idle", Utilization{Datapoints: 24, CPUPercent: 1})
+	launch("busy", Utilization{Datapoints: 24, CPUPercent: 50})
+	launch("silent", Utilization{})
+
+	// three hours after the instances launched
+	now := time.Now().Add(3 * time.Hour)
+	stopper := New(store, instance.NewService(provider), metrics, Options{Now: func() time.Time { return now }})
+
+	report, err := stopper.Run(ctx)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(report.Stopped) != 1 || report.Stopped[0].DeploymentID != "idle" || report.Stopped[0].InstanceID != idleID {
+		t.Fatalf("Run stopped %+v, want only the idle deployment", report.Stopped)
+	}
+	record, err := store.GetRecord(ctx, "idle")
+	if err != nil {
+		t.Fatalf("GetRecord: %v", err)
+	}
+	if record.StopReason != "idle 2h" || record.StoppedAt != now.Unix() {
+		t.Errorf("stop reason %q at %d, want %q at %d", record.StopReason, record.StoppedAt, "idle 2h", now.Unix())
+	}
+
+	// a stopped instance is not stopped again
+	report, err = stopper.Run(ctx)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(report.Stopped) != 0 {
+		t.Errorf("second Run stopped %+v, want nothing", report.Stopped)
+	}
+}
+
+func TestRunSkipsInstancesLaunchedWithinTheLookback(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	provider := instance.NewFakeProvider()
+	provider.TransitionDelay = 0
+	metrics := NewFakeMetrics()
+
+	if _, err := store.SaveRecord(ctx, models.DynamoDBData{ID: "new", Hostname: "new", IdlePolicy: &models.IdlePolicy{CPUPercent: 5, Lookback: "2h"}}); err != nil {
+		t.Fatalf("SaveRecord: %v", err)
+	}
+	instanceID := provider.RunInstance(instance.FakeInstanceSpec{
+		ImageID:      "ami-1",
+		InstanceType: "t3.small",
+		Tags:         map[string]string{"DeployedBy": "turbo-deploy", "DeploymentID": "new"},
+	})
+	metrics.Set(instanceID, Utilization{Datapoints: 12, CPUPercent: 1})
+
+	report, err := New(store, instance.NewService(provider), metrics, Options{}).Run(ctx)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(report.Stopped) != 0 {
+		t.Errorf("Run stopped %+v, want nothing", report.Stopped)
+	}
+}
+
+func TestRunSkipsSpotInstances(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	provider := instance.NewFakeProvider()
+	provider.TransitionDelay = 0
+	metrics := NewFakeMetrics()
+
+	if _, err := store.SaveRecord(ctx, models.DynamoDBData{ID: "spot", Hostname: "spot", Lifecycle: "spot", IdlePolicy: &models.IdlePolicy{CPUPercent: 5, Lookback: "2h"}}); err != nil {
+		t.Fatalf("SaveRecord: %v", err)
+	}
+	instanceID := provider.RunInstance(instance.FakeInstanceSpec{
+		ImageID:      "ami-1",
+		InstanceType: "t3.small",
+		Lifecycle:    "spot",
+		Tags:         map[string]string{"DeployedBy": "turbo-deploy", "DeploymentID": "spot"},
+	})
+	metrics.Set(instanceID, Utilization{Datapoints: 24, CPUPercent: 1})
+
+	now := time.Now().Add(3 * time.Hour)
+	report, err := New(store, instance.NewService(provider), metrics, Options{Now: func() time.Time { return now }}).Run(ctx)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(report.Stopped) != 0 {
+		t.Errorf("Run stopped %+v, want nothing", report.Stopped)
+	}
+}
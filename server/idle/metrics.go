@@ -0,0 +1,60 @@
+package idle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Period is the interval instance metrics are aggregated over, the
+// resolution of basic EC2 monitoring.
+const Period = 5 * time.Minute
+
+// Metrics reads the utilization of instances. CloudWatch reads it from
+// Amazon CloudWatch, FakeMetrics simulates it in memory.
+type Metrics interface {
+	// Utilization returns the peak utilization of instanceID in the Periods
+	// between start and end.
+	Utilization(ctx context.Context, instanceID string, start, end time.Time) (Utilization, error)
+}
+
+// Utilization is the peak use of an instance over a number of Periods.
+type Utilization struct {
+	// Datapoints is the number of periods with data, zero if the instance
+	// reported nothing.
+	Datapoints int `json:"datapoints"`
+	// CPUPercent is the highest average CPU utilization of a period.
+	CPUPercent float64 `json:"cpuPercent"`
+	// NetworkBytesPerSecond is the highest rate of traffic received and
+	// sent in a period.
+	NetworkBytesPerSecond float64 `json:"networkBytesPerSecond"`
+}
+
+var _ Metrics = (*FakeMetrics)(nil)
+
+// FakeMetrics is a Metrics that reports the utilization set for each
+// instance, whatever the time range. Instances without one report no data.
+type FakeMetrics struct {
+	mu          sync.Mutex
+	utilization map[string]Utilization
+}
+
+// NewFakeMetrics returns a FakeMetrics without data.
+func NewFakeMetrics() *FakeMetrics {
+	return &FakeMetrics{utilization: make(map[string]Utilization)}
+}
+
+// Set makes instanceID report u.
+func (m *FakeMetrics) Set(instanceID string, u Utilization) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.utilization[instanceID] = u
+}
+
+func (m *FakeMetrics) Utilization(_ context.Context, instanceID string, _, _ time.Time) (Utilization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.utilization[instanceID], nil
+}
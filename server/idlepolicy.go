@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/idle"
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/frgrisk/turbo-deploy/server/validate"
+	"github.com/gin-gonic/gin"
+)
+
+// SetIdlePolicy attaches an idle policy to a deployment, replacing the one
+// it has.
+func (s *Server) SetIdlePolicy(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param(pathParameterName)
+
+	var policy models.IdlePolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		respondWithError(c, badRequest(err))
+		return
+	}
+	if errs := validate.IdlePolicy(policy); len(errs) > 0 {
+		respondWithError(c, validationFailed(errs))
+		return
+	}
+	if err := s.checkStoppable(ctx, id); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	if err := s.store.SetIdlePolicy(ctx, id, &policy); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	s.respondWithDeployment(c, id)
+}
+
+// DeleteIdlePolicy removes the idle policy of a deployment.
+func (s *Server) DeleteIdlePolicy(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param(pathParameterName)
+
+	if _, err := s.activeRecord(ctx, id); err != nil {
+		respondWithError(c, err)
+		return
+	}
+	if err := s.store.SetIdlePolicy(ctx, id, nil); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// StopIdle stops the instances of deployments that have been idle for the
+// lookback of their idle policy.
+func (s *Server) StopIdle(ctx context.Context, dryRun bool) (idle.Report, error) {
+	return idle.New(s.store, s.compute, s.metrics, idle.Options{DryRun: dryRun}).Run(ctx)
+}
+
+// startInstance starts the instance of a deployment and forgets why it was
+// stopped automatically.
+func (s *Server) startInstance(ctx context.Context, deploymentID, instanceID string) error {
+	if err := s.compute.StartInstance(ctx, deploymentID, instanceID); err != nil {
+		return err
+	}
+
+	if err := s.store.SetStopReason(ctx, deploymentID, "", 0); err != nil && !errors.Is(err, db.ErrURLNotFound) {
+		log.Printf("failed to clear the stop reason of deployment %s: %v", deploymentID, err)
+	}
+	return nil
+}
+
+// stopReason returns the reason the instance of record was stopped
+// automatically, while it is still stopped.
+func stopReason(record *models.DynamoDBData, inst *models.DeploymentResponse) (string, int64) {
+	if record == nil || inst == nil || (inst.Status != "stopped" && inst.Status != "stopping") {
+		return "", 0
+	}
+	return record.StopReason, record.StoppedAt
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/frgrisk/turbo-deploy/server/config"
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/instance"
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+func TestIdlePolicyRefusesRemovedDeployments(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	policy := `{"cpuPercent": 5, "networkBytesPerSecond": 1000, "lookback": "2h"}`
+
+	tests := []struct {
+		status models.DeploymentStatus
+		// removed deployments refuse both calls and keep their policy
+		removed bool
+	}{
+		{models.StatusRunning, false},
+		{models.StatusFailed, false},
+		{models.StatusDeleting, true},
+		{models.StatusDeleted, true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			ctx := context.Background()
+			store := db.NewMemoryStore()
+			s := &Server{
+				cfg:     &config.Config{Domain: "example.com"},
+				store:   store,
+				compute: instance.NewService(instance.NewFakeProvider()),
+			}
+			router := gin.New()
+			router.PUT("/v1/deployments/:id/idle-policy", s.SetIdlePolicy)
+			router.DELETE("/v1/deployments/:id/idle-policy", s.DeleteIdlePolicy)
+
+			_, err := store.SaveRecord(ctx, models.DynamoDBData{
+				ID:         "a",
+				Hostname:   "web.example.com",
+				Lifecycle:  "on-demand",
+				Status:     tt.status,
+				IdlePolicy: &models.IdlePolicy{CPUPercent: 1, Lookback: "1h"},
+			})
+			if err != nil {
+				t.Fatalf("SaveRecord: %v", err)
+			}
+
+			for _, call := range []struct {
+				method, body string
+				ok           int
+			}{
+				{http.MethodPut, policy, http.StatusOK},
+				{http.MethodDelete, "", http.StatusNoContent},
+			} {
+				want := call.ok
+				if tt.removed {
+					want = http.StatusConflict
+				}
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest(call.method, "/v1/deployments/a/idle-policy", strings.NewReader(call.body)))
+				if w.Code != want {
+					t.Errorf("%s: status %d, want %d: %s", call.method, w.Code, want, w.Body)
+				}
+			}
+
+			record, err := store.GetRecord(ctx, "a")
+			if err != nil {
+				t.Fatalf("GetRecord: %v", err)
+			}
+			if kept := record.IdlePolicy != nil && record.IdlePolicy.Lookback == "1h"; kept != tt.removed {
+				t.Errorf("idle policy is %+v after the calls", record.IdlePolicy)
+			}
+		})
+	}
+}
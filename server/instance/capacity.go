@@ -0,0 +1,112 @@
+package instance
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// InstanceTypeVCPUs returns the default vCPU count of each of the instance
+// types. Types EC2 does not know are left out.
+func (s *Service) InstanceTypeVCPUs(ctx context.Context, instanceTypes []string) (map[string]int, error) {
+	s.vcpusMu.Lock()
+	defer s.vcpusMu.Unlock()
+	if s.vcpus == nil {
+		s.vcpus = make(map[string]int)
+	}
+
+	var missing []types.InstanceType
+	for _, instanceType := range instanceTypes {
+		if _, ok := s.vcpus[instanceType]; !ok && instanceType != "" {
+			missing = append(missing, types.InstanceType(instanceType))
+		}
+	}
+
+	if len(missing) > 0 {
+		paginator := ec2.NewDescribeInstanceTypesPaginator(s.provider, &ec2.DescribeInstanceTypesInput{
+			InstanceTypes: missing,
+		})
+		for paginator.HasMorePages() {
+			output, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, info := range output.InstanceTypes {
+				if info.VCpuInfo != nil {
+					s.vcpus[string(info.InstanceType)] = int(aws.ToInt32(info.VCpuInfo.DefaultVCpus))
+				}
+			}
+		}
+	}
+
+	vcpus := make(map[string]int, len(instanceTypes))
+	for _, instanceType := range instanceTypes {
+		if count, ok := s.vcpus[instanceType]; ok {
+			vcpus[instanceType] = count
+		}
+	}
+	return vcpus, nil
+}
+
+// DeployedInstanceTypes returns the instance type of the live instance of
+// every deployment, by deployment ID. Unlike GetDeployedInstances it does
+// not look up the images of the instances.
+func (s *Service) DeployedInstanceTypes(ctx context.Context) (map[string]string, error) {
+	paginator := ec2.NewDescribeInstancesPaginator(s.provider, &ec2.DescribeInstancesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("tag:DeployedBy"),
+				Values: []string{deployedByValue},
+			},
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: []string{"pending", "running", "stopping", "stopped"},
+			},
+		},
+	})
+
+	instanceTypes := make(map[string]string)
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, reservation := range output.Reservations {
+			for _, inst := range reservation.Instances {
+				instanceTypes[getInstanceTagValue(deploymentIDTag, inst.Tags)] = string(inst.InstanceType)
+			}
+		}
+	}
+	return instanceTypes, nil
+}
+
+// ImageStorageGB returns the size of the EBS volumes of each of the images in
+// GB. Images that no longer exist are left out.
+func (s *Service) ImageStorageGB(ctx context.Context, imageIDs []string) (map[string]int, error) {
+	storage := make(map[string]int, len(imageIDs))
+	if len(imageIDs) == 0 {
+		return storage, nil
+	}
+
+	// a filter rather than ImageIds, which fails if any image is missing
+	output, err := s.GetImage(ctx, []types.Filter{{
+		Name:   aws.String("image-id"),
+		Values: imageIDs,
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, image := range output.Images {
+		size := 0
+		for _, mapping := range image.BlockDeviceMappings {
+			if mapping.Ebs != nil {
+				size += int(aws.ToInt32(mapping.Ebs.VolumeSize))
+			}
+		}
+		storage[aws.ToString(image.ImageId)] = size
+	}
+	return storage, nil
+}
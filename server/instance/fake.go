@@ -0,0 +1,681 @@
+package instance
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	fakeAvailabilityZone = "local-1a"
+	fakeRootVolumeSizeGB = 8
+)
+
+// FakeProvider is an in-memory ComputeProvider that simulates the parts of
+// EC2 used by turbo-deploy. Started and stopped instances pass through the
+// pending and stopping states, and captured images stay pending, for
+// TransitionDelay before settling, so the UI sees the same progression it
+// would against AWS.
+//
+// Filters are matched on the names turbo-deploy uses (ids, states, names,
+// tags, is-public and source-instance-id). Unknown filter names are ignored
+// rather than rejected so arbitrary AMI_FILTERS still work locally.
+type FakeProvider struct {
+	// TransitionDelay is how long instances and images remain in a
+	// transitional state before settling.
+	TransitionDelay time.Duration
+
+	mu            sync.Mutex
+	now           func() time.Time
+	counter       int
+	instances     map[string]*fakeInstance
+	images        map[string]*fakeImage
+	instanceTypes map[types.InstanceType]types.InstanceTypeInfo
+	// clientTokens maps the ClientToken of launches to their instance.
+	clientTokens map[string]string
+}
+
+type fakeInstance struct {
+	instance types.Instance
+	// next is the state the instance settles in once settleAt has passed.
+	next     types.InstanceStateName
+	settleAt time.Time
+}
+
+type fakeImage struct {
+	image    types.Image
+	settleAt time.Time
+}
+
+// FakeInstanceSpec describes an instance launched with FakeProvider.RunInstance.
+type FakeInstanceSpec struct {
+	ImageID      string
+	InstanceType string
+	// Lifecycle is either "spot" or "on-demand".
+	Lifecycle string
+	Tags      map[string]string
+}
+
+var _ ComputeProvider = (*FakeProvider)(nil)
+
+// NewFakeProvider returns an empty FakeProvider with a two second
+// transition delay.
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{
+		TransitionDelay: 2 * time.Second,
+		now:             time.Now,
+		instances:       make(map[string]*fakeInstance),
+		images:          make(map[string]*fakeImage),
+		instanceTypes:   make(map[types.InstanceType]types.InstanceTypeInfo),
+		clientTokens:    make(map[string]string),
+	}
+}
+
+// AddImage registers an available image, as if it had been published to the
+// account beforehand.
+func (p *FakeProvider) AddImage(imageID, name string, tags map[string]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.images[imageID] = &fakeImage{image: types.Image{
+		ImageId:             aws.String(imageID),
+		Name:                aws.String(name),
+		State:               types.ImageStateAvailable,
+		Public:              aws.Bool(false),
+		CreationDate:        aws.String(p.now().UTC().Format(time.RFC3339)),
+		Tags:                toTags(tags),
+		BlockDeviceMappings: rootVolume(),
+	}}
+}
+
+// AddInstanceType registers an instance type returned by DescribeInstanceTypes.
+func (p *FakeProvider) AddInstanceType(instanceType string, vcpus int32, memoryMiB int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.instanceTypes[types.InstanceType(instanceType)] = types.InstanceTypeInfo{
+		InstanceType: types.InstanceType(instanceType),
+		VCpuInfo:     &types.VCpuInfo{DefaultVCpus: aws.Int32(vcpus)},
+		MemoryInfo:   &types.MemoryInfo{SizeInMiB: aws.Int64(memoryMiB)},
+	}
+}
+
+// RunInstance launches an instance that starts out pending and becomes
+// running after TransitionDelay. It returns the new instance ID.
+func (p *FakeProvider) RunInstance(spec FakeInstanceSpec) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return aws.ToString(p.runInstance(spec, toTags(spec.Tags)).InstanceId)
+}
+
+// runInstance launches an instance with tags. The caller must hold p.mu.
+func (p *FakeProvider) runInstance(spec FakeInstanceSpec, tags []types.Tag) types.Instance {
+	p.counter++
+	instanceID := fmt.Sprintf("i-0f%015x", p.counter)
+
+	inst := types.Instance{
+		InstanceId:       aws.String(instanceID),
+		ImageId:          aws.String(spec.ImageID),
+		InstanceType:     types.InstanceType(spec.InstanceType),
+		LaunchTime:       aws.Time(p.now().UTC()),
+		Placement:        &types.Placement{AvailabilityZone: aws.String(fakeAvailabilityZone)},
+		PrivateIpAddress: aws.String(fmt.Sprintf("10.0.%d.%d", p.counter/250, p.counter%250+4)),
+		State:            instanceState(types.InstanceStateNamePending),
+		Tags:             tags,
+	}
+	if spec.Lifecycle == string(types.InstanceLifecycleTypeSpot) {
+		inst.InstanceLifecycle = types.InstanceLifecycleTypeSpot
+	}
+
+	p.instances[instanceID] = &fakeInstance{
+		instance: inst,
+		next:     types.InstanceStateNameRunning,
+		settleAt: p.now().Add(p.TransitionDelay),
+	}
+
+	return inst
+}
+
+// TerminateInstance shuts the instance down, it is reported as terminated
+// after TransitionDelay.
+func (p *FakeProvider) TerminateInstance(instanceID string) error {
+	_, err := p.TerminateInstances(context.Background(), &ec2.TerminateInstancesInput{
+		InstanceIds: []string{instanceID},
+	})
+	return err
+}
+
+func (p *FakeProvider) DescribeInstances(_ context.Context, params *ec2.DescribeInstancesInput, _ ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.settle()
+
+	for _, id := range params.InstanceIds {
+		if _, ok := p.instances[id]; !ok {
+			return nil, fakeError("InvalidInstanceID.NotFound", "The instance ID '%s' does not exist", id)
+		}
+	}
+
+	var instances []types.Instance
+	for _, id := range slices.Sorted(maps.Keys(p.instances)) {
+		inst := p.instances[id].instance
+		if len(params.InstanceIds) > 0 && !slices.Contains(params.InstanceIds, id) {
+			continue
+		}
+		if !matchFilters(params.Filters, func(name string) []string { return instanceAttribute(inst, name) }) {
+			continue
+		}
+		inst.Tags = append([]types.Tag(nil), inst.Tags...)
+		instances = append(instances, inst)
+	}
+
+	output := &ec2.DescribeInstancesOutput{}
+	if len(instances) > 0 {
+		output.Reservations = []types.Reservation{{Instances: instances}}
+	}
+	return output, nil
+}
+
+// RunInstances launches a single instance of a known image and instance
+// type. The instance tags of the request are put on it, and a request with
+// the ClientToken of an earlier one returns the instance launched then.
+func (p *FakeProvider) RunInstances(_ context.Context, params *ec2.RunInstancesInput, _ ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.settle()
+
+	if token := aws.ToString(params.ClientToken); token != "" {
+		if instanceID, ok := p.clientTokens[token]; ok {
+			return &ec2.RunInstancesOutput{Instances: []types.Instance{p.instances[instanceID].instance}}, nil
+		}
+	}
+
+	imageID := aws.ToString(params.ImageId)
+	if _, ok := p.images[imageID]; !ok {
+		return nil, fakeError("InvalidAMIID.NotFound", "The image id '[%s]' does not exist", imageID)
+	}
+	if _, ok := p.instanceTypes[params.InstanceType]; !ok {
+		return nil, fakeError("InvalidParameterValue", "Invalid value '%s' for InstanceType.", params.InstanceType)
+	}
+
+	var tags []types.Tag
+	for _, spec := range params.TagSpecifications {
+		if spec.ResourceType == types.ResourceTypeInstance {
+			tags = append(tags, spec.Tags...)
+		}
+	}
+	spec := FakeInstanceSpec{ImageID: imageID, InstanceType: string(params.InstanceType)}
+	if params.InstanceMarketOptions != nil && params.InstanceMarketOptions.MarketType == types.MarketTypeSpot {
+		spec.Lifecycle = string(types.InstanceLifecycleTypeSpot)
+	}
+
+	inst := p.runInstance(spec, tags)
+	if token := aws.ToString(params.ClientToken); token != "" {
+		p.clientTokens[token] = aws.ToString(inst.InstanceId)
+	}
+	return &ec2.RunInstancesOutput{Instances: []types.Instance{inst}}, nil
+}
+
+// ModifyInstanceAttribute changes the instance type of a stopped instance,
+// other attributes are ignored.
+func (p *FakeProvider) ModifyInstanceAttribute(_ context.Context, params *ec2.ModifyInstanceAttributeInput, _ ...func(*ec2.Options)) (*ec2.ModifyInstanceAttributeOutput, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.settle()
+
+	instanceID := aws.ToString(params.InstanceId)
+	inst, ok := p.instances[instanceID]
+	if !ok {
+		return nil, fakeError("InvalidInstanceID.NotFound", "The instance ID '%s' does not exist", instanceID)
+	}
+
+	if params.InstanceType != nil {
+		instanceType := types.InstanceType(aws.ToString(params.InstanceType.Value))
+		if _, ok := p.instanceTypes[instanceType]; !ok {
+			return nil, fakeError("InvalidParameterValue", "Invalid value '%s' for InstanceType.", instanceType)
+		}
+		if inst.instance.State.Name != types.InstanceStateNameStopped {
+			return nil, fakeError("IncorrectInstanceState", "The instance '%s' is not in the 'stopped' state.", instanceID)
+		}
+		inst.instance.InstanceType = instanceType
+	}
+
+	return &ec2.ModifyInstanceAttributeOutput{}, nil
+}
+
+func (p *FakeProvider) StartInstances(_ context.Context, params *ec2.StartInstancesInput, _ ...func(*ec2.Options)) (*ec2.StartInstancesOutput, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.settle()
+
+	output := &ec2.StartInstancesOutput{}
+	for _, id := range params.InstanceIds {
+		inst, ok := p.instances[id]
+		if !ok {
+			return nil, fakeError("InvalidInstanceID.NotFound", "The instance ID '%s' does not exist", id)
+		}
+
+		previous := inst.instance.State.Name
+		switch previous {
+		case types.InstanceStateNamePending, types.InstanceStateNameRunning:
+		case types.InstanceStateNameStopped:
+			p.transition(inst, types.InstanceStateNamePending, types.InstanceStateNameRunning)
+		default:
+			return nil, fakeError("IncorrectInstanceState", "The instance '%s' is not in a state from which it can be started", id)
+		}
+
+		output.StartingInstances = append(output.StartingInstances, types.InstanceStateChange{
+			InstanceId:    aws.String(id),
+			PreviousState: instanceState(previous),
+			CurrentState:  instanceState(inst.instance.State.Name),
+		})
+	}
+
+	return output, nil
+}
+
+func (p *FakeProvider) StopInstances(_ context.Context, params *ec2.StopInstancesInput, _ ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.settle()
+
+	output := &ec2.StopInstancesOutput{}
+	for _, id := range params.InstanceIds {
+		inst, ok := p.instances[id]
+		if !ok {
+			return nil, fakeError("InvalidInstanceID.NotFound", "The instance ID '%s' does not exist", id)
+		}
+
+		previous := inst.instance.State.Name
+		switch previous {
+		case types.InstanceStateNameStopping, types.InstanceStateNameStopped:
+		case types.InstanceStateNamePending, types.InstanceStateNameRunning:
+			p.transition(inst, types.InstanceStateNameStopping, types.InstanceStateNameStopped)
+		default:
+			return nil, fakeError("IncorrectInstanceState", "The instance '%s' is not in a state from which it can be stopped", id)
+		}
+
+		output.StoppingInstances = append(output.StoppingInstances, types.InstanceStateChange{
+			InstanceId:    aws.String(id),
+			PreviousState: instanceState(previous),
+			CurrentState:  instanceState(inst.instance.State.Name),
+		})
+	}
+
+	return output, nil
+}
+
+func (p *FakeProvider) TerminateInstances(_ context.Context, params *ec2.TerminateInstancesInput, _ ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.settle()
+
+	output := &ec2.TerminateInstancesOutput{}
+	for _, id := range params.InstanceIds {
+		inst, ok := p.instances[id]
+		if !ok {
+			return nil, fakeError("InvalidInstanceID.NotFound", "The instance ID '%s' does not exist", id)
+		}
+
+		previous := inst.instance.State.Name
+		switch previous {
+		case types.InstanceStateNameShuttingDown, types.InstanceStateNameTerminated:
+		default:
+			p.transition(inst, types.InstanceStateNameShuttingDown, types.InstanceStateNameTerminated)
+		}
+
+		output.TerminatingInstances = append(output.TerminatingInstances, types.InstanceStateChange{
+			InstanceId:    aws.String(id),
+			PreviousState: instanceState(previous),
+			CurrentState:  instanceState(inst.instance.State.Name),
+		})
+	}
+
+	return output, nil
+}
+
+func (p *FakeProvider) CreateImage(_ context.Context, params *ec2.CreateImageInput, _ ...func(*ec2.Options)) (*ec2.CreateImageOutput, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.settle()
+
+	instanceID := aws.ToString(params.InstanceId)
+	inst, ok := p.instances[instanceID]
+	if !ok {
+		return nil, fakeError("InvalidInstanceID.NotFound", "The instance ID '%s' does not exist", instanceID)
+	}
+	if inst.instance.State.Name == types.InstanceStateNameTerminated {
+		return nil, fakeError("IncorrectInstanceState", "The instance '%s' is terminated", instanceID)
+	}
+
+	name := aws.ToString(params.Name)
+	for _, image := range p.images {
+		if aws.ToString(image.image.Name) == name {
+			return nil, fakeError("InvalidAMIName.Duplicate", "AMI name %s is already in use by AMI %s", name, aws.ToString(image.image.ImageId))
+		}
+	}
+
+	var tags []types.Tag
+	for _, spec := range params.TagSpecifications {
+		if spec.ResourceType == types.ResourceTypeImage {
+			tags = append(tags, spec.Tags...)
+		}
+	}
+
+	p.counter++
+	imageID := fmt.Sprintf("ami-0f%015x", p.counter)
+	p.images[imageID] = &fakeImage{
+		image: types.Image{
+			ImageId:             aws.String(imageID),
+			Name:                aws.String(name),
+			State:               types.ImageStatePending,
+			Public:              aws.Bool(false),
+			CreationDate:        aws.String(p.now().UTC().Format(time.RFC3339)),
+			SourceInstanceId:    aws.String(instanceID),
+			Tags:                tags,
+			BlockDeviceMappings: rootVolume(),
+		},
+		settleAt: p.now().Add(p.TransitionDelay),
+	}
+
+	return &ec2.CreateImageOutput{ImageId: aws.String(imageID)}, nil
+}
+
+func (p *FakeProvider) DeregisterImage(_ context.Context, params *ec2.DeregisterImageInput, _ ...func(*ec2.Options)) (*ec2.DeregisterImageOutput, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	imageID := aws.ToString(params.ImageId)
+	if _, ok := p.images[imageID]; !ok {
+		return nil, fakeError("InvalidAMIID.NotFound", "The image id '[%s]' does not exist", imageID)
+	}
+
+	delete(p.images, imageID)
+	return &ec2.DeregisterImageOutput{}, nil
+}
+
+func (p *FakeProvider) DescribeImages(_ context.Context, params *ec2.DescribeImagesInput, _ ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.settle()
+
+	output := &ec2.DescribeImagesOutput{}
+	for _, id := range slices.Sorted(maps.Keys(p.images)) {
+		image := p.images[id].image
+		if len(params.ImageIds) > 0 && !slices.Contains(params.ImageIds, id) {
+			continue
+		}
+		if !matchFilters(params.Filters, func(name string) []string { return imageAttribute(image, name) }) {
+			continue
+		}
+		image.Tags = append([]types.Tag(nil), image.Tags...)
+		output.Images = append(output.Images, image)
+	}
+
+	return output, nil
+}
+
+func (p *FakeProvider) DescribeTags(_ context.Context, params *ec2.DescribeTagsInput, _ ...func(*ec2.Options)) (*ec2.DescribeTagsOutput, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var descriptions []types.TagDescription
+	collect := func(resourceID string, resourceType types.ResourceType, tags []types.Tag) {
+		for _, tag := range tags {
+			attr := func(name string) []string {
+				switch name {
+				case "resource-id":
+					return []string{resourceID}
+				case "resource-type":
+					return []string{string(resourceType)}
+				case "key":
+					return []string{aws.ToString(tag.Key)}
+				case "value":
+					return []string{aws.ToString(tag.Value)}
+				}
+				return nil
+			}
+			if matchFilters(params.Filters, attr) {
+				descriptions = append(descriptions, types.TagDescription{
+					Key:          tag.Key,
+					Value:        tag.Value,
+					ResourceId:   aws.String(resourceID),
+					ResourceType: resourceType,
+				})
+			}
+		}
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(p.instances)) {
+		collect(id, types.ResourceTypeInstance, p.instances[id].instance.Tags)
+	}
+	for _, id := range slices.Sorted(maps.Keys(p.images)) {
+		collect(id, types.ResourceTypeImage, p.images[id].image.Tags)
+	}
+
+	return &ec2.DescribeTagsOutput{Tags: descriptions}, nil
+}
+
+func (p *FakeProvider) CreateTags(_ context.Context, params *ec2.CreateTagsInput, _ ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, resourceID := range params.Resources {
+		switch {
+		case p.instances[resourceID] != nil:
+			inst := p.instances[resourceID]
+			inst.instance.Tags = mergeTags(inst.instance.Tags, params.Tags)
+		case p.images[resourceID] != nil:
+			image := p.images[resourceID]
+			image.image.Tags = mergeTags(image.image.Tags, params.Tags)
+		default:
+			return nil, fakeError("InvalidID", "The ID '%s' is not valid", resourceID)
+		}
+	}
+
+	return &ec2.CreateTagsOutput{}, nil
+}
+
+// DescribeSpotInstanceRequests always returns no requests, spot instances
+// launched by RunInstance and RunInstances carry their tags directly.
+func (p *FakeProvider) DescribeSpotInstanceRequests(_ context.Context, _ *ec2.DescribeSpotInstanceRequestsInput, _ ...func(*ec2.Options)) (*ec2.DescribeSpotInstanceRequestsOutput, error) {
+	return &ec2.DescribeSpotInstanceRequestsOutput{}, nil
+}
+
+// CancelSpotInstanceRequests accepts any request, FakeProvider keeps none.
+func (p *FakeProvider) CancelSpotInstanceRequests(_ context.Context, params *ec2.CancelSpotInstanceRequestsInput, _ ...func(*ec2.Options)) (*ec2.CancelSpotInstanceRequestsOutput, error) {
+	output := &ec2.CancelSpotInstanceRequestsOutput{}
+	for _, id := range params.SpotInstanceRequestIds {
+		output.CancelledSpotInstanceRequests = append(output.CancelledSpotInstanceRequests, types.CancelledSpotInstanceRequest{
+			SpotInstanceRequestId: aws.String(id),
+			State:                 types.CancelSpotInstanceRequestStateCancelled,
+		})
+	}
+	return output, nil
+}
+
+func (p *FakeProvider) DescribeInstanceTypes(_ context.Context, params *ec2.DescribeInstanceTypesInput, _ ...func(*ec2.Options)) (*ec2.DescribeInstanceTypesOutput, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	output := &ec2.DescribeInstanceTypesOutput{}
+	for _, name := range slices.Sorted(maps.Keys(p.instanceTypes)) {
+		if len(params.InstanceTypes) > 0 && !slices.Contains(params.InstanceTypes, name) {
+			continue
+		}
+		output.InstanceTypes = append(output.InstanceTypes, p.instanceTypes[name])
+	}
+
+	return output, nil
+}
+
+// settle moves instances and images whose transition delay has passed into
+// their final state. The caller must hold p.mu.
+func (p *FakeProvider) settle() {
+	now := p.now()
+	for _, inst := range p.instances {
+		if inst.next != "" && !now.Before(inst.settleAt) {
+			inst.instance.State = instanceState(inst.next)
+			inst.next = ""
+		}
+	}
+	for _, image := range p.images {
+		if image.image.State == types.ImageStatePending && !now.Before(image.settleAt) {
+			image.image.State = types.ImageStateAvailable
+		}
+	}
+}
+
+// transition puts the instance in an intermediate state that settles into
+// next after TransitionDelay. The caller must hold p.mu.
+func (p *FakeProvider) transition(inst *fakeInstance, current, next types.InstanceStateName) {
+	inst.instance.State = instanceState(current)
+	inst.next = next
+	inst.settleAt = p.now().Add(p.TransitionDelay)
+}
+
+func instanceAttribute(inst types.Instance, name string) []string {
+	if key, ok := strings.CutPrefix(name, "tag:"); ok {
+		return tagValues(inst.Tags, key)
+	}
+
+	switch name {
+	case "instance-id":
+		return []string{aws.ToString(inst.InstanceId)}
+	case "instance-state-name":
+		return []string{string(inst.State.Name)}
+	case "instance-type":
+		return []string{string(inst.InstanceType)}
+	case "image-id":
+		return []string{aws.ToString(inst.ImageId)}
+	case "tag-key":
+		return tagKeys(inst.Tags)
+	}
+	return nil
+}
+
+func imageAttribute(image types.Image, name string) []string {
+	if key, ok := strings.CutPrefix(name, "tag:"); ok {
+		return tagValues(image.Tags, key)
+	}
+
+	switch name {
+	case "image-id":
+		return []string{aws.ToString(image.ImageId)}
+	case "name":
+		return []string{aws.ToString(image.Name)}
+	case "state":
+		return []string{string(image.State)}
+	case "is-public":
+		return []string{fmt.Sprint(aws.ToBool(image.Public))}
+	case "source-instance-id":
+		return []string{aws.ToString(image.SourceInstanceId)}
+	case "tag-key":
+		return tagKeys(image.Tags)
+	}
+	return nil
+}
+
+var knownFilters = map[string]bool{
+	"instance-id": true, "instance-state-name": true, "instance-type": true,
+	"image-id": true, "tag-key": true, "name": true, "state": true,
+	"is-public": true, "source-instance-id": true, "resource-id": true,
+	"resource-type": true, "key": true, "value": true,
+}
+
+// matchFilters reports whether a resource matches every filter. attr returns
+// the resource's values for a filter name. Filter values may use the * and ?
+// wildcards supported by EC2.
+func matchFilters(filters []types.Filter, attr func(name string) []string) bool {
+	for _, filter := range filters {
+		name := aws.ToString(filter.Name)
+		if !knownFilters[name] && !strings.HasPrefix(name, "tag:") {
+			continue
+		}
+
+		matched := false
+		for _, actual := range attr(name) {
+			for _, pattern := range filter.Values {
+				if ok, _ := path.Match(pattern, actual); ok {
+					matched = true
+				}
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func mergeTags(existing, updates []types.Tag) []types.Tag {
+	merged := append([]types.Tag(nil), existing...)
+	for _, update := range updates {
+		replaced := false
+		for i := range merged {
+			if aws.ToString(merged[i].Key) == aws.ToString(update.Key) {
+				merged[i] = update
+				replaced = true
+			}
+		}
+		if !replaced {
+			merged = append(merged, update)
+		}
+	}
+	return merged
+}
+
+func tagValues(tags []types.Tag, key string) []string {
+	var values []string
+	for _, tag := range tags {
+		if aws.ToString(tag.Key) == key {
+			values = append(values, aws.ToString(tag.Value))
+		}
+	}
+	return values
+}
+
+func tagKeys(tags []types.Tag) []string {
+	keys := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		keys = append(keys, aws.ToString(tag.Key))
+	}
+	return keys
+}
+
+func instanceState(name types.InstanceStateName) *types.InstanceState {
+	codes := map[types.InstanceStateName]int32{
+		types.InstanceStateNamePending:      0,
+		types.InstanceStateNameRunning:      16,
+		types.InstanceStateNameShuttingDown: 32,
+		types.InstanceStateNameTerminated:   48,
+		types.InstanceStateNameStopping:     64,
+		types.InstanceStateNameStopped:      80,
+	}
+	return &types.InstanceState{Name: name, Code: aws.Int32(codes[name])}
+}
+
+func rootVolume() []types.BlockDeviceMapping {
+	return []types.BlockDeviceMapping{{
+		DeviceName: aws.String("/dev/xvda"),
+		Ebs: &types.EbsBlockDevice{
+			VolumeSize: aws.Int32(fakeRootVolumeSizeGB),
+			VolumeType: types.VolumeTypeGp3,
+		},
+	}}
+}
+
+func fakeError(code, format string, args ...any) error {
+	return &smithy.GenericAPIError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,102 @@
+package instance
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+// newTestProvider returns a FakeProvider on a clock that only moves when the
+// returned function is called.
+func newTestProvider() (*FakeProvider, func(time.Duration)) {
+	now := time.Unix(1_000_000, 0)
+	p := NewFakeProvider()
+	p.now = func() time.Time { return now }
+	return p, func(d time.Duration) { now = now.Add(d) }
+}
+
+func instanceStateOf(t *testing.T, p *FakeProvider, instanceID string) types.InstanceStateName {
+	t.Helper()
+	out, err := p.DescribeInstances(context.Background(), &ec2.DescribeInstancesInput{InstanceIds: []string{instanceID}})
+	if err != nil {
+		t.Fatalf("DescribeInstances: %v", err)
+	}
+	if len(out.Reservations) != 1 || len(out.Reservations[0].Instances) != 1 {
+		t.Fatalf("DescribeInstances(%s) returned %d reservations", instanceID, len(out.Reservations))
+	}
+	return out.Reservations[0].Instances[0].State.Name
+}
+
+func TestFakeProviderStartStop(t *testing.T) {
+	ctx := context.Background()
+	p, advance := newTestProvider()
+	id := p.RunInstance(FakeInstanceSpec{ImageID: "ami-1", InstanceType: "t3.small"})
+
+	steps := []struct {
+		name   string
+		action func() error
+		want   types.InstanceStateName
+	}{
+		{"launched", nil, types.InstanceStateNamePending},
+		{"launch settled", func() error { advance(p.TransitionDelay); return nil }, types.InstanceStateNameRunning},
+		{"stop", func() error {
+			_, err := p.StopInstances(ctx, &ec2.StopInstancesInput{InstanceIds: []string{id}})
+			return err
+		}, types.InstanceStateNameStopping},
+		{"stop again while stopping", func() error {
+			_, err := p.StopInstances(ctx, &ec2.StopInstancesInput{InstanceIds: []string{id}})
+			return err
+		}, types.InstanceStateNameStopping},
+		{"stop settled", func() error { advance(p.TransitionDelay); return nil }, types.InstanceStateNameStopped},
+		{"start", func() error {
+			_, err := p.StartInstances(ctx, &ec2.StartInstancesInput{InstanceIds: []string{id}})
+			return err
+		}, types.InstanceStateNamePending},
+		{"start settled", func() error { advance(p.TransitionDelay); return nil }, types.InstanceStateNameRunning},
+		{"terminate", func() error { return p.TerminateInstance(id) }, types.InstanceStateNameShuttingDown},
+		{"terminate settled", func() error { advance(p.TransitionDelay); return nil }, types.InstanceStateNameTerminated},
+	}
+	for _, step := range steps {
+		if step.action != nil {
+			if err := step.action(); err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+		}
+		if got := instanceStateOf(t, p, id); got != step.want {
+			t.Fatalf("%s: state %s, want %s", step.name, got, step.want)
+		}
+	}
+}
+
+func TestFakeProviderRefusesInvalidTransitions(t *testing.T) {
+	ctx := context.Background()
+	p, advance := newTestProvider()
+	id := p.RunInstance(FakeInstanceSpec{ImageID: "ami-1", InstanceType: "t3.small"})
+	advance(p.TransitionDelay)
+	if err := p.TerminateInstance(id); err != nil {
+		t.Fatalf("TerminateInstance: %v", err)
+	}
+	advance(p.TransitionDelay)
+
+	_, err := p.StartInstances(ctx, &ec2.StartInstancesInput{InstanceIds: []string{id}})
+	if code := apiErrorCode(err); code != "IncorrectInstanceState" {
+		t.Errorf("StartInstances of a terminated instance = %v, want IncorrectInstanceState", err)
+	}
+	_, err = p.StopInstances(ctx, &ec2.StopInstancesInput{InstanceIds: []string{id}})
+	if code := apiErrorCode(err); code != "IncorrectInstanceState" {
+		t.Errorf("StopInstances of a terminated instance = %v, want IncorrectInstanceState", err)
+	}
+}
+
+func apiErrorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
@@ -0,0 +1,94 @@
+package instance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+const (
+	deployedByTag   = "DeployedBy"
+	deployedByValue = "turbo-deploy"
+	deploymentIDTag = "DeploymentID"
+)
+
+// ErrNotManaged is returned when asked to act on an instance or image that
+// turbo-deploy did not create for the deployment in question. It keeps the
+// API from touching unrelated resources in the same account.
+var ErrNotManaged = errors.New("not a turbo-deploy resource of this deployment")
+
+// verifyInstance checks that instanceID was launched by turbo-deploy for
+// deployment deploymentID.
+func (s *Service) verifyInstance(ctx context.Context, deploymentID, instanceID string) error {
+	_, err := s.managedInstance(ctx, deploymentID, instanceID)
+	return err
+}
+
+// managedInstance returns instanceID after checking that it was launched by
+// turbo-deploy for deployment deploymentID.
+func (s *Service) managedInstance(ctx context.Context, deploymentID, instanceID string) (types.Instance, error) {
+	output, err := s.provider.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+		InstanceIds: []string{instanceID},
+	})
+	if err != nil {
+		return types.Instance{}, err
+	}
+
+	for _, reservation := range output.Reservations {
+		for _, inst := range reservation.Instances {
+			if aws.ToString(inst.InstanceId) == instanceID {
+				return inst, checkOwnership("instance "+instanceID, deploymentID, inst.Tags)
+			}
+		}
+	}
+
+	return types.Instance{}, fmt.Errorf("%w: instance %s not found", ErrNotManaged, instanceID)
+}
+
+// verifyImage checks that imageID was captured by turbo-deploy from an
+// instance of deployment deploymentID.
+func (s *Service) verifyImage(ctx context.Context, deploymentID, imageID string) error {
+	output, err := s.provider.DescribeImages(ctx, &ec2.DescribeImagesInput{
+		ImageIds: []string{imageID},
+	})
+	if err != nil {
+		return err
+	}
+	if len(output.Images) == 0 {
+		return fmt.Errorf("%w: image %s not found", ErrNotManaged, imageID)
+	}
+	image := output.Images[0]
+
+	if getInstanceTagValue(deployedByTag, image.Tags) != deployedByValue {
+		return fmt.Errorf("%w: image %s was not captured by turbo-deploy", ErrNotManaged, imageID)
+	}
+
+	// images are tagged with their deployment since they are guarded, older
+	// ones are traced back through the instance they were captured from
+	if getInstanceTagValue(deploymentIDTag, image.Tags) != "" {
+		return checkOwnership("image "+imageID, deploymentID, image.Tags)
+	}
+	sourceInstanceID := aws.ToString(image.SourceInstanceId)
+	if sourceInstanceID == "" {
+		return fmt.Errorf("%w: image %s has no source instance", ErrNotManaged, imageID)
+	}
+	if err := s.verifyInstance(ctx, deploymentID, sourceInstanceID); err != nil {
+		return fmt.Errorf("image %s: %w", imageID, err)
+	}
+	return nil
+}
+
+// checkOwnership checks the tags of resource name against deploymentID.
+func checkOwnership(name, deploymentID string, tags []types.Tag) error {
+	if getInstanceTagValue(deployedByTag, tags) != deployedByValue {
+		return fmt.Errorf("%w: %s was not created by turbo-deploy", ErrNotManaged, name)
+	}
+	if owner := getInstanceTagValue(deploymentIDTag, tags); owner == "" || owner != deploymentID {
+		return fmt.Errorf("%w: %s does not belong to deployment %s", ErrNotManaged, name, deploymentID)
+	}
+	return nil
+}
@@ -2,51 +2,89 @@ package instance
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/frgrisk/turbo-deploy/server/models"
 	"golang.org/x/sync/errgroup"
 )
 
-var ec2Client *ec2.Client
+// ErrNoInstance is returned when a deployment has no instance, usually
+// because the provisioner has not launched it yet.
+var ErrNoInstance = errors.New("deployment has no instance")
 
-func init() {
-	cfg, err := config.LoadDefaultConfig(context.Background())
+// Service runs the instance and image operations behind the API on top of a
+// ComputeProvider.
+type Service struct {
+	provider ComputeProvider
+
+	// vcpus caches the vCPU count of instance types, which never changes.
+	vcpusMu sync.Mutex
+	vcpus   map[string]int
+}
+
+// NewService returns a Service that talks to the given provider.
+func NewService(provider ComputeProvider) *Service {
+	return &Service{provider: provider}
+}
+
+func (s *Service) GetDeployedInstances(ctx context.Context) ([]models.DeploymentResponse, error) {
+	return s.describeDeployments(ctx)
+}
+
+// GetDeploymentInstance returns the instance provisioned for a deployment, or
+// ErrNoInstance if there is none yet.
+func (s *Service) GetDeploymentInstance(ctx context.Context, deploymentID string) (*models.DeploymentResponse, error) {
+	deployments, err := s.describeDeployments(ctx, types.Filter{
+		Name:   aws.String("tag:DeploymentID"),
+		Values: []string{deploymentID},
+	})
 	if err != nil {
-		log.Printf("unable to load SDK config %v", err)
+		return nil, err
 	}
+	if len(deployments) == 0 {
+		return nil, ErrNoInstance
+	}
+	return &deployments[0], nil
+}
 
-	ec2Client = ec2.NewFromConfig(cfg)
+// GetInstanceDeployment returns the turbo-deploy instance instanceID, or
+// ErrNoInstance if no deployment has an instance with that ID.
+func (s *Service) GetInstanceDeployment(ctx context.Context, instanceID string) (*models.DeploymentResponse, error) {
+	deployments, err := s.describeDeployments(ctx, types.Filter{
+		Name:   aws.String("instance-id"),
+		Values: []string{instanceID},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(deployments) == 0 {
+		return nil, ErrNoInstance
+	}
+	return &deployments[0], nil
 }
 
-func GetDeployedInstances() ([]models.DeploymentResponse, error) {
+// describeDeployments lists the live turbo-deploy instances matching the
+// extra filters.
+func (s *Service) describeDeployments(ctx context.Context, filters ...types.Filter) ([]models.DeploymentResponse, error) {
 	input := &ec2.DescribeInstancesInput{
-		Filters: []types.Filter{
-			{
-				Name:   aws.String("tag:DeployedBy"),
-				Values: []string{"turbo-deploy"},
-			},
-			{
-				Name:   aws.String("instance-state-name"),
-				Values: []string{"pending", "running", "stopping", "stopped"},
-			},
-		},
+		Filters: liveInstanceFilters(filters...),
 	}
 
 	var deployments []models.DeploymentResponse
 
-	paginator := ec2.NewDescribeInstancesPaginator(ec2Client, input)
+	paginator := ec2.NewDescribeInstancesPaginator(s.provider, input)
 	for paginator.HasMorePages() {
-		output, err := paginator.NextPage(context.Background())
+		output, err := paginator.NextPage(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -54,28 +92,17 @@ func GetDeployedInstances() ([]models.DeploymentResponse, error) {
 		for _, reservation := range output.Reservations {
 			for _, instance := range reservation.Instances {
 				// Get image based on the instance
-				filter := []types.Filter{
-					{
-						Name:   aws.String("source-instance-id"),
-						Values: []string{*instance.InstanceId},
-					},
-					{
-						Name:   aws.String("is-public"),
-						Values: []string{"false"},
-					},
-				}
-
-				imageResult, err := GetImage(filter)
+				images, err := s.GetInstanceImages(ctx, aws.ToString(instance.InstanceId))
 				if err != nil {
 					log.Printf("failed to resolve image for instance %s: %v", *instance.InstanceId, err)
 					return nil, err
 				}
 
 				var imageID string
-				if len(imageResult.Images) == 0 {
+				if len(images) == 0 {
 					imageID = "none"
 				} else {
-					imageID = *imageResult.Images[0].ImageId
+					imageID = *images[0].ImageId
 				}
 
 				deployment := models.DeploymentResponse{
@@ -90,6 +117,7 @@ func GetDeployedInstances() ([]models.DeploymentResponse, error) {
 					Lifecycle:        getLifecycle(instance.InstanceLifecycle),
 					Status:           string(instance.State.Name),
 					UserData:         splitUserData(getInstanceTagValue("UserData", instance.Tags)),
+					LaunchTime:       instance.LaunchTime,
 				}
 
 				deployments = append(deployments, deployment)
@@ -100,16 +128,37 @@ func GetDeployedInstances() ([]models.DeploymentResponse, error) {
 	return deployments, nil
 }
 
+// liveInstanceFilters returns the filters matching the turbo-deploy instances
+// that are not shutting down or terminated, followed by extra.
+func liveInstanceFilters(extra ...types.Filter) []types.Filter {
+	return append([]types.Filter{
+		{
+			Name:   aws.String("tag:DeployedBy"),
+			Values: []string{"turbo-deploy"},
+		},
+		{
+			Name:   aws.String("instance-state-name"),
+			Values: []string{"pending", "running", "stopping", "stopped"},
+		},
+	}, extra...)
+}
+
 func splitUserData(userData string) []string {
 	return strings.Split(userData, ",")
 }
 
-func StartInstance(instanceID string) error {
+// StartInstance starts instanceID, which must be the instance of deployment
+// deploymentID.
+func (s *Service) StartInstance(ctx context.Context, deploymentID, instanceID string) error {
+	if err := s.verifyInstance(ctx, deploymentID, instanceID); err != nil {
+		return err
+	}
+
 	input := &ec2.StartInstancesInput{
 		InstanceIds: []string{instanceID},
 	}
 
-	_, err := ec2Client.StartInstances(context.Background(), input)
+	_, err := s.provider.StartInstances(ctx, input)
 	if err != nil {
 		log.Printf("failed to start instance %s: %v", instanceID, err)
 		return err
@@ -119,12 +168,18 @@ func StartInstance(instanceID string) error {
 	return nil
 }
 
-func StopInstance(instanceID string) error {
+// StopInstance stops instanceID, which must be the instance of deployment
+// deploymentID.
+func (s *Service) StopInstance(ctx context.Context, deploymentID, instanceID string) error {
+	if err := s.verifyInstance(ctx, deploymentID, instanceID); err != nil {
+		return err
+	}
+
 	input := &ec2.StopInstancesInput{
 		InstanceIds: []string{instanceID},
 	}
 
-	_, err := ec2Client.StopInstances(context.Background(), input)
+	_, err := s.provider.StopInstances(ctx, input)
 	if err != nil {
 		log.Printf("failed to stop instance %s: %v", instanceID, err)
 		return err
@@ -134,6 +189,61 @@ func StopInstance(instanceID string) error {
 	return nil
 }
 
+// TerminateInstance terminates instanceID, which must be the instance of
+// deployment deploymentID. The spot request of a spot instance is cancelled
+// first, so a persistent request does not launch it again.
+func (s *Service) TerminateInstance(ctx context.Context, deploymentID, instanceID string) error {
+	inst, err := s.managedInstance(ctx, deploymentID, instanceID)
+	if err != nil {
+		return err
+	}
+
+	if requestID := aws.ToString(inst.SpotInstanceRequestId); requestID != "" {
+		_, err := s.provider.CancelSpotInstanceRequests(ctx, &ec2.CancelSpotInstanceRequestsInput{
+			SpotInstanceRequestIds: []string{requestID},
+		})
+		if err != nil {
+			log.Printf("failed to cancel spot request %s of instance %s: %v", requestID, instanceID, err)
+			return err
+		}
+	}
+
+	input := &ec2.TerminateInstancesInput{
+		InstanceIds: []string{instanceID},
+	}
+
+	_, err = s.provider.TerminateInstances(ctx, input)
+	if err != nil {
+		log.Printf("failed to terminate instance %s: %v", instanceID, err)
+		return err
+	}
+
+	log.Printf("Instance %s terminated successfully", instanceID)
+	return nil
+}
+
+// SetInstanceExpiry updates the TimeToExpire tag of instanceID, which must be
+// the instance of deployment deploymentID.
+func (s *Service) SetInstanceExpiry(ctx context.Context, deploymentID, instanceID string, timeToExpire int64) error {
+	if err := s.verifyInstance(ctx, deploymentID, instanceID); err != nil {
+		return err
+	}
+
+	_, err := s.provider.CreateTags(ctx, &ec2.CreateTagsInput{
+		Resources: []string{instanceID},
+		Tags: []types.Tag{{
+			Key:   aws.String("TimeToExpire"),
+			Value: aws.String(strconv.FormatInt(timeToExpire, 10)),
+		}},
+	})
+	if err != nil {
+		log.Printf("failed to tag instance %s: %v", instanceID, err)
+		return err
+	}
+
+	return nil
+}
+
 func getInstanceTagValue(tagKey string, tags []types.Tag) string {
 	for _, tag := range tags {
 		if *tag.Key == tagKey {
@@ -150,7 +260,13 @@ func getLifecycle(lifecycle types.InstanceLifecycleType) string {
 	return string(lifecycle)
 }
 
-func CaptureInstanceImage(instanceID string) (string, error) {
+// CaptureInstanceImage creates an image of instanceID, which must be the
+// instance of deployment deploymentID, and returns the image ID.
+func (s *Service) CaptureInstanceImage(ctx context.Context, deploymentID, instanceID string) (string, error) {
+	if err := s.verifyInstance(ctx, deploymentID, instanceID); err != nil {
+		return "", err
+	}
+
 	// get tags of the instance
 	describeInstanceTags := &ec2.DescribeTagsInput{
 		Filters: []types.Filter{
@@ -161,7 +277,7 @@ func CaptureInstanceImage(instanceID string) (string, error) {
 		},
 	}
 
-	tagsResult, err := ec2Client.DescribeTags(context.Background(), describeInstanceTags)
+	tagsResult, err := s.provider.DescribeTags(ctx, describeInstanceTags)
 	if err != nil {
 		log.Printf("failed to describe tags for instance %s: %v", instanceID, err)
 		return "", err
@@ -189,14 +305,18 @@ func CaptureInstanceImage(instanceID string) (string, error) {
 				ResourceType: types.ResourceType("image"),
 				Tags: []types.Tag{
 					{
-						Key:   aws.String("DeployedBy"),
-						Value: aws.String("turbo-deploy"),
+						Key:   aws.String(deployedByTag),
+						Value: aws.String(deployedByValue),
+					},
+					{
+						Key:   aws.String(deploymentIDTag),
+						Value: aws.String(deploymentID),
 					},
 				},
 			},
 		},
 	}
-	result, err := ec2Client.CreateImage(context.Background(), imageInput)
+	result, err := s.provider.CreateImage(ctx, imageInput)
 	if err != nil {
 		log.Printf("failed to create image for instance %s: %v", instanceID, err)
 		return "", err
@@ -206,14 +326,30 @@ func CaptureInstanceImage(instanceID string) (string, error) {
 	return aws.ToString(result.ImageId), nil
 }
 
-func GetAvailableAmis(amilist []models.AmiAttr, filterMap map[string][]types.Filter) ([]models.AmiAttr, error) {
+// WaitForImage waits until imageID is available, failing if it fails or is
+// still pending after timeout. pollInterval is how often it is checked, 15
+// seconds if zero.
+func (s *Service) WaitForImage(ctx context.Context, imageID string, pollInterval, timeout time.Duration) error {
+	waiter := ec2.NewImageAvailableWaiter(s.provider, func(o *ec2.ImageAvailableWaiterOptions) {
+		if pollInterval > 0 {
+			o.MinDelay = pollInterval
+			o.MaxDelay = max(o.MaxDelay, pollInterval)
+		}
+	})
+	if err := waiter.Wait(ctx, &ec2.DescribeImagesInput{ImageIds: []string{imageID}}, timeout); err != nil {
+		return fmt.Errorf("image %s is not available: %w", imageID, err)
+	}
+	return nil
+}
+
+func (s *Service) GetAvailableAmis(ctx context.Context, amilist []models.AmiAttr, filterMap map[string][]types.Filter) ([]models.AmiAttr, error) {
 	g := new(errgroup.Group)
 	var mutex sync.Mutex
 
 	for _, filter := range filterMap {
 		f := filter
 		g.Go(func() error {
-			imageResult, err := GetImage(f)
+			imageResult, err := s.GetImage(ctx, f)
 			if err != nil {
 				log.Printf("failed to retrieve images: %v", err)
 				return err
@@ -253,7 +389,7 @@ func GetAvailableAmis(amilist []models.AmiAttr, filterMap map[string][]types.Fil
 // GetAMIName assigns names to AMI attributes by fetching the image details from AWS
 // using the AMI IDs provided in the ami slice. It uses goroutines to fetch names
 // concurrently for each AMI ID, improving performance when dealing with multiple AMIs.
-func GetAMIName(ami []models.AmiAttr) ([]models.AmiAttr, error) {
+func (s *Service) GetAMIName(ctx context.Context, ami []models.AmiAttr) ([]models.AmiAttr, error) {
 	g := new(errgroup.Group)
 	for index := range ami {
 		i := index
@@ -264,7 +400,7 @@ func GetAMIName(ami []models.AmiAttr) ([]models.AmiAttr, error) {
 					Values: []string{ami[i].AmiID},
 				},
 			}
-			imageResult, err := GetImage(filter)
+			imageResult, err := s.GetImage(ctx, filter)
 			if err == nil {
 				ami[i].AmiName = *imageResult.Images[0].Name
 			}
@@ -278,12 +414,12 @@ func GetAMIName(ami []models.AmiAttr) ([]models.AmiAttr, error) {
 	return ami, nil
 }
 
-func GetImage(filter []types.Filter) (*ec2.DescribeImagesOutput, error) {
+func (s *Service) GetImage(ctx context.Context, filter []types.Filter) (*ec2.DescribeImagesOutput, error) {
 	describeInstanceImage := &ec2.DescribeImagesInput{
 		Filters: filter,
 	}
 
-	imageResult, err := ec2Client.DescribeImages(context.Background(), describeInstanceImage)
+	imageResult, err := s.provider.DescribeImages(ctx, describeInstanceImage)
 	if err != nil {
 		return nil, err
 	}
@@ -291,13 +427,37 @@ func GetImage(filter []types.Filter) (*ec2.DescribeImagesOutput, error) {
 	return imageResult, nil
 }
 
-func DeregisterImage(imageID string) error {
+// GetInstanceImages returns the private images captured from an instance.
+func (s *Service) GetInstanceImages(ctx context.Context, instanceID string) ([]types.Image, error) {
+	imageResult, err := s.GetImage(ctx, []types.Filter{
+		{
+			Name:   aws.String("source-instance-id"),
+			Values: []string{instanceID},
+		},
+		{
+			Name:   aws.String("is-public"),
+			Values: []string{"false"},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return imageResult.Images, nil
+}
+
+// DeregisterImage deletes imageID and its snapshots. The image must have been
+// captured from an instance of deployment deploymentID.
+func (s *Service) DeregisterImage(ctx context.Context, deploymentID, imageID string) error {
+	if err := s.verifyImage(ctx, deploymentID, imageID); err != nil {
+		return err
+	}
+
 	describeDeregisterImage := &ec2.DeregisterImageInput{
 		ImageId:                   aws.String(imageID),
 		DeleteAssociatedSnapshots: aws.Bool(true),
 	}
 
-	_, err := ec2Client.DeregisterImage(context.Background(), describeDeregisterImage)
+	_, err := s.provider.DeregisterImage(ctx, describeDeregisterImage)
 	if err != nil {
 		log.Printf("failed to deregister image %s: %v", imageID, err)
 		return err
@@ -306,3 +466,75 @@ func DeregisterImage(imageID string) error {
 	log.Printf("Image %s deregistered successfully", imageID)
 	return nil
 }
+
+// PopulateSpotTagResponse copies the tags of fulfilled spot requests onto their
+// instances, since tags set on a spot request are not applied to the instance.
+func (s *Service) PopulateSpotTagResponse(ctx context.Context) error {
+	// Get all EC2 instances
+	instancesResp, err := s.provider.DescribeInstances(ctx, &ec2.DescribeInstancesInput{})
+	if err != nil {
+		log.Printf("error describing EC2 instances: %v", err)
+		return err
+	}
+
+	// Get all Spot instance requests
+	spotResp, err := s.provider.DescribeSpotInstanceRequests(ctx, &ec2.DescribeSpotInstanceRequestsInput{})
+	if err != nil {
+		log.Printf("error describing EC2 spot instances: %v", err)
+		return err
+	}
+
+	// Create a map to associate spot instance request IDs with their tags
+	requestTags := make(map[string][]types.Tag)
+	for _, request := range spotResp.SpotInstanceRequests {
+		requestTags[*request.SpotInstanceRequestId] = request.Tags
+	}
+
+	for _, reservation := range instancesResp.Reservations {
+		for _, instance := range reservation.Instances {
+			// check if the instance is a spot instance and has a corresponding spot req
+			if instance.InstanceLifecycle == types.InstanceLifecycleTypeSpot && instance.SpotInstanceRequestId != nil {
+				spotRequestID := *instance.SpotInstanceRequestId
+				if tags, ok := requestTags[spotRequestID]; ok {
+					// Check if instance already has tags; if not, apply them
+					if len(instance.Tags) == 0 {
+						_, err := s.provider.CreateTags(ctx, &ec2.CreateTagsInput{
+							Resources: []string{*instance.InstanceId},
+							Tags:      tags,
+						})
+						if err != nil {
+							log.Printf("Failed to create tags for instance %s: %v", *instance.InstanceId, err)
+							return err
+						}
+						log.Printf("Tags from Spot Request %s have been applied to Instance %s", spotRequestID, *instance.InstanceId)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Service) GetEC2InstanceTypes(ctx context.Context) ([]string, error) {
+	input := &ec2.DescribeInstanceTypesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("processor-info.supported-architecture"),
+				Values: []string{"x86_64"},
+			},
+		},
+	}
+
+	response, err := s.provider.DescribeInstanceTypes(ctx, input)
+	if err != nil {
+		log.Printf("Failed to describe EC2 instance types: %v", err)
+		return nil, err
+	}
+
+	instanceTypes := make([]string, 0, len(response.InstanceTypes))
+	for _, it := range response.InstanceTypes {
+		instanceTypes = append(instanceTypes, string(it.InstanceType))
+	}
+
+	return instanceTypes, nil
+}
@@ -0,0 +1,209 @@
+package instance
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// resizeTimeout is how long ResizeInstance waits for an instance to stop.
+const resizeTimeout = 10 * time.Minute
+
+// LaunchSpec describes the instance of a deployment to launch.
+type LaunchSpec struct {
+	DeploymentID string
+	ImageID      string
+	InstanceType string
+	// Spot launches a one-time spot instance rather than an on-demand one.
+	Spot bool
+	// SubnetID and SecurityGroupIDs default to those of the default VPC.
+	SubnetID         string
+	SecurityGroupIDs []string
+	KeyName          string
+	// InstanceProfile is the name of the IAM instance profile.
+	InstanceProfile string
+	// UserData is the plain user data, it is encoded by LaunchInstance.
+	UserData string
+	// Tags are put on the instance and its volumes, DeployedBy and
+	// DeploymentID are always added.
+	Tags map[string]string
+	// ClientToken makes the launch idempotent, retrying it with the same
+	// token returns the instance launched the first time.
+	ClientToken string
+}
+
+// ListInstances returns the live turbo-deploy instances, only those of the
+// given deployments if any are given.
+func (s *Service) ListInstances(ctx context.Context, deploymentIDs ...string) ([]types.Instance, error) {
+	var filters []types.Filter
+	if len(deploymentIDs) > 0 {
+		filters = append(filters, types.Filter{
+			Name:   aws.String("tag:" + deploymentIDTag),
+			Values: deploymentIDs,
+		})
+	}
+
+	var instances []types.Instance
+	paginator := ec2.NewDescribeInstancesPaginator(s.provider, &ec2.DescribeInstancesInput{
+		Filters: liveInstanceFilters(filters...),
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, reservation := range output.Reservations {
+			instances = append(instances, reservation.Instances...)
+		}
+	}
+
+	return instances, nil
+}
+
+// LaunchInstance launches the instance described by spec and returns it as
+// it was launched, still pending.
+func (s *Service) LaunchInstance(ctx context.Context, spec LaunchSpec) (types.Instance, error) {
+	tags := maps.Clone(spec.Tags)
+	if tags == nil {
+		tags = make(map[string]string)
+	}
+	tags[deployedByTag] = deployedByValue
+	tags[deploymentIDTag] = spec.DeploymentID
+
+	input := &ec2.RunInstancesInput{
+		ImageId:      aws.String(spec.ImageID),
+		InstanceType: types.InstanceType(spec.InstanceType),
+		MinCount:     aws.Int32(1),
+		MaxCount:     aws.Int32(1),
+		TagSpecifications: []types.TagSpecification{
+			{ResourceType: types.ResourceTypeInstance, Tags: toTags(tags)},
+			{ResourceType: types.ResourceTypeVolume, Tags: toTags(tags)},
+		},
+	}
+	if spec.Spot {
+		input.InstanceMarketOptions = &types.InstanceMarketOptionsRequest{
+			MarketType: types.MarketTypeSpot,
+			SpotOptions: &types.SpotMarketOptions{
+				SpotInstanceType:             types.SpotInstanceTypeOneTime,
+				InstanceInterruptionBehavior: types.InstanceInterruptionBehaviorTerminate,
+			},
+		}
+	}
+	if spec.SubnetID != "" {
+		input.SubnetId = aws.String(spec.SubnetID)
+	}
+	if len(spec.SecurityGroupIDs) > 0 {
+		input.SecurityGroupIds = spec.SecurityGroupIDs
+	}
+	if spec.KeyName != "" {
+		input.KeyName = aws.String(spec.KeyName)
+	}
+	if spec.InstanceProfile != "" {
+		input.IamInstanceProfile = &types.IamInstanceProfileSpecification{Name: aws.String(spec.InstanceProfile)}
+	}
+	if spec.UserData != "" {
+		input.UserData = aws.String(base64.StdEncoding.EncodeToString([]byte(spec.UserData)))
+	}
+	if spec.ClientToken != "" {
+		input.ClientToken = aws.String(spec.ClientToken)
+	}
+
+	output, err := s.provider.RunInstances(ctx, input)
+	if err != nil {
+		log.Printf("failed to launch instance for deployment %s: %v", spec.DeploymentID, err)
+		return types.Instance{}, err
+	}
+	if len(output.Instances) == 0 {
+		return types.Instance{}, fmt.Errorf("no instance launched for deployment %s", spec.DeploymentID)
+	}
+
+	inst := output.Instances[0]
+	log.Printf("Instance %s launched for deployment %s", aws.ToString(inst.InstanceId), spec.DeploymentID)
+	return inst, nil
+}
+
+// ResizeInstance changes the type of instanceID, which must be the instance
+// of deployment deploymentID. A running instance is stopped for the change
+// and started again, pollInterval is how often it is checked while stopping,
+// 15 seconds if zero.
+func (s *Service) ResizeInstance(ctx context.Context, deploymentID, instanceID, instanceType string, pollInterval time.Duration) error {
+	inst, err := s.managedInstance(ctx, deploymentID, instanceID)
+	if err != nil {
+		return err
+	}
+
+	state := inst.State.Name
+	restart := state == types.InstanceStateNamePending || state == types.InstanceStateNameRunning
+	if state != types.InstanceStateNameStopped {
+		if restart {
+			if _, err := s.provider.StopInstances(ctx, &ec2.StopInstancesInput{InstanceIds: []string{instanceID}}); err != nil {
+				log.Printf("failed to stop instance %s: %v", instanceID, err)
+				return err
+			}
+		}
+		waiter := ec2.NewInstanceStoppedWaiter(s.provider, func(o *ec2.InstanceStoppedWaiterOptions) {
+			if pollInterval > 0 {
+				o.MinDelay = pollInterval
+				o.MaxDelay = max(o.MaxDelay, pollInterval)
+			}
+		})
+		err := waiter.Wait(ctx, &ec2.DescribeInstancesInput{InstanceIds: []string{instanceID}}, resizeTimeout)
+		if err != nil {
+			return fmt.Errorf("instance %s did not stop: %w", instanceID, err)
+		}
+	}
+
+	_, err = s.provider.ModifyInstanceAttribute(ctx, &ec2.ModifyInstanceAttributeInput{
+		InstanceId:   aws.String(instanceID),
+		InstanceType: &types.AttributeValue{Value: aws.String(instanceType)},
+	})
+	if err != nil {
+		log.Printf("failed to resize instance %s: %v", instanceID, err)
+		return err
+	}
+
+	if restart {
+		if _, err := s.provider.StartInstances(ctx, &ec2.StartInstancesInput{InstanceIds: []string{instanceID}}); err != nil {
+			log.Printf("failed to start instance %s: %v", instanceID, err)
+			return err
+		}
+	}
+
+	log.Printf("Instance %s resized to %s", instanceID, instanceType)
+	return nil
+}
+
+// TagInstance sets tags on instanceID, which must be the instance of
+// deployment deploymentID. Other tags are left alone.
+func (s *Service) TagInstance(ctx context.Context, deploymentID, instanceID string, tags map[string]string) error {
+	if err := s.verifyInstance(ctx, deploymentID, instanceID); err != nil {
+		return err
+	}
+
+	_, err := s.provider.CreateTags(ctx, &ec2.CreateTagsInput{
+		Resources: []string{instanceID},
+		Tags:      toTags(tags),
+	})
+	if err != nil {
+		log.Printf("failed to tag instance %s: %v", instanceID, err)
+		return err
+	}
+
+	return nil
+}
+
+func toTags(tags map[string]string) []types.Tag {
+	result := make([]types.Tag, 0, len(tags))
+	for _, key := range slices.Sorted(maps.Keys(tags)) {
+		result = append(result, types.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+	}
+	return result
+}
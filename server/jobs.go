@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/frgrisk/turbo-deploy/server/notify"
+	"github.com/frgrisk/turbo-deploy/server/reaper"
+)
+
+// JobEvent asks the Lambda function to run a scheduled job rather than serve
+// an API request. EventBridge rules send it as their constant input, e.g.
+// {"job": "reap"}.
+type JobEvent struct {
+	// Job names the job to run, see Jobs.
+	Job string `json:"job"`
+	// DryRun reports what the job would do without doing it.
+	DryRun bool `json:"dryRun"`
+}
+
+// jobs maps the name of every scheduled job to the method running it.
+func (s *Server) jobs() map[string]func(ctx context.Context, dryRun bool) (any, error) {
+	return map[string]func(ctx context.Context, dryRun bool) (any, error){
+		"reap":      func(ctx context.Context, dryRun bool) (any, error) { return s.Reap(ctx, dryRun) },
+		"notify":    func(ctx context.Context, dryRun bool) (any, error) { return s.Notify(ctx, dryRun) },
+		"scheduler": func(ctx context.Context, dryRun bool) (any, error) { return s.Schedule(ctx, dryRun) },
+		"stop-idle": func(ctx context.Context, dryRun bool) (any, error) { return s.StopIdle(ctx, dryRun) },
+		"reconcile": func(ctx context.Context, dryRun bool) (any, error) { return s.Reconcile(ctx, dryRun) },
+	}
+}
+
+// Jobs returns the names of the scheduled jobs.
+func (s *Server) Jobs() []string {
+	names := make([]string, 0, len(s.jobs()))
+	for name := range s.jobs() {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// RunJob runs the job named by event and returns its report.
+func (s *Server) RunJob(ctx context.Context, event JobEvent) (any, error) {
+	run, ok := s.jobs()[event.Job]
+	if !ok {
+		return nil, fmt.Errorf("unknown job %q, jobs are %s", event.Job, strings.Join(s.Jobs(), ", "))
+	}
+	return run(ctx, event.DryRun)
+}
+
+// Reap removes the deployments whose TimeToExpire has passed, as configured
+// by the reaper section of the configuration.
+func (s *Server) Reap(ctx context.Context, dryRun bool) (reaper.Report, error) {
+	return reaper.New(s.store, s.compute, reaper.Options{
+		DryRun:        dryRun,
+		GracePeriod:   s.cfg.Reaper.GracePeriod,
+		FinalSnapshot: s.cfg.Reaper.FinalSnapshot,
+	}).Run(ctx)
+}
+
+// Notify warns the users of deployments that are about to expire, through
+// the channels in the notify section of the configuration.
+func (s *Server) Notify(ctx context.Context, dryRun bool) (notify.Report, error) {
+	return notify.New(s.store, notify.ChannelsFromConfig(s.cfg.Notify), notify.Options{
+		LeadTimes: s.cfg.Notify.LeadTimes,
+		DryRun:    dryRun,
+		Links:     s.links,
+	}).Run(ctx)
+}
@@ -0,0 +1,245 @@
+// Package local runs the turbo-deploy API against in-process stand-ins for
+// DynamoDB and EC2 so the server can be used without network access.
+package local
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server"
+	"github.com/frgrisk/turbo-deploy/server/config"
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/idle"
+	"github.com/frgrisk/turbo-deploy/server/instance"
+	"github.com/frgrisk/turbo-deploy/server/pricing"
+	"github.com/frgrisk/turbo-deploy/server/provisioner"
+)
+
+// AMI is an image seeded into the fake compute provider.
+type AMI struct {
+	ID   string
+	Name string
+}
+
+// Options configures the local environment.
+type Options struct {
+	Region      string
+	Amis        []AMI
+	ServerSizes []string
+	UserScripts []string
+	// SyncInterval is how often the provisioner turns deployment records
+	// into fake instances.
+	SyncInterval time.Duration
+	// TransitionDelay is how long fake instances and images take to change
+	// state.
+	TransitionDelay time.Duration
+	// Prices are used to estimate costs, a table with typical AWS prices for
+	// the server sizes is used if nil.
+	Prices *pricing.Table
+}
+
+// DefaultOptions returns the catalog used when no seeds are given.
+func DefaultOptions() Options {
+	return Options{
+		Region: "local-1",
+		Amis: []AMI{
+			{ID: "ami-0a000000000000001", Name: "amazon-linux-2023"},
+			{ID: "ami-0a000000000000002", Name: "ubuntu-24.04"},
+		},
+		ServerSizes:     []string{"t3.micro", "t3.medium", "t3.large", "m5.xlarge"},
+		UserScripts:     []string{"docker", "nginx"},
+		SyncInterval:    2 * time.Second,
+		TransitionDelay: 5 * time.Second,
+	}
+}
+
+type instanceTypeSpec struct {
+	vcpus     int32
+	memoryMiB int64
+	// onDemand is the hourly price in USD, spot instances cost a third of it.
+	onDemand float64
+}
+
+// instanceTypeSpecs holds the vCPU count, memory and price of common instance
+// types for the fake provider and the local price table. Unknown sizes get
+// defaultInstanceSpec.
+var instanceTypeSpecs = map[string]instanceTypeSpec{
+	"t3.nano":    {2, 512, 0.0052},
+	"t3.micro":   {2, 1024, 0.0104},
+	"t3.small":   {2, 2048, 0.0208},
+	"t3.medium":  {2, 4096, 0.0416},
+	"t3.large":   {2, 8192, 0.0832},
+	"t3.xlarge":  {4, 16384, 0.1664},
+	"t3.2xlarge": {8, 32768, 0.3328},
+	"m5.large":   {2, 8192, 0.096},
+	"m5.xlarge":  {4, 16384, 0.192},
+	"m5.2xlarge": {8, 32768, 0.384},
+	"m5.4xlarge": {16, 65536, 0.768},
+}
+
+var defaultInstanceSpec = instanceTypeSpec{vcpus: 2, memoryMiB: 4096, onDemand: 0.05}
+
+// localEBSPerGBMonth is the gp3 storage price used by the local price table.
+const localEBSPerGBMonth = 0.08
+
+// Environment is a Server wired to an in-memory store and a fake compute
+// provider.
+type Environment struct {
+	Store    *db.MemoryStore
+	Provider *instance.FakeProvider
+	// Metrics reports no data until utilization is set for an instance.
+	Metrics *idle.FakeMetrics
+	// DNS holds the hostnames registered by the provisioner.
+	DNS    *provisioner.FakeDNS
+	Server *server.Server
+
+	opts Options
+}
+
+// OptionsFromConfig returns DefaultOptions overridden by the seeds in cfg.
+func OptionsFromConfig(cfg config.LocalConfig) (Options, error) {
+	opts := DefaultOptions()
+
+	if len(cfg.Amis) > 0 {
+		opts.Amis = nil
+		for _, value := range cfg.Amis {
+			ami, err := ParseAMI(value)
+			if err != nil {
+				return Options{}, err
+			}
+			opts.Amis = append(opts.Amis, ami)
+		}
+	}
+	if len(cfg.ServerSizes) > 0 {
+		opts.ServerSizes = cfg.ServerSizes
+	}
+	if len(cfg.UserScripts) > 0 {
+		opts.UserScripts = cfg.UserScripts
+	}
+
+	return opts, nil
+}
+
+// New seeds the stand-ins from opts and builds a Server on top of them. The
+// region and catalog of cfg are replaced by the seeded ones.
+func New(cfg *config.Config, opts Options) *Environment {
+	provider := instance.NewFakeProvider()
+	provider.TransitionDelay = opts.TransitionDelay
+
+	for _, ami := range opts.Amis {
+		provider.AddImage(ami.ID, ami.Name, nil)
+	}
+	prices := opts.Prices
+	if prices == nil {
+		prices = &pricing.Table{
+			Currency: "USD",
+			Regions: map[string]pricing.RegionPrices{opts.Region: {
+				EBSPerGBMonth: localEBSPerGBMonth,
+				Instances:     make(map[string]pricing.InstancePrices),
+			}},
+		}
+	}
+	for _, size := range opts.ServerSizes {
+		spec, ok := instanceTypeSpecs[size]
+		if !ok {
+			spec = defaultInstanceSpec
+		}
+		provider.AddInstanceType(size, spec.vcpus, spec.memoryMiB)
+		if opts.Prices == nil {
+			prices.Regions[opts.Region].Instances[size] = pricing.InstancePrices{
+				OnDemand: spec.onDemand,
+				Spot:     pricing.Round(spec.onDemand / 3),
+			}
+		}
+	}
+
+	amiIDs := make([]string, 0, len(opts.Amis))
+	for _, ami := range opts.Amis {
+		amiIDs = append(amiIDs, ami.ID)
+	}
+
+	localCfg := *cfg
+	localCfg.Region = opts.Region
+	localCfg.Catalog = config.CatalogConfig{
+		Amis:        amiIDs,
+		ServerSizes: opts.ServerSizes,
+		UserScripts: opts.UserScripts,
+	}
+
+	metrics := idle.NewFakeMetrics()
+	dns := provisioner.NewFakeDNS()
+	store := db.NewMemoryStore()
+	stores := db.Stores{
+		Deployments: store,
+		APIKeys:     db.NewMemoryAPIKeyStore(),
+		Audit:       db.NewMemoryAuditStore(),
+	}
+	return &Environment{
+		Store:    store,
+		Provider: provider,
+		Metrics:  metrics,
+		DNS:      dns,
+		Server: server.New(&localCfg, stores, instance.NewService(provider), prices, metrics, provisioner.Backends{
+			DNS:     dns,
+			Scripts: localScripts(opts.UserScripts),
+		}),
+		opts: opts,
+	}
+}
+
+// ParseAMI parses an "ami-id=name" seed. The name defaults to the ID.
+func ParseAMI(value string) (AMI, error) {
+	id, name, _ := strings.Cut(value, "=")
+	id = strings.TrimSpace(id)
+	if !strings.HasPrefix(id, "ami-") {
+		return AMI{}, fmt.Errorf("invalid AMI %q: expected ami-<id>[=name]", value)
+	}
+	if name == "" {
+		name = id
+	}
+	return AMI{ID: id, Name: name}, nil
+}
+
+// Run keeps the fake instances in line with the deployment records until ctx
+// is cancelled, the same way the reconcile job does against AWS.
+func (e *Environment) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.opts.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := e.Sync(ctx); err != nil {
+			log.Printf("local provisioner: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync launches instances for new records, updates or replaces instances
+// whose record changed and terminates instances whose deployment was
+// deleted, through the same provisioner as the reconcile job.
+func (e *Environment) Sync(ctx context.Context) error {
+	report, err := e.Server.Reconcile(ctx, false)
+	for _, change := range report.Changes {
+		log.Printf("local provisioner: deployment %s: %v %s", change.DeploymentID, change.Actions, change.Status)
+	}
+	return err
+}
+
+// localScripts returns stand-ins for the base script and the user scripts.
+func localScripts(userScripts []string) provisioner.StaticScripts {
+	scripts := provisioner.StaticScripts{
+		"user-data-base/base.sh": "#!/bin/bash\nhostnamectl set-hostname ${hostname}\n",
+	}
+	for _, name := range userScripts {
+		scripts["user-data-scripts/"+name+".sh"] = fmt.Sprintf("#!/bin/bash\necho 'running the %s user script'\n", name)
+	}
+	return scripts
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type DynamoDBData struct {
 	ID                string   `dynamodbav:"id"`
 	Ami               string   `dynamodbav:"ami"`
@@ -11,7 +13,105 @@ type DynamoDBData struct {
 	SnapShot          string   `dynamodbav:"snapShot"`
 	ContentDeployment string   `dynamodbav:"contentDeployment"`
 	UserData          []string `dynamodbav:"userData"`
+	Collaborators     []string `dynamodbav:"collaborators,omitempty"`
 	TimeToExpire      int64    `dynamodbav:"timeToExpire"`
+	// CreatedAt is when the record was created, in Unix seconds. It is zero
+	// for records created before it was recorded.
+	CreatedAt int64 `dynamodbav:"createdAt,omitempty"`
+	// ExtendedBy and ExtendedAt record the last change of TimeToExpire
+	// through the extend routes.
+	ExtendedBy string `dynamodbav:"extendedBy,omitempty"`
+	ExtendedAt int64  `dynamodbav:"extendedAt,omitempty"`
+	// WarningsSent lists the expiry warnings sent, see notify.
+	WarningsSent []string `dynamodbav:"warningsSent,stringset,omitempty"`
+	// Schedule powers the instance on and off, unless suspended until
+	// ScheduleSuspendedUntil (Unix time in seconds).
+	Schedule               *Schedule `dynamodbav:"schedule,omitempty"`
+	ScheduleSuspendedUntil int64     `dynamodbav:"scheduleSuspendedUntil,omitempty"`
+	// IdlePolicy stops the instance once it has been idle.
+	IdlePolicy *IdlePolicy `dynamodbav:"idlePolicy,omitempty"`
+	// StopReason says why the instance was last stopped automatically, such
+	// as "idle 2h", and StoppedAt when (Unix time in seconds). Both are
+	// cleared when the instance is started again.
+	StopReason string `dynamodbav:"stopReason,omitempty"`
+	StoppedAt  int64  `dynamodbav:"stoppedAt,omitempty"`
+	// Status is where the deployment is in its lifecycle, changed at
+	// StatusChangedAt (Unix time in seconds). It is empty for records
+	// created before it was recorded.
+	Status          DeploymentStatus `dynamodbav:"status,omitempty"`
+	StatusChangedAt int64            `dynamodbav:"statusChangedAt,omitempty"`
+	// LastError is the last provisioning failure, at LastErrorAt. It is kept
+	// after the deployment recovers.
+	LastError   string `dynamodbav:"lastError,omitempty"`
+	LastErrorAt int64  `dynamodbav:"lastErrorAt,omitempty"`
+}
+
+// Removed reports whether the deployment was deleted, so its instance is
+// being or has been torn down.
+func (d DynamoDBData) Removed() bool {
+	return d.Status == StatusDeleting || d.Status == StatusDeleted
+}
+
+// DeploymentStatus is where a deployment is in its lifecycle. The API moves
+// it to requested when the deployment is created or edited and to deleting
+// when it is deleted, the provisioner on from there.
+type DeploymentStatus string
+
+const (
+	// StatusRequested is waiting for the provisioner to pick up a change.
+	StatusRequested DeploymentStatus = "requested"
+	// StatusProvisioning is being applied by the provisioner.
+	StatusProvisioning DeploymentStatus = "provisioning"
+	// StatusRunning has its instance provisioned. Whether the instance is
+	// stopped or running is the status of the instance.
+	StatusRunning DeploymentStatus = "running"
+	// StatusFailed could not be provisioned, see LastError.
+	StatusFailed DeploymentStatus = "failed"
+	// StatusDeleting is having its instance terminated.
+	StatusDeleting DeploymentStatus = "deleting"
+	// StatusDeleted has no instance anymore. The record is removed by the
+	// provisioner a day later.
+	StatusDeleted DeploymentStatus = "deleted"
+)
+
+// DeploymentStatuses lists every DeploymentStatus in lifecycle order.
+var DeploymentStatuses = []DeploymentStatus{
+	StatusRequested, StatusProvisioning, StatusRunning, StatusFailed, StatusDeleting, StatusDeleted,
+}
+
+// IdlePolicy stops the instance of a deployment once it has been idle for
+// Lookback, that is its CPU utilization and network traffic stayed below the
+// thresholds in every five minute interval. A zero threshold is not checked,
+// but at least one must be set.
+type IdlePolicy struct {
+	CPUPercent            float64 `dynamodbav:"cpuPercent" json:"cpuPercent"`
+	NetworkBytesPerSecond float64 `dynamodbav:"networkBytesPerSecond" json:"networkBytesPerSecond"` // Received and sent
+	Lookback              string  `dynamodbav:"lookback" json:"lookback"`                           // Go duration such as 2h
+}
+
+// Schedule keeps the instance of a deployment running during office hours
+// and stopped outside them. Times and dates are local to Timezone.
+type Schedule struct {
+	// Timezone is an IANA time zone such as Europe/London.
+	Timezone string           `dynamodbav:"timezone" json:"timezone"`
+	Windows  []ScheduleWindow `dynamodbav:"windows" json:"windows"`
+	// Holidays are dates such as 2026-12-25 on which no window starts.
+	Holidays []string `dynamodbav:"holidays,omitempty" json:"holidays"`
+}
+
+// ScheduleWindow is a period the instance runs on each of Days. A window
+// whose Stop is not after its Start runs past midnight into the next day.
+type ScheduleWindow struct {
+	Days  []string `dynamodbav:"days" json:"days"`   // mon, tue, wed, thu, fri, sat or sun
+	Start string   `dynamodbav:"start" json:"start"` // 24-hour time such as 08:00
+	Stop  string   `dynamodbav:"stop" json:"stop"`
+}
+
+// ScheduleOverride is the body of PUT /v1/deployments/{id}/schedule/override.
+// The schedule leaves the instance alone until Until, so it can be started
+// late or stopped early by hand.
+type ScheduleOverride struct {
+	Until time.Time `json:"until"`
 }
 
 type Response struct {
@@ -31,6 +131,7 @@ type Payload struct {
 	TTLUnit           string   `json:"ttlUnit"`
 	TimeToExpire      string   `json:"timeToExpire"`
 	UserData          []string `json:"userData"`
+	Collaborators     []string `json:"collaborators"`
 	TTLValue          int64    `json:"ttlValue"`
 }
 
@@ -64,4 +165,403 @@ type DeploymentResponse struct {
 	Status           string   `json:"status"`
 	TimeToExpire     string   `json:"timeToExpire"`
 	UserData         []string `json:"userData"`
+	AllowedActions   []Action `json:"allowedActions"` // Actions the caller may take on the deployment
+	// LaunchTime is when the instance was last started.
+	LaunchTime *time.Time `json:"launchTime,omitempty"`
+	Cost       *Cost      `json:"cost,omitempty"`
+	// StopReason says why the stopped instance was stopped automatically,
+	// e.g. idle 2h.
+	StopReason string `json:"stopReason,omitempty"`
+	// DeploymentStatus is the lifecycle status of the deployment. Entries of
+	// deployments without an instance yet only carry the fields of the
+	// request, and their Status is the DeploymentStatus.
+	DeploymentStatus DeploymentStatus `json:"deploymentStatus,omitempty"`
+	LastError        string           `json:"lastError,omitempty"`
+}
+
+// DeploymentRequest is the body of the /v1 create and edit deployment
+// requests. CreationUser is ignored when authentication is enabled, the
+// deployment is then recorded under the authenticated caller.
+type DeploymentRequest struct {
+	Hostname      string   `json:"hostname"`
+	Ami           string   `json:"ami"`
+	ServerSize    string   `json:"serverSize"`
+	Lifecycle     string   `json:"lifecycle"`
+	CreationUser  string   `json:"creationUser,omitempty"`
+	UserData      []string `json:"userData,omitempty"`
+	Collaborators []string `json:"collaborators"`
+	TTLValue      int64    `json:"ttlValue,omitempty"`
+	TTLUnit       string   `json:"ttlUnit,omitempty"`
+}
+
+// ExtendRequest moves the expiry of a deployment. Exactly one of Duration and
+// ExpiresAt must be set.
+type ExtendRequest struct {
+	// Duration is added to the current expiry, or to now if the deployment
+	// does not expire. It is a Go duration such as 4h or 90m, negative
+	// durations shorten the deployment.
+	Duration  string     `json:"duration,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Expiry is the expiry of a deployment after it was extended.
+type Expiry struct {
+	DeploymentID string    `json:"deploymentId"`
+	TimeToExpire int64     `json:"timeToExpire"` // Unix time in seconds
+	ExpiresAt    time.Time `json:"expiresAt"`
+	ExtendedBy   string    `json:"extendedBy,omitempty"`
+	ExtendedAt   time.Time `json:"extendedAt"`
+}
+
+// Deployment is a deployment request together with the instance provisioned
+// for it. Instance is null until the provisioner has launched it.
+type Deployment struct {
+	ID                     string              `json:"id"`
+	Hostname               string              `json:"hostname"`
+	Ami                    string              `json:"ami"`
+	ServerSize             string              `json:"serverSize"`
+	Lifecycle              string              `json:"lifecycle"`
+	CreationUser           string              `json:"creationUser"`
+	UserData               []string            `json:"userData"`
+	Collaborators          []string            `json:"collaborators"`
+	SnapshotID             string              `json:"snapshotId,omitempty"`
+	TimeToExpire           int64               `json:"timeToExpire,omitempty"` // Unix time in seconds
+	ExtendedBy             string              `json:"extendedBy,omitempty"`
+	ExtendedAt             int64               `json:"extendedAt,omitempty"`             // Unix time in seconds
+	Schedule               *Schedule           `json:"schedule"`                         // Null if the deployment runs around the clock
+	ScheduleSuspendedUntil int64               `json:"scheduleSuspendedUntil,omitempty"` // Unix time in seconds, set while the schedule is overridden
+	IdlePolicy             *IdlePolicy         `json:"idlePolicy"`                       // Null if the instance is never stopped for being idle
+	StopReason             string              `json:"stopReason,omitempty"`             // Why the stopped instance was stopped automatically, e.g. idle 2h
+	StoppedAt              int64               `json:"stoppedAt,omitempty"`              // Unix time in seconds
+	Status                 DeploymentStatus    `json:"status"`
+	StatusChangedAt        int64               `json:"statusChangedAt,omitempty"` // Unix time in seconds
+	LastError              string              `json:"lastError,omitempty"`       // The last provisioning failure
+	LastErrorAt            int64               `json:"lastErrorAt,omitempty"`     // Unix time in seconds
+	Instance               *DeploymentInstance `json:"instance"`
+	AllowedActions         []Action            `json:"allowedActions"`
+	Cost                   *Cost               `json:"cost"` // Null if no price is configured for the deployment
+}
+
+// Action is something a caller can do to a deployment. Which actions a
+// caller may take depends on their role for the deployment.
+type Action string
+
+const (
+	ActionEdit     Action = "edit"
+	ActionDelete   Action = "delete"
+	ActionStart    Action = "start"
+	ActionStop     Action = "stop"
+	ActionSnapshot Action = "snapshot"
+)
+
+// Actions lists every Action.
+var Actions = []Action{ActionEdit, ActionDelete, ActionStart, ActionStop, ActionSnapshot}
+
+// Permission is something an API key may be used for: creating deployments
+// or taking the Action of the same name.
+type Permission string
+
+// PermissionCreate allows creating deployments.
+const PermissionCreate Permission = "create"
+
+// Permissions lists every Permission.
+var Permissions = []Permission{
+	PermissionCreate,
+	Permission(ActionEdit),
+	Permission(ActionDelete),
+	Permission(ActionStart),
+	Permission(ActionStop),
+	Permission(ActionSnapshot),
+}
+
+// APIKeyRecord is an API key as stored in DynamoDB. Only the SHA-256 hash of
+// the secret part of the key is kept. Times are Unix time in seconds.
+type APIKeyRecord struct {
+	ID          string       `dynamodbav:"id"`
+	Name        string       `dynamodbav:"name"`
+	User        string       `dynamodbav:"user"`
+	Permissions []Permission `dynamodbav:"permissions"`
+	SecretHash  string       `dynamodbav:"secretHash"`
+	CreatedBy   string       `dynamodbav:"createdBy"`
+	CreatedAt   int64        `dynamodbav:"createdAt"`
+	ExpiresAt   int64        `dynamodbav:"expiresAt,omitempty"`
+	RevokedAt   int64        `dynamodbav:"revokedAt,omitempty"`
+}
+
+// APIKeyRequest is the body of POST /v1/apikeys. User defaults to the
+// caller, only admins may create keys for other users.
+type APIKeyRequest struct {
+	Name        string       `json:"name"`
+	User        string       `json:"user,omitempty"`
+	Permissions []Permission `json:"permissions"`
+	ExpiresAt   int64        `json:"expiresAt,omitempty"` // Unix time in seconds, the key never expires if 0
+}
+
+// APIKey is an API key without its secret.
+type APIKey struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	User        string       `json:"user"`
+	Permissions []Permission `json:"permissions"`
+	CreatedBy   string       `json:"createdBy"`
+	CreatedAt   int64        `json:"createdAt"`           // Unix time in seconds
+	ExpiresAt   int64        `json:"expiresAt,omitempty"` // Unix time in seconds
+	RevokedAt   int64        `json:"revokedAt,omitempty"` // Unix time in seconds
+}
+
+// CreatedAPIKey is the response of POST /v1/apikeys. Key is sent as bearer
+// token, it is only ever returned here.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// APIKeyList is the response of GET /v1/apikeys.
+type APIKeyList struct {
+	APIKeys []APIKey `json:"apiKeys"`
+}
+
+// Cost is the estimated cost of a deployment. Stopped instances only cost
+// their storage.
+type Cost struct {
+	Currency   string  `json:"currency"`
+	HourlyCost float64 `json:"hourlyCost"`
+	// AccruedCost is what the instance cost since it was last started, at
+	// its current hourly cost.
+	AccruedCost float64 `json:"accruedCost"`
+}
+
+// CostEstimate is the response of POST /v1/costs/estimate.
+// LifetimeCost is only set for requests with a TTL.
+type CostEstimate struct {
+	Currency      string  `json:"currency"`
+	Region        string  `json:"region"`
+	ServerSize    string  `json:"serverSize"`
+	Lifecycle     string  `json:"lifecycle"`
+	StorageGB     int     `json:"storageGb"`
+	HourlyCost    float64 `json:"hourlyCost"`
+	MonthlyCost   float64 `json:"monthlyCost"`
+	LifetimeHours float64 `json:"lifetimeHours,omitempty"`
+	LifetimeCost  float64 `json:"lifetimeCost,omitempty"`
+}
+
+// UserCost sums the costs of the deployments of a user. Unpriced counts the
+// deployments left out because the price table has no price for them.
+type UserCost struct {
+	User        string  `json:"user"`
+	Deployments int     `json:"deployments"`
+	Unpriced    int     `json:"unpriced"`
+	HourlyCost  float64 `json:"hourlyCost"`
+	AccruedCost float64 `json:"accruedCost"`
+}
+
+// CostSummary is the response of GET /v1/costs.
+type CostSummary struct {
+	Currency    string     `json:"currency"`
+	Users       []UserCost `json:"users"`
+	HourlyCost  float64    `json:"hourlyCost"`
+	AccruedCost float64    `json:"accruedCost"`
+}
+
+// DeploymentInstance is the EC2 instance currently backing a deployment.
+type DeploymentInstance struct {
+	ID               string `json:"id"`
+	Status           string `json:"status"`
+	Ami              string `json:"ami"`
+	ServerSize       string `json:"serverSize"`
+	AvailabilityZone string `json:"availabilityZone"`
+}
+
+// DeploymentList is the response of GET /v1/deployments.
+type DeploymentList struct {
+	Deployments []Deployment `json:"deployments"`
+}
+
+// Snapshot is an image captured from a deployment's instance.
+type Snapshot struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	State     string `json:"state"`
+	CreatedAt string `json:"createdAt,omitempty"`
+}
+
+// SnapshotList is the response of GET /v1/deployments/{id}/snapshots. Limit
+// is the number of snapshots an instance may have.
+type SnapshotList struct {
+	Snapshots []Snapshot `json:"snapshots"`
+	Limit     int        `json:"limit"`
+}
+
+// AMILimitResponse reports whether an instance already has the maximum number
+// of images and, if so, which image would be replaced by a new capture.
+type AMILimitResponse struct {
+	OldestImageID   string `json:"oldest_image_id,omitempty"`
+	OldestImageName string `json:"oldest_image_name,omitempty"`
+	OldestImageDate string `json:"oldest_image_date,omitempty"`
+	AMILimitHit     bool   `json:"ami_limit_hit"`
+}
+
+// AuditEvent records a call to a route that changes something. Events are
+// written once and never changed.
+type AuditEvent struct {
+	ID        string    `dynamodbav:"id" json:"id"`
+	Time      time.Time `dynamodbav:"time" json:"time"`
+	RequestID string    `dynamodbav:"requestId" json:"requestId"`
+	// CorrelationID is the X-Request-ID or X-Correlation-ID the caller sent.
+	CorrelationID string `dynamodbav:"correlationId,omitempty" json:"correlationId,omitempty"`
+	// Actor is the authenticated caller, empty when authentication is
+	// disabled. APIKeyID is set when they used an API key.
+	Actor    string `dynamodbav:"actor" json:"actor"`
+	APIKeyID string `dynamodbav:"apiKeyId,omitempty" json:"apiKeyId,omitempty"`
+	SourceIP string `dynamodbav:"sourceIp" json:"sourceIp"`
+	// Action is the operation ID of the route, e.g. deleteDeployment.
+	Action       string `dynamodbav:"action" json:"action"`
+	Method       string `dynamodbav:"method" json:"method"`
+	Path         string `dynamodbav:"path" json:"path"`
+	DeploymentID string `dynamodbav:"deploymentId,omitempty" json:"deploymentId,omitempty"`
+	InstanceID   string `dynamodbav:"instanceId,omitempty" json:"instanceId,omitempty"`
+	ImageID      string `dynamodbav:"imageId,omitempty" json:"imageId,omitempty"`
+	// Changes lists the fields of the deployment request that the call
+	// changed.
+	Changes   []AuditChange `dynamodbav:"changes,omitempty" json:"changes,omitempty"`
+	Status    int           `dynamodbav:"status" json:"status"`
+	Result    AuditResult   `dynamodbav:"result" json:"result"`
+	ErrorCode ErrorCode     `dynamodbav:"errorCode,omitempty" json:"errorCode,omitempty"`
+}
+
+// AuditChange is a field of a deployment request changed by a call. Before is
+// empty for created deployments and After for deleted ones.
+type AuditChange struct {
+	Field  string `dynamodbav:"field" json:"field"`
+	Before string `dynamodbav:"before" json:"before"`
+	After  string `dynamodbav:"after" json:"after"`
+}
+
+// AuditResult is the outcome of an audited call.
+type AuditResult string
+
+const (
+	AuditSuccess AuditResult = "success"
+	// AuditDenied calls were refused by authorization.
+	AuditDenied  AuditResult = "denied"
+	AuditFailure AuditResult = "failure"
+)
+
+// AuditEventList is the response of GET /v1/audit.
+type AuditEventList struct {
+	Events []AuditEvent `json:"events"`
+}
+
+// DriftKind classifies a disagreement between the deployment records and
+// the EC2 instances.
+type DriftKind string
+
+const (
+	// DriftMissingInstance is a deployment that should have an instance but
+	// has none.
+	DriftMissingInstance DriftKind = "missing_instance"
+	// DriftOrphanedInstance is an instance whose deployment has no record,
+	// or whose record is deleted.
+	DriftOrphanedInstance DriftKind = "orphaned_instance"
+	// DriftDuplicateInstance is an instance of a deployment that already has
+	// an older one.
+	DriftDuplicateInstance DriftKind = "duplicate_instance"
+	// DriftServerSize, DriftAmi and DriftLifecycle are instances whose
+	// server size, AMI or lifecycle differs from their record.
+	DriftServerSize DriftKind = "server_size_mismatch"
+	DriftAmi        DriftKind = "ami_mismatch"
+	DriftLifecycle  DriftKind = "lifecycle_mismatch"
+)
+
+// DriftKinds lists every DriftKind.
+var DriftKinds = []DriftKind{
+	DriftMissingInstance, DriftOrphanedInstance, DriftDuplicateInstance, DriftServerSize, DriftAmi, DriftLifecycle,
+}
+
+// Drift is a single disagreement. Expected is the value of the record and
+// Actual that of the instance, for the mismatch kinds only.
+type Drift struct {
+	Kind         DriftKind        `json:"kind"`
+	DeploymentID string           `json:"deploymentId"`
+	InstanceID   string           `json:"instanceId,omitempty"`
+	Hostname     string           `json:"hostname,omitempty"`
+	Status       DeploymentStatus `json:"status,omitempty"`
+	Expected     string           `json:"expected,omitempty"`
+	Actual       string           `json:"actual,omitempty"`
+}
+
+// DriftReport is the response of GET /v1/admin/drift. Deployments and
+// Instances count what was compared.
+type DriftReport struct {
+	CheckedAt   time.Time `json:"checkedAt"`
+	Deployments int       `json:"deployments"`
+	Instances   int       `json:"instances"`
+	Drifts      []Drift   `json:"drifts"`
+}
+
+// QuotaLimits are the limits of a quota. Zero limits and an empty
+// ServerSizes are unlimited.
+type QuotaLimits struct {
+	MaxDeployments int      `json:"maxDeployments"`
+	MaxVCPUs       int      `json:"maxVcpus"`
+	MaxOnDemand    int      `json:"maxOnDemand"`
+	ServerSizes    []string `json:"serverSizes"`
+}
+
+// QuotaUsage is what counts against a quota.
+type QuotaUsage struct {
+	Deployments int `json:"deployments"`
+	VCPUs       int `json:"vcpus"`
+	OnDemand    int `json:"onDemand"` // Deployments that are not spot instances
+}
+
+// TeamQuota is the usage of a team the user is a member of, which counts the
+// deployments of every member.
+type TeamQuota struct {
+	Name    string      `json:"name"`
+	Members []string    `json:"members"`
+	Limits  QuotaLimits `json:"limits"`
+	Usage   QuotaUsage  `json:"usage"`
+}
+
+// Quota is the response of GET /v1/quota.
+type Quota struct {
+	User   string      `json:"user"`
+	Limits QuotaLimits `json:"limits"`
+	Usage  QuotaUsage  `json:"usage"`
+	Teams  []TeamQuota `json:"teams"`
+}
+
+// FieldError describes why a single request field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ErrorCode is a stable, machine readable identifier for an API error.
+type ErrorCode string
+
+const (
+	ErrCodeInvalidRequest   ErrorCode = "invalid_request"
+	ErrCodeValidationFailed ErrorCode = "validation_failed"
+	ErrCodeUnauthorized     ErrorCode = "unauthorized"
+	ErrCodeForbidden        ErrorCode = "forbidden"
+	ErrCodeNotFound         ErrorCode = "not_found"
+	ErrCodeHostnameExists   ErrorCode = "hostname_exists"
+	ErrCodeConflict         ErrorCode = "conflict"
+	ErrCodeQuotaExceeded    ErrorCode = "quota_exceeded"
+	ErrCodeThrottled        ErrorCode = "throttled"
+	ErrCodeAWSUnauthorized  ErrorCode = "aws_unauthorized"
+	ErrCodeAWSError         ErrorCode = "aws_error"
+	ErrCodeInternal         ErrorCode = "internal_error"
+)
+
+// ErrorResponse is the body of every non-2xx response.
+type ErrorResponse struct {
+	Code      ErrorCode `json:"code"`
+	Message   string    `json:"message"`
+	RequestID string    `json:"requestId"`
+	// CorrelationID is the X-Request-ID or X-Correlation-ID the caller sent.
+	CorrelationID string       `json:"correlationId,omitempty"`
+	Details       []FieldError `json:"details,omitempty"`
 }
@@ -0,0 +1,138 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/config"
+)
+
+// ErrNoRecipient is returned by channels that cannot address the user of a
+// warning, e.g. mail for a user that is not an e-mail address.
+var ErrNoRecipient = errors.New("no recipient for the user")
+
+// Channel delivers warnings.
+type Channel interface {
+	// Name identifies the channel in reports.
+	Name() string
+	Send(ctx context.Context, warning Warning) error
+}
+
+// ChannelsFromConfig returns the channels configured in cfg.
+func ChannelsFromConfig(cfg config.NotifyConfig) []Channel {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	var channels []Channel
+	if cfg.Webhook.URL != "" {
+		channels = append(channels, &Webhook{URL: cfg.Webhook.URL, Client: client})
+	}
+	if cfg.Slack.WebhookURL != "" {
+		channels = append(channels, &Slack{WebhookURL: cfg.Slack.WebhookURL, Client: client})
+	}
+	if cfg.SMTP.Host != "" {
+		channels = append(channels, &Mail{
+			Addr:     net.JoinHostPort(cfg.SMTP.Host, strconv.Itoa(cfg.SMTP.Port)),
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			From:     cfg.SMTP.From,
+		})
+	}
+	return channels
+}
+
+// Webhook posts warnings as JSON.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+func (w *Webhook) Name() string { return "webhook" }
+
+func (w *Webhook) Send(ctx context.Context, warning Warning) error {
+	return postJSON(ctx, w.Client, w.URL, warning)
+}
+
+// Slack posts warnings as messages to a Slack compatible incoming webhook.
+type Slack struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+func (s *Slack) Name() string { return "slack" }
+
+func (s *Slack) Send(ctx context.Context, warning Warning) error {
+	text := ":warning: " + warning.Message()
+	if warning.ExtendURL != "" {
+		text += fmt.Sprintf(" <%s|Extend by %s>", warning.ExtendURL, warning.ExtendBy)
+	}
+	return postJSON(ctx, s.Client, s.WebhookURL, map[string]string{"text": text})
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, body any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// Mail mails warnings to their user, who must be an e-mail address.
+type Mail struct {
+	// Addr is the host:port of the SMTP server.
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *Mail) Name() string { return "smtp" }
+
+func (m *Mail) Send(_ context.Context, warning Warning) error {
+	if !strings.Contains(warning.User, "@") {
+		return fmt.Errorf("%w %q", ErrNoRecipient, warning.User)
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", m.From)
+	fmt.Fprintf(&body, "To: %s\r\n", warning.User)
+	fmt.Fprintf(&body, "Subject: %s expires in %s\r\n", warning.Hostname, warning.LeadTime)
+	body.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	body.WriteString(warning.Message() + "\r\n")
+	if warning.ExtendURL != "" {
+		fmt.Fprintf(&body, "\r\nExtend it by %s: %s\r\n", warning.ExtendBy, warning.ExtendURL)
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, _ := net.SplitHostPort(m.Addr)
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	return smtp.SendMail(m.Addr, auth, m.From, []string{warning.User}, []byte(body.String()))
+}
@@ -0,0 +1,47 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/timeutil"
+)
+
+// Links signs and verifies one-click extend links. A link extends its
+// deployment by ExtendBy and only while the deployment still expires at the
+// time it was signed for, so it can be used once.
+type Links struct {
+	// BaseURL is the URL of the API, including the API Gateway stage.
+	BaseURL  string
+	Secret   []byte
+	ExtendBy time.Duration
+}
+
+// URL returns the extend link of deployment id, which expires at expiry
+// (Unix seconds).
+func (l *Links) URL(id string, expiry int64) string {
+	by := timeutil.FormatDuration(l.ExtendBy)
+	query := url.Values{
+		"by":     {by},
+		"expiry": {strconv.FormatInt(expiry, 10)},
+		"sig":    {l.sign(id, by, expiry)},
+	}
+	return strings.TrimSuffix(l.BaseURL, "/") + "/v1/deployments/" + url.PathEscape(id) + "/extend-link?" + query.Encode()
+}
+
+// Verify reports whether sig is the signature of a link extending deployment
+// id by by from expiry.
+func (l *Links) Verify(id, by string, expiry int64, sig string) bool {
+	return hmac.Equal([]byte(sig), []byte(l.sign(id, by, expiry)))
+}
+
+func (l *Links) sign(id, by string, expiry int64) string {
+	mac := hmac.New(sha256.New, l.Secret)
+	mac.Write([]byte(id + "\n" + by + "\n" + strconv.FormatInt(expiry, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,184 @@
+// Package notify warns users before their deployments expire.
+//
+// Every run looks at the deployments that expire within the longest lead
+// time and sends one warning for the shortest lead time that has been
+// reached, through every channel. Sent warnings are recorded on the
+// deployment for the expiry they were sent for, so each lead time is warned
+// about once, and again after the deployment was extended.
+package notify
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/frgrisk/turbo-deploy/server/timeutil"
+)
+
+// Warning tells a user that their deployment is about to expire.
+type Warning struct {
+	DeploymentID string    `json:"deploymentId"`
+	Hostname     string    `json:"hostname"`
+	User         string    `json:"user"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+	// LeadTime is the lead time reached, e.g. 24h.
+	LeadTime string `json:"leadTime"`
+	// ExtendURL opens a page that extends the deployment by ExtendBy once
+	// confirmed. Both are empty if links are not configured.
+	ExtendURL string `json:"extendUrl,omitempty"`
+	ExtendBy  string `json:"extendBy,omitempty"`
+}
+
+// Message describes the warning in a sentence.
+func (w Warning) Message() string {
+	return fmt.Sprintf("Deployment %s (%s) of %s expires in less than %s, at %s, and will be destroyed.",
+		w.Hostname, w.DeploymentID, cmp.Or(w.User, "an unknown user"), w.LeadTime, w.ExpiresAt.Format(time.RFC1123))
+}
+
+// Options control a run of the notifier.
+type Options struct {
+	LeadTimes []time.Duration
+	// DryRun reports the warnings that are due without sending them.
+	DryRun bool
+	// Links adds extend links to warnings if not nil.
+	Links *Links
+	// Now returns the current time, time.Now if nil.
+	Now func() time.Time
+}
+
+// Notifier sends the warnings that are due.
+type Notifier struct {
+	store    db.DeploymentStore
+	channels []Channel
+	opts     Options
+}
+
+// New returns a Notifier warning about the deployments in store through
+// channels.
+func New(store db.DeploymentStore, channels []Channel, opts Options) *Notifier {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Notifier{store: store, channels: channels, opts: opts}
+}
+
+// Report lists the warnings a run sent, or would have sent in a dry run.
+type Report struct {
+	DryRun   bool     `json:"dryRun"`
+	Channels []string `json:"channels"`
+	Sent     []Sent   `json:"sent"`
+}
+
+// Sent is a warning and where it was delivered.
+type Sent struct {
+	Warning
+	Channels []string `json:"channels"`
+	// Error is set if a channel failed.
+	Error string `json:"error,omitempty"`
+}
+
+// Run sends the warnings that are due, in deployment ID order. A warning is
+// recorded as sent when at least one channel delivered it, otherwise it is
+// tried again on the next run. The returned error joins the channel
+// failures, which are also reported in the Report.
+func (n *Notifier) Run(ctx context.Context) (Report, error) {
+	report := Report{DryRun: n.opts.DryRun, Channels: []string{}, Sent: []Sent{}}
+	for _, channel := range n.channels {
+		report.Channels = append(report.Channels, channel.Name())
+	}
+	if len(n.opts.LeadTimes) == 0 || len(n.channels) == 0 {
+		return report, nil
+	}
+
+	records, err := n.store.ListRecords(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to list deployment records: %w", err)
+	}
+	records = slices.DeleteFunc(records, models.DynamoDBData.Removed)
+	slices.SortFunc(records, func(a, b models.DynamoDBData) int { return cmp.Compare(a.ID, b.ID) })
+
+	now := n.opts.Now()
+	var errs []error
+	for _, record := range records {
+		lead, ok := n.due(record, now)
+		if !ok {
+			continue
+		}
+
+		sent := Sent{Warning: n.warning(record, lead), Channels: []string{}}
+		if !n.opts.DryRun {
+			var failed []error
+			for _, channel := range n.channels {
+				if err := channel.Send(ctx, sent.Warning); err != nil {
+					failed = append(failed, fmt.Errorf("%s: %w", channel.Name(), err))
+					continue
+				}
+				sent.Channels = append(sent.Channels, channel.Name())
+			}
+
+			if len(sent.Channels) > 0 {
+				if err := n.store.MarkWarningSent(ctx, record.ID, sentKey(lead, record.TimeToExpire)); err != nil && !errors.Is(err, db.ErrURLNotFound) {
+					failed = append(failed, fmt.Errorf("failed to record the warning: %w", err))
+				}
+			}
+			if err := errors.Join(failed...); err != nil {
+				sent.Error = err.Error()
+				errs = append(errs, fmt.Errorf("deployment %s: %w", record.ID, err))
+			}
+			log.Printf("notify: warned about deployment %s expiring in %s through %v", record.ID, sent.LeadTime, sent.Channels)
+		}
+		report.Sent = append(report.Sent, sent)
+	}
+
+	return report, errors.Join(errs...)
+}
+
+// due returns the lead time record should be warned about now, the shortest
+// one it is within, unless that warning was sent already.
+func (n *Notifier) due(record models.DynamoDBData, now time.Time) (time.Duration, bool) {
+	if record.TimeToExpire <= 0 {
+		return 0, false
+	}
+	remaining := time.Unix(record.TimeToExpire, 0).Sub(now)
+	if remaining <= 0 {
+		return 0, false
+	}
+
+	var lead time.Duration
+	for _, l := range n.opts.LeadTimes {
+		if l >= remaining && (lead == 0 || l < lead) {
+			lead = l
+		}
+	}
+	if lead == 0 || slices.Contains(record.WarningsSent, sentKey(lead, record.TimeToExpire)) {
+		return 0, false
+	}
+	return lead, true
+}
+
+func (n *Notifier) warning(record models.DynamoDBData, lead time.Duration) Warning {
+	warning := Warning{
+		DeploymentID: record.ID,
+		Hostname:     record.Hostname,
+		User:         record.CreationUser,
+		ExpiresAt:    time.Unix(record.TimeToExpire, 0).UTC(),
+		LeadTime:     timeutil.FormatDuration(lead),
+	}
+	if n.opts.Links != nil {
+		warning.ExtendURL = n.opts.Links.URL(record.ID, record.TimeToExpire)
+		warning.ExtendBy = timeutil.FormatDuration(n.opts.Links.ExtendBy)
+	}
+	return warning
+}
+
+// sentKey identifies a warning in WarningsSent, e.g. 24h@1767225600.
+func sentKey(lead time.Duration, expiry int64) string {
+	return timeutil.FormatDuration(lead) + "@" + strconv.FormatInt(expiry, 10)
+}
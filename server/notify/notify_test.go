@@ -0,0 +1,257 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+// recorder is a Channel that keeps the warnings it is sent, or fails.
+type recorder struct {
+	name string
+	err  error
+	sent []Warning
+}
+
+func (r *recorder) Name() string { return r.name }
+
+func (r *recorder) Send(_ context.Context, warning Warning) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.sent = append(r.sent, warning)
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	now := time.Now().Truncate(time.Second)
+	in := func(d time.Duration) int64 { return now.Add(d).Unix() }
+
+	records := []models.DynamoDBData{
+		{ID: "soon", Hostname: "soon", TimeToExpire: in(30 * time.Minute), WarningsSent: []string{"24h@" + strconv.FormatInt(in(30*time.Minute), 10)}},
+		{ID: "tomorrow", Hostname: "tomorrow", TimeToExpire: in(20 * time.Hour)},
+		{ID: "later", Hostname: "later", TimeToExpire: in(48 * time.Hour)},
+		{ID: "forever", Hostname: "forever"},
+		{ID: "warned", Hostname: "warned", TimeToExpire: in(20 * time.Hour), WarningsSent: []string{"24h@" + strconv.FormatInt(in(20*time.Hour), 10)}},
+		// warned for an expiry it was extended from since
+		{ID: "extended", Hostname: "extended", TimeToExpire: in(20 * time.Hour), WarningsSent: []string{"24h@" + strconv.FormatInt(in(-time.Hour), 10)}},
+		{ID: "deleting", Hostname: "deleting", TimeToExpire: in(20 * time.Hour), Status: models.StatusDeleting},
+	}
+	for _, record := range records {
+		if _, err := store.SaveRecord(ctx, record); err != nil {
+			t.Fatalf("SaveRecord(%s): %v", record.ID, err)
+		}
+	}
+
+	channel := &recorder{name: "test"}
+	notifier := New(store, []Channel{channel}, Options{
+		LeadTimes: []time.Duration{24 * time.Hour, time.Hour},
+		Now:       func() time.Time { return now },
+	})
+
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"first run", []string{"extended 24h", "soon 1h", "tomorrow 24h"}},
+		{"sent warnings are not sent again", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel.sent = nil
+			report, err := notifier.Run(ctx)
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+
+			var got []string
+			for _, warning := range channel.sent {
+				got = append(got, warning.DeploymentID+" "+warning.LeadTime)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Run sent %v, want %v", got, tt.want)
+			}
+			if len(report.Sent) != len(tt.want) {
+				t.Errorf("Run reported %d warnings, want %d", len(report.Sent), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestRunChannelFailures(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	errDown := errors.New("down")
+
+	tests := []struct {
+		name     string
+		channels []*recorder
+		recorded bool
+	}{
+		{"every channel delivers", []*recorder{{name: "a"}, {name: "b"}}, true},
+		{"one channel fails", []*recorder{{name: "a", err: errDown}, {name: "b"}}, true},
+		{"every channel fails", []*recorder{{name: "a", err: errDown}, {name: "b", err: errDown}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := db.NewMemoryStore()
+			if _, err := store.SaveRecord(ctx, models.DynamoDBData{ID: "a1", Hostname: "web", TimeToExpire: now.Add(time.Hour).Unix()}); err != nil {
+				t.Fatalf("SaveRecord: %v", err)
+			}
+
+			var channels []Channel
+			var failing bool
+			for _, channel := range tt.channels {
+				channels = append(channels, channel)
+				failing = failing || channel.err != nil
+			}
+			report, err := New(store, channels, Options{
+				LeadTimes: []time.Duration{24 * time.Hour},
+				Now:       func() time.Time { return now },
+			}).Run(ctx)
+			if (err != nil) != failing {
+				t.Errorf("Run error = %v, want one: %v", err, failing)
+			}
+			if len(report.Sent) != 1 || (report.Sent[0].Error != "") != failing {
+				t.Errorf("Run reported %+v", report.Sent)
+			}
+
+			record, err := store.GetRecord(ctx, "a1")
+			if err != nil {
+				t.Fatalf("GetRecord: %v", err)
+			}
+			if recorded := len(record.WarningsSent) > 0; recorded != tt.recorded {
+				t.Errorf("warning recorded: %v, want %v", recorded, tt.recorded)
+			}
+		})
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	now := time.Now()
+	if _, err := store.SaveRecord(ctx, models.DynamoDBData{ID: "a1", Hostname: "web", TimeToExpire: now.Add(time.Hour).Unix()}); err != nil {
+		t.Fatalf("SaveRecord: %v", err)
+	}
+
+	channel := &recorder{name: "test"}
+	report, err := New(store, []Channel{channel}, Options{
+		LeadTimes: []time.Duration{24 * time.Hour},
+		DryRun:    true,
+		Now:       func() time.Time { return now },
+	}).Run(ctx)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(report.Sent) != 1 || len(channel.sent) != 0 {
+		t.Errorf("dry run reported %d and sent %d warnings, want 1 and 0", len(report.Sent), len(channel.sent))
+	}
+}
+
+func TestLinks(t *testing.T) {
+	links := &Links{BaseURL: "https://api.example.com/prod/", Secret: []byte("secret"), ExtendBy: 4 * time.Hour}
+	link, err := url.Parse(links.URL("a1", 1_000_000))
+	if err != nil {
+		t.Fatalf("URL: %v", err)
+	}
+	if link.Path != "/prod/v1/deployments/a1/extend-link" {
+		t.Fatalf("URL path = %s", link.Path)
+	}
+	query := link.Query()
+	if query.Get("by") != "4h" || query.Get("expiry") != "1000000" {
+		t.Fatalf("URL query = %s", link.RawQuery)
+	}
+	sig := query.Get("sig")
+
+	tests := []struct {
+		name   string
+		id     string
+		by     string
+		expiry int64
+		sig    string
+		secret string
+		ok     bool
+	}{
+		{"as signed", "a1", "4h", 1_000_000, sig, "secret", true},
+		{"other deployment", "b2", "4h", 1_000_000, sig, "secret", false},
+		{"longer extension", "a1", "400h", 1_000_000, sig, "secret", false},
+		{"other expiry", "a1", "4h", 2_000_000, sig, "secret", false},
+		{"other secret", "a1", "4h", 1_000_000, sig, "guess", false},
+		{"no signature", "a1", "4h", 1_000_000, "", "secret", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := &Links{Secret: []byte(tt.secret)}
+			if got := verifier.Verify(tt.id, tt.by, tt.expiry, tt.sig); got != tt.ok {
+				t.Errorf("Verify() = %v, want %v", got, tt.ok)
+			}
+		})
+	}
+}
+
+func TestPostChannels(t *testing.T) {
+	warning := Warning{
+		DeploymentID: "a1",
+		Hostname:     "web",
+		User:         "alice@example.com",
+		ExpiresAt:    time.Unix(1_000_000, 0).UTC(),
+		LeadTime:     "1h",
+		ExtendURL:    "https://api.example.com/v1/deployments/a1/extend-link?sig=x",
+		ExtendBy:     "4h",
+	}
+
+	tests := []struct {
+		name    string
+		channel func(url string) Channel
+		status  int
+		want    string
+		ok      bool
+	}{
+		{"webhook", func(url string) Channel { return &Webhook{URL: url, Client: http.DefaultClient} }, http.StatusOK, `"extendUrl":"https://api.example.com/v1/deployments/a1/extend-link?sig=x"`, true},
+		{"slack", func(url string) Channel { return &Slack{WebhookURL: url, Client: http.DefaultClient} }, http.StatusOK, `|Extend by 4h\u003e`, true},
+		{"failing webhook", func(url string) Channel { return &Webhook{URL: url, Client: http.DefaultClient} }, http.StatusBadGateway, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var payload json.RawMessage
+				if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+					t.Errorf("request body is not JSON: %v", err)
+				}
+				body = string(payload)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			err := tt.channel(server.URL).Send(context.Background(), warning)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Send() = %v, want success: %v", err, tt.ok)
+			}
+			if !strings.Contains(body, tt.want) {
+				t.Errorf("Send() posted %s, want it to contain %s", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestMailNeedsAnAddress(t *testing.T) {
+	err := (&Mail{Addr: "localhost:0"}).Send(context.Background(), Warning{User: "alice"})
+	if !errors.Is(err, ErrNoRecipient) {
+		t.Errorf("Send() to a user without an address = %v, want ErrNoRecipient", err)
+	}
+}
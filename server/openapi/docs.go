@@ -0,0 +1,9 @@
+package openapi
+
+import _ "embed"
+
+// DocsPage is an HTML page rendering the document served at openapi.json,
+// relative to the page itself.
+//
+//go:embed docs.html
+var DocsPage []byte
@@ -0,0 +1,408 @@
+// Package openapi builds an OpenAPI 3 document from a table of routes and the
+// Go types they accept and return.
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is the OpenAPI specification version documents are written in.
+const Version = "3.0.3"
+
+// Document is an OpenAPI document. Only the parts used by turbo-deploy are
+// modelled.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Security   []SecurityReq       `json:"security,omitempty"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+// Info describes the API.
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// PathItem holds the operations of a path, keyed by lowercase HTTP method.
+type PathItem map[string]*Operation
+
+// Operation is a single API operation.
+type Operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary,omitempty"`
+	Description string              `json:"description,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Deprecated  bool                `json:"deprecated,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+	Security    []SecurityReq       `json:"security,omitempty"`
+}
+
+// Parameter is a path, query or header parameter.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody describes the body an operation accepts.
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes one possible response of an operation.
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema of a request or response body.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds the named schemas referenced by operations and the
+// security schemes of the API.
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme describes how callers authenticate.
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// SecurityReq names the security schemes, with their scopes, that together
+// satisfy a security requirement. An empty requirement allows anonymous
+// access.
+type SecurityReq map[string][]string
+
+// Schema is a JSON schema as used by OpenAPI 3.0.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+}
+
+// Route describes an operation to document.
+type Route struct {
+	Method      string
+	Path        string // gin style, e.g. /deployments/:id
+	OperationID string
+	Summary     string
+	Description string
+	Tag         string
+	Deprecated  bool
+	// Public operations are called anonymously whatever the security
+	// schemes, they authenticate callers by other means.
+	Public bool
+	// Query lists the query parameters the operation accepts.
+	Query []Parameter
+	// Request is a value of the type of the request body, or nil if the
+	// operation takes no body.
+	Request any
+	// Response is a value of the type of the success response body, or nil
+	// if the operation responds without a body.
+	Response any
+	// Status is the success status code. It defaults to 200.
+	Status int
+	// Errors lists the error status codes the operation is known to return.
+	// Every operation also documents a default error response.
+	Errors []int
+}
+
+// Generator turns routes into a Document.
+type Generator struct {
+	info    Info
+	schemas map[string]*Schema
+	enums   map[reflect.Type][]string
+	// errorType is the type of the body of every error response.
+	errorType       reflect.Type
+	security        []SecurityReq
+	securitySchemes map[string]*SecurityScheme
+}
+
+// NewGenerator returns a Generator for an API described by info. errorBody is
+// a value of the type returned by every error response.
+func NewGenerator(info Info, errorBody any) *Generator {
+	return &Generator{
+		info:      info,
+		schemas:   make(map[string]*Schema),
+		enums:     make(map[reflect.Type][]string),
+		errorType: reflect.TypeOf(errorBody),
+	}
+}
+
+// RegisterEnum documents the allowed values of the type of value.
+func (g *Generator) RegisterEnum(value any, values ...string) {
+	g.enums[reflect.TypeOf(value)] = values
+}
+
+// AddSecurityScheme documents a way of authenticating that applies to every
+// operation. Unless required, operations may also be called anonymously.
+func (g *Generator) AddSecurityScheme(name string, scheme SecurityScheme, required bool) {
+	if g.securitySchemes == nil {
+		g.securitySchemes = make(map[string]*SecurityScheme)
+	}
+	g.securitySchemes[name] = &scheme
+	g.security = append(g.security, SecurityReq{name: {}})
+	if !required {
+		g.security = append(g.security, SecurityReq{})
+	}
+}
+
+// Generate builds the document for routes.
+func (g *Generator) Generate(routes []Route) (*Document, error) {
+	doc := &Document{
+		OpenAPI:  Version,
+		Info:     g.info,
+		Security: g.security,
+		Paths:    make(map[string]PathItem),
+	}
+
+	errorSchema := g.schemaFor(g.errorType)
+
+	seen := make(map[string]bool)
+	for _, route := range routes {
+		if route.OperationID == "" {
+			return nil, fmt.Errorf("%s %s: missing operation ID", route.Method, route.Path)
+		}
+		if seen[route.OperationID] {
+			return nil, fmt.Errorf("%s %s: duplicate operation ID %q", route.Method, route.Path, route.OperationID)
+		}
+		seen[route.OperationID] = true
+
+		path, params := convertPath(route.Path)
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = make(PathItem)
+			doc.Paths[path] = item
+		}
+
+		method := strings.ToLower(route.Method)
+		if _, exists := item[method]; exists {
+			return nil, fmt.Errorf("%s %s: route documented twice", route.Method, route.Path)
+		}
+		item[method] = g.operation(route, params, errorSchema)
+	}
+
+	// g.schemas is shared with previous calls, copy it so documents stay
+	// independent
+	doc.Components.Schemas = make(map[string]*Schema, len(g.schemas))
+	for name, schema := range g.schemas {
+		doc.Components.Schemas[name] = schema
+	}
+	doc.Components.SecuritySchemes = g.securitySchemes
+
+	return doc, nil
+}
+
+func (g *Generator) operation(route Route, pathParams []string, errorSchema *Schema) *Operation {
+	op := &Operation{
+		OperationID: route.OperationID,
+		Summary:     route.Summary,
+		Description: route.Description,
+		Deprecated:  route.Deprecated,
+		Responses:   make(map[string]Response),
+	}
+	if route.Tag != "" {
+		op.Tags = []string{route.Tag}
+	}
+	if route.Public {
+		op.Security = []SecurityReq{{}}
+	}
+
+	for _, name := range pathParams {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		})
+	}
+	op.Parameters = append(op.Parameters, route.Query...)
+
+	if route.Request != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  jsonContent(g.schemaFor(reflect.TypeOf(route.Request))),
+		}
+	}
+
+	status := route.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := Response{Description: http.StatusText(status)}
+	if route.Response != nil {
+		success.Content = jsonContent(g.schemaFor(reflect.TypeOf(route.Response)))
+	}
+	op.Responses[strconv.Itoa(status)] = success
+
+	for _, code := range route.Errors {
+		op.Responses[strconv.Itoa(code)] = Response{
+			Description: http.StatusText(code),
+			Content:     jsonContent(errorSchema),
+		}
+	}
+	op.Responses["default"] = Response{
+		Description: "Unexpected error",
+		Content:     jsonContent(errorSchema),
+	}
+
+	return op
+}
+
+func jsonContent(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema}}
+}
+
+// convertPath turns a gin path into an OpenAPI path and returns the names of
+// its parameters.
+func convertPath(path string) (string, []string) {
+	segments := strings.Split(path, "/")
+	var params []string
+	for i, segment := range segments {
+		if len(segment) > 1 && (segment[0] == ':' || segment[0] == '*') {
+			params = append(params, segment[1:])
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor returns the schema of t. Named structs are added to the
+// components and referenced.
+func (g *Generator) schemaFor(t reflect.Type) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		nullable = true
+	}
+
+	var schema *Schema
+	switch {
+	case t == timeType:
+		schema = &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		if _, ok := g.schemas[t.Name()]; !ok {
+			// register before recursing so self references terminate
+			g.schemas[t.Name()] = &Schema{}
+			*g.schemas[t.Name()] = *g.structSchema(t)
+		}
+		schema = &Schema{Ref: "#/components/schemas/" + t.Name()}
+	case t.Kind() == reflect.Struct:
+		schema = g.structSchema(t)
+	default:
+		schema = g.basicSchema(t)
+	}
+
+	// $ref siblings are ignored in OpenAPI 3.0, so nullability is only
+	// recorded on inline schemas
+	if nullable && schema.Ref == "" {
+		schema.Nullable = true
+	}
+	return schema
+}
+
+func (g *Generator) basicSchema(t reflect.Type) *Schema {
+	schema := &Schema{}
+	switch t.Kind() {
+	case reflect.String:
+		schema.Type = "string"
+	case reflect.Bool:
+		schema.Type = "boolean"
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		schema.Type = "integer"
+		schema.Format = "int32"
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		schema.Type = "integer"
+		schema.Format = "int64"
+	case reflect.Float32:
+		schema.Type = "number"
+		schema.Format = "float"
+	case reflect.Float64:
+		schema.Type = "number"
+		schema.Format = "double"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		schema.Type = "array"
+		schema.Items = g.schemaFor(t.Elem())
+	case reflect.Map:
+		schema.Type = "object"
+		schema.AdditionalProperties = g.schemaFor(t.Elem())
+	default:
+		// interfaces and anything else can hold any JSON value
+		return &Schema{}
+	}
+
+	if values, ok := g.enums[t]; ok {
+		schema.Enum = values
+	}
+	return schema
+}
+
+// structSchema follows the rules of encoding/json: the json tag names the
+// property, "-" skips the field and embedded structs are flattened.
+func (g *Generator) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				inner := g.structSchema(embedded)
+				for prop, propSchema := range inner.Properties {
+					schema.Properties[prop] = propSchema
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = g.schemaFor(field.Type)
+	}
+
+	return schema
+}
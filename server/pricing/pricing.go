@@ -0,0 +1,120 @@
+// Package pricing estimates what deployments cost from a price table.
+//
+// The table lists the hourly price of instance types per region and
+// lifecycle, and the monthly price of EBS storage per GB:
+//
+//	currency: USD
+//	regions:
+//	  us-east-2:
+//	    ebs_gb_month: 0.08
+//	    instances:
+//	      t3.medium: {on_demand: 0.0416, spot: 0.0139}
+//
+// Prices are estimates, they do not include data transfer, snapshots or
+// discounts.
+package pricing
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// HoursPerMonth is the number of hours AWS bills a month of storage for.
+const HoursPerMonth = 730
+
+// Table holds the prices of instances and storage per region.
+type Table struct {
+	Currency string                  `yaml:"currency"`
+	Regions  map[string]RegionPrices `yaml:"regions"`
+}
+
+// RegionPrices are the prices in a single region.
+type RegionPrices struct {
+	EBSPerGBMonth float64                   `yaml:"ebs_gb_month"`
+	Instances     map[string]InstancePrices `yaml:"instances"`
+}
+
+// InstancePrices are the hourly prices of an instance type. A zero Spot
+// price falls back to OnDemand.
+type InstancePrices struct {
+	OnDemand float64 `yaml:"on_demand"`
+	Spot     float64 `yaml:"spot"`
+}
+
+// Usage describes what is being priced.
+type Usage struct {
+	Region       string
+	InstanceType string
+	// Lifecycle is spot or on-demand.
+	Lifecycle string
+	StorageGB int
+	// Running is false for stopped instances, which are only charged for
+	// their storage.
+	Running bool
+}
+
+// LoadTable reads a price table from a YAML or JSON file.
+func LoadTable(path string) (*Table, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price table: %w", err)
+	}
+
+	var table Table
+	if err := yaml.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("failed to parse price table %s: %w", path, err)
+	}
+	if err := table.validate(); err != nil {
+		return nil, fmt.Errorf("price table %s: %w", path, err)
+	}
+
+	return &table, nil
+}
+
+func (t *Table) validate() error {
+	if t.Currency == "" {
+		return fmt.Errorf("currency must be set")
+	}
+	for region, prices := range t.Regions {
+		if prices.EBSPerGBMonth < 0 {
+			return fmt.Errorf("regions.%s.ebs_gb_month must not be negative", region)
+		}
+		for instanceType, price := range prices.Instances {
+			if price.OnDemand <= 0 || price.Spot < 0 {
+				return fmt.Errorf("regions.%s.instances.%s: on_demand must be positive and spot must not be negative", region, instanceType)
+			}
+		}
+	}
+	return nil
+}
+
+// Hourly returns the hourly cost of usage, or false if the table has no price
+// for its instance type in its region.
+func (t *Table) Hourly(usage Usage) (float64, bool) {
+	region, ok := t.Regions[usage.Region]
+	if !ok {
+		return 0, false
+	}
+	prices, ok := region.Instances[usage.InstanceType]
+	if !ok {
+		return 0, false
+	}
+
+	hourly := float64(usage.StorageGB) * region.EBSPerGBMonth / HoursPerMonth
+	if usage.Running {
+		if usage.Lifecycle == "spot" && prices.Spot > 0 {
+			hourly += prices.Spot
+		} else {
+			hourly += prices.OnDemand
+		}
+	}
+	return Round(hourly), true
+}
+
+// Round rounds a cost to a hundredth of a cent.
+func Round(cost float64) float64 {
+	return math.Round(cost*10000) / 10000
+}
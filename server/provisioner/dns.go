@@ -0,0 +1,151 @@
+package provisioner
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// recordTTL is the TTL of the address records of deployments, in seconds.
+const recordTTL = 60
+
+// DNS keeps the address records pointing the hostnames of deployments at
+// their instances. Route53 keeps them in a hosted zone, FakeDNS in memory.
+type DNS interface {
+	// Address returns the address hostname points at, "" if it has no
+	// record.
+	Address(ctx context.Context, hostname string) (string, error)
+	// SetAddress points hostname at address.
+	SetAddress(ctx context.Context, hostname, address string) error
+	// RemoveAddress deletes the record of hostname if it points at address,
+	// or at anything if address is "".
+	RemoveAddress(ctx context.Context, hostname, address string) error
+}
+
+// Route53API is the subset of the Route53 API that Route53 depends on.
+type Route53API interface {
+	ListResourceRecordSets(ctx context.Context, params *route53.ListResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ListResourceRecordSetsOutput, error)
+	ChangeResourceRecordSets(ctx context.Context, params *route53.ChangeResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error)
+}
+
+var (
+	_ Route53API = (*route53.Client)(nil)
+	_ DNS        = (*Route53)(nil)
+)
+
+// Route53 keeps A records in an Amazon Route 53 hosted zone, the way the
+// Terraform module did.
+type Route53 struct {
+	client Route53API
+	zoneID string
+}
+
+// NewRoute53 returns a Route53 keeping its records in hosted zone zoneID.
+func NewRoute53(client Route53API, zoneID string) *Route53 {
+	return &Route53{client: client, zoneID: zoneID}
+}
+
+func (r *Route53) Address(ctx context.Context, hostname string) (string, error) {
+	record, err := r.record(ctx, hostname)
+	if err != nil || record == nil || len(record.ResourceRecords) == 0 {
+		return "", err
+	}
+	return aws.ToString(record.ResourceRecords[0].Value), nil
+}
+
+func (r *Route53) SetAddress(ctx context.Context, hostname, address string) error {
+	return r.change(ctx, types.ChangeActionUpsert, &types.ResourceRecordSet{
+		Name:            aws.String(hostname),
+		Type:            types.RRTypeA,
+		TTL:             aws.Int64(recordTTL),
+		ResourceRecords: []types.ResourceRecord{{Value: aws.String(address)}},
+	})
+}
+
+func (r *Route53) RemoveAddress(ctx context.Context, hostname, address string) error {
+	record, err := r.record(ctx, hostname)
+	if err != nil || record == nil {
+		return err
+	}
+	if address != "" && (len(record.ResourceRecords) != 1 || aws.ToString(record.ResourceRecords[0].Value) != address) {
+		return nil
+	}
+	// a deletion must match the record exactly
+	return r.change(ctx, types.ChangeActionDelete, record)
+}
+
+// record returns the A record of hostname, nil if there is none.
+func (r *Route53) record(ctx context.Context, hostname string) (*types.ResourceRecordSet, error) {
+	output, err := r.client.ListResourceRecordSets(ctx, &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(r.zoneID),
+		StartRecordName: aws.String(hostname),
+		StartRecordType: types.RRTypeA,
+		MaxItems:        aws.Int32(1),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the listing starts at hostname, the first record is another one if
+	// hostname has none
+	for _, record := range output.ResourceRecordSets {
+		if record.Type == types.RRTypeA && strings.EqualFold(strings.TrimSuffix(aws.ToString(record.Name), "."), hostname) {
+			return &record, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *Route53) change(ctx context.Context, action types.ChangeAction, record *types.ResourceRecordSet) error {
+	_, err := r.client.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(r.zoneID),
+		ChangeBatch: &types.ChangeBatch{
+			Comment: aws.String("turbo-deploy"),
+			Changes: []types.Change{{Action: action, ResourceRecordSet: record}},
+		},
+	})
+	return err
+}
+
+var _ DNS = (*FakeDNS)(nil)
+
+// FakeDNS is a DNS that keeps the records in memory.
+type FakeDNS struct {
+	mu      sync.Mutex
+	records map[string]string
+}
+
+// NewFakeDNS returns a FakeDNS without records.
+func NewFakeDNS() *FakeDNS {
+	return &FakeDNS{records: make(map[string]string)}
+}
+
+func (d *FakeDNS) Address(_ context.Context, hostname string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.records[strings.ToLower(hostname)], nil
+}
+
+func (d *FakeDNS) SetAddress(_ context.Context, hostname, address string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.records[strings.ToLower(hostname)] = address
+	return nil
+}
+
+func (d *FakeDNS) RemoveAddress(_ context.Context, hostname, address string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hostname = strings.ToLower(hostname)
+	if current, ok := d.records[hostname]; ok && (address == "" || current == address) {
+		delete(d.records, hostname)
+	}
+	return nil
+}
@@ -0,0 +1,561 @@
+// Package provisioner launches and updates the instances of deployments and
+// terminates those of deleted deployments, in place of the Terraform Lambda.
+//
+// A run diffs the deployment records against the live turbo-deploy
+// instances, matched by their DeploymentID tag, and only acts on the
+// deployments that differ. A deployment without an instance is launched, one
+// whose image, lifecycle or hostname changed is replaced, and one whose size
+// or tags changed is resized or retagged in place; spot instances cannot be
+// stopped, so they are replaced to be resized. The hostname of a deployment
+// acted upon is pointed at its instance. Deleting deployments have their
+// instance terminated and are marked deleted, deleted ones are removed once
+// the retention has passed, and instances whose record is gone are
+// terminated.
+//
+// Deployments move through their statuses like with the Terraform Lambda:
+// provisioning while their instance is changed, then running, or failed with
+// the error as lastError. Failed deployments are retried on every run.
+// Records created before statuses were kept are provisioned without one.
+package provisioner
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/instance"
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+// Options control a run of the provisioner.
+type Options struct {
+	// DryRun reports what would be changed without changing anything.
+	DryRun bool
+	// DeploymentIDs limits the run to these deployments, every deployment
+	// is reconciled if it is empty.
+	DeploymentIDs []string
+	// SubnetID, SecurityGroupID, KeyName and InstanceProfile are the
+	// settings instances are launched with, see instance.LaunchSpec.
+	SubnetID        string
+	SecurityGroupID string
+	KeyName         string
+	InstanceProfile string
+	// DeletedRetention is how long deleted deployments are kept before their
+	// records are removed.
+	DeletedRetention time.Duration
+	// PollInterval is how often an instance being resized is checked, see
+	// instance.Service.ResizeInstance.
+	PollInterval time.Duration
+	// Now returns the current time, time.Now if nil.
+	Now func() time.Time
+}
+
+// Backends are the services a Provisioner uses besides DynamoDB and EC2.
+type Backends struct {
+	// DNS registers the hostnames of deployments, they are not registered
+	// if it is nil.
+	DNS DNS
+	// Scripts supplies the user data of instances, which get none if it is
+	// nil.
+	Scripts Scripts
+}
+
+// Provisioner reconciles the instances of deployments with their records.
+type Provisioner struct {
+	store   db.DeploymentStore
+	compute *instance.Service
+	dns     DNS
+	scripts Scripts
+	opts    Options
+}
+
+// New returns a Provisioner for the deployments in store, managing their
+// instances through compute and their hostnames and user data through
+// backends.
+func New(store db.DeploymentStore, compute *instance.Service, backends Backends, opts Options) *Provisioner {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Provisioner{
+		store:   store,
+		compute: compute,
+		dns:     backends.DNS,
+		scripts: backends.Scripts,
+		opts:    opts,
+	}
+}
+
+// Action is something done to a deployment.
+type Action string
+
+const (
+	// ActionLaunch launches the instance of a deployment.
+	ActionLaunch Action = "launch"
+	// ActionReplace terminates the instance of a deployment and launches a
+	// new one.
+	ActionReplace Action = "replace"
+	// ActionResize changes the instance type in place.
+	ActionResize Action = "resize"
+	// ActionTag updates the tags of the instance.
+	ActionTag Action = "tag"
+	// ActionDNS points the hostname at the instance, or removes it.
+	ActionDNS Action = "dns"
+	// ActionTerminate terminates an instance that is not wanted: that of a
+	// deleted deployment, a duplicate, or one without a record.
+	ActionTerminate Action = "terminate"
+	// ActionRemove deletes the record of a deployment deleted for longer
+	// than the retention.
+	ActionRemove Action = "remove"
+)
+
+// Report lists what a run changed, or would have changed in a dry run.
+type Report struct {
+	DryRun  bool     `json:"dryRun"`
+	Changes []Change `json:"changes"`
+}
+
+// Change describes what was done to a deployment.
+type Change struct {
+	DeploymentID string `json:"deploymentId"`
+	Hostname     string `json:"hostname,omitempty"`
+	// InstanceID is the instance of the deployment once changed, or the
+	// instance terminated.
+	InstanceID string   `json:"instanceId,omitempty"`
+	Actions    []Action `json:"actions"`
+	// Status is the status the deployment was moved to, if any.
+	Status models.DeploymentStatus `json:"status,omitempty"`
+	// Error is set if the deployment could not be changed completely.
+	Error string `json:"error,omitempty"`
+}
+
+// Run reconciles the deployments, in deployment ID order. The returned error
+// joins the failures of single deployments, which are also reported in the
+// Report.
+func (p *Provisioner) Run(ctx context.Context) (Report, error) {
+	report := Report{DryRun: p.opts.DryRun, Changes: []Change{}}
+
+	records, err := p.records(ctx)
+	if err != nil {
+		return report, err
+	}
+	// spot instances launched by Terraform only carry the tags of their
+	// request until populated
+	if err := p.compute.PopulateSpotTagResponse(ctx); err != nil {
+		return report, fmt.Errorf("failed to populate tags for deployed instances: %w", err)
+	}
+	instances, err := p.compute.ListInstances(ctx, p.opts.DeploymentIDs...)
+	if err != nil {
+		return report, fmt.Errorf("failed to list deployed instances: %w", err)
+	}
+
+	// the oldest instance of a deployment is kept, others are duplicates
+	byDeployment := make(map[string][]types.Instance)
+	for _, inst := range instances {
+		if id := tagValue(inst.Tags, "DeploymentID"); id != "" {
+			byDeployment[id] = append(byDeployment[id], inst)
+		}
+	}
+	for _, insts := range byDeployment {
+		slices.SortFunc(insts, func(a, b types.Instance) int {
+			return cmp.Or(
+				aws.ToTime(a.LaunchTime).Compare(aws.ToTime(b.LaunchTime)),
+				cmp.Compare(aws.ToString(a.InstanceId), aws.ToString(b.InstanceId)),
+			)
+		})
+	}
+
+	now := p.opts.Now()
+	var errs []error
+	for _, record := range records {
+		insts := byDeployment[record.ID]
+		delete(byDeployment, record.ID)
+
+		var change Change
+		if record.Removed() {
+			change, err = p.remove(ctx, record, insts, now)
+		} else {
+			change, err = p.apply(ctx, record, insts)
+		}
+		if len(change.Actions) == 0 && change.Status == "" && err == nil {
+			continue
+		}
+		if err != nil {
+			change.Error = err.Error()
+			errs = append(errs, fmt.Errorf("deployment %s: %w", record.ID, err))
+		}
+		report.Changes = append(report.Changes, change)
+	}
+
+	// whatever is left had no record when they were listed
+	for _, id := range slices.Sorted(maps.Keys(byDeployment)) {
+		// unless the deployment was created since and already launched
+		if _, err := p.store.GetRecord(ctx, id); !errors.Is(err, db.ErrURLNotFound) {
+			if err != nil {
+				errs = append(errs, fmt.Errorf("deployment %s: %w", id, err))
+			}
+			continue
+		}
+		for _, inst := range byDeployment[id] {
+			change := Change{
+				DeploymentID: id,
+				Hostname:     tagValue(inst.Tags, "Name"),
+				InstanceID:   aws.ToString(inst.InstanceId),
+				Actions:      []Action{ActionTerminate},
+			}
+			if !p.opts.DryRun {
+				if err := p.terminate(ctx, id, inst); err != nil {
+					change.Error = err.Error()
+					errs = append(errs, fmt.Errorf("deployment %s: %w", id, err))
+				}
+			}
+			report.Changes = append(report.Changes, change)
+		}
+	}
+	slices.SortStableFunc(report.Changes, func(a, b Change) int { return cmp.Compare(a.DeploymentID, b.DeploymentID) })
+
+	return report, errors.Join(errs...)
+}
+
+// records returns the records of the deployments of the run sorted by ID.
+func (p *Provisioner) records(ctx context.Context) ([]models.DynamoDBData, error) {
+	if len(p.opts.DeploymentIDs) == 0 {
+		records, err := p.store.ListRecords(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list deployment records: %w", err)
+		}
+		slices.SortFunc(records, func(a, b models.DynamoDBData) int { return cmp.Compare(a.ID, b.ID) })
+		return records, nil
+	}
+
+	var records []models.DynamoDBData
+	for _, id := range slices.Sorted(slices.Values(p.opts.DeploymentIDs)) {
+		record, err := p.store.GetRecord(ctx, id)
+		if errors.Is(err, db.ErrURLNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get deployment record %s: %w", id, err)
+		}
+		records = append(records, *record)
+	}
+	return records, nil
+}
+
+// plan is what apply does to the instance of a deployment.
+type plan struct {
+	launch, replace, resize bool
+	// tags are the tags to update.
+	tags map[string]string
+}
+
+func (pl plan) actions() []Action {
+	var actions []Action
+	switch {
+	case pl.launch:
+		actions = append(actions, ActionLaunch)
+	case pl.replace:
+		actions = append(actions, ActionReplace)
+	}
+	if pl.resize {
+		actions = append(actions, ActionResize)
+	}
+	if len(pl.tags) > 0 {
+		actions = append(actions, ActionTag)
+	}
+	return actions
+}
+
+// apply brings the instances of record in line with it. insts are its live
+// instances, oldest first.
+func (p *Provisioner) apply(ctx context.Context, record models.DynamoDBData, insts []types.Instance) (Change, error) {
+	change := Change{DeploymentID: record.ID, Hostname: record.Hostname}
+
+	var current *types.Instance
+	var duplicates []types.Instance
+	if len(insts) > 0 {
+		current, duplicates = &insts[0], insts[1:]
+		change.InstanceID = aws.ToString(current.InstanceId)
+	}
+	for range duplicates {
+		change.Actions = append(change.Actions, ActionTerminate)
+	}
+
+	var pl plan
+	switch {
+	case current == nil:
+		pl.launch = true
+	case needsReplacement(record, *current):
+		pl.replace = true
+	default:
+		pl.resize = string(current.InstanceType) != record.ServerSize
+		pl.tags = changedTags(record, *current)
+	}
+	change.Actions = append(change.Actions, pl.actions()...)
+
+	pending := record.Status == models.StatusRequested || record.Status == models.StatusProvisioning || record.Status == models.StatusFailed
+	if len(change.Actions) == 0 && !pending {
+		return change, nil
+	}
+
+	if p.opts.DryRun {
+		if p.dns != nil && (current == nil || pl.replace || p.addressDiffers(ctx, record.Hostname, *current)) {
+			change.Actions = append(change.Actions, ActionDNS)
+		}
+		if record.Status != "" && record.Status != models.StatusRunning {
+			change.Status = models.StatusRunning
+		}
+		return change, nil
+	}
+
+	if len(change.Actions) > 0 && record.Status != "" && record.Status != models.StatusProvisioning {
+		if err := p.setStatus(ctx, record.ID, models.StatusProvisioning, ""); err != nil {
+			return change, err
+		}
+	}
+
+	applied := p.execute(ctx, record, current, duplicates, pl, &change)
+
+	status, lastError := models.StatusRunning, ""
+	if applied != nil {
+		log.Printf("provisioner: deployment %s failed: %v", record.ID, applied)
+		status, lastError = models.StatusFailed, applied.Error()
+	}
+	if record.Status != "" && (len(change.Actions) > 0 || record.Status != status) {
+		if err := p.setStatus(ctx, record.ID, status, lastError); err != nil {
+			return change, errors.Join(applied, err)
+		}
+		change.Status = status
+	}
+	return change, applied
+}
+
+// execute carries out pl for record, whose instance is current if it has
+// one, and terminates its duplicates. The actions taken besides those of pl
+// are added to change.
+func (p *Provisioner) execute(ctx context.Context, record models.DynamoDBData, current *types.Instance, duplicates []types.Instance, pl plan, change *Change) error {
+	for _, inst := range duplicates {
+		log.Printf("provisioner: terminating duplicate instance %s of deployment %s", aws.ToString(inst.InstanceId), record.ID)
+		if err := p.terminate(ctx, record.ID, inst); err != nil {
+			return err
+		}
+	}
+
+	if pl.replace {
+		log.Printf("provisioner: replacing instance %s of deployment %s", aws.ToString(current.InstanceId), record.ID)
+		if err := p.terminate(ctx, record.ID, *current); err != nil {
+			return err
+		}
+	}
+	if pl.launch || pl.replace {
+		inst, err := p.launch(ctx, record)
+		if err != nil {
+			return err
+		}
+		current = &inst
+		change.InstanceID = aws.ToString(inst.InstanceId)
+	}
+
+	instanceID := aws.ToString(current.InstanceId)
+	if pl.resize {
+		if err := p.compute.ResizeInstance(ctx, record.ID, instanceID, record.ServerSize, p.opts.PollInterval); err != nil {
+			return fmt.Errorf("failed to resize instance %s: %w", instanceID, err)
+		}
+	}
+	if len(pl.tags) > 0 {
+		if err := p.compute.TagInstance(ctx, record.ID, instanceID, pl.tags); err != nil {
+			return fmt.Errorf("failed to tag instance %s: %w", instanceID, err)
+		}
+	}
+
+	if p.dns != nil && p.addressDiffers(ctx, record.Hostname, *current) {
+		if err := p.dns.SetAddress(ctx, record.Hostname, aws.ToString(current.PrivateIpAddress)); err != nil {
+			return fmt.Errorf("failed to register hostname %s: %w", record.Hostname, err)
+		}
+		change.Actions = append(change.Actions, ActionDNS)
+	}
+
+	return nil
+}
+
+// addressDiffers reports whether hostname does not point at inst, lookup
+// failures count as differing so the record is set again.
+func (p *Provisioner) addressDiffers(ctx context.Context, hostname string, inst types.Instance) bool {
+	address, err := p.dns.Address(ctx, hostname)
+	return err != nil || address != aws.ToString(inst.PrivateIpAddress)
+}
+
+// launch launches the instance of record.
+func (p *Provisioner) launch(ctx context.Context, record models.DynamoDBData) (types.Instance, error) {
+	spec := instance.LaunchSpec{
+		DeploymentID:    record.ID,
+		ImageID:         record.Ami,
+		InstanceType:    record.ServerSize,
+		Spot:            record.Lifecycle == string(types.InstanceLifecycleTypeSpot),
+		SubnetID:        p.opts.SubnetID,
+		KeyName:         p.opts.KeyName,
+		InstanceProfile: p.opts.InstanceProfile,
+		Tags:            recordTags(record),
+		// a launch retried for the same version of the record, e.g. by a
+		// concurrent run, returns the instance launched the first time
+		ClientToken: record.ID + "-" + strconv.FormatInt(record.StatusChangedAt, 10),
+	}
+	if p.opts.SecurityGroupID != "" {
+		spec.SecurityGroupIDs = []string{p.opts.SecurityGroupID}
+	}
+	if p.scripts != nil {
+		userData, err := renderUserData(ctx, p.scripts, record.Hostname, record.UserData)
+		if err != nil {
+			return types.Instance{}, fmt.Errorf("failed to render user data: %w", err)
+		}
+		spec.UserData = userData
+	}
+
+	inst, err := p.compute.LaunchInstance(ctx, spec)
+	if err != nil {
+		return types.Instance{}, fmt.Errorf("failed to launch instance: %w", err)
+	}
+	log.Printf("provisioner: launched instance %s for deployment %s", aws.ToString(inst.InstanceId), record.ID)
+	return inst, nil
+}
+
+// remove terminates the instances of a deleting or deleted record, marks it
+// deleted and removes it once the retention has passed.
+func (p *Provisioner) remove(ctx context.Context, record models.DynamoDBData, insts []types.Instance, now time.Time) (Change, error) {
+	change := Change{DeploymentID: record.ID, Hostname: record.Hostname}
+	for _, inst := range insts {
+		change.InstanceID = aws.ToString(inst.InstanceId)
+		change.Actions = append(change.Actions, ActionTerminate)
+	}
+
+	deleting := record.Status == models.StatusDeleting
+	// the hostname is still held by a deleting deployment, so whatever it
+	// points at is the deployment's
+	unregister := false
+	if deleting && p.dns != nil {
+		address, err := p.dns.Address(ctx, record.Hostname)
+		unregister = err != nil || address != ""
+	}
+	if unregister {
+		change.Actions = append(change.Actions, ActionDNS)
+	}
+	if deleting {
+		change.Status = models.StatusDeleted
+	}
+	expired := record.Status == models.StatusDeleted && now.Sub(time.Unix(record.StatusChangedAt, 0)) >= p.opts.DeletedRetention
+	if expired {
+		change.Actions = append(change.Actions, ActionRemove)
+	}
+	if p.opts.DryRun || len(change.Actions) == 0 && change.Status == "" {
+		return change, nil
+	}
+
+	for _, inst := range insts {
+		if err := p.terminate(ctx, record.ID, inst); err != nil {
+			change.Status = ""
+			return change, err
+		}
+	}
+	if unregister {
+		if err := p.dns.RemoveAddress(ctx, record.Hostname, ""); err != nil {
+			change.Status = ""
+			return change, fmt.Errorf("failed to unregister hostname %s: %w", record.Hostname, err)
+		}
+	}
+	if deleting {
+		if err := p.setStatus(ctx, record.ID, models.StatusDeleted, ""); err != nil {
+			change.Status = ""
+			return change, err
+		}
+	}
+	if expired {
+		log.Printf("provisioner: removing deployment %s, deleted at %s", record.ID, time.Unix(record.StatusChangedAt, 0).Format(time.RFC3339))
+		if err := p.store.DeleteRecord(ctx, record.ID); err != nil && !errors.Is(err, db.ErrURLNotFound) {
+			return change, fmt.Errorf("failed to delete record: %w", err)
+		}
+	}
+	return change, nil
+}
+
+// terminate terminates inst of deployment deploymentID and removes its
+// hostname if it still points at it.
+func (p *Provisioner) terminate(ctx context.Context, deploymentID string, inst types.Instance) error {
+	instanceID := aws.ToString(inst.InstanceId)
+	if err := p.compute.TerminateInstance(ctx, deploymentID, instanceID); err != nil {
+		return fmt.Errorf("failed to terminate instance %s: %w", instanceID, err)
+	}
+
+	hostname, address := tagValue(inst.Tags, "Name"), aws.ToString(inst.PrivateIpAddress)
+	if p.dns == nil || hostname == "" || address == "" {
+		return nil
+	}
+	if err := p.dns.RemoveAddress(ctx, hostname, address); err != nil {
+		return fmt.Errorf("failed to unregister hostname %s: %w", hostname, err)
+	}
+	return nil
+}
+
+// setStatus records the status of deployment id, which may have been
+// removed meanwhile.
+func (p *Provisioner) setStatus(ctx context.Context, id string, status models.DeploymentStatus, lastError string) error {
+	err := p.store.SetStatus(ctx, id, status, lastError, p.opts.Now().Unix())
+	if err != nil && !errors.Is(err, db.ErrURLNotFound) {
+		return fmt.Errorf("failed to set status %s: %w", status, err)
+	}
+	return nil
+}
+
+// recordTags returns the tags of the instance of record, the same as the
+// Terraform module put on instances.
+func recordTags(record models.DynamoDBData) map[string]string {
+	return map[string]string{
+		"Name":         record.Hostname,
+		"Hostname":     record.Hostname,
+		"DeploymentID": record.ID,
+		"TimeToExpire": strconv.FormatInt(record.TimeToExpire, 10),
+		"DeployedBy":   "turbo-deploy",
+		"UserData":     strings.Join(record.UserData, ","),
+	}
+}
+
+// changedTags returns the tags of record that inst lacks or has another
+// value for.
+func changedTags(record models.DynamoDBData, inst types.Instance) map[string]string {
+	changed := make(map[string]string)
+	for key, value := range recordTags(record) {
+		if tagValue(inst.Tags, key) != value {
+			changed[key] = value
+		}
+	}
+	return changed
+}
+
+// needsReplacement reports whether the record changed in a way that cannot
+// be applied to its instance in place.
+func needsReplacement(record models.DynamoDBData, inst types.Instance) bool {
+	wantSpot := record.Lifecycle == string(types.InstanceLifecycleTypeSpot)
+	isSpot := inst.InstanceLifecycle == types.InstanceLifecycleTypeSpot
+
+	return aws.ToString(inst.ImageId) != record.Ami ||
+		wantSpot != isSpot ||
+		tagValue(inst.Tags, "Hostname") != record.Hostname ||
+		isSpot && string(inst.InstanceType) != record.ServerSize
+}
+
+func tagValue(tags []types.Tag, key string) string {
+	for _, tag := range tags {
+		if aws.ToString(tag.Key) == key {
+			return aws.ToString(tag.Value)
+		}
+	}
+	return ""
+}
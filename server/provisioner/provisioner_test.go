@@ -0,0 +1,278 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/instance"
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+func testInstance(record models.DynamoDBData) types.Instance {
+	inst := types.Instance{
+		InstanceId:   aws.String("i-1"),
+		ImageId:      aws.String(record.Ami),
+		InstanceType: types.InstanceType(record.ServerSize),
+	}
+	if record.Lifecycle == "spot" {
+		inst.InstanceLifecycle = types.InstanceLifecycleTypeSpot
+	}
+	for key, value := range recordTags(record) {
+		inst.Tags = append(inst.Tags, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	return inst
+}
+
+func TestPlan(t *testing.T) {
+	record := models.DynamoDBData{
+		ID:           "d1",
+		Hostname:     "web",
+		Ami:          "ami-1",
+		ServerSize:   "t3.small",
+		Lifecycle:    "on-demand",
+		TimeToExpire: 1_000_000,
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*models.DynamoDBData)
+		replace bool
+		actions []Action
+		tags    []string
+	}{
+		{"unchanged", func(*models.DynamoDBData) {}, false, nil, nil},
+		{"new image", func(r *models.DynamoDBData) { r.Ami = "ami-2" }, true, nil, nil},
+		{"new hostname", func(r *models.DynamoDBData) { r.Hostname = "api" }, true, nil, nil},
+		{"on-demand to spot", func(r *models.DynamoDBData) { r.Lifecycle = "spot" }, true, nil, nil},
+		{"resized on-demand", func(r *models.DynamoDBData) { r.ServerSize = "t3.large" }, false, []Action{ActionResize}, nil},
+		{"extended", func(r *models.DynamoDBData) { r.TimeToExpire = 2_000_000 }, false, []Action{ActionTag}, []string{"TimeToExpire"}},
+		{"new user data", func(r *models.DynamoDBData) { r.UserData = []string{"docker.sh"} }, false, []Action{ActionTag}, []string{"UserData"}},
+		{"resized and extended", func(r *models.DynamoDBData) { r.ServerSize, r.TimeToExpire = "t3.large", 0 }, false, []Action{ActionResize, ActionTag}, []string{"TimeToExpire"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := record
+			tt.modify(&changed)
+			inst := testInstance(record)
+
+			if got := needsReplacement(changed, inst); got != tt.replace {
+				t.Fatalf("needsReplacement() = %v, want %v", got, tt.replace)
+			}
+			if tt.replace {
+				return
+			}
+			pl := plan{resize: string(inst.InstanceType) != changed.ServerSize, tags: changedTags(changed, inst)}
+			if got := pl.actions(); !slices.Equal(got, tt.actions) {
+				t.Errorf("actions() = %v, want %v", got, tt.actions)
+			}
+			if got := slices.Sorted(maps.Keys(pl.tags)); !slices.Equal(got, tt.tags) {
+				t.Errorf("changedTags() = %v, want %v", got, tt.tags)
+			}
+		})
+	}
+}
+
+func TestNeedsReplacementToResizeSpot(t *testing.T) {
+	record := models.DynamoDBData{ID: "d1", Hostname: "web", Ami: "ami-1", ServerSize: "t3.small", Lifecycle: "spot"}
+	inst := testInstance(record)
+	record.ServerSize = "t3.large"
+	if !needsReplacement(record, inst) {
+		t.Error("needsReplacement() of a resized spot instance = false, spot instances cannot be stopped")
+	}
+}
+
+func TestPlanActionsLaunch(t *testing.T) {
+	if got := (plan{launch: true, tags: map[string]string{"Name": "web"}}).actions(); !slices.Equal(got, []Action{ActionLaunch, ActionTag}) {
+		t.Errorf("actions() = %v", got)
+	}
+	if got := (plan{replace: true}).actions(); !slices.Equal(got, []Action{ActionReplace}) {
+		t.Errorf("actions() = %v", got)
+	}
+}
+
+// testProvisioner returns a Provisioner over an empty store and a fake
+// account offering the images ami-1 and ami-2 and the sizes t3.small and
+// t3.large.
+func testProvisioner(t *testing.T, opts Options) (*Provisioner, *db.MemoryStore, *instance.FakeProvider, *FakeDNS) {
+	t.Helper()
+	store := db.NewMemoryStore()
+	provider := instance.NewFakeProvider()
+	provider.TransitionDelay = 0
+	provider.AddImage("ami-1", "base", nil)
+	provider.AddImage("ami-2", "base-next", nil)
+	provider.AddInstanceType("t3.small", 2, 2048)
+	provider.AddInstanceType("t3.large", 2, 8192)
+	dns := NewFakeDNS()
+	opts.PollInterval = time.Millisecond
+	p := New(store, instance.NewService(provider), Backends{DNS: dns}, opts)
+	return p, store, provider, dns
+}
+
+func runOnce(t *testing.T, p *Provisioner) Change {
+	t.Helper()
+	report, err := p.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(report.Changes) != 1 {
+		t.Fatalf("Run changed %+v, want a single deployment", report.Changes)
+	}
+	return report.Changes[0]
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	p, store, _, dns := testProvisioner(t, Options{})
+
+	record := models.DynamoDBData{ID: "d1", Hostname: "web", Ami: "ami-1", ServerSize: "t3.small", Lifecycle: "on-demand", Status: models.StatusRequested}
+	if _, err := store.SaveRecord(ctx, record); err != nil {
+		t.Fatalf("SaveRecord: %v", err)
+	}
+
+	change := runOnce(t, p)
+	if !slices.Equal(change.Actions, []Action{ActionLaunch, ActionDNS}) || change.Status != models.StatusRunning {
+		t.Fatalf("first Run = %+v, want a launch", change)
+	}
+	first := change.InstanceID
+	if address, _ := dns.Address(ctx, "web"); address == "" {
+		t.Error("hostname not registered")
+	}
+
+	// nothing to do once the instance matches
+	report, err := p.Run(ctx)
+	if err != nil || len(report.Changes) != 0 {
+		t.Fatalf("second Run = %+v, %v, want no changes", report.Changes, err)
+	}
+
+	edit := func(modify func(*models.DynamoDBData)) {
+		t.Helper()
+		current, err := store.GetRecord(ctx, "d1")
+		if err != nil {
+			t.Fatalf("GetRecord: %v", err)
+		}
+		modify(current)
+		if err := store.UpdateRecord(ctx, "d1", *current); err != nil {
+			t.Fatalf("UpdateRecord: %v", err)
+		}
+	}
+
+	edit(func(r *models.DynamoDBData) {
+		r.ServerSize, r.TimeToExpire = "t3.large", time.Now().Add(time.Hour).Unix()
+	})
+	change = runOnce(t, p)
+	if !slices.Equal(change.Actions, []Action{ActionResize, ActionTag}) || change.InstanceID != first {
+		t.Fatalf("Run after a resize = %+v, want the instance resized and retagged", change)
+	}
+
+	edit(func(r *models.DynamoDBData) { r.Ami = "ami-2" })
+	change = runOnce(t, p)
+	if !slices.Equal(change.Actions, []Action{ActionReplace, ActionDNS}) || change.InstanceID == first {
+		t.Fatalf("Run after an image change = %+v, want the instance replaced", change)
+	}
+
+	if err := store.SetStatus(ctx, "d1", models.StatusDeleting, "", time.Now().Unix()); err != nil {
+		t.Fatalf("SetStatus: %v", err)
+	}
+	change = runOnce(t, p)
+	if !slices.Equal(change.Actions, []Action{ActionTerminate, ActionDNS}) || change.Status != models.StatusDeleted {
+		t.Fatalf("Run after a delete = %+v, want the instance terminated", change)
+	}
+	if address, _ := dns.Address(ctx, "web"); address != "" {
+		t.Errorf("hostname still points at %s", address)
+	}
+}
+
+func TestRunFailedLaunch(t *testing.T) {
+	ctx := context.Background()
+	p, store, _, _ := testProvisioner(t, Options{})
+
+	if _, err := store.SaveRecord(ctx, models.DynamoDBData{ID: "d1", Hostname: "web", Ami: "ami-9", ServerSize: "t3.small", Status: models.StatusRequested}); err != nil {
+		t.Fatalf("SaveRecord: %v", err)
+	}
+	if _, err := p.Run(ctx); err == nil {
+		t.Fatal("Run of an unknown image succeeded")
+	}
+	record, err := store.GetRecord(ctx, "d1")
+	if err != nil {
+		t.Fatalf("GetRecord: %v", err)
+	}
+	if record.Status != models.StatusFailed || record.LastError == "" {
+		t.Errorf("status %s with error %q, want failed with the error", record.Status, record.LastError)
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	ctx := context.Background()
+	p, store, provider, _ := testProvisioner(t, Options{DryRun: true})
+
+	if _, err := store.SaveRecord(ctx, models.DynamoDBData{ID: "d1", Hostname: "web", Ami: "ami-1", ServerSize: "t3.small", Status: models.StatusRequested}); err != nil {
+		t.Fatalf("SaveRecord: %v", err)
+	}
+	orphan := provider.RunInstance(instance.FakeInstanceSpec{
+		ImageID:      "ami-1",
+		InstanceType: "t3.small",
+		Tags:         map[string]string{"DeployedBy": "turbo-deploy", "DeploymentID": "gone"},
+	})
+
+	report, err := p.Run(ctx)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := []Change{
+		{DeploymentID: "d1", Hostname: "web", Actions: []Action{ActionLaunch, ActionDNS}, Status: models.StatusRunning},
+		{DeploymentID: "gone", InstanceID: orphan, Actions: []Action{ActionTerminate}},
+	}
+	if len(report.Changes) != len(want) {
+		t.Fatalf("Run = %+v, want %+v", report.Changes, want)
+	}
+	for i := range want {
+		got := report.Changes[i]
+		if got.DeploymentID != want[i].DeploymentID || got.InstanceID != want[i].InstanceID || got.Status != want[i].Status || !slices.Equal(got.Actions, want[i].Actions) {
+			t.Errorf("change %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+
+	// nothing was changed
+	record, err := store.GetRecord(ctx, "d1")
+	if err != nil {
+		t.Fatalf("GetRecord: %v", err)
+	}
+	if record.Status != models.StatusRequested {
+		t.Errorf("status %s, want requested", record.Status)
+	}
+	instances, err := instance.NewService(provider).ListInstances(ctx)
+	if err != nil {
+		t.Fatalf("ListInstances: %v", err)
+	}
+	if len(instances) != 1 || aws.ToString(instances[0].InstanceId) != orphan {
+		t.Errorf("instances after a dry run = %d, want only the orphan", len(instances))
+	}
+}
+
+func TestRunRemovesDeletedAfterRetention(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(2_000_000, 0)
+	p, store, _, _ := testProvisioner(t, Options{DeletedRetention: time.Hour, Now: func() time.Time { return now }})
+
+	if _, err := store.SaveRecord(ctx, models.DynamoDBData{ID: "d1", Hostname: "web", Status: models.StatusRunning}); err != nil {
+		t.Fatalf("SaveRecord: %v", err)
+	}
+	if err := store.SetStatus(ctx, "d1", models.StatusDeleted, "", now.Add(-time.Hour).Unix()); err != nil {
+		t.Fatalf("SetStatus: %v", err)
+	}
+
+	if change := runOnce(t, p); !slices.Equal(change.Actions, []Action{ActionRemove}) {
+		t.Fatalf("Run = %+v, want the record removed", change)
+	}
+	if _, err := store.GetRecord(ctx, "d1"); !errors.Is(err, db.ErrURLNotFound) {
+		t.Errorf("GetRecord after removal = %v, want ErrURLNotFound", err)
+	}
+}
@@ -0,0 +1,140 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	// baseScript is run first by every instance.
+	baseScript = "user-data-base/base.sh"
+	// userDataBoundary separates the parts of the user data, as in the
+	// cloudinit_config of the Terraform module.
+	userDataBoundary = "MIMEBOUNDARY"
+)
+
+// ErrScriptNotFound is returned for a script that does not exist.
+var ErrScriptNotFound = errors.New("script not found")
+
+// userScript returns the key of the user script name.
+func userScript(name string) string {
+	return "user-data-scripts/" + name + ".sh"
+}
+
+// Scripts holds the shell scripts instances run at boot, by key: the base
+// script in user-data-base/base.sh and the user scripts in
+// user-data-scripts/NAME.sh. S3Scripts reads them from the bucket the
+// Terraform module uploads them to, StaticScripts holds them in memory.
+type Scripts interface {
+	// Script returns the script at key, or ErrScriptNotFound.
+	Script(ctx context.Context, key string) (string, error)
+}
+
+// renderUserData returns the cloud-init user data of an instance named
+// hostname running the base script and then the user scripts names, with
+// ${hostname} replaced like Terraform's templatestring does.
+func renderUserData(ctx context.Context, scripts Scripts, hostname string, names []string) (string, error) {
+	keys := []string{baseScript}
+	for _, name := range names {
+		if name != "" {
+			keys = append(keys, userScript(name))
+		}
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	if err := w.SetBoundary(userDataBoundary); err != nil {
+		return "", err
+	}
+	template := strings.NewReplacer("$${", "${", "%%{", "%{", "${hostname}", hostname)
+	for _, key := range keys {
+		script, err := scripts.Script(ctx, key)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", key, err)
+		}
+
+		_, filename, _ := strings.Cut(key, "/")
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", filename)},
+			"Content-Transfer-Encoding": {"7bit"},
+			"Content-Type":              {"text/x-shellscript"},
+			"Mime-Version":              {"1.0"},
+		})
+		if err != nil {
+			return "", err
+		}
+		if _, err := io.WriteString(part, template.Replace(script)); err != nil {
+			return "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Content-Type: multipart/mixed; boundary=%q\r\nMIME-Version: 1.0\r\n\r\n", userDataBoundary) + body.String(), nil
+}
+
+var _ Scripts = StaticScripts(nil)
+
+// StaticScripts is a Scripts holding the scripts by key.
+type StaticScripts map[string]string
+
+func (s StaticScripts) Script(_ context.Context, key string) (string, error) {
+	script, ok := s[key]
+	if !ok {
+		return "", ErrScriptNotFound
+	}
+	return script, nil
+}
+
+// S3API is the subset of the S3 API that S3Scripts depends on.
+type S3API interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+var (
+	_ S3API   = (*s3.Client)(nil)
+	_ Scripts = (*S3Scripts)(nil)
+)
+
+// S3Scripts reads the scripts from an Amazon S3 bucket.
+type S3Scripts struct {
+	client S3API
+	bucket string
+}
+
+// NewS3Scripts returns an S3Scripts reading from bucket through client.
+func NewS3Scripts(client S3API, bucket string) *S3Scripts {
+	return &S3Scripts{client: client, bucket: bucket}
+}
+
+func (s *S3Scripts) Script(ctx context.Context, key string) (string, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchKey" {
+			return "", ErrScriptNotFound
+		}
+		return "", err
+	}
+	defer out.Body.Close()
+
+	script, err := io.ReadAll(out.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(script), nil
+}
@@ -0,0 +1,64 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// stubS3 answers GetObject with the objects of a single bucket.
+type stubS3 map[string]string
+
+func (s stubS3) GetObject(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if aws.ToString(params.Bucket) != "scripts" {
+		return nil, &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"}
+	}
+	body, ok := s[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &types.NoSuchKey{Message: aws.String("The specified key does not exist.")}
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(body))}, nil
+}
+
+func TestS3Scripts(t *testing.T) {
+	objects := stubS3{baseScript: "#!/bin/sh\nhostname ${hostname}\n"}
+
+	tests := []struct {
+		name   string
+		bucket string
+		key    string
+		want   string
+		err    error
+	}{
+		{"found", "scripts", baseScript, objects[baseScript], nil},
+		{"missing", "scripts", userScript("docker"), "", ErrScriptNotFound},
+		{"denied", "other", baseScript, "", &smithy.GenericAPIError{Code: "AccessDenied"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := NewS3Scripts(objects, tt.bucket).Script(context.Background(), tt.key)
+			var apiErr smithy.APIError
+			switch {
+			case tt.err == nil && err != nil:
+				t.Fatalf("Script: %v", err)
+			case errors.As(tt.err, &apiErr):
+				var got smithy.APIError
+				if !errors.As(err, &got) || got.ErrorCode() != apiErr.ErrorCode() {
+					t.Fatalf("Script() = %v, want API error %s", err, apiErr.ErrorCode())
+				}
+			case !errors.Is(err, tt.err):
+				t.Fatalf("Script() = %v, want %v", err, tt.err)
+			}
+			if script != tt.want {
+				t.Errorf("Script() = %q, want %q", script, tt.want)
+			}
+		})
+	}
+}
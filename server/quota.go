@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/frgrisk/turbo-deploy/server/auth"
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/frgrisk/turbo-deploy/server/quota"
+	"github.com/gin-gonic/gin"
+)
+
+// checkQuota refuses to save data if that takes its creation user or one of
+// their teams over a quota.
+func (s *Server) checkQuota(ctx context.Context, data models.DynamoDBData) error {
+	if !s.quotas.Enabled() {
+		return nil
+	}
+
+	deployments, err := s.quotaDeployments(ctx, &data)
+	if err != nil {
+		return err
+	}
+	candidate := deployments[len(deployments)-1]
+
+	if problems := s.quotas.Check(deployments[:len(deployments)-1], candidate); len(problems) > 0 {
+		return &apiError{
+			status:  http.StatusForbidden,
+			code:    models.ErrCodeQuotaExceeded,
+			message: "Quota exceeded",
+			details: problems,
+		}
+	}
+
+	return nil
+}
+
+// quotaDeployments lists what every deployment counts against quotas. A
+// deployment counts the vCPUs of its server size or of the instance it is
+// running on, whichever is larger, so resizes in progress are not missed.
+// extra is appended last, counted at its own server size.
+func (s *Server) quotaDeployments(ctx context.Context, extra *models.DynamoDBData) ([]quota.Deployment, error) {
+	records, err := s.store.ListRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	instanceTypes, err := s.compute.DeployedInstanceTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make([]string, 0, len(records)+len(instanceTypes)+1)
+	for _, record := range records {
+		sizes = append(sizes, record.ServerSize)
+	}
+	for _, instanceType := range instanceTypes {
+		sizes = append(sizes, instanceType)
+	}
+	if extra != nil {
+		sizes = append(sizes, extra.ServerSize)
+	}
+	vcpus, err := s.compute.InstanceTypeVCPUs(ctx, sizes)
+	if err != nil {
+		return nil, err
+	}
+
+	deployments := make([]quota.Deployment, 0, len(records)+1)
+	for _, record := range records {
+		// deleted deployments free their quota right away
+		if record.Removed() {
+			continue
+		}
+		d := quotaDeployment(record, vcpus)
+		d.VCPUs = max(d.VCPUs, vcpus[instanceTypes[record.ID]])
+		deployments = append(deployments, d)
+	}
+	if extra != nil {
+		deployments = append(deployments, quotaDeployment(*extra, vcpus))
+	}
+
+	return deployments, nil
+}
+
+func quotaDeployment(record models.DynamoDBData, vcpus map[string]int) quota.Deployment {
+	return quota.Deployment{
+		ID:         record.ID,
+		User:       record.CreationUser,
+		ServerSize: record.ServerSize,
+		VCPUs:      vcpus[record.ServerSize],
+		OnDemand:   record.Lifecycle != "spot",
+	}
+}
+
+// GetQuota returns the quota limits and usage of the caller and their teams.
+// Admins may ask for another user with the user query parameter, as may
+// anyone when authentication is disabled.
+func (s *Server) GetQuota(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	user := c.Query("user")
+	if identity, ok := auth.FromContext(ctx); ok {
+		switch {
+		case user == "":
+			user = identity.User
+		case !strings.EqualFold(user, identity.User) && !s.policy.IsAdmin(identity):
+			respondWithError(c, newAPIError(http.StatusForbidden, models.ErrCodeForbidden, "Only admins may see the quota of other users"))
+			return
+		}
+	}
+
+	deployments, err := s.quotaDeployments(ctx, nil)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, s.quotas.Status(user, deployments))
+}
@@ -0,0 +1,194 @@
+// Package quota decides whether a deployment fits the quotas configured for
+// its user and the teams they belong to.
+//
+// Usage is counted over every deployment of the user, or of every member of
+// the team. A change is refused when it takes usage over a limit, changes
+// that keep or lower usage are allowed even if it is already over a limit,
+// e.g. because the limit was lowered since.
+package quota
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/frgrisk/turbo-deploy/server/config"
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+// Deployment is what a deployment counts against quotas.
+type Deployment struct {
+	ID         string
+	User       string
+	ServerSize string
+	VCPUs      int
+	OnDemand   bool
+}
+
+// Quotas evaluates deployments against the configured quotas.
+type Quotas struct {
+	cfg config.QuotaConfig
+}
+
+// New returns the quotas configured by cfg.
+func New(cfg config.QuotaConfig) *Quotas {
+	return &Quotas{cfg: cfg}
+}
+
+// Enabled reports whether any limit is configured.
+func (q *Quotas) Enabled() bool {
+	if !q.cfg.Default.Unlimited() {
+		return true
+	}
+	return slices.ContainsFunc(q.cfg.Users, func(u config.UserQuota) bool { return !u.Unlimited() }) ||
+		slices.ContainsFunc(q.cfg.Teams, func(t config.TeamQuota) bool { return !t.Unlimited() })
+}
+
+// Limits returns the limits of user, their own or the default ones.
+func (q *Quotas) Limits(user string) config.QuotaLimits {
+	for _, u := range q.cfg.Users {
+		if sameUser(u.User, user) {
+			return u.QuotaLimits
+		}
+	}
+	return q.cfg.Default
+}
+
+// Teams returns the teams user is a member of.
+func (q *Quotas) Teams(user string) []config.TeamQuota {
+	var teams []config.TeamQuota
+	for _, team := range q.cfg.Teams {
+		if isMember(team, user) {
+			teams = append(teams, team)
+		}
+	}
+	return teams
+}
+
+// Check returns the limits broken by saving deployment, given the
+// deployments that exist now. A deployment with the same ID is replaced.
+func (q *Quotas) Check(deployments []Deployment, deployment Deployment) []models.FieldError {
+	var existing *Deployment
+	after := make([]Deployment, 0, len(deployments)+1)
+	for i := range deployments {
+		if deployments[i].ID == deployment.ID {
+			existing = &deployments[i]
+			continue
+		}
+		after = append(after, deployments[i])
+	}
+	after = append(after, deployment)
+
+	// a size already in use stays allowed
+	newSize := existing == nil || existing.ServerSize != deployment.ServerSize
+
+	owner := func(user string) bool { return sameUser(user, deployment.User) }
+	scope := "user " + cmp.Or(deployment.User, "(anonymous)")
+	problems := exceeded(scope, q.Limits(deployment.User), Usage(deployments, owner), Usage(after, owner))
+	if newSize {
+		problems = append(problems, sizeNotAllowed(scope, q.Limits(deployment.User), deployment.ServerSize)...)
+	}
+
+	for _, team := range q.Teams(deployment.User) {
+		member := func(user string) bool { return isMember(team, user) }
+		scope := "team " + team.Name
+		problems = append(problems, exceeded(scope, team.QuotaLimits, Usage(deployments, member), Usage(after, member))...)
+		if newSize {
+			problems = append(problems, sizeNotAllowed(scope, team.QuotaLimits, deployment.ServerSize)...)
+		}
+	}
+
+	return problems
+}
+
+// Status returns the limits and usage of user and their teams.
+func (q *Quotas) Status(user string, deployments []Deployment) models.Quota {
+	status := models.Quota{
+		User:   user,
+		Limits: limitsModel(q.Limits(user)),
+		Usage:  Usage(deployments, func(u string) bool { return sameUser(u, user) }),
+		Teams:  []models.TeamQuota{},
+	}
+	for _, team := range q.Teams(user) {
+		status.Teams = append(status.Teams, models.TeamQuota{
+			Name:    team.Name,
+			Members: team.Members,
+			Limits:  limitsModel(team.QuotaLimits),
+			Usage:   Usage(deployments, func(u string) bool { return isMember(team, u) }),
+		})
+	}
+	return status
+}
+
+// Usage sums the deployments of the users for which counted returns true.
+func Usage(deployments []Deployment, counted func(user string) bool) models.QuotaUsage {
+	var usage models.QuotaUsage
+	for _, d := range deployments {
+		if !counted(d.User) {
+			continue
+		}
+		usage.Deployments++
+		usage.VCPUs += d.VCPUs
+		if d.OnDemand {
+			usage.OnDemand++
+		}
+	}
+	return usage
+}
+
+// exceeded reports the limits that usage goes over by growing from before to
+// after.
+func exceeded(scope string, limits config.QuotaLimits, before, after models.QuotaUsage) []models.FieldError {
+	var problems []models.FieldError
+	for _, check := range []struct {
+		field         string
+		what          string
+		limit         int
+		before, after int
+	}{
+		{"maxDeployments", "deployments", limits.MaxDeployments, before.Deployments, after.Deployments},
+		{"maxVcpus", "vCPUs", limits.MaxVCPUs, before.VCPUs, after.VCPUs},
+		{"maxOnDemand", "on-demand deployments", limits.MaxOnDemand, before.OnDemand, after.OnDemand},
+	} {
+		if check.limit > 0 && check.after > check.limit && check.after > check.before {
+			problems = append(problems, models.FieldError{
+				Field:   check.field,
+				Message: fmt.Sprintf("%s would have %d %s, the limit is %d", scope, check.after, check.what, check.limit),
+			})
+		}
+	}
+	return problems
+}
+
+func sizeNotAllowed(scope string, limits config.QuotaLimits, serverSize string) []models.FieldError {
+	if len(limits.ServerSizes) == 0 || slices.Contains(limits.ServerSizes, serverSize) {
+		return nil
+	}
+	return []models.FieldError{{
+		Field:   "serverSize",
+		Message: fmt.Sprintf("%s may not deploy %s, allowed server sizes are %s", scope, serverSize, strings.Join(limits.ServerSizes, ", ")),
+	}}
+}
+
+func limitsModel(limits config.QuotaLimits) models.QuotaLimits {
+	serverSizes := limits.ServerSizes
+	if serverSizes == nil {
+		serverSizes = []string{}
+	}
+	return models.QuotaLimits{
+		MaxDeployments: limits.MaxDeployments,
+		MaxVCPUs:       limits.MaxVCPUs,
+		MaxOnDemand:    limits.MaxOnDemand,
+		ServerSizes:    serverSizes,
+	}
+}
+
+func isMember(team config.TeamQuota, user string) bool {
+	return slices.ContainsFunc(team.Members, func(member string) bool { return sameUser(member, user) })
+}
+
+// sameUser compares user names ignoring case, as e-mail addresses are.
+func sameUser(a, b string) bool {
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
@@ -0,0 +1,88 @@
+package quota
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/frgrisk/turbo-deploy/server/config"
+)
+
+func TestCheck(t *testing.T) {
+	q := New(config.QuotaConfig{
+		Default: config.QuotaLimits{MaxDeployments: 2, MaxVCPUs: 4, ServerSizes: []string{"t3.small", "t3.large"}},
+		Users: []config.UserQuota{
+			{User: "Boss@example.com", QuotaLimits: config.QuotaLimits{MaxDeployments: 10}},
+		},
+		Teams: []config.TeamQuota{
+			{Name: "data", Members: []string{"alice@example.com", "bob@example.com"}, QuotaLimits: config.QuotaLimits{MaxOnDemand: 1}},
+		},
+	})
+
+	small := func(id, user string) Deployment {
+		return Deployment{ID: id, User: user, ServerSize: "t3.small", VCPUs: 2}
+	}
+	existing := []Deployment{
+		small("a1", "alice@example.com"),
+		{ID: "b1", User: "bob@example.com", ServerSize: "t3.small", VCPUs: 2, OnDemand: true},
+	}
+
+	tests := []struct {
+		name        string
+		deployments []Deployment
+		deployment  Deployment
+		fields      []string
+	}{
+		{"within the default", existing, small("a2", "alice@example.com"), nil},
+		{"over deployments and vCPUs", append(slices.Clone(existing), small("a2", "alice@example.com")), small("a3", "alice@example.com"), []string{"maxDeployments", "maxVcpus"}},
+		{"server size not allowed", existing, Deployment{ID: "a2", User: "alice@example.com", ServerSize: "m5.large", VCPUs: 2}, []string{"serverSize"}},
+		{"team over on-demand", existing, Deployment{ID: "a2", User: "alice@example.com", ServerSize: "t3.small", VCPUs: 2, OnDemand: true}, []string{"maxOnDemand"}},
+		{"other team members do not count", existing, Deployment{ID: "c1", User: "carol@example.com", ServerSize: "t3.small", VCPUs: 2, OnDemand: true}, nil},
+		{"user limits replace the default, ignoring case", []Deployment{small("x1", "boss@example.com"), small("x2", "boss@example.com")}, small("x3", " BOSS@example.com"), nil},
+		{"replacing a deployment is not counted twice", existing, Deployment{ID: "a1", User: "alice@example.com", ServerSize: "t3.large", VCPUs: 2}, nil},
+		{"growing a deployment over the vCPU limit", existing, Deployment{ID: "a1", User: "alice@example.com", ServerSize: "t3.large", VCPUs: 6}, []string{"maxVcpus"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fields []string
+			for _, problem := range q.Check(tt.deployments, tt.deployment) {
+				fields = append(fields, problem.Field)
+			}
+			if !slices.Equal(fields, tt.fields) {
+				t.Errorf("Check() reported %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestCheckAllowsChangesThatKeepUsage(t *testing.T) {
+	// the limits were lowered after alice deployed
+	q := New(config.QuotaConfig{
+		Default: config.QuotaLimits{MaxDeployments: 1, MaxVCPUs: 2, ServerSizes: []string{"t3.small"}},
+	})
+	deployments := []Deployment{
+		{ID: "a1", User: "alice", ServerSize: "t3.xlarge", VCPUs: 4},
+		{ID: "a2", User: "alice", ServerSize: "t3.small", VCPUs: 2},
+	}
+
+	// editing a deployment without growing it or changing its size is allowed
+	if problems := q.Check(deployments, Deployment{ID: "a1", User: "alice", ServerSize: "t3.xlarge", VCPUs: 4}); len(problems) != 0 {
+		t.Errorf("Check() of an unchanged deployment = %v, want none", problems)
+	}
+	// shrinking it is allowed too, even if usage stays over the limit
+	if problems := q.Check(deployments, Deployment{ID: "a1", User: "alice", ServerSize: "t3.small", VCPUs: 2}); len(problems) != 0 {
+		t.Errorf("Check() of a shrunk deployment = %v, want none", problems)
+	}
+	// but not another deployment
+	if problems := q.Check(deployments, Deployment{ID: "a3", User: "alice", ServerSize: "t3.small", VCPUs: 2}); len(problems) != 2 {
+		t.Errorf("Check() of a new deployment = %v, want maxDeployments and maxVcpus", problems)
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	if New(config.QuotaConfig{}).Enabled() {
+		t.Error("Enabled() without limits = true")
+	}
+	if !New(config.QuotaConfig{Teams: []config.TeamQuota{{Name: "data", QuotaLimits: config.QuotaLimits{MaxVCPUs: 8}}}}).Enabled() {
+		t.Error("Enabled() with a team limit = false")
+	}
+}
@@ -0,0 +1,237 @@
+// Package reaper enforces the TimeToExpire of deployments.
+//
+// A deployment is expired once its TimeToExpire, plus the grace period, has
+// passed. The record is authoritative when there is one, instances whose
+// record is gone fall back to their TimeToExpire tag. A TimeToExpire of zero
+// never expires.
+//
+// Every expired deployment is reaped in the same order: its instance is
+// optionally captured in a final image, which is waited for until it is
+// available, then the deployment is marked deleting, the same as deleting it
+// through the API. The provisioner then
+// terminates its instance, unregisters its hostname and removes the record
+// once the deleted retention has passed. Deployments that are already
+// deleting or deleted are left to it. Only instances without a record are
+// terminated by the reaper itself.
+package reaper
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/instance"
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+// Options control a run of the reaper.
+type Options struct {
+	// DryRun reports what would be reaped without changing anything.
+	DryRun bool
+	// GracePeriod is how long past its expiry a deployment is kept.
+	GracePeriod time.Duration
+	// FinalSnapshot captures an image of every instance before it is
+	// terminated. A deployment whose image fails, or is not available
+	// within ImageTimeout, is not reaped.
+	FinalSnapshot bool
+	// ImageTimeout is how long a final image may stay pending, 10 minutes
+	// if zero.
+	ImageTimeout time.Duration
+	// ImagePollInterval is how often a pending final image is checked, 15
+	// seconds if zero.
+	ImagePollInterval time.Duration
+	// Now returns the current time, time.Now if nil.
+	Now func() time.Time
+}
+
+// defaultImageTimeout is how long a final image may stay pending by default.
+const defaultImageTimeout = 10 * time.Minute
+
+// Reaper removes expired deployments.
+type Reaper struct {
+	store   db.DeploymentStore
+	compute *instance.Service
+	opts    Options
+}
+
+// New returns a Reaper that marks the expired deployments in store deleting
+// and terminates instances without a record through compute.
+func New(store db.DeploymentStore, compute *instance.Service, opts Options) *Reaper {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	if opts.ImageTimeout <= 0 {
+		opts.ImageTimeout = defaultImageTimeout
+	}
+	return &Reaper{store: store, compute: compute, opts: opts}
+}
+
+// Report lists what a run reaped, or would have reaped in a dry run.
+type Report struct {
+	DryRun bool     `json:"dryRun"`
+	Reaped []Reaped `json:"reaped"`
+}
+
+// Reaped describes an expired deployment.
+type Reaped struct {
+	DeploymentID string    `json:"deploymentId"`
+	InstanceID   string    `json:"instanceId,omitempty"`
+	Hostname     string    `json:"hostname,omitempty"`
+	CreationUser string    `json:"creationUser,omitempty"`
+	ExpiredAt    time.Time `json:"expiredAt"`
+	SnapshotID   string    `json:"snapshotId,omitempty"`
+	// Error is set if the deployment could not be reaped completely.
+	Error string `json:"error,omitempty"`
+}
+
+// expired is a deployment found to be expired, with its record and instance
+// if it has them.
+type expired struct {
+	id        string
+	expiredAt time.Time
+	record    *models.DynamoDBData
+	instance  *models.DeploymentResponse
+}
+
+// Run reaps every expired deployment, in deployment ID order. The returned
+// error joins the failures of single deployments, which are also reported
+// in the Report.
+func (r *Reaper) Run(ctx context.Context) (Report, error) {
+	report := Report{DryRun: r.opts.DryRun, Reaped: []Reaped{}}
+
+	candidates, err := r.find(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	var errs []error
+	for _, candidate := range candidates {
+		reaped := Reaped{
+			DeploymentID: candidate.id,
+			ExpiredAt:    candidate.expiredAt,
+		}
+		if candidate.record != nil {
+			reaped.Hostname = candidate.record.Hostname
+			reaped.CreationUser = candidate.record.CreationUser
+		}
+		if candidate.instance != nil {
+			reaped.InstanceID = candidate.instance.InstanceID
+			reaped.Hostname = cmp.Or(reaped.Hostname, candidate.instance.Hostname)
+		}
+
+		if !r.opts.DryRun {
+			if err := r.reap(ctx, candidate, &reaped); err != nil {
+				reaped.Error = err.Error()
+				errs = append(errs, fmt.Errorf("deployment %s: %w", candidate.id, err))
+			}
+		}
+		report.Reaped = append(report.Reaped, reaped)
+	}
+
+	return report, errors.Join(errs...)
+}
+
+// find returns the expired deployments sorted by ID.
+func (r *Reaper) find(ctx context.Context) ([]expired, error) {
+	records, err := r.store.ListRecords(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployment records: %w", err)
+	}
+	// spot instances only carry the tags of their request until populated
+	if err := r.compute.PopulateSpotTagResponse(ctx); err != nil {
+		return nil, fmt.Errorf("failed to populate tags for deployed instances: %w", err)
+	}
+	instances, err := r.compute.GetDeployedInstances(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployed instances: %w", err)
+	}
+
+	deployments := make(map[string]*expired, len(records)+len(instances))
+	for i := range records {
+		deployments[records[i].ID] = &expired{
+			id:        records[i].ID,
+			expiredAt: expiry(records[i].TimeToExpire),
+			record:    &records[i],
+		}
+	}
+	for i := range instances {
+		id := instances[i].DeploymentID
+		if id == "" {
+			continue
+		}
+		d, ok := deployments[id]
+		if !ok {
+			ttl, err := strconv.ParseInt(instances[i].TimeToExpire, 10, 64)
+			if err != nil {
+				log.Printf("reaper: instance %s has no valid TimeToExpire tag %q, skipping", instances[i].InstanceID, instances[i].TimeToExpire)
+				continue
+			}
+			d = &expired{id: id, expiredAt: expiry(ttl)}
+			deployments[id] = d
+		}
+		d.instance = &instances[i]
+	}
+
+	deadline := r.opts.Now().Add(-r.opts.GracePeriod)
+	var found []expired
+	for _, d := range deployments {
+		// deleting and deleted deployments are already being removed
+		if d.record != nil && d.record.Removed() {
+			continue
+		}
+		if !d.expiredAt.IsZero() && !d.expiredAt.After(deadline) {
+			found = append(found, *d)
+		}
+	}
+	slices.SortFunc(found, func(a, b expired) int { return cmp.Compare(a.id, b.id) })
+
+	return found, nil
+}
+
+// reap snapshots a single deployment and marks it deleting, or terminates
+// its instance if it has no record, filling in reaped as it goes. The final
+// image must be available first, the instance may be terminated as soon as
+// the deployment is deleting.
+func (r *Reaper) reap(ctx context.Context, d expired, reaped *Reaped) error {
+	if r.opts.FinalSnapshot && d.instance != nil {
+		imageID, err := r.compute.CaptureInstanceImage(ctx, d.id, d.instance.InstanceID)
+		if err != nil {
+			return fmt.Errorf("failed to capture final image, not reaped: %w", err)
+		}
+		reaped.SnapshotID = imageID
+		if err := r.compute.WaitForImage(ctx, imageID, r.opts.ImagePollInterval, r.opts.ImageTimeout); err != nil {
+			return fmt.Errorf("final image not completed, not reaped: %w", err)
+		}
+	}
+
+	switch {
+	case d.record != nil:
+		// a record removed meanwhile leaves an orphan, which the provisioner
+		// terminates as well
+		err := r.store.SetStatus(ctx, d.id, models.StatusDeleting, "", r.opts.Now().Unix())
+		if err != nil && !errors.Is(err, db.ErrURLNotFound) {
+			return fmt.Errorf("failed to mark deployment deleting: %w", err)
+		}
+	case d.instance != nil:
+		if err := r.compute.TerminateInstance(ctx, d.id, d.instance.InstanceID); err != nil {
+			return fmt.Errorf("failed to terminate instance %s: %w", d.instance.InstanceID, err)
+		}
+	}
+
+	log.Printf("reaper: reaped deployment %s, expired at %s", d.id, d.expiredAt.Format(time.RFC3339))
+	return nil
+}
+
+// expiry converts a TimeToExpire in Unix seconds, zero for never.
+func expiry(ttl int64) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(ttl, 0).UTC()
+}
@@ -0,0 +1,264 @@
+package reaper
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/instance"
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+func TestRun(t *testing.T) {
+	// the in-memory store drops records once their TTL passes, so the
+	// deployments expire later today and the reaper runs tomorrow
+	now := time.Now()
+	runAt := now.Add(24 * time.Hour)
+	expiredAt := now.Add(time.Hour).Unix()
+	withinGrace := runAt.Add(-30 * time.Minute).Unix()
+
+	tests := []struct {
+		name   string
+		opts   Options
+		reaped []string
+		// deleting are the deployments marked deleting, terminated the
+		// instances terminated by the reaper itself
+		deleting   []string
+		terminated []string
+		snapshots  bool
+	}{
+		{"grace period", Options{GracePeriod: time.Hour}, []string{"expired", "orphan"}, []string{"expired"}, []string{"orphan"}, false},
+		{"no grace period", Options{}, []string{"expired", "grace", "orphan"}, []string{"expired", "grace"}, []string{"orphan"}, false},
+		{"dry run", Options{DryRun: true, GracePeriod: time.Hour, FinalSnapshot: true}, []string{"expired", "orphan"}, nil, nil, false},
+		{"final snapshot", Options{GracePeriod: time.Hour, FinalSnapshot: true}, []string{"expired", "orphan"}, []string{"expired"}, []string{"orphan"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := db.NewMemoryStore()
+			provider := instance.NewFakeProvider()
+			provider.TransitionDelay = 0
+
+			deploy := func(record models.DynamoDBData, withRecord bool) string {
+				if withRecord {
+					if _, err := store.SaveRecord(ctx, record); err != nil {
+						t.Fatalf("SaveRecord: %v", err)
+					}
+				}
+				return provider.RunInstance(instance.FakeInstanceSpec{
+					ImageID:      "ami-1",
+					InstanceType: "t3.small",
+					Tags: map[string]string{
+						"Name":         record.Hostname,
+						"DeployedBy":   "turbo-deploy",
+						"DeploymentID": record.ID,
+						"TimeToExpire": strconv.FormatInt(record.TimeToExpire, 10),
+					},
+				})
+			}
+			instances := map[string]string{
+				"expired":  deploy(models.DynamoDBData{ID: "expired", Hostname: "expired", TimeToExpire: expiredAt, Status: models.StatusRunning}, true),
+				"grace":    deploy(models.DynamoDBData{ID: "grace", Hostname: "grace", TimeToExpire: withinGrace, Status: models.StatusRunning}, true),
+				"live":     deploy(models.DynamoDBData{ID: "live", Hostname: "live", TimeToExpire: runAt.Add(time.Hour).Unix(), Status: models.StatusRunning}, true),
+				"forever":  deploy(models.DynamoDBData{ID: "forever", Hostname: "forever", Status: models.StatusRunning}, true),
+				"deleting": deploy(models.DynamoDBData{ID: "deleting", Hostname: "deleting", TimeToExpire: expiredAt, Status: models.StatusDeleting}, true),
+				"orphan":   deploy(models.DynamoDBData{ID: "orphan", Hostname: "orphan", TimeToExpire: expiredAt}, false),
+			}
+
+			opts := tt.opts
+			opts.Now = func() time.Time { return runAt }
+			report, err := New(store, instance.NewService(provider), opts).Run(ctx)
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+
+			var reaped []string
+			for _, r := range report.Reaped {
+				reaped = append(reaped, r.DeploymentID)
+				if r.InstanceID != instances[r.DeploymentID] {
+					t.Errorf("%s reported instance %s, want %s", r.DeploymentID, r.InstanceID, instances[r.DeploymentID])
+				}
+				if (r.SnapshotID != "") != tt.snapshots {
+					t.Errorf("%s reported snapshot %q, want one: %v", r.DeploymentID, r.SnapshotID, tt.snapshots)
+				}
+			}
+			if !slices.Equal(reaped, tt.reaped) {
+				t.Errorf("Run reaped %v, want %v", reaped, tt.reaped)
+			}
+
+			for _, id := range []string{"expired", "grace", "live", "forever"} {
+				record, err := store.GetRecord(ctx, id)
+				if err != nil {
+					t.Fatalf("GetRecord(%s): %v", id, err)
+				}
+				want := models.StatusRunning
+				if slices.Contains(tt.deleting, id) {
+					want = models.StatusDeleting
+				}
+				if record.Status != want {
+					t.Errorf("%s is %s, want %s", id, record.Status, want)
+				}
+			}
+
+			for id, instanceID := range instances {
+				out, err := provider.DescribeInstances(ctx, &ec2.DescribeInstancesInput{InstanceIds: []string{instanceID}})
+				if err != nil {
+					t.Fatalf("DescribeInstances: %v", err)
+				}
+				want := types.InstanceStateNameRunning
+				if slices.Contains(tt.terminated, id) {
+					want = types.InstanceStateNameTerminated
+				}
+				if got := out.Reservations[0].Instances[0].State.Name; got != want {
+					t.Errorf("instance of %s is %s, want %s", id, got, want)
+				}
+			}
+		})
+	}
+}
+
+// imageWatcher runs observe with the deployment of every image described by
+// ID through the FakeProvider it wraps.
+type imageWatcher struct {
+	*instance.FakeProvider
+	observe func(deploymentID string)
+}
+
+func (w *imageWatcher) DescribeImages(ctx context.Context, params *ec2.DescribeImagesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+	out, err := w.FakeProvider.DescribeImages(ctx, params, optFns...)
+	if err == nil && len(params.ImageIds) > 0 {
+		for _, image := range out.Images {
+			for _, tag := range image.Tags {
+				if aws.ToString(tag.Key) == "DeploymentID" {
+					w.observe(aws.ToString(tag.Value))
+				}
+			}
+		}
+	}
+	return out, err
+}
+
+func TestRunWaitsForFinalSnapshot(t *testing.T) {
+	now := time.Now()
+	runAt := now.Add(24 * time.Hour)
+
+	tests := []struct {
+		name string
+		// settle is how long the final image stays pending
+		settle  time.Duration
+		reaped  bool
+		wantErr bool
+	}{
+		{"available", 50 * time.Millisecond, true, false},
+		{"still pending", time.Hour, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := db.NewMemoryStore()
+			provider := instance.NewFakeProvider()
+			provider.TransitionDelay = 0
+
+			records := map[string]models.DynamoDBData{
+				"expired": {ID: "expired", Hostname: "expired", TimeToExpire: now.Add(time.Hour).Unix(), Status: models.StatusRunning},
+				"orphan":  {ID: "orphan", Hostname: "orphan", TimeToExpire: now.Add(time.Hour).Unix()},
+			}
+			instances := make(map[string]string, len(records))
+			for id, record := range records {
+				if id != "orphan" {
+					if _, err := store.SaveRecord(ctx, record); err != nil {
+						t.Fatalf("SaveRecord: %v", err)
+					}
+				}
+				instances[id] = provider.RunInstance(instance.FakeInstanceSpec{
+					ImageID:      "ami-1",
+					InstanceType: "t3.small",
+					Tags: map[string]string{
+						"Name":         record.Hostname,
+						"DeployedBy":   "turbo-deploy",
+						"DeploymentID": id,
+						"TimeToExpire": strconv.FormatInt(record.TimeToExpire, 10),
+					},
+				})
+			}
+			// the instances are running, the images captured from now on
+			// stay pending for settle
+			if _, err := provider.DescribeInstances(ctx, &ec2.DescribeInstancesInput{}); err != nil {
+				t.Fatalf("DescribeInstances: %v", err)
+			}
+			provider.TransitionDelay = tt.settle
+
+			// while the final image of a deployment is checked, it may not
+			// be deleting and its instance not terminated yet
+			checks := make(map[string]int)
+			watcher := &imageWatcher{FakeProvider: provider, observe: func(id string) {
+				checks[id]++
+				if record, err := store.GetRecord(ctx, id); err == nil && record.Status != models.StatusRunning {
+					t.Errorf("%s is %s while its final image is checked", id, record.Status)
+				}
+				out, err := provider.DescribeInstances(ctx, &ec2.DescribeInstancesInput{InstanceIds: []string{instances[id]}})
+				if err != nil {
+					t.Errorf("DescribeInstances: %v", err)
+				} else if state := out.Reservations[0].Instances[0].State.Name; state != types.InstanceStateNameRunning {
+					t.Errorf("instance of %s is %s while its final image is checked", id, state)
+				}
+			}}
+
+			report, err := New(store, instance.NewService(watcher), Options{
+				FinalSnapshot:     true,
+				ImageTimeout:      200 * time.Millisecond,
+				ImagePollInterval: 10 * time.Millisecond,
+				Now:               func() time.Time { return runAt },
+			}).Run(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run error %v, want one: %v", err, tt.wantErr)
+			}
+			for id := range records {
+				// a pending image is checked at least twice
+				if checks[id] < 2 {
+					t.Errorf("the final image of %s was checked %d times, want it waited for", id, checks[id])
+				}
+			}
+
+			for _, r := range report.Reaped {
+				if r.SnapshotID == "" {
+					t.Errorf("%s reported no snapshot", r.DeploymentID)
+				}
+				if (r.Error == "") != tt.reaped {
+					t.Errorf("%s reported error %q, want reaped: %v", r.DeploymentID, r.Error, tt.reaped)
+				}
+			}
+
+			record, err := store.GetRecord(ctx, "expired")
+			if err != nil {
+				t.Fatalf("GetRecord: %v", err)
+			}
+			wantStatus := models.StatusRunning
+			if tt.reaped {
+				wantStatus = models.StatusDeleting
+			}
+			if record.Status != wantStatus {
+				t.Errorf("expired is %s, want %s", record.Status, wantStatus)
+			}
+
+			out, err := provider.DescribeInstances(ctx, &ec2.DescribeInstancesInput{InstanceIds: []string{instances["orphan"]}})
+			if err != nil {
+				t.Fatalf("DescribeInstances: %v", err)
+			}
+			wantState := types.InstanceStateNameRunning
+			if tt.reaped {
+				wantState = types.InstanceStateNameShuttingDown
+			}
+			if got := out.Reservations[0].Instances[0].State.Name; got != wantState && !(tt.reaped && got == types.InstanceStateNameTerminated) {
+				t.Errorf("instance of orphan is %s, want %s", got, wantState)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"slices"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/frgrisk/turbo-deploy/server/provisioner"
+)
+
+// provisionedAttributes are the attributes of deployment records the
+// provisioner applies to instances. Writes to any other attribute, such as
+// the expiry, sent warnings or stop reasons, do not reconcile a deployment.
+var provisionedAttributes = []string{"ami", "serverSize", "hostname", "lifecycle", "userData"}
+
+// Reconcile launches, updates and terminates instances to match the
+// deployment records, only those of deploymentIDs if any are given, as
+// configured by the provisioner section of the configuration.
+func (s *Server) Reconcile(ctx context.Context, dryRun bool, deploymentIDs ...string) (provisioner.Report, error) {
+	return provisioner.New(s.store, s.compute, s.backends, provisioner.Options{
+		DryRun:           dryRun,
+		DeploymentIDs:    deploymentIDs,
+		SubnetID:         s.cfg.Provisioner.SubnetID,
+		SecurityGroupID:  s.cfg.Provisioner.SecurityGroupID,
+		KeyName:          s.cfg.Provisioner.KeyName,
+		InstanceProfile:  s.cfg.Provisioner.InstanceProfile,
+		DeletedRetention: s.cfg.Provisioner.DeletedRetention,
+	}).Run(ctx)
+}
+
+// reconcileStream reconciles the deployments changed in a DynamoDB stream
+// batch. Failures are only logged: the deployments are marked failed and
+// retried by the next reconcile job, while a failed batch would be retried
+// by Lambda until it expires, holding up the stream.
+func (s *Server) reconcileStream(ctx context.Context, event events.DynamoDBEvent) (any, error) {
+	ids := changedDeployments(event)
+	if len(ids) == 0 {
+		return provisioner.Report{Changes: []provisioner.Change{}}, nil
+	}
+
+	report, err := s.Reconcile(ctx, false, ids...)
+	if err != nil {
+		log.Printf("reconcile: %v", err)
+	}
+	return report, nil
+}
+
+// changedDeployments returns the IDs of the deployments created or changed
+// through the API in a stream batch: created, moved to requested or deleting,
+// or with a provisioned attribute changed. Comparing needs the stream to
+// carry old images; without them every requested and deleting deployment is
+// returned.
+func changedDeployments(event events.DynamoDBEvent) []string {
+	var ids []string
+	for _, record := range event.Records {
+		change := record.Change
+		id, ok := change.Keys["id"]
+		if !ok || record.EventName == string(events.DynamoDBOperationTypeRemove) {
+			continue
+		}
+
+		status := imageStatus(change.NewImage)
+		pending := status == models.StatusRequested || status == models.StatusDeleting
+		var changed bool
+		switch {
+		case record.EventName == string(events.DynamoDBOperationTypeInsert):
+			changed = true
+		case change.OldImage == nil:
+			changed = pending
+		default:
+			changed = pending && imageStatus(change.OldImage) != status ||
+				slices.ContainsFunc(provisionedAttributes, func(name string) bool {
+					return !reflect.DeepEqual(change.OldImage[name], change.NewImage[name])
+				})
+		}
+
+		if changed && !slices.Contains(ids, id.String()) {
+			ids = append(ids, id.String())
+		}
+	}
+	return ids
+}
+
+// imageStatus returns the status in a stream image of a deployment record.
+func imageStatus(image map[string]events.DynamoDBAttributeValue) models.DeploymentStatus {
+	if value, ok := image["status"]; ok && value.DataType() == events.DataTypeString {
+		return models.DeploymentStatus(value.String())
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestChangedDeployments(t *testing.T) {
+	image := func(id, status, size string) map[string]events.DynamoDBAttributeValue {
+		item := map[string]events.DynamoDBAttributeValue{
+			"id":         events.NewStringAttribute(id),
+			"serverSize": events.NewStringAttribute(size),
+		}
+		if status != "" {
+			item["status"] = events.NewStringAttribute(status)
+			item["statusChangedAt"] = events.NewNumberAttribute("1000")
+		}
+		return item
+	}
+	change := func(name events.DynamoDBOperationType, id string, oldImage, newImage map[string]events.DynamoDBAttributeValue) events.DynamoDBEventRecord {
+		return events.DynamoDBEventRecord{
+			EventName: string(name),
+			Change: events.DynamoDBStreamRecord{
+				Keys:     map[string]events.DynamoDBAttributeValue{"id": events.NewStringAttribute(id)},
+				OldImage: oldImage,
+				NewImage: newImage,
+			},
+		}
+	}
+	// with adds attributes to a copy of item
+	with := func(item map[string]events.DynamoDBAttributeValue, name string, value events.DynamoDBAttributeValue) map[string]events.DynamoDBAttributeValue {
+		item = maps.Clone(item)
+		item[name] = value
+		return item
+	}
+	insert, modify, remove := events.DynamoDBOperationTypeInsert, events.DynamoDBOperationTypeModify, events.DynamoDBOperationTypeRemove
+
+	tests := []struct {
+		name    string
+		records []events.DynamoDBEventRecord
+		want    []string
+	}{
+		{"created", []events.DynamoDBEventRecord{change(insert, "a", nil, image("a", "requested", "t3.small"))}, []string{"a"}},
+		{"created before statuses", []events.DynamoDBEventRecord{change(insert, "a", nil, image("a", "", "t3.small"))}, []string{"a"}},
+		{"edited", []events.DynamoDBEventRecord{change(modify, "a", image("a", "running", "t3.small"), image("a", "requested", "t3.large"))}, []string{"a"}},
+		{"deleted", []events.DynamoDBEventRecord{change(modify, "a", image("a", "running", "t3.small"), image("a", "deleting", "t3.small"))}, []string{"a"}},
+		{"provisioned", []events.DynamoDBEventRecord{change(modify, "a", image("a", "provisioning", "t3.small"), image("a", "running", "t3.small"))}, nil},
+		{"failed", []events.DynamoDBEventRecord{change(modify, "a", image("a", "provisioning", "t3.small"), image("a", "failed", "t3.small"))}, nil},
+		{"resized while running", []events.DynamoDBEventRecord{change(modify, "a", image("a", "running", "t3.small"), image("a", "running", "t3.large"))}, []string{"a"}},
+		{"retried by an edit", []events.DynamoDBEventRecord{change(modify, "a", image("a", "failed", "t3.small"), image("a", "requested", "t3.small"))}, []string{"a"}},
+		{"extended", []events.DynamoDBEventRecord{change(modify, "a",
+			with(image("a", "failed", "t3.small"), "timeToExpire", events.NewNumberAttribute("1000")),
+			with(with(image("a", "failed", "t3.small"), "timeToExpire", events.NewNumberAttribute("2000")), "extendedBy", events.NewStringAttribute("alice")),
+		)}, nil},
+		{"warned", []events.DynamoDBEventRecord{change(modify, "a", image("a", "failed", "t3.small"),
+			with(image("a", "failed", "t3.small"), "warningsSent", events.NewStringSetAttribute([]string{"1h"})))}, nil},
+		{"stopped by the scheduler", []events.DynamoDBEventRecord{change(modify, "a", image("a", "running", "t3.small"),
+			with(image("a", "running", "t3.small"), "stopReason", events.NewStringAttribute("outside office hours")))}, nil},
+		{"snapshot while requested", []events.DynamoDBEventRecord{change(modify, "a", image("a", "requested", "t3.small"),
+			with(image("a", "requested", "t3.small"), "snapShot", events.NewStringAttribute("ami-2")))}, nil},
+		{"snapshot while deleting", []events.DynamoDBEventRecord{change(modify, "a", image("a", "deleting", "t3.small"),
+			with(image("a", "deleting", "t3.small"), "snapShot", events.NewStringAttribute("ami-2")))}, nil},
+		{"requested without the old image", []events.DynamoDBEventRecord{change(modify, "a", nil, image("a", "requested", "t3.large"))}, []string{"a"}},
+		{"running without the old image", []events.DynamoDBEventRecord{change(modify, "a", nil, image("a", "running", "t3.large"))}, nil},
+		{"removed", []events.DynamoDBEventRecord{change(remove, "a", image("a", "deleted", "t3.small"), nil)}, nil},
+		{"changed twice in a batch", []events.DynamoDBEventRecord{
+			change(insert, "a", nil, image("a", "requested", "t3.small")),
+			change(modify, "b", image("b", "running", "t3.small"), image("b", "deleting", "t3.small")),
+			change(modify, "a", image("a", "requested", "t3.small"), image("a", "requested", "t3.large")),
+		}, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := changedDeployments(events.DynamoDBEvent{Records: tt.records})
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("changedDeployments() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,839 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/frgrisk/turbo-deploy/server/openapi"
+	"github.com/gin-gonic/gin"
+)
+
+// route is an API route together with its documentation. SetupRoutes
+// registers the handlers and OpenAPISpec documents the same table, so the two
+// cannot drift apart.
+type route struct {
+	openapi.Route
+	handler gin.HandlerFunc
+	// authorize checks that the caller may use the route. Every route that
+	// creates or changes a deployment needs one.
+	authorize gin.HandlerFunc
+	// successor is the path of the route replacing a deprecated one. Path
+	// parameters are filled in from the request, on routes with an
+	// instanceParam :id is the deployment of the instance.
+	successor string
+	// instanceParam names the path parameter holding the instance ID on
+	// legacy routes that address an instance rather than a deployment.
+	instanceParam string
+	// readOnly routes change nothing although they are not GET routes, so
+	// they are not audited.
+	readOnly bool
+}
+
+const (
+	tagDeployments = "deployments"
+	tagSnapshots   = "snapshots"
+	tagCatalog     = "catalog"
+	tagAPIKeys     = "apikeys"
+	tagAudit       = "audit"
+	tagQuota       = "quota"
+	tagCosts       = "costs"
+	tagAdmin       = "admin"
+	tagLegacy      = "legacy"
+)
+
+func (s *Server) routes() []route {
+	routes := append(s.v1Routes(), s.legacyRoutes()...)
+	for i := range routes {
+		if routes[i].authorize != nil {
+			routes[i].Errors = append(routes[i].Errors, http.StatusForbidden)
+		}
+	}
+	return routes
+}
+
+// v1Routes are the resource oriented routes of version 1 of the API. Every
+// new route goes here, admin routes under /v1/admin, the unversioned legacy
+// routes only serve the web application and get no new ones.
+func (s *Server) v1Routes() []route {
+	return []route{
+		{
+			Route: openapi.Route{
+				Method:      http.MethodGet,
+				Path:        "/v1/deployments",
+				OperationID: "listDeployments",
+				Summary:     "List deployments and their instances",
+				Tag:         tagDeployments,
+				Response:    models.DeploymentList{},
+			},
+			handler: s.ListDeployments,
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodPost,
+				Path:        "/v1/deployments",
+				OperationID: "createDeployment",
+				Summary:     "Request a new deployment",
+				Description: "The instance is provisioned asynchronously, it is null until it has been launched.",
+				Tag:         tagDeployments,
+				Request:     models.DeploymentRequest{},
+				Response:    models.Deployment{},
+				Status:      http.StatusCreated,
+				Errors:      []int{http.StatusBadRequest, http.StatusConflict},
+			},
+			handler:   s.CreateDeployment,
+			authorize: s.requirePermission(models.PermissionCreate),
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodGet,
+				Path:        "/v1/deployments/:id",
+				OperationID: "getDeployment",
+				Summary:     "Get a deployment",
+				Tag:         tagDeployments,
+				Response:    models.Deployment{},
+				Errors:      []int{http.StatusNotFound},
+			},
+			handler: s.GetDeployment,
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodPut,
+				Path:        "/v1/deployments/:id",
+				OperationID: "updateDeployment",
+				Summary:     "Edit a deployment",
+				Tag:         tagDeployments,
+				Request:     models.DeploymentRequest{},
+				Response:    models.Deployment{},
+				Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+			},
+			handler:   s.UpdateDeployment,
+			authorize: s.requireAction(models.ActionEdit),
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodDelete,
+				Path:        "/v1/deployments/:id",
+				OperationID: "deleteDeployment",
+				Summary:     "Delete a deployment and terminate its instance",
+				Description: "The deployment is deleting until the provisioner has terminated its instance, and deleted for a day after.",
+				Tag:         tagDeployments,
+				Status:      http.StatusNoContent,
+				Errors:      []int{http.StatusNotFound},
+			},
+			handler:   s.DeleteDeployment,
+			authorize: s.requireAction(models.ActionDelete),
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodPost,
+				Path:        "/v1/deployments/:id/actions/start",
+				OperationID: "startDeployment",
+				Summary:     "Start the instance of a deployment",
+				Tag:         tagDeployments,
+				Status:      http.StatusAccepted,
+				Errors:      []int{http.StatusNotFound, http.StatusConflict},
+			},
+			handler:   s.StartDeployment,
+			authorize: s.requireAction(models.ActionStart),
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodPost,
+				Path:        "/v1/deployments/:id/actions/stop",
+				OperationID: "stopDeployment",
+				Summary:     "Stop the instance of a deployment",
+				Tag:         tagDeployments,
+				Status:      http.StatusAccepted,
+				Errors:      []int{http.StatusNotFound, http.StatusConflict},
+			},
+			handler:   s.StopDeployment,
+			authorize: s.requireAction(models.ActionStop),
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodPost,
+				Path:        "/v1/deployments/:id/actions/extend",
+				OperationID: "extendDeployment",
+				Summary:     "Extend or shorten the time to live of a deployment",
+				Description: "Moves the expiry by a duration or to a time, without editing the rest of the deployment. The expiry may not pass the configured maximum lifetime.",
+				Tag:         tagDeployments,
+				Request:     models.ExtendRequest{},
+				Response:    models.Expiry{},
+				Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+			},
+			handler:   s.ExtendDeployment,
+			authorize: s.requireAction(models.ActionEdit),
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodGet,
+				Path:        "/v1/deployments/:id/extend-link",
+				OperationID: "confirmExtendDeploymentByLink",
+				Summary:     "Confirm the extension of a deployment through the link in an expiry warning",
+				Description: "The link is signed by the server and authenticates the call. Responds with an HTML page whose button extends the deployment with a POST to the same link, following the link changes nothing.",
+				Tag:         tagDeployments,
+				Public:      true,
+				Query:       extendLinkParameters(),
+				Errors:      []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict},
+			},
+			handler: s.ConfirmExtendDeploymentByLink,
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodPost,
+				Path:        "/v1/deployments/:id/extend-link",
+				OperationID: "extendDeploymentByLink",
+				Summary:     "Extend a deployment through the link in an expiry warning",
+				Description: "The link is signed by the server and authenticates the call. It extends the deployment once, while it still expires at the time in the link.",
+				Tag:         tagDeployments,
+				Public:      true,
+				Query:       extendLinkParameters(),
+				Response:    models.Expiry{},
+				Errors:      []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict},
+			},
+			handler: s.ExtendDeploymentByLink,
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodPut,
+				Path:        "/v1/deployments/:id/schedule",
+				OperationID: "setDeploymentSchedule",
+				Summary:     "Run a deployment on an office-hours schedule",
+				Description: "The scheduler job starts the instance within the windows of the schedule and stops it outside them. Replaces the current schedule. Fails with 409 for spot deployments, whose instances cannot be stopped.",
+				Tag:         tagDeployments,
+				Request:     models.Schedule{},
+				Response:    models.Deployment{},
+				Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+			},
+			handler:   s.SetSchedule,
+			authorize: s.requireAction(models.ActionEdit),
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodDelete,
+				Path:        "/v1/deployments/:id/schedule",
+				OperationID: "deleteDeploymentSchedule",
+				Summary:     "Remove the schedule of a deployment",
+				Tag:         tagDeployments,
+				Status:      http.StatusNoContent,
+				Errors:      []int{http.StatusNotFound, http.StatusConflict},
+			},
+			handler:   s.DeleteSchedule,
+			authorize: s.requireAction(models.ActionEdit),
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodPut,
+				Path:        "/v1/deployments/:id/schedule/override",
+				OperationID: "suspendDeploymentSchedule",
+				Summary:     "Suspend the schedule of a deployment until a given time",
+				Description: "The scheduler leaves the instance alone until then, so it can be kept running late or stopped early. Fails with 409 if the deployment has no schedule.",
+				Tag:         tagDeployments,
+				Request:     models.ScheduleOverride{},
+				Response:    models.Deployment{},
+				Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+			},
+			handler:   s.SuspendSchedule,
+			authorize: s.requireAction(models.ActionEdit),
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodDelete,
+				Path:        "/v1/deployments/:id/schedule/override",
+				OperationID: "resumeDeploymentSchedule",
+				Summary:     "Resume the suspended schedule of a deployment",
+				Tag:         tagDeployments,
+				Status:      http.StatusNoContent,
+				Errors:      []int{http.StatusNotFound, http.StatusConflict},
+			},
+			handler:   s.ResumeSchedule,
+			authorize: s.requireAction(models.ActionEdit),
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodPut,
+				Path:        "/v1/deployments/:id/idle-policy",
+				OperationID: "setDeploymentIdlePolicy",
+				Summary:     "Stop the instance of a deployment when it is idle",
+				Description: "The stop-idle job stops the instance once its CPU utilization and network traffic stayed below the thresholds for the lookback, and records the reason in stopReason. Replaces the current policy. Fails with 409 for spot deployments, whose instances cannot be stopped.",
+				Tag:         tagDeployments,
+				Request:     models.IdlePolicy{},
+				Response:    models.Deployment{},
+				Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+			},
+			handler:   s.SetIdlePolicy,
+			authorize: s.requireAction(models.ActionEdit),
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodDelete,
+				Path:        "/v1/deployments/:id/idle-policy",
+				OperationID: "deleteDeploymentIdlePolicy",
+				Summary:     "Remove the idle policy of a deployment",
+				Tag:         tagDeployments,
+				Status:      http.StatusNoContent,
+				Errors:      []int{http.StatusNotFound, http.StatusConflict},
+			},
+			handler:   s.DeleteIdlePolicy,
+			authorize: s.requireAction(models.ActionEdit),
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodGet,
+				Path:        "/v1/deployments/:id/snapshots",
+				OperationID: "listSnapshots",
+				Summary:     "List the snapshots of a deployment, newest first",
+				Tag:         tagSnapshots,
+				Response:    models.SnapshotList{},
+				Errors:      []int{http.StatusNotFound, http.StatusConflict},
+			},
+			handler: s.ListSnapshots,
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodPost,
+				Path:        "/v1/deployments/:id/snapshots",
+				OperationID: "createSnapshot",
+				Summary:     "Capture a snapshot of a deployment's instance",
+				Description: "The snapshot becomes the deployment's snapshot. Fails with 409 when the snapshot limit is reached.",
+				Tag:         tagSnapshots,
+				Response:    models.Snapshot{},
+				Status:      http.StatusAccepted,
+				Errors:      []int{http.StatusNotFound, http.StatusConflict},
+			},
+			handler:   s.CreateSnapshot,
+			authorize: s.requireAction(models.ActionSnapshot),
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodGet,
+				Path:        "/v1/deployments/:id/snapshots/:snapshot_id",
+				OperationID: "getSnapshot",
+				Summary:     "Get a snapshot of a deployment",
+				Tag:         tagSnapshots,
+				Response:    models.Snapshot{},
+				Errors:      []int{http.StatusNotFound, http.StatusConflict},
+			},
+			handler: s.GetSnapshot,
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodDelete,
+				Path:        "/v1/deployments/:id/snapshots/:snapshot_id",
+				OperationID: "deleteSnapshot",
+				Summary:     "Delete a snapshot of a deployment",
+				Tag:         tagSnapshots,
+				Status:      http.StatusNoContent,
+				Errors:      []int{http.StatusNotFound, http.StatusConflict},
+			},
+			handler:   s.DeleteSnapshot,
+			authorize: s.requireAction(models.ActionSnapshot),
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodGet,
+				Path:        "/v1/catalog",
+				OperationID: "getCatalog",
+				Summary:     "List the AMIs, server sizes and user scripts that can be deployed",
+				Tag:         tagCatalog,
+				Response:    models.Config{},
+			},
+			handler: s.GetAWSData,
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodGet,
+				Path:        "/v1/apikeys",
+				OperationID: "listAPIKeys",
+				Summary:     "List API keys",
+				Description: "Callers see their own keys, admins see every key.",
+				Tag:         tagAPIKeys,
+				Query:       []openapi.Parameter{queryParameter("user", "Only list the keys of this user, admins only.")},
+				Response:    models.APIKeyList{},
+				Errors:      []int{http.StatusConflict},
+			},
+			handler:   s.ListAPIKeys,
+			authorize: s.requireInteractive,
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodPost,
+				Path:        "/v1/apikeys",
+				OperationID: "createAPIKey",
+				Summary:     "Create an API key for a CI or automation client",
+				Description: "The key acts as its user, limited to its permissions. It is only returned in this response.",
+				Tag:         tagAPIKeys,
+				Request:     models.APIKeyRequest{},
+				Response:    models.CreatedAPIKey{},
+				Status:      http.StatusCreated,
+				Errors:      []int{http.StatusBadRequest, http.StatusConflict},
+			},
+			handler:   s.CreateAPIKey,
+			authorize: s.requireInteractive,
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodDelete,
+				Path:        "/v1/apikeys/:key_id",
+				OperationID: "revokeAPIKey",
+				Summary:     "Revoke an API key",
+				Tag:         tagAPIKeys,
+				Status:      http.StatusNoContent,
+				Errors:      []int{http.StatusNotFound, http.StatusConflict},
+			},
+			handler:   s.RevokeAPIKey,
+			authorize: s.requireInteractive,
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodGet,
+				Path:        "/v1/quota",
+				OperationID: "getQuota",
+				Summary:     "Get quota limits and usage",
+				Description: "Limits and usage of the caller and of the teams they are a member of. Creating or editing a deployment that would exceed a limit fails with code quota_exceeded.",
+				Tag:         tagQuota,
+				Query:       []openapi.Parameter{queryParameter("user", "Report on this user instead of the caller, admins only.")},
+				Response:    models.Quota{},
+				Errors:      []int{http.StatusForbidden},
+			},
+			handler: s.GetQuota,
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodGet,
+				Path:        "/v1/costs",
+				OperationID: "getCostSummary",
+				Summary:     "Summarize the cost of all deployments by user",
+				Description: "Costs are estimated from the configured price table. Fails with 409 if there is none.",
+				Tag:         tagCosts,
+				Response:    models.CostSummary{},
+				Errors:      []int{http.StatusConflict},
+			},
+			handler: s.GetCostSummary,
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodPost,
+				Path:        "/v1/costs/estimate",
+				OperationID: "estimateDeploymentCost",
+				Summary:     "Estimate the cost of a deployment request",
+				Description: "Nothing is created. Only the AMI, server size, lifecycle and TTL of the request are used. Fails with 409 if no price table is configured.",
+				Tag:         tagCosts,
+				Request:     models.DeploymentRequest{},
+				Response:    models.CostEstimate{},
+				Errors:      []int{http.StatusBadRequest, http.StatusConflict},
+			},
+			handler:  s.EstimateDeploymentCost,
+			readOnly: true,
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodGet,
+				Path:        "/v1/audit",
+				OperationID: "listAuditEvents",
+				Summary:     "List audit events, newest first",
+				Description: "Every call of a route that changes something is recorded, including refused and failed calls. Admins only.",
+				Tag:         tagAudit,
+				Query: []openapi.Parameter{
+					queryParameter("user", "Only events of this actor."),
+					queryParameter("deployment", "Only events of this deployment ID."),
+					queryParameter("from", "Only events at or after this RFC 3339 time."),
+					queryParameter("to", "Only events before this RFC 3339 time."),
+					{
+						Name:        "limit",
+						In:          "query",
+						Description: "Maximum number of events, 100 by default.",
+						Schema:      &openapi.Schema{Type: "integer", Format: "int32"},
+					},
+				},
+				Response: models.AuditEventList{},
+				Errors:   []int{http.StatusBadRequest},
+			},
+			handler:   s.ListAuditEvents,
+			authorize: s.requireAdmin(),
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodGet,
+				Path:        "/v1/admin/drift",
+				OperationID: "getDriftReport",
+				Summary:     "Report where the deployment records and the EC2 instances disagree",
+				Description: "Lists deployments without an instance, instances without a deployment, duplicate instances and instances whose server size, AMI or lifecycle differs from their deployment. Deployments the provisioner has yet to apply are left out. Admins only.",
+				Tag:         tagAdmin,
+				Response:    models.DriftReport{},
+			},
+			handler:   s.GetDriftReport,
+			authorize: s.requireAdmin(),
+		},
+	}
+}
+
+func queryParameter(name, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Schema: &openapi.Schema{Type: "string"}}
+}
+
+// extendLinkParameters are the query parameters of an extend link.
+func extendLinkParameters() []openapi.Parameter {
+	return []openapi.Parameter{
+		queryParameter("by", "How much to extend the deployment by."),
+		queryParameter("expiry", "The expiry the link was issued for, in Unix seconds."),
+		queryParameter("sig", "Signature of the link."),
+	}
+}
+
+// legacyRoutes are the unversioned routes used before /v1. They are kept
+// until the sunset date in api.legacy_sunset.
+func (s *Server) legacyRoutes() []route {
+	return []route{
+		// EC2 Instance Request Management
+		{
+			Route: openapi.Route{
+				Method:      http.MethodPost,
+				Path:        "/instance-request",
+				OperationID: "createDeploymentRequest",
+				Summary:     "Request a new deployment",
+				Tag:         tagLegacy,
+				Deprecated:  true,
+				Request:     models.Payload{},
+				Response:    models.Response{},
+				Status:      http.StatusCreated,
+				Errors:      []int{http.StatusBadRequest, http.StatusConflict},
+			},
+			handler:   s.CreateInstanceRequest,
+			authorize: s.requirePermission(models.PermissionCreate),
+			successor: "/v1/deployments",
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodGet,
+				Path:        "/instance-request/:id",
+				OperationID: "getDeploymentRequest",
+				Summary:     "Get a deployment request",
+				Description: "The hostname is returned without the Route 53 domain.",
+				Tag:         tagLegacy,
+				Deprecated:  true,
+				Response:    models.DynamoDBData{},
+				Errors:      []int{http.StatusNotFound},
+			},
+			handler:   s.GetInstanceRequest,
+			successor: "/v1/deployments/:id",
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodDelete,
+				Path:        "/instance-request/:id",
+				OperationID: "deleteDeploymentRequest",
+				Summary:     "Delete a deployment request",
+				Tag:         tagLegacy,
+				Deprecated:  true,
+				Status:      http.StatusNoContent,
+				Errors:      []int{http.StatusNotFound},
+			},
+			handler:   s.DeleteInstanceRequest,
+			authorize: s.requireAction(models.ActionDelete),
+			successor: "/v1/deployments/:id",
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodDelete,
+				Path:        "/instance-requests",
+				OperationID: "deleteAllDeploymentRequests",
+				Summary:     "Delete every deployment request",
+				Tag:         tagLegacy,
+				Deprecated:  true,
+				Status:      http.StatusNoContent,
+			},
+			handler:   s.DeleteAllInstanceRequests,
+			authorize: s.requireAdmin(models.Permission(models.ActionDelete)),
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodPut,
+				Path:        "/instance-request/:id",
+				OperationID: "updateDeploymentRequest",
+				Summary:     "Edit a deployment request",
+				Tag:         tagLegacy,
+				Deprecated:  true,
+				Request:     models.Payload{},
+				Status:      http.StatusNoContent,
+				Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+			},
+			handler:   s.UpdateInstanceRequest,
+			authorize: s.requireAction(models.ActionEdit),
+			successor: "/v1/deployments/:id",
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodPost,
+				Path:        "/instance-request/:id/extend",
+				OperationID: "extendDeploymentRequest",
+				Summary:     "Extend or shorten the time to live of a deployment request",
+				Tag:         tagLegacy,
+				Deprecated:  true,
+				Request:     models.ExtendRequest{},
+				Response:    models.Expiry{},
+				Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+			},
+			handler:   s.ExtendDeployment,
+			authorize: s.requireAction(models.ActionEdit),
+			successor: "/v1/deployments/:id/actions/extend",
+		},
+
+		// Deployed EC2 Instances
+		{
+			Route: openapi.Route{
+				Method:      http.MethodGet,
+				Path:        "/deployments",
+				OperationID: "listDeployedInstances",
+				Summary:     "List deployed instances",
+				Description: "Deployments without an instance yet are listed with their deploymentStatus as status.",
+				Tag:         tagLegacy,
+				Deprecated:  true,
+				Response:    []models.DeploymentResponse{},
+			},
+			handler:   s.GetDeployedRequest,
+			successor: "/v1/deployments",
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodPost,
+				Path:        "/start-instance/:id",
+				OperationID: "startInstance",
+				Summary:     "Start a stopped instance",
+				Tag:         tagLegacy,
+				Deprecated:  true,
+				Errors:      []int{http.StatusNotFound, http.StatusConflict},
+			},
+			handler:       s.StartInstanceRequest,
+			authorize:     s.requireInstanceAction(models.ActionStart, pathParameterName),
+			successor:     "/v1/deployments/:id/actions/start",
+			instanceParam: pathParameterName,
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodPost,
+				Path:        "/stop-instance/:id",
+				OperationID: "stopInstance",
+				Summary:     "Stop a running instance",
+				Tag:         tagLegacy,
+				Deprecated:  true,
+				Errors:      []int{http.StatusNotFound, http.StatusConflict},
+			},
+			handler:       s.StopInstanceRequest,
+			authorize:     s.requireInstanceAction(models.ActionStop, pathParameterName),
+			successor:     "/v1/deployments/:id/actions/stop",
+			instanceParam: pathParameterName,
+		},
+
+		// AWS Data requests
+		{
+			Route: openapi.Route{
+				Method:      http.MethodGet,
+				Path:        "/awsdata",
+				OperationID: "getAWSData",
+				Summary:     "List the AMIs, server sizes and user scripts that can be deployed",
+				Tag:         tagLegacy,
+				Deprecated:  true,
+				Response:    models.Config{},
+			},
+			handler:   s.GetAWSData,
+			successor: "/v1/catalog",
+		},
+
+		// Capture instance Ami
+		{
+			Route: openapi.Route{
+				Method:      http.MethodPut,
+				Path:        "/instance-ami/:id/capture",
+				OperationID: "captureImage",
+				Summary:     "Capture an image of a deployment's instance",
+				Description: "The path parameter is the deployment ID. The instance is taken from instanceId and the new image becomes the snapshot of the deployment, the rest of the body is ignored.",
+				Tag:         tagLegacy,
+				Deprecated:  true,
+				Request:     models.Payload{},
+				Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+			},
+			handler:   s.CaptureInstanceAMI,
+			authorize: s.requireAction(models.ActionSnapshot),
+			successor: "/v1/deployments/:id/snapshots",
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodGet,
+				Path:        "/instance-ami/:instance_id/check-limit",
+				OperationID: "checkImageLimit",
+				Summary:     "Check whether an instance has reached its image limit",
+				Tag:         tagLegacy,
+				Deprecated:  true,
+				Response:    models.AMILimitResponse{},
+			},
+			handler:       s.CheckAMILimit,
+			successor:     "/v1/deployments/:id/snapshots",
+			instanceParam: instanceParameterName,
+		},
+		{
+			Route: openapi.Route{
+				Method:      http.MethodDelete,
+				Path:        "/instance-ami/:instance_id/:image_id",
+				OperationID: "deleteImage",
+				Summary:     "Deregister an image",
+				Tag:         tagLegacy,
+				Deprecated:  true,
+				Errors:      []int{http.StatusNotFound},
+			},
+			handler:       s.DeleteInstanceAMI,
+			authorize:     s.requireInstanceAction(models.ActionSnapshot, instanceParameterName),
+			successor:     "/v1/deployments/:id/snapshots/:image_id",
+			instanceParam: instanceParameterName,
+		},
+	}
+}
+
+// OpenAPISpec returns the OpenAPI document of the API, formatted the way it is
+// committed to api/openapi.json.
+func OpenAPISpec() ([]byte, error) {
+	generator := openapi.NewGenerator(openapi.Info{
+		Title:       "turbo-deploy",
+		Description: "Self service deployment of EC2 instances.",
+		Version:     "1.0.0",
+	}, models.ErrorResponse{})
+	generator.RegisterEnum(models.ErrorCode(""),
+		string(models.ErrCodeInvalidRequest),
+		string(models.ErrCodeValidationFailed),
+		string(models.ErrCodeUnauthorized),
+		string(models.ErrCodeForbidden),
+		string(models.ErrCodeNotFound),
+		string(models.ErrCodeHostnameExists),
+		string(models.ErrCodeConflict),
+		string(models.ErrCodeQuotaExceeded),
+		string(models.ErrCodeThrottled),
+		string(models.ErrCodeAWSUnauthorized),
+		string(models.ErrCodeAWSError),
+		string(models.ErrCodeInternal),
+	)
+	actions := make([]string, 0, len(models.Actions))
+	for _, action := range models.Actions {
+		actions = append(actions, string(action))
+	}
+	generator.RegisterEnum(models.Action(""), actions...)
+	permissions := make([]string, 0, len(models.Permissions))
+	for _, permission := range models.Permissions {
+		permissions = append(permissions, string(permission))
+	}
+	generator.RegisterEnum(models.Permission(""), permissions...)
+	statuses := make([]string, 0, len(models.DeploymentStatuses))
+	for _, status := range models.DeploymentStatuses {
+		statuses = append(statuses, string(status))
+	}
+	generator.RegisterEnum(models.DeploymentStatus(""), statuses...)
+	kinds := make([]string, 0, len(models.DriftKinds))
+	for _, kind := range models.DriftKinds {
+		kinds = append(kinds, string(kind))
+	}
+	generator.RegisterEnum(models.DriftKind(""), kinds...)
+	generator.RegisterEnum(models.AuditResult(""),
+		string(models.AuditSuccess),
+		string(models.AuditDenied),
+		string(models.AuditFailure),
+	)
+	generator.AddSecurityScheme("bearerAuth", openapi.SecurityScheme{
+		Type:         "http",
+		Scheme:       "bearer",
+		BearerFormat: "JWT",
+		Description:  "Required when the server runs with auth.mode jwt. The token is a JWT or an API key created with POST /v1/apikeys. The documentation routes are always public.",
+	}, false)
+
+	// the handlers are never called, a zero Server is enough to list them
+	routes := (&Server{}).routes()
+	documented := make([]openapi.Route, 0, len(routes))
+	for _, r := range routes {
+		documented = append(documented, r.Route)
+	}
+
+	doc, err := generator.Generate(documented)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// legacyDeprecatedAt is when the unversioned routes were deprecated in favour
+// of /v1.
+var legacyDeprecatedAt = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+
+// deprecated announces that a legacy route is deprecated using the
+// Deprecation (RFC 9745) and Sunset (RFC 8594) headers, and links to the route
+// replacing it.
+func (s *Server) deprecated(successor, instanceParam string) gin.HandlerFunc {
+	sunset, hasSunset := s.cfg.API.Sunset()
+
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "@"+strconv.FormatInt(legacyDeprecatedAt.Unix(), 10))
+		if hasSunset {
+			c.Header("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+		if path, ok := s.successorPath(c, successor, instanceParam); ok {
+			c.Header("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", path))
+		}
+		c.Next()
+	}
+}
+
+// successorPath fills in successor for the request. On routes addressing an
+// instance, :id is the deployment of the instance in instanceParam, and there
+// is no successor if it belongs to no deployment.
+func (s *Server) successorPath(c *gin.Context, successor, instanceParam string) (string, bool) {
+	if successor == "" {
+		return "", false
+	}
+	params := c.Params
+	if instanceParam != "" {
+		// requireInstanceAction has looked it up already when authenticating
+		deploymentID := c.GetString(deploymentIDContextKey)
+		if deploymentID == "" {
+			var err error
+			if deploymentID, err = s.instanceDeploymentID(c.Request.Context(), c.Param(instanceParam)); err != nil {
+				return "", false
+			}
+		}
+		params = slices.DeleteFunc(slices.Clone(params), func(p gin.Param) bool { return p.Key == pathParameterName })
+		params = append(params, gin.Param{Key: pathParameterName, Value: deploymentID})
+	}
+	return expandPath(successor, params), true
+}
+
+// expandPath fills the parameters of a gin path with the values in params.
+func expandPath(path string, params gin.Params) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = params.ByName(segment[1:])
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func (s *Server) GetOpenAPISpec(c *gin.Context) {
+	spec, err := OpenAPISpec()
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json", spec)
+}
+
+func (s *Server) GetDocs(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", openapi.DocsPage)
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/frgrisk/turbo-deploy/server/config"
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/instance"
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+func TestDeprecatedSuccessor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	provider := instance.NewFakeProvider()
+	provider.TransitionDelay = 0
+	s := &Server{
+		cfg:     &config.Config{Domain: "example.com"},
+		store:   store,
+		compute: instance.NewService(provider),
+		audit:   db.NewMemoryAuditStore(),
+	}
+	router := gin.New()
+	s.SetupRoutes(router)
+
+	if _, err := store.SaveRecord(ctx, models.DynamoDBData{ID: "dep", Hostname: "web", Status: models.StatusRunning}); err != nil {
+		t.Fatalf("SaveRecord: %v", err)
+	}
+	instanceID := provider.RunInstance(instance.FakeInstanceSpec{
+		ImageID:      "ami-1",
+		InstanceType: "t3.small",
+		Tags:         map[string]string{"Name": "web", "DeployedBy": "turbo-deploy", "DeploymentID": "dep"},
+	})
+
+	tests := []struct {
+		method, path string
+		// link is the successor announced, empty for none
+		link string
+	}{
+		{http.MethodGet, "/instance-request/dep", "</v1/deployments/dep>; rel=\"successor-version\""},
+		{http.MethodPost, "/instance-request/dep/extend", "</v1/deployments/dep/actions/extend>; rel=\"successor-version\""},
+		{http.MethodPost, "/start-instance/" + instanceID, "</v1/deployments/dep/actions/start>; rel=\"successor-version\""},
+		{http.MethodPost, "/stop-instance/" + instanceID, "</v1/deployments/dep/actions/stop>; rel=\"successor-version\""},
+		{http.MethodGet, "/instance-ami/" + instanceID + "/check-limit", "</v1/deployments/dep/snapshots>; rel=\"successor-version\""},
+		{http.MethodDelete, "/instance-ami/" + instanceID + "/ami-2", "</v1/deployments/dep/snapshots/ami-2>; rel=\"successor-version\""},
+		// an instance of no deployment has no successor
+		{http.MethodPost, "/stop-instance/i-unknown", ""},
+		{http.MethodPost, "/instance-request/dep/capture", ""},
+		{http.MethodDelete, "/instance-requests", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if got := w.Header().Get("Link"); got != tt.link {
+				t.Errorf("Link = %q, want %q", got, tt.link)
+			}
+		})
+	}
+}
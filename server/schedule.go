@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/frgrisk/turbo-deploy/server/scheduler"
+	"github.com/frgrisk/turbo-deploy/server/validate"
+	"github.com/gin-gonic/gin"
+)
+
+// SetSchedule attaches an office-hours schedule to a deployment, replacing
+// the one it has. An override of the previous schedule is kept.
+func (s *Server) SetSchedule(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param(pathParameterName)
+
+	var schedule models.Schedule
+	if err := c.ShouldBindJSON(&schedule); err != nil {
+		respondWithError(c, badRequest(err))
+		return
+	}
+	if errs := validate.Schedule(schedule); len(errs) > 0 {
+		respondWithError(c, validationFailed(errs))
+		return
+	}
+	if err := s.checkStoppable(ctx, id); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	if err := s.store.SetSchedule(ctx, id, &schedule); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	s.respondWithDeployment(c, id)
+}
+
+// DeleteSchedule removes the schedule of a deployment, which then runs
+// around the clock.
+func (s *Server) DeleteSchedule(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param(pathParameterName)
+
+	if _, err := s.activeRecord(ctx, id); err != nil {
+		respondWithError(c, err)
+		return
+	}
+	if err := s.store.SetSchedule(ctx, id, nil); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// SuspendSchedule stops the scheduler from starting or stopping the instance
+// of a deployment until the time in the request.
+func (s *Server) SuspendSchedule(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param(pathParameterName)
+
+	var override models.ScheduleOverride
+	if err := c.ShouldBindJSON(&override); err != nil {
+		respondWithError(c, badRequest(err))
+		return
+	}
+	if !override.Until.After(time.Now()) {
+		respondWithError(c, validationFailed([]models.FieldError{{Field: "until", Message: "until must be in the future"}}))
+		return
+	}
+
+	record, err := s.activeRecord(ctx, id)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	if record.Schedule == nil {
+		respondWithError(c, newAPIError(http.StatusConflict, models.ErrCodeConflict, "Deployment %s has no schedule to suspend", id))
+		return
+	}
+
+	if err := s.store.SuspendSchedule(ctx, id, override.Until.Unix()); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	s.respondWithDeployment(c, id)
+}
+
+// ResumeSchedule ends the override of a deployment's schedule, the next run
+// of the scheduler applies it again.
+func (s *Server) ResumeSchedule(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param(pathParameterName)
+
+	if _, err := s.activeRecord(ctx, id); err != nil {
+		respondWithError(c, err)
+		return
+	}
+	if err := s.store.SuspendSchedule(ctx, id, 0); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// checkStoppable refuses schedules and idle policies for deployment id if it
+// is deleting or deleted, or if its instance cannot be stopped.
+func (s *Server) checkStoppable(ctx context.Context, id string) error {
+	record, err := s.activeRecord(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := validate.Stoppable(record.Lifecycle); err != nil {
+		return newAPIError(http.StatusConflict, models.ErrCodeConflict, "Deployment %s cannot be stopped automatically: %v", id, err)
+	}
+	return nil
+}
+
+func (s *Server) respondWithDeployment(c *gin.Context, id string) {
+	deployment, err := s.getDeployment(c.Request.Context(), id)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, deployment)
+}
+
+// Schedule starts and stops the instances of scheduled deployments to match
+// their schedules.
+func (s *Server) Schedule(ctx context.Context, dryRun bool) (scheduler.Report, error) {
+	return scheduler.New(s.store, s.compute, scheduler.Options{DryRun: dryRun}).Run(ctx)
+}
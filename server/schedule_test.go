@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/frgrisk/turbo-deploy/server/config"
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/instance"
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+func TestScheduleRefusesRemovedDeployments(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schedule := `{"timezone": "UTC", "windows": [{"days": ["mon"], "start": "08:00", "stop": "18:00"}]}`
+	until := `{"until": "` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `"}`
+
+	tests := []struct {
+		status models.DeploymentStatus
+		want   int
+	}{
+		{models.StatusRunning, http.StatusOK},
+		{models.StatusFailed, http.StatusOK},
+		{models.StatusDeleting, http.StatusConflict},
+		{models.StatusDeleted, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			ctx := context.Background()
+			store := db.NewMemoryStore()
+			s := &Server{
+				cfg:     &config.Config{Domain: "example.com"},
+				store:   store,
+				compute: instance.NewService(instance.NewFakeProvider()),
+			}
+			router := gin.New()
+			router.PUT("/v1/deployments/:id/schedule", s.SetSchedule)
+			router.DELETE("/v1/deployments/:id/schedule", s.DeleteSchedule)
+			router.PUT("/v1/deployments/:id/schedule/override", s.SuspendSchedule)
+			router.DELETE("/v1/deployments/:id/schedule/override", s.ResumeSchedule)
+
+			_, err := store.SaveRecord(ctx, models.DynamoDBData{
+				ID:        "a",
+				Hostname:  "web.example.com",
+				Lifecycle: "on-demand",
+				Status:    tt.status,
+				Schedule:  &models.Schedule{Timezone: "UTC"},
+			})
+			if err != nil {
+				t.Fatalf("SaveRecord: %v", err)
+			}
+
+			for _, call := range []struct {
+				method, path, body string
+				ok                 int
+			}{
+				{http.MethodPut, "/v1/deployments/a/schedule/override", until, http.StatusOK},
+				{http.MethodDelete, "/v1/deployments/a/schedule/override", "", http.StatusNoContent},
+				{http.MethodPut, "/v1/deployments/a/schedule", schedule, http.StatusOK},
+				{http.MethodDelete, "/v1/deployments/a/schedule", "", http.StatusNoContent},
+			} {
+				want := tt.want
+				if want == http.StatusOK {
+					want = call.ok
+				}
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest(call.method, call.path, strings.NewReader(call.body)))
+				if w.Code != want {
+					t.Errorf("%s %s: status %d, want %d: %s", call.method, call.path, w.Code, want, w.Body)
+				}
+			}
+
+			record, err := store.GetRecord(ctx, "a")
+			if err != nil {
+				t.Fatalf("GetRecord: %v", err)
+			}
+			if removed := tt.want != http.StatusOK; removed != (record.Schedule != nil) {
+				t.Errorf("schedule is %+v after the calls", record.Schedule)
+			}
+		})
+	}
+}
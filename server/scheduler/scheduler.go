@@ -0,0 +1,229 @@
+// Package scheduler powers deployments on and off on their office-hours
+// schedules.
+//
+// Every run compares the instance of each scheduled deployment with its
+// schedule: stopped instances are started within a window and running ones
+// stopped outside. Instances that are starting or stopping are left alone, as
+// are deployments whose schedule is suspended by an override, so an instance
+// started by hand at night stays up until the override ends. An instance the
+// idle stopper stopped within a window stays stopped until that window ends.
+// Spot instances cannot be stopped and are never touched.
+// Stopped deployments show the reason, such as "outside office hours", until
+// they are started again.
+package scheduler
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	// Lambda runtimes come without a time zone database
+	_ "time/tzdata"
+
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/instance"
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/frgrisk/turbo-deploy/server/validate"
+)
+
+// Options control a run of the scheduler.
+type Options struct {
+	// DryRun reports what would be started and stopped without doing it.
+	DryRun bool
+	// Now returns the current time, time.Now if nil.
+	Now func() time.Time
+}
+
+// Scheduler starts and stops instances on their schedules.
+type Scheduler struct {
+	store   db.DeploymentStore
+	compute *instance.Service
+	opts    Options
+}
+
+// New returns a Scheduler for the deployments in store, starting and
+// stopping their instances through compute.
+func New(store db.DeploymentStore, compute *instance.Service, opts Options) *Scheduler {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Scheduler{store: store, compute: compute, opts: opts}
+}
+
+// Report lists what a run started and stopped, or would have in a dry run.
+type Report struct {
+	DryRun  bool     `json:"dryRun"`
+	Actions []Action `json:"actions"`
+}
+
+// Action is an instance started or stopped by the scheduler.
+type Action struct {
+	DeploymentID string `json:"deploymentId"`
+	InstanceID   string `json:"instanceId"`
+	Hostname     string `json:"hostname"`
+	// Action is start or stop.
+	Action string `json:"action"`
+	// Reason is the window the instance runs in, or why it does not.
+	Reason string `json:"reason"`
+	// Error is set if the instance could not be started or stopped.
+	Error string `json:"error,omitempty"`
+}
+
+// Run starts and stops the instances that do not match their schedule, in
+// deployment ID order. The returned error joins the failures, which are also
+// reported in the Report.
+func (s *Scheduler) Run(ctx context.Context) (Report, error) {
+	report := Report{DryRun: s.opts.DryRun, Actions: []Action{}}
+
+	records, err := s.store.ListRecords(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to list deployment records: %w", err)
+	}
+	records = slices.DeleteFunc(records, func(r models.DynamoDBData) bool { return r.Schedule == nil || r.Removed() })
+	if len(records) == 0 {
+		return report, nil
+	}
+	slices.SortFunc(records, func(a, b models.DynamoDBData) int { return cmp.Compare(a.ID, b.ID) })
+
+	// spot instances only carry the tags of their request until populated
+	if err := s.compute.PopulateSpotTagResponse(ctx); err != nil {
+		return report, fmt.Errorf("failed to populate tags for deployed instances: %w", err)
+	}
+	instances, err := s.compute.GetDeployedInstances(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to get deployed instances: %w", err)
+	}
+	byDeployment := make(map[string]*models.DeploymentResponse, len(instances))
+	for i := range instances {
+		byDeployment[instances[i].DeploymentID] = &instances[i]
+	}
+
+	now := s.opts.Now()
+	var errs []error
+	for _, record := range records {
+		inst := byDeployment[record.ID]
+		if inst == nil || record.ScheduleSuspendedUntil > now.Unix() || validate.Stoppable(inst.Lifecycle) != nil {
+			continue
+		}
+
+		running, windowStart, reason, err := currentWindow(*record.Schedule, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("deployment %s: %w", record.ID, err))
+			continue
+		}
+
+		action := Action{
+			DeploymentID: record.ID,
+			InstanceID:   inst.InstanceID,
+			Hostname:     record.Hostname,
+			Reason:       reason,
+		}
+		change := s.compute.StartInstance
+		switch {
+		// the scheduler only stops outside windows, so a stop reason from
+		// within this one is the idle stopper's
+		case running && inst.Status == "stopped" && record.StopReason != "" && record.StoppedAt >= windowStart.Unix():
+			continue
+		case running && inst.Status == "stopped":
+			action.Action = "start"
+		case !running && inst.Status == "running":
+			action.Action = "stop"
+			change = s.compute.StopInstance
+		default:
+			continue
+		}
+
+		if !s.opts.DryRun {
+			if err := s.apply(ctx, action, change, now); err != nil {
+				action.Error = err.Error()
+				errs = append(errs, fmt.Errorf("deployment %s: %w", record.ID, err))
+			}
+		}
+		report.Actions = append(report.Actions, action)
+	}
+
+	return report, errors.Join(errs...)
+}
+
+// apply starts or stops the instance of action through change, and records
+// why it was stopped on the deployment, or clears that once it is started.
+func (s *Scheduler) apply(ctx context.Context, action Action, change func(ctx context.Context, deploymentID, instanceID string) error, now time.Time) error {
+	if err := change(ctx, action.DeploymentID, action.InstanceID); err != nil {
+		return fmt.Errorf("failed to %s instance %s: %w", action.Action, action.InstanceID, err)
+	}
+	log.Printf("scheduler: %s instance %s of deployment %s, %s", action.Action, action.InstanceID, action.DeploymentID, action.Reason)
+
+	reason, stoppedAt := action.Reason, now.Unix()
+	if action.Action == "start" {
+		reason, stoppedAt = "", 0
+	}
+	if err := s.store.SetStopReason(ctx, action.DeploymentID, reason, stoppedAt); err != nil && !errors.Is(err, db.ErrURLNotFound) {
+		return fmt.Errorf("failed to record the stop reason: %w", err)
+	}
+	return nil
+}
+
+// Running reports whether schedule keeps its instance running at t, and why.
+// A window belongs to the day it starts on, so a holiday skips the windows
+// starting that day but not one running into it from the day before.
+func Running(schedule models.Schedule, t time.Time) (bool, string, error) {
+	running, _, reason, err := currentWindow(schedule, t)
+	return running, reason, err
+}
+
+// currentWindow is Running, which also returns when the window t falls in
+// started.
+func currentWindow(schedule models.Schedule, t time.Time) (bool, time.Time, string, error) {
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		return false, time.Time{}, "", fmt.Errorf("invalid schedule time zone: %w", err)
+	}
+	local := t.In(loc)
+
+	for _, daysAgo := range []int{0, 1} {
+		day := local.AddDate(0, 0, -daysAgo)
+		if slices.Contains(schedule.Holidays, day.Format(validate.DateLayout)) {
+			continue
+		}
+		weekday := validate.Weekdays[day.Weekday()]
+
+		for _, window := range schedule.Windows {
+			if !slices.Contains(window.Days, weekday) {
+				continue
+			}
+			start, err := clock(day, window.Start)
+			if err != nil {
+				return false, time.Time{}, "", err
+			}
+			stop, err := clock(day, window.Stop)
+			if err != nil {
+				return false, time.Time{}, "", err
+			}
+			if !stop.After(start) {
+				stop = stop.AddDate(0, 0, 1)
+			}
+
+			if !local.Before(start) && local.Before(stop) {
+				return true, start, fmt.Sprintf("within %s %s-%s %s", weekday, window.Start, window.Stop, schedule.Timezone), nil
+			}
+		}
+	}
+
+	if slices.Contains(schedule.Holidays, local.Format(validate.DateLayout)) {
+		return false, time.Time{}, "holiday " + local.Format(validate.DateLayout), nil
+	}
+	return false, time.Time{}, "outside office hours", nil
+}
+
+// clock returns the time of day value on the date of day.
+func clock(day time.Time, value string) (time.Time, error) {
+	t, err := time.Parse(validate.ClockLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid schedule time %q", value)
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, day.Location()), nil
+}
@@ -0,0 +1,166 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/instance"
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+func TestRunning(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.December, day, hour, minute, 0, 0, london)
+	}
+	schedule := models.Schedule{
+		Timezone: "Europe/London",
+		Windows: []models.ScheduleWindow{
+			{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "08:00", Stop: "18:00"},
+			// a night shift running into the next morning
+			{Days: []string{"thu", "fri"}, Start: "22:00", Stop: "06:00"},
+		},
+		// Friday 25 December
+		Holidays: []string{"2026-12-25"},
+	}
+
+	tests := []struct {
+		name    string
+		t       time.Time
+		running bool
+		reason  string
+	}{
+		{"within a day window", at(24, 10, 0), true, "within thu 08:00-18:00 Europe/London"},
+		{"at the start of a window", at(24, 8, 0), true, "within thu 08:00-18:00 Europe/London"},
+		{"at the stop of a window", at(24, 18, 0), false, "outside office hours"},
+		{"overnight before midnight", at(24, 23, 0), true, "within thu 22:00-06:00 Europe/London"},
+		{"overnight window running into a holiday", at(25, 2, 0), true, "within thu 22:00-06:00 Europe/London"},
+		{"overnight window stopped on a holiday", at(25, 6, 0), false, "holiday 2026-12-25"},
+		{"day window on a holiday", at(25, 10, 0), false, "holiday 2026-12-25"},
+		{"overnight window starting on a holiday", at(26, 2, 0), false, "outside office hours"},
+		{"weekend", at(27, 10, 0), false, "outside office hours"},
+		{"other time zone", time.Date(2026, time.December, 24, 7, 30, 0, 0, time.FixedZone("EST", -5*3600)), true, "within thu 08:00-18:00 Europe/London"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			running, reason, err := Running(schedule, tt.t)
+			if err != nil {
+				t.Fatalf("Running(): %v", err)
+			}
+			if running != tt.running || reason != tt.reason {
+				t.Errorf("Running() = %v, %q, want %v, %q", running, reason, tt.running, tt.reason)
+			}
+		})
+	}
+}
+
+func TestRunningInvalidSchedule(t *testing.T) {
+	now := time.Date(2026, time.December, 24, 10, 0, 0, 0, time.UTC)
+	window := []models.ScheduleWindow{{Days: []string{"thu"}, Start: "08:00", Stop: "18:00"}}
+
+	if _, _, err := Running(models.Schedule{Timezone: "Mars/Olympus", Windows: window}, now); err == nil {
+		t.Error("Running() with an unknown time zone succeeded")
+	}
+	window[0].Start = "8am"
+	if _, _, err := Running(models.Schedule{Timezone: "UTC", Windows: window}, now); err == nil {
+		t.Error("Running() with an invalid start time succeeded")
+	}
+}
+
+func TestRunLeavesIdleStoppedInstancesUntilTheWindowEnds(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	provider := instance.NewFakeProvider()
+	provider.TransitionDelay = 0
+	schedule := &models.Schedule{
+		Timezone: "UTC",
+		Windows:  []models.ScheduleWindow{{Days: []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}, Start: "08:00", Stop: "18:00"}},
+	}
+	windowStart := time.Date(2026, time.December, 24, 8, 0, 0, 0, time.UTC)
+
+	// both instances are stopped, one overnight by the scheduler and one
+	// within today's window by the idle stopper
+	stopped := map[string]time.Time{
+		"night": windowStart.Add(-14 * time.Hour),
+		"idle":  windowStart.Add(time.Hour),
+	}
+	reasons := map[string]string{"night": "outside office hours", "idle": "idle 2h"}
+	for id, at := range stopped {
+		if _, err := store.SaveRecord(ctx, models.DynamoDBData{ID: id, Hostname: id, Schedule: schedule, Status: models.StatusRunning}); err != nil {
+			t.Fatalf("SaveRecord: %v", err)
+		}
+		instanceID := provider.RunInstance(instance.FakeInstanceSpec{
+			ImageID:      "ami-1",
+			InstanceType: "t3.small",
+			Tags:         map[string]string{"DeployedBy": "turbo-deploy", "DeploymentID": id},
+		})
+		if _, err := provider.StopInstances(ctx, &ec2.StopInstancesInput{InstanceIds: []string{instanceID}}); err != nil {
+			t.Fatalf("StopInstances: %v", err)
+		}
+		if err := store.SetStopReason(ctx, id, reasons[id], at.Unix()); err != nil {
+			t.Fatalf("SetStopReason: %v", err)
+		}
+	}
+
+	started := func(now time.Time) []string {
+		t.Helper()
+		report, err := New(store, instance.NewService(provider), Options{Now: func() time.Time { return now }}).Run(ctx)
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		var ids []string
+		for _, action := range report.Actions {
+			if action.Action != "start" {
+				t.Fatalf("Run: unexpected %+v", action)
+			}
+			ids = append(ids, action.DeploymentID)
+		}
+		return ids
+	}
+
+	if ids := started(windowStart.Add(2 * time.Hour)); len(ids) != 1 || ids[0] != "night" {
+		t.Fatalf("Run within the window started %v, want [night]", ids)
+	}
+	// the next day's window starts the idle instance again
+	if ids := started(windowStart.Add(26 * time.Hour)); len(ids) != 1 || ids[0] != "idle" {
+		t.Fatalf("Run within the next window started %v, want [idle]", ids)
+	}
+}
+
+func TestRunSkipsSpotInstances(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	provider := instance.NewFakeProvider()
+	provider.TransitionDelay = 0
+	schedule := &models.Schedule{
+		Timezone: "UTC",
+		Windows:  []models.ScheduleWindow{{Days: []string{"mon"}, Start: "08:00", Stop: "18:00"}},
+	}
+
+	if _, err := store.SaveRecord(ctx, models.DynamoDBData{ID: "spot", Hostname: "spot", Lifecycle: "spot", Schedule: schedule}); err != nil {
+		t.Fatalf("SaveRecord: %v", err)
+	}
+	provider.RunInstance(instance.FakeInstanceSpec{
+		ImageID:      "ami-1",
+		InstanceType: "t3.small",
+		Lifecycle:    "spot",
+		Tags:         map[string]string{"DeployedBy": "turbo-deploy", "DeploymentID": "spot"},
+	})
+
+	// a Sunday, outside every window
+	now := time.Date(2026, time.December, 27, 12, 0, 0, 0, time.UTC)
+	report, err := New(store, instance.NewService(provider), Options{Now: func() time.Time { return now }}).Run(ctx)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(report.Actions) != 0 {
+		t.Errorf("Run took %+v, want nothing", report.Actions)
+	}
+}
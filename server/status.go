@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+// errDeploymentRemoved is returned when a deleted deployment is edited.
+var errDeploymentRemoved = newAPIError(http.StatusConflict, models.ErrCodeConflict, "The deployment is being deleted")
+
+// activeRecord returns the record of deployment id, or errDeploymentRemoved
+// once it is deleting or deleted.
+func (s *Server) activeRecord(ctx context.Context, id string) (*models.DynamoDBData, error) {
+	record, err := s.store.GetRecord(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if record.Removed() {
+		return nil, errDeploymentRemoved
+	}
+	return record, nil
+}
+
+// deleteDeployment marks deployment id as deleting, the provisioner then
+// terminates its instance. Deleting it again is a no-op until it is deleted,
+// after which it is not found.
+func (s *Server) deleteDeployment(ctx context.Context, id string) error {
+	record, err := s.store.GetRecord(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	switch record.Status {
+	case models.StatusDeleted:
+		return db.ErrURLNotFound
+	case models.StatusDeleting:
+		return nil
+	}
+	return s.store.SetStatus(ctx, id, models.StatusDeleting, "", time.Now().Unix())
+}
+
+// deploymentStatus returns the status of the deployment of record. Records
+// created before statuses were kept count as running once they have an
+// instance and as provisioning until then.
+func deploymentStatus(record *models.DynamoDBData, inst *models.DeploymentResponse) models.DeploymentStatus {
+	switch {
+	case record.Status != "":
+		return record.Status
+	case inst != nil:
+		return models.StatusRunning
+	default:
+		return models.StatusProvisioning
+	}
+}
+
+// pendingDeployment describes a deployment without an instance in the shape
+// of the legacy deployments list, with its status in place of the instance
+// state.
+func (s *Server) pendingDeployment(ctx context.Context, record *models.DynamoDBData) models.DeploymentResponse {
+	status := deploymentStatus(record, nil)
+	userData := record.UserData
+	if userData == nil {
+		userData = []string{}
+	}
+	return models.DeploymentResponse{
+		DeploymentID:     record.ID,
+		Ami:              record.Ami,
+		ServerSize:       record.ServerSize,
+		Hostname:         record.Hostname,
+		Lifecycle:        record.Lifecycle,
+		Status:           string(status),
+		TimeToExpire:     strconv.FormatInt(record.TimeToExpire, 10),
+		UserData:         userData,
+		AllowedActions:   s.allowedActions(ctx, record),
+		DeploymentStatus: status,
+		LastError:        record.LastError,
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/db"
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+func TestDeleteDeployment(t *testing.T) {
+	tests := []struct {
+		status models.DeploymentStatus
+		want   models.DeploymentStatus
+		err    error
+	}{
+		{"", models.StatusDeleting, nil},
+		{models.StatusRequested, models.StatusDeleting, nil},
+		{models.StatusProvisioning, models.StatusDeleting, nil},
+		{models.StatusRunning, models.StatusDeleting, nil},
+		{models.StatusFailed, models.StatusDeleting, nil},
+		{models.StatusDeleting, models.StatusDeleting, nil},
+		{models.StatusDeleted, models.StatusDeleted, db.ErrURLNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			ctx := context.Background()
+			s := &Server{store: db.NewMemoryStore()}
+			_, err := s.store.SaveRecord(ctx, models.DynamoDBData{
+				ID:           "a",
+				Hostname:     "a",
+				TimeToExpire: time.Now().Add(time.Hour).Unix(),
+				Status:       tt.status,
+			})
+			if err != nil {
+				t.Fatalf("SaveRecord: %v", err)
+			}
+
+			if err := s.deleteDeployment(ctx, "a"); !errors.Is(err, tt.err) {
+				t.Errorf("deleteDeployment() = %v, want %v", err, tt.err)
+			}
+			record, err := s.store.GetRecord(ctx, "a")
+			if err != nil {
+				t.Fatalf("GetRecord: %v", err)
+			}
+			if record.Status != tt.want {
+				t.Errorf("status is %s, want %s", record.Status, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeploymentStatus(t *testing.T) {
+	inst := &models.DeploymentResponse{DeploymentID: "a"}
+	tests := []struct {
+		name   string
+		status models.DeploymentStatus
+		inst   *models.DeploymentResponse
+		want   models.DeploymentStatus
+	}{
+		{"recorded", models.StatusFailed, inst, models.StatusFailed},
+		{"recorded without an instance", models.StatusDeleting, nil, models.StatusDeleting},
+		{"legacy with an instance", "", inst, models.StatusRunning},
+		{"legacy without an instance", "", nil, models.StatusProvisioning},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := deploymentStatus(&models.DynamoDBData{ID: "a", Status: tt.status}, tt.inst)
+			if got != tt.want {
+				t.Errorf("deploymentStatus() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
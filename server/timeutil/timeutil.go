@@ -2,6 +2,7 @@ package timeutil
 
 import (
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -15,3 +16,16 @@ func CalculateTTL(durationValue int64, durationUnit string) (int64, error) {
 	ttl := time.Now().UTC().Add(duration).Unix()
 	return ttl, nil
 }
+
+// FormatDuration formats d without zero minutes and seconds, e.g. 24h rather
+// than 24h0m0s.
+func FormatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
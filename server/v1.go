@@ -0,0 +1,418 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/frgrisk/turbo-deploy/server/instance"
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/gin-gonic/gin"
+)
+
+const snapshotParameterName = "snapshot_id"
+
+func (s *Server) ListDeployments(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	records, err := s.store.ListRecords(ctx)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	if err := s.compute.PopulateSpotTagResponse(ctx); err != nil {
+		respondWithError(c, fmt.Errorf("failed to populate tags for deployed instances: %w", err))
+		return
+	}
+	instances, err := s.compute.GetDeployedInstances(ctx)
+	if err != nil {
+		respondWithError(c, fmt.Errorf("failed to get deployed instances: %w", err))
+		return
+	}
+
+	byDeployment := make(map[string]*models.DeploymentResponse, len(instances))
+	for i := range instances {
+		byDeployment[instances[i].DeploymentID] = &instances[i]
+	}
+
+	costs, err := s.deploymentCosts(ctx, records, byDeployment)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	response := models.DeploymentList{Deployments: make([]models.Deployment, 0, len(records))}
+	for _, record := range records {
+		deployment := s.deploymentFromRecord(ctx, record, byDeployment[record.ID])
+		deployment.Cost = costs[record.ID]
+		response.Deployments = append(response.Deployments, deployment)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (s *Server) CreateDeployment(c *gin.Context) {
+	var req models.DeploymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, badRequest(err))
+		return
+	}
+
+	id, err := s.createRecord(c.Request.Context(), payloadFromRequest(req))
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	noteCreated(c, id)
+
+	deployment, err := s.getDeployment(c.Request.Context(), id)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.Header("Location", "/v1/deployments/"+id)
+	c.JSON(http.StatusCreated, deployment)
+}
+
+func (s *Server) GetDeployment(c *gin.Context) {
+	deployment, err := s.getDeployment(c.Request.Context(), c.Param(pathParameterName))
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, deployment)
+}
+
+func (s *Server) UpdateDeployment(c *gin.Context) {
+	var req models.DeploymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, badRequest(err))
+		return
+	}
+
+	id := c.Param(pathParameterName)
+	ctx := c.Request.Context()
+
+	existing, err := s.store.GetRecord(ctx, id)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	// editing a deployment keeps its snapshot and, unless given, its owner
+	payload := payloadFromRequest(req)
+	payload.SnapShot = existing.SnapShot
+	if payload.CreationUser == "" {
+		payload.CreationUser = existing.CreationUser
+	}
+	if err := s.updateRecord(ctx, id, payload); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	deployment, err := s.getDeployment(ctx, id)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, deployment)
+}
+
+func (s *Server) DeleteDeployment(c *gin.Context) {
+	id := c.Param(pathParameterName)
+
+	if err := s.deleteDeployment(c.Request.Context(), id); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	log.Println("marked deployment for deletion", id)
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) StartDeployment(c *gin.Context) {
+	s.runInstanceAction(c, s.startInstance)
+}
+
+func (s *Server) StopDeployment(c *gin.Context) {
+	s.runInstanceAction(c, s.compute.StopInstance)
+}
+
+// runInstanceAction applies action to the instance of the deployment in the
+// path. The instance changes state asynchronously, so 202 is returned.
+func (s *Server) runInstanceAction(c *gin.Context, action func(ctx context.Context, deploymentID, instanceID string) error) {
+	ctx := c.Request.Context()
+	id := c.Param(pathParameterName)
+
+	inst, err := s.deploymentInstance(ctx, id)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	noteAudit(c).instanceID = inst.InstanceID
+
+	if err := action(ctx, id, inst.InstanceID); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+func (s *Server) ListSnapshots(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	inst, err := s.deploymentInstance(ctx, c.Param(pathParameterName))
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	images, err := s.compute.GetInstanceImages(ctx, inst.InstanceID)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	sortImagesOldestFirst(images)
+	slices.Reverse(images)
+
+	response := models.SnapshotList{
+		Snapshots: make([]models.Snapshot, 0, len(images)),
+		Limit:     maxImagesPerInstance,
+	}
+	for _, image := range images {
+		response.Snapshots = append(response.Snapshots, snapshot(image))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetSnapshot returns a snapshot of a deployment, such as the one a capture
+// points to in its Location header.
+func (s *Server) GetSnapshot(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param(pathParameterName)
+	snapshotID := c.Param(snapshotParameterName)
+
+	inst, err := s.deploymentInstance(ctx, id)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	images, err := s.compute.GetInstanceImages(ctx, inst.InstanceID)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	i := slices.IndexFunc(images, func(image types.Image) bool {
+		return aws.ToString(image.ImageId) == snapshotID
+	})
+	if i < 0 {
+		respondWithError(c, newAPIError(http.StatusNotFound, models.ErrCodeNotFound, "Deployment %s has no snapshot %s", id, snapshotID))
+		return
+	}
+
+	c.JSON(http.StatusOK, snapshot(images[i]))
+}
+
+func snapshot(image types.Image) models.Snapshot {
+	return models.Snapshot{
+		ID:        aws.ToString(image.ImageId),
+		Name:      aws.ToString(image.Name),
+		State:     string(image.State),
+		CreatedAt: aws.ToString(image.CreationDate),
+	}
+}
+
+// CreateSnapshot captures an image of the deployment's instance and records
+// it as the deployment's snapshot. Unlike the legacy capture route it refuses
+// to go over the snapshot limit instead of relying on the caller to check.
+func (s *Server) CreateSnapshot(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param(pathParameterName)
+
+	if _, err := s.store.GetRecord(ctx, id); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	inst, err := s.deploymentInstance(ctx, id)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	entry := noteAudit(c)
+	entry.instanceID = inst.InstanceID
+
+	images, err := s.compute.GetInstanceImages(ctx, inst.InstanceID)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	if len(images) >= maxImagesPerInstance {
+		respondWithError(c, newAPIError(http.StatusConflict, models.ErrCodeConflict,
+			"Deployment %s already has %d snapshots, delete one before capturing another", id, len(images)))
+		return
+	}
+
+	imageID, err := s.compute.CaptureInstanceImage(ctx, id, inst.InstanceID)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	entry.imageID = imageID
+
+	// only the snapshot is written, the record read before the capture may
+	// be stale by now
+	if err := s.store.SetSnapshot(ctx, id, imageID); err != nil {
+		respondWithError(c, fmt.Errorf("failed to update snapshot ID: %w", err))
+		return
+	}
+
+	c.Header("Location", "/v1/deployments/"+id+"/snapshots/"+imageID)
+	c.JSON(http.StatusAccepted, models.Snapshot{ID: imageID, State: "pending"})
+}
+
+func (s *Server) DeleteSnapshot(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param(pathParameterName)
+	snapshotID := c.Param(snapshotParameterName)
+	noteAudit(c).imageID = snapshotID
+
+	inst, err := s.deploymentInstance(ctx, id)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	entry := noteAudit(c)
+	entry.instanceID = inst.InstanceID
+
+	images, err := s.compute.GetInstanceImages(ctx, inst.InstanceID)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	// only images of this deployment's instance can be deleted through it
+	found := slices.ContainsFunc(images, func(image types.Image) bool {
+		return aws.ToString(image.ImageId) == snapshotID
+	})
+	if !found {
+		respondWithError(c, newAPIError(http.StatusNotFound, models.ErrCodeNotFound, "Deployment %s has no snapshot %s", id, snapshotID))
+		return
+	}
+
+	if err := s.compute.DeregisterImage(ctx, id, snapshotID); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// getDeployment loads a deployment request and the instance provisioned for
+// it, if any.
+func (s *Server) getDeployment(ctx context.Context, id string) (models.Deployment, error) {
+	record, err := s.store.GetRecord(ctx, id)
+	if err != nil {
+		return models.Deployment{}, err
+	}
+
+	inst, err := s.deploymentInstance(ctx, id)
+	if err != nil && !errors.Is(err, instance.ErrNoInstance) {
+		return models.Deployment{}, err
+	}
+
+	instances := make(map[string]*models.DeploymentResponse, 1)
+	if inst != nil {
+		instances[id] = inst
+	}
+	costs, err := s.deploymentCosts(ctx, []models.DynamoDBData{*record}, instances)
+	if err != nil {
+		return models.Deployment{}, err
+	}
+
+	deployment := s.deploymentFromRecord(ctx, *record, inst)
+	deployment.Cost = costs[id]
+	return deployment, nil
+}
+
+// deploymentInstance returns the instance of deployment id. Tags of spot
+// requests are copied first, as the instance is found by its DeploymentID
+// tag.
+func (s *Server) deploymentInstance(ctx context.Context, id string) (*models.DeploymentResponse, error) {
+	if err := s.compute.PopulateSpotTagResponse(ctx); err != nil {
+		return nil, fmt.Errorf("failed to populate tags for deployed instances: %w", err)
+	}
+	return s.compute.GetDeploymentInstance(ctx, id)
+}
+
+func (s *Server) deploymentFromRecord(ctx context.Context, record models.DynamoDBData, inst *models.DeploymentResponse) models.Deployment {
+	deployment := models.Deployment{
+		ID:             record.ID,
+		Hostname:       s.shortHostname(record.Hostname),
+		Ami:            record.Ami,
+		ServerSize:     record.ServerSize,
+		Lifecycle:      record.Lifecycle,
+		CreationUser:   record.CreationUser,
+		UserData:       record.UserData,
+		Collaborators:  record.Collaborators,
+		SnapshotID:     record.SnapShot,
+		TimeToExpire:   record.TimeToExpire,
+		ExtendedBy:     record.ExtendedBy,
+		ExtendedAt:     record.ExtendedAt,
+		Schedule:       record.Schedule,
+		AllowedActions: s.allowedActions(ctx, &record),
+	}
+	if record.Schedule != nil {
+		deployment.ScheduleSuspendedUntil = record.ScheduleSuspendedUntil
+	}
+	deployment.IdlePolicy = record.IdlePolicy
+	deployment.StopReason, deployment.StoppedAt = stopReason(&record, inst)
+	deployment.Status = deploymentStatus(&record, inst)
+	deployment.StatusChangedAt = record.StatusChangedAt
+	deployment.LastError, deployment.LastErrorAt = record.LastError, record.LastErrorAt
+	if deployment.UserData == nil {
+		deployment.UserData = []string{}
+	}
+	if deployment.Collaborators == nil {
+		deployment.Collaborators = []string{}
+	}
+
+	if inst != nil {
+		deployment.Instance = &models.DeploymentInstance{
+			ID:               inst.InstanceID,
+			Status:           inst.Status,
+			Ami:              inst.Ami,
+			ServerSize:       inst.ServerSize,
+			AvailabilityZone: inst.AvailabilityZone,
+		}
+	}
+
+	return deployment
+}
+
+func payloadFromRequest(req models.DeploymentRequest) models.Payload {
+	return models.Payload{
+		Hostname:      req.Hostname,
+		Ami:           req.Ami,
+		ServerSize:    req.ServerSize,
+		Lifecycle:     req.Lifecycle,
+		CreationUser:  req.CreationUser,
+		UserData:      req.UserData,
+		Collaborators: req.Collaborators,
+		TTLValue:      req.TTLValue,
+		TTLUnit:       req.TTLUnit,
+	}
+}
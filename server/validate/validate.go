@@ -0,0 +1,268 @@
+// Package validate checks deployment, API key, schedule and idle policy
+// requests before they are stored.
+package validate
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/frgrisk/turbo-deploy/server/models"
+	"github.com/frgrisk/turbo-deploy/server/timeutil"
+)
+
+const (
+	maxHostnameLength = 63
+	maxCollaborators  = 20
+	maxAPIKeyName     = 64
+	maxWindows        = 14
+	maxHolidays       = 100
+	// idle lookbacks span at least two five minute metric periods, and at
+	// most the three days CloudWatch answers in one request
+	minIdleLookback = 10 * time.Minute
+	maxIdleLookback = 72 * time.Hour
+)
+
+// Weekdays are the day names of ScheduleWindow.Days, indexed by
+// time.Weekday.
+var Weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ClockLayout and DateLayout are the formats of schedule times and holidays.
+const (
+	ClockLayout = "15:04"
+	DateLayout  = time.DateOnly
+)
+
+// Lifecycles are the purchase options an instance can be deployed with.
+var Lifecycles = []string{"on-demand", "spot"}
+
+// TTLUnits are the duration units accepted in Payload.TTLUnit.
+var TTLUnits = []string{"h", "m"}
+
+var hostnamePattern = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+
+// Catalog holds the choices a payload is checked against.
+type Catalog struct {
+	Amis        []string
+	ServerSizes []string
+	UserScripts []string
+}
+
+// CatalogFromConfig flattens the catalog returned by GET /awsdata.
+func CatalogFromConfig(config models.Config) Catalog {
+	catalog := Catalog{
+		ServerSizes: config.ServerSizes,
+		UserScripts: config.UserData,
+	}
+	for _, ami := range config.Ami {
+		catalog.Amis = append(catalog.Amis, ami.AmiID)
+	}
+	return catalog
+}
+
+// Hostname checks the hostname rules from the README: letters and digits
+// only, without spaces or symbols, and short enough to be a DNS label.
+func Hostname(hostname string) error {
+	switch {
+	case hostname == "":
+		return fmt.Errorf("hostname is required")
+	case len(hostname) > maxHostnameLength:
+		return fmt.Errorf("hostname must be at most %d characters", maxHostnameLength)
+	case !hostnamePattern.MatchString(hostname):
+		return fmt.Errorf("hostname may only contain letters and digits")
+	}
+	return nil
+}
+
+// Payload returns every problem with a create or edit request, or nil if it
+// can be stored as is.
+func Payload(req models.Payload, catalog Catalog) []models.FieldError {
+	var errs []models.FieldError
+	add := func(field, format string, args ...any) {
+		errs = append(errs, models.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if err := Hostname(req.Hostname); err != nil {
+		add("hostname", "%s", err)
+	}
+
+	switch {
+	case req.Ami == "":
+		add("ami", "ami is required")
+	case !slices.Contains(catalog.Amis, req.Ami):
+		add("ami", "%q is not an available AMI", req.Ami)
+	}
+
+	switch {
+	case req.ServerSize == "":
+		add("serverSize", "serverSize is required")
+	case !slices.Contains(catalog.ServerSizes, req.ServerSize):
+		add("serverSize", "%q is not an available server size, expected one of %s", req.ServerSize, strings.Join(catalog.ServerSizes, ", "))
+	}
+
+	if !slices.Contains(Lifecycles, req.Lifecycle) {
+		add("lifecycle", "lifecycle must be one of %s", strings.Join(Lifecycles, ", "))
+	}
+
+	for _, script := range req.UserData {
+		if !slices.Contains(catalog.UserScripts, script) {
+			add("userData", "%q is not a known user-data script", script)
+		}
+	}
+
+	if len(req.Collaborators) > maxCollaborators {
+		add("collaborators", "at most %d collaborators may be named", maxCollaborators)
+	}
+	for _, user := range req.Collaborators {
+		if strings.TrimSpace(user) == "" {
+			add("collaborators", "collaborators must not be empty")
+			break
+		}
+	}
+
+	switch {
+	case req.TTLValue < 0:
+		add("ttlValue", "ttlValue must not be negative")
+	case req.TTLValue > 0 && !slices.Contains(TTLUnits, req.TTLUnit):
+		add("ttlUnit", "ttlUnit must be one of %s", strings.Join(TTLUnits, ", "))
+	case req.TTLValue > 0:
+		if _, err := timeutil.CalculateTTL(req.TTLValue, req.TTLUnit); err != nil {
+			add("ttlValue", "ttlValue is out of range")
+		}
+	}
+
+	return errs
+}
+
+// APIKeyRequest returns every problem with a request for an API key created
+// at now, or nil if the key can be issued.
+func APIKeyRequest(req models.APIKeyRequest, now time.Time) []models.FieldError {
+	var errs []models.FieldError
+	add := func(field, format string, args ...any) {
+		errs = append(errs, models.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch name := strings.TrimSpace(req.Name); {
+	case name == "":
+		add("name", "name is required")
+	case len(name) > maxAPIKeyName:
+		add("name", "name must be at most %d characters", maxAPIKeyName)
+	}
+
+	if len(req.Permissions) == 0 {
+		add("permissions", "at least one permission is required")
+	}
+	for _, permission := range req.Permissions {
+		if !slices.Contains(models.Permissions, permission) {
+			names := make([]string, 0, len(models.Permissions))
+			for _, p := range models.Permissions {
+				names = append(names, string(p))
+			}
+			add("permissions", "%q is not a permission, expected one of %s", permission, strings.Join(names, ", "))
+		}
+	}
+
+	if req.ExpiresAt != 0 && req.ExpiresAt <= now.Unix() {
+		add("expiresAt", "expiresAt must be in the future")
+	}
+
+	return errs
+}
+
+// Schedule returns every problem with an office-hours schedule, or nil if it
+// can be stored as is.
+func Schedule(schedule models.Schedule) []models.FieldError {
+	var errs []models.FieldError
+	add := func(field, format string, args ...any) {
+		errs = append(errs, models.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case schedule.Timezone == "":
+		add("timezone", "timezone is required")
+	default:
+		if _, err := time.LoadLocation(schedule.Timezone); err != nil {
+			add("timezone", "%q is not an IANA time zone such as Europe/London", schedule.Timezone)
+		}
+	}
+
+	switch {
+	case len(schedule.Windows) == 0:
+		add("windows", "at least one window is required")
+	case len(schedule.Windows) > maxWindows:
+		add("windows", "at most %d windows may be given", maxWindows)
+	}
+	for i, window := range schedule.Windows {
+		field := fmt.Sprintf("windows[%d]", i)
+		if len(window.Days) == 0 {
+			add(field+".days", "at least one day is required")
+		}
+		for _, day := range window.Days {
+			if !slices.Contains(Weekdays, day) {
+				add(field+".days", "%q is not a day, expected one of %s", day, strings.Join(Weekdays, ", "))
+			}
+		}
+		start, startErr := time.Parse(ClockLayout, window.Start)
+		if startErr != nil {
+			add(field+".start", "%q is not a 24-hour time such as 08:00", window.Start)
+		}
+		stop, stopErr := time.Parse(ClockLayout, window.Stop)
+		if stopErr != nil {
+			add(field+".stop", "%q is not a 24-hour time such as 18:00", window.Stop)
+		}
+		if startErr == nil && stopErr == nil && start.Equal(stop) {
+			add(field+".stop", "stop must differ from start")
+		}
+	}
+
+	if len(schedule.Holidays) > maxHolidays {
+		add("holidays", "at most %d holidays may be given", maxHolidays)
+	}
+	for _, holiday := range schedule.Holidays {
+		if _, err := time.Parse(DateLayout, holiday); err != nil {
+			add("holidays", "%q is not a date such as 2026-12-25", holiday)
+		}
+	}
+
+	return errs
+}
+
+// Stoppable returns an error if the instance of a deployment with lifecycle
+// cannot be stopped, which schedules and idle policies rely on. Spot
+// instances are launched as one-time requests, and EC2 cannot stop those.
+func Stoppable(lifecycle string) error {
+	if lifecycle == "spot" {
+		return fmt.Errorf("spot instances cannot be stopped, so spot deployments cannot have a schedule or idle policy")
+	}
+	return nil
+}
+
+// IdlePolicy returns every problem with an idle policy, or nil if it can be
+// stored as is.
+func IdlePolicy(policy models.IdlePolicy) []models.FieldError {
+	var errs []models.FieldError
+	add := func(field, format string, args ...any) {
+		errs = append(errs, models.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case policy.CPUPercent < 0 || policy.CPUPercent > 100:
+		add("cpuPercent", "cpuPercent must be between 0 and 100")
+	case policy.NetworkBytesPerSecond < 0:
+		add("networkBytesPerSecond", "networkBytesPerSecond must not be negative")
+	case policy.CPUPercent == 0 && policy.NetworkBytesPerSecond == 0:
+		add("cpuPercent", "set cpuPercent, networkBytesPerSecond or both")
+	}
+
+	lookback, err := time.ParseDuration(policy.Lookback)
+	switch {
+	case err != nil:
+		add("lookback", "%q is not a duration such as 2h", policy.Lookback)
+	case lookback < minIdleLookback || lookback > maxIdleLookback:
+		add("lookback", "lookback must be between %s and %s", timeutil.FormatDuration(minIdleLookback), timeutil.FormatDuration(maxIdleLookback))
+	}
+
+	return errs
+}
@@ -0,0 +1,92 @@
+package validate
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/frgrisk/turbo-deploy/server/models"
+)
+
+var testCatalog = Catalog{
+	Amis:        []string{"ami-1"},
+	ServerSizes: []string{"t3.small", "t3.large"},
+	UserScripts: []string{"docker.sh"},
+}
+
+func validPayload() models.Payload {
+	return models.Payload{
+		Hostname:   "web01",
+		Ami:        "ami-1",
+		ServerSize: "t3.small",
+		Lifecycle:  "on-demand",
+		UserData:   []string{"docker.sh"},
+		TTLValue:   8,
+		TTLUnit:    "h",
+	}
+}
+
+func TestPayload(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*models.Payload)
+		fields []string
+	}{
+		{"valid", func(*models.Payload) {}, nil},
+		{"no expiry", func(p *models.Payload) { p.TTLValue, p.TTLUnit = 0, "" }, nil},
+		{"hostname with symbols", func(p *models.Payload) { p.Hostname = "web-01" }, []string{"hostname"}},
+		{"hostname too long", func(p *models.Payload) { p.Hostname = strings.Repeat("a", maxHostnameLength+1) }, []string{"hostname"}},
+		{"missing hostname", func(p *models.Payload) { p.Hostname = "" }, []string{"hostname"}},
+		{"unknown ami", func(p *models.Payload) { p.Ami = "ami-2" }, []string{"ami"}},
+		{"missing server size", func(p *models.Payload) { p.ServerSize = "" }, []string{"serverSize"}},
+		{"unknown server size", func(p *models.Payload) { p.ServerSize = "m5.24xlarge" }, []string{"serverSize"}},
+		{"unknown lifecycle", func(p *models.Payload) { p.Lifecycle = "reserved" }, []string{"lifecycle"}},
+		{"unknown user-data script", func(p *models.Payload) { p.UserData = []string{"docker.sh", "rm.sh"} }, []string{"userData"}},
+		{"blank collaborator", func(p *models.Payload) { p.Collaborators = []string{"alice", " "} }, []string{"collaborators"}},
+		{"too many collaborators", func(p *models.Payload) {
+			p.Collaborators = slices.Repeat([]string{"alice"}, maxCollaborators+1)
+		}, []string{"collaborators"}},
+		{"negative ttl", func(p *models.Payload) { p.TTLValue = -1 }, []string{"ttlValue"}},
+		{"unknown ttl unit", func(p *models.Payload) { p.TTLUnit = "d" }, []string{"ttlUnit"}},
+		{"ttl out of range", func(p *models.Payload) { p.TTLValue = 1 << 62 }, []string{"ttlValue"}},
+		{"every problem at once", func(p *models.Payload) {
+			*p = models.Payload{TTLValue: -1}
+		}, []string{"hostname", "ami", "serverSize", "lifecycle", "ttlValue"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := validPayload()
+			tt.modify(&req)
+
+			var fields []string
+			for _, err := range Payload(req, testCatalog) {
+				fields = append(fields, err.Field)
+			}
+			if !slices.Equal(fields, tt.fields) {
+				t.Errorf("Payload() reported %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestStoppable(t *testing.T) {
+	for _, lifecycle := range Lifecycles {
+		if err := Stoppable(lifecycle); (err != nil) != (lifecycle == "spot") {
+			t.Errorf("Stoppable(%q) = %v", lifecycle, err)
+		}
+	}
+}
+
+func TestCatalogFromConfig(t *testing.T) {
+	catalog := CatalogFromConfig(models.Config{
+		Ami:         []models.AmiAttr{{AmiID: "ami-1"}, {AmiID: "ami-2"}},
+		ServerSizes: []string{"t3.small"},
+		UserData:    []string{"docker.sh"},
+	})
+	if !slices.Equal(catalog.Amis, []string{"ami-1", "ami-2"}) {
+		t.Errorf("Amis = %v, want [ami-1 ami-2]", catalog.Amis)
+	}
+	if len(Payload(validPayload(), catalog)) != 0 {
+		t.Errorf("Payload() rejected a request matching the catalog")
+	}
+}